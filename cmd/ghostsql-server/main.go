@@ -36,7 +36,7 @@ func main() {
 	// Check if setup is needed (only if ghost has default password and we are in interactive mode or forced)
 	if _, exists := db.RoleStore.GetRole("ghost"); exists {
 		ghost, _ := db.RoleStore.GetRole("ghost")
-		if ghost.PasswordHash == storage.HashPassword("ghost") && *interactive {
+		if ghost.VerifyPassword("ghost") && *interactive {
 			promptSetup(db)
 		}
 	}
@@ -1,20 +1,31 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/ghosecorp/ghostsql/internal/protocol/pg"
 	"github.com/ghosecorp/ghostsql/internal/storage"
 )
 
+// shutdownModes maps the signals that stop the server to shutdown modes
+var shutdownModes = map[os.Signal]storage.ShutdownMode{
+	syscall.SIGTERM: storage.ShutdownSmart,
+	syscall.SIGINT:  storage.ShutdownFast,
+	syscall.SIGQUIT: storage.ShutdownImmediate,
+}
+
 // Server represents the GhostSQL network server
 type Server struct {
-	db   *storage.Database
-	port int
+	db         *storage.Database
+	port       int
+	tlsConfig  *tls.Config
+	localConns atomic.Uint64 // Numbers Unix-domain socket sessions, which have no remote address
 }
 
 // NewServer creates a new networked server
@@ -27,6 +38,15 @@ func NewServer(db *storage.Database, port int) *Server {
 
 // Start begins listening for TCP connections
 func (s *Server) Start() error {
+	tlsConfig, err := pg.LoadTLSConfig(s.db)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		s.db.Logger.Info("SSL enabled for client connections")
+	}
+	s.tlsConfig = tlsConfig
+
 	addr := fmt.Sprintf(":%d", s.port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
@@ -36,23 +56,71 @@ func (s *Server) Start() error {
 
 	s.db.Logger.Info("GhostSQL server listening on %s", addr)
 
-	// Handle graceful shutdown
+	listeners := []net.Listener{listener}
+	for _, dir := range s.db.Config.SocketDirectories() {
+		unixListener, err := pg.ListenUnix(dir, s.port)
+		if err != nil {
+			s.db.Logger.Error("Could not create Unix-domain socket in %s: %v", dir, err)
+			continue
+		}
+		defer unixListener.Close()
+		listeners = append(listeners, unixListener)
+		s.db.Logger.Info("GhostSQL server listening on %s", unixListener.Addr())
+	}
+
+	// Handle graceful shutdown. Like the postmaster, SIGTERM requests a
+	// smart shutdown, SIGINT a fast one and SIGQUIT an immediate one; a
+	// later signal can escalate the mode.
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	done := make(chan struct{})
 
 	go func() {
-		<-sigChan
-		s.db.Logger.Info("Shutting down server...")
-		listener.Close()
+		draining := false
+		for sig := range sigChan {
+			if !s.db.RequestShutdown(shutdownModes[sig]) || draining {
+				continue
+			}
+			draining = true
+			go func() {
+				// New connections are refused with 57P03 until the
+				// sessions have closed
+				s.db.Logger.Info("Shutting down server...")
+				s.db.DrainSessions()
+				close(done)
+				for _, l := range listeners {
+					l.Close()
+				}
+			}()
+		}
+	}()
+
+	// Reload configuration files on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			// Errors are logged and the previous settings stay in effect
+			s.db.Reload()
+		}
 	}()
 
+	for _, l := range listeners[1:] {
+		go s.serve(l, done)
+	}
+	s.serve(listener, done)
+	return nil
+}
+
+// serve accepts connections on listener until done is closed
+func (s *Server) serve(listener net.Listener, done <-chan struct{}) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			// Check if listener was closed
 			select {
-			case <-sigChan:
-				return nil
+			case <-done:
+				return
 			default:
 				s.db.Logger.Error("Accept error: %v", err)
 				continue
@@ -70,8 +138,12 @@ func (s *Server) handleConnection(conn net.Conn) {
 	
 	// Generate a unique session ID based on remote address
 	sessionID := conn.RemoteAddr().String()
+	if _, ok := conn.(*net.UnixConn); ok {
+		sessionID = fmt.Sprintf("[local]:%d", s.localConns.Add(1))
+	}
 	session := s.db.SessionMgr.CreateSession(sessionID)
 	defer s.db.SessionMgr.CloseSession(sessionID)
+	session.SetClientAddr(conn.RemoteAddr())
 
 	// Set default database
 	session.SetDatabase("ghostsql")
@@ -80,6 +152,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 	// Initialize PG protocol handler
 	handler := pg.NewHandler(conn, s.db, session)
+	handler.SetTLSConfig(s.tlsConfig)
 	if err := handler.Handle(); err != nil {
 		s.db.Logger.Error("Session %s error: %v", sessionID, err)
 	}
@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// isSuperuser reports whether the session user is a superuser
+func (e *Executor) isSuperuser() bool {
+	user := e.session.GetUser()
+	if role, ok := e.db.RoleStore.GetRole(user); ok && role.IsSuperuser {
+		return true
+	}
+	// Legacy superuser check for the default 'ghost' account
+	return user == "ghost"
+}
+
+// pgReloadConf implements pg_reload_conf(). Like PostgreSQL it returns true
+// once the reload has been attempted; a file that fails to parse is logged
+// and shown in pg_hba_file_rules, and the current rules stay in effect.
+func (e *Executor) pgReloadConf(args []interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("function pg_reload_conf expects 0 arguments, got %d", len(args))
+	}
+	if !e.isSuperuser() {
+		return nil, errInsufficientPrivilege("permission denied for function pg_reload_conf")
+	}
+	e.db.Reload()
+	return true, nil
+}
+
+// pgCancelBackend implements pg_cancel_backend(pid), which cancels the
+// running statement of another session like a CancelRequest
+func (e *Executor) pgCancelBackend(args []interface{}) (interface{}, error) {
+	session, err := e.signalTarget("pg_cancel_backend", args)
+	if session == nil || err != nil {
+		return false, err
+	}
+	session.Cancel()
+	return true, nil
+}
+
+// pgTerminateBackend implements pg_terminate_backend(pid). The session's
+// running statement is interrupted and its connection closed, which rolls
+// back its transaction and releases its table locks and cursors.
+func (e *Executor) pgTerminateBackend(args []interface{}) (interface{}, error) {
+	session, err := e.signalTarget("pg_terminate_backend", args)
+	if session == nil || err != nil {
+		return false, err
+	}
+	session.Terminate()
+	return true, nil
+}
+
+// signalTarget returns the session whose backend PID is the single argument
+// of a superuser-only signaling function, or nil if there is none
+func (e *Executor) signalTarget(name string, args []interface{}) (*storage.Session, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("function %s expects 1 argument, got %d", name, len(args))
+	}
+	if !e.isSuperuser() {
+		return nil, errInsufficientPrivilege("permission denied for function %s", name)
+	}
+
+	var pid int64
+	switch v := args[0].(type) {
+	case int:
+		pid = int64(v)
+	case int32:
+		pid = int64(v)
+	case int64:
+		pid = v
+	case float64:
+		pid = int64(v)
+		if float64(pid) != v {
+			return nil, util.NewSQLError(util.SQLStateInvalidParameterValue, "invalid process ID: %v", v)
+		}
+	case nil:
+		return nil, nil
+	default:
+		return nil, util.NewSQLError(util.SQLStateInvalidParameterValue, "invalid process ID: %v", v)
+	}
+
+	session, ok := e.db.SessionMgr.FindByPID(int32(pid))
+	if !ok || int64(int32(pid)) != pid {
+		e.db.Logger.Info("PID %d is not a PostgreSQL backend process", pid)
+		return nil, nil
+	}
+	return session, nil
+}
+
+// parseValidUntil parses the timestamp of VALID UNTIL. An empty string or
+// 'infinity' means the password never expires, as the zero time. Timestamps
+// without a time zone are taken as UTC.
+func parseValidUntil(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "infinity") {
+		return time.Time{}, nil
+	}
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05-07",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, util.NewSQLError(util.SQLStateInvalidDatetimeFormat, "invalid input syntax for type timestamp with time zone: \"%s\"", s)
+}
+
+// executeCheckpoint forces a checkpoint, writing the changes logged in the
+// WAL to the table files
+func (e *Executor) executeCheckpoint() (*Result, error) {
+	if !e.isSuperuser() {
+		return nil, errInsufficientPrivilege("must be superuser to do CHECKPOINT")
+	}
+	if err := e.db.Checkpoint(); err != nil {
+		return nil, fmt.Errorf("checkpoint failed: %w", err)
+	}
+	return &Result{Message: "CHECKPOINT"}, nil
+}
+
+// executeVacuum reclaims the space of dead tuples in a table, or in every
+// table the user owns. VACUUM FULL also shrinks the table files, so it is
+// followed by a checkpoint rather than waiting for the next one.
+func (e *Executor) executeVacuum(stmt *parser.VacuumStmt) (*Result, error) {
+	if e.session != nil && e.session.TxActive {
+		return nil, util.NewSQLError(util.SQLStateActiveTransaction, "VACUUM cannot run inside a transaction block")
+	}
+	dbInstance, err := e.getActiveDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	names := dbInstance.TableNames()
+	if stmt.TableName != "" {
+		names = []string{stmt.TableName}
+	}
+	result := &Result{Message: "VACUUM"}
+	for _, name := range names {
+		// Waits for open transactions that changed the table, since their
+		// copies share its pages and would be broken by moved tuples
+		if err := e.lockTableForWrite(dbInstance, name); err != nil {
+			return nil, err
+		}
+		table, exists := dbInstance.GetTable(name)
+		if !exists {
+			return nil, errUndefinedTable(name)
+		}
+		if e.session != nil && table.Owner != e.session.GetUser() && !e.isSuperuser() {
+			// Only tables named explicitly are reported
+			if stmt.TableName != "" {
+				result.Notices = append(result.Notices, newNotice(SeverityWarning, util.SQLStateInsufficientPrivilege, "permission denied to vacuum \"%s\", skipping it", name))
+			}
+			continue
+		}
+
+		var removed int
+		if stmt.Full {
+			removed, err = table.VacuumFull()
+		} else {
+			removed, err = table.Vacuum()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := e.db.SaveTableToDisk(dbInstance, table); err != nil {
+			return nil, fmt.Errorf("failed to persist table: %w", err)
+		}
+		e.db.Logger.Info("Vacuumed %s: removed %d dead tuple(s)", name, removed)
+		e.releaseStatementLocks()
+	}
+
+	if stmt.Full {
+		if err := e.db.Checkpoint(); err != nil {
+			return nil, fmt.Errorf("checkpoint failed: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// pgCurrentWALLSN implements pg_current_wal_lsn()
+func (e *Executor) pgCurrentWALLSN(args []interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("function pg_current_wal_lsn expects 0 arguments, got %d", len(args))
+	}
+	return e.db.CurrentWALLSN().String(), nil
+}
@@ -0,0 +1,188 @@
+package executor
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// ColumnType describes the type and origin of a result column
+type ColumnType struct {
+	Type     storage.DataType
+	Length   int   // VARCHAR length or VECTOR dimensions, 0 if unconstrained
+	TableOID int64 // OID of the source table, 0 for computed columns
+	AttNum   int16 // 1-based attribute number in the source table, 0 for computed columns
+}
+
+// describeResult fills in result.ColumnTypes with the types Describe
+// derives for the statement. Columns it cannot type, and declared types some
+// value does not fit, as happens with loosely typed catalog rows, are typed
+// from their values instead.
+func (e *Executor) describeResult(stmt parser.Statement, result *Result) {
+	if result == nil || len(result.Columns) == 0 || len(result.ColumnTypes) == len(result.Columns) {
+		return
+	}
+
+	described := make(map[string]ColumnType)
+	if shape := e.describeColumns(stmt); shape != nil {
+		for i, name := range shape.Columns {
+			if _, seen := described[name]; !seen {
+				described[name] = shape.ColumnTypes[i]
+			}
+		}
+	}
+	types := make([]ColumnType, len(result.Columns))
+	for i, name := range result.Columns {
+		types[i] = reconcileColumnType(described[name], result.Rows, name)
+	}
+	result.ColumnTypes = types
+}
+
+// inferColumnType derives the type of a computed column from its values
+func inferColumnType(rows []storage.Row, name string) ColumnType {
+	ct := valueColumnType(rows, name)
+	if ct.Type == storage.TypeInvalid {
+		ct.Type = storage.TypeText
+	}
+	return ct
+}
+
+// reconcileColumnType keeps a described column type unless it is unknown or
+// some value cannot be represented by it
+func reconcileColumnType(ct ColumnType, rows []storage.Row, name string) ColumnType {
+	if ct.Type == storage.TypeInvalid {
+		return inferColumnType(rows, name)
+	}
+	for _, row := range rows {
+		if val := row[name]; val != nil && !representable(val, ct.Type) {
+			return inferColumnType(rows, name)
+		}
+	}
+	return ct
+}
+
+// representable reports whether val can be sent as a value of type t
+func representable(val interface{}, t storage.DataType) bool {
+	switch t {
+	case storage.TypeInt, storage.TypeBigInt:
+		var n int64
+		switch v := val.(type) {
+		case int:
+			n = int64(v)
+		case int16:
+			n = int64(v)
+		case int32:
+			n = int64(v)
+		case int64:
+			n = v
+		case float64:
+			if v != math.Trunc(v) || math.Abs(v) > math.MaxInt64 {
+				return false
+			}
+			n = int64(v)
+		case string:
+			parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return false
+			}
+			n = parsed
+		default:
+			return false
+		}
+		return t == storage.TypeBigInt || (n >= math.MinInt32 && n <= math.MaxInt32)
+	case storage.TypeFloat:
+		if s, ok := val.(string); ok {
+			_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			return err == nil
+		}
+		_, err := storage.ConvertToFloat64(val)
+		return err == nil
+	case storage.TypeBoolean:
+		switch v := val.(type) {
+		case bool:
+			return true
+		case string:
+			_, ok := storage.ParseBool(v)
+			return ok
+		}
+		return false
+	case storage.TypeVector:
+		switch val.(type) {
+		case *storage.Vector, string:
+			return true
+		}
+		return false
+	case storage.TypeJSONB:
+		switch val.(type) {
+		case string, map[string]interface{}, []interface{}:
+			return true
+		}
+		return false
+	default:
+		_, isVector := val.(*storage.Vector)
+		return !isVector
+	}
+}
+
+// valueColumnType returns the common type of the non-NULL values of a column,
+// or TypeInvalid if the column has no values
+func valueColumnType(rows []storage.Row, name string) ColumnType {
+	inferred := storage.TypeInvalid
+	for _, row := range rows {
+		var t storage.DataType
+		switch v := row[name].(type) {
+		case nil:
+			continue
+		case int:
+			t = storage.TypeInt
+			if v > math.MaxInt32 || v < math.MinInt32 {
+				t = storage.TypeBigInt
+			}
+		case int32, int16:
+			t = storage.TypeInt
+		case int64:
+			t = storage.TypeBigInt
+		case float32, float64:
+			t = storage.TypeFloat
+		case bool:
+			t = storage.TypeBoolean
+		case *storage.Vector:
+			return ColumnType{Type: storage.TypeVector, Length: v.Dimensions}
+		case map[string]interface{}, []interface{}:
+			t = storage.TypeJSONB
+		default:
+			return ColumnType{Type: storage.TypeText}
+		}
+
+		switch {
+		case inferred == storage.TypeInvalid || inferred == t:
+			inferred = t
+		case isIntegerType(inferred) && isIntegerType(t):
+			inferred = storage.TypeBigInt
+		case isNumericType(inferred) && isNumericType(t):
+			inferred = storage.TypeFloat
+		default:
+			return ColumnType{Type: storage.TypeText}
+		}
+	}
+	return ColumnType{Type: inferred}
+}
+
+// isPlainColumnRef reports whether expr is a (possibly qualified) column name
+func isPlainColumnRef(expr string) bool {
+	if expr == "" || expr == "*" {
+		return false
+	}
+	return !strings.ContainsAny(expr, "()+-*/%'\" :<>=|,")
+}
+
+func isIntegerType(t storage.DataType) bool {
+	return t == storage.TypeInt || t == storage.TypeBigInt
+}
+
+func isNumericType(t storage.DataType) bool {
+	return isIntegerType(t) || t == storage.TypeFloat
+}
@@ -0,0 +1,248 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// CopyColumns returns the columns COPY FROM STDIN expects, in the order the
+// client sends them. It is called before the client starts sending data so
+// that a statement that cannot run fails right away.
+func (e *Executor) CopyColumns(stmt *parser.CopyStmt) ([]storage.Column, error) {
+	if err := e.checkFailedTransaction(stmt); err != nil {
+		return nil, err
+	}
+	if err := e.checkPrivilege("TABLE", stmt.TableName, "INSERT"); err != nil {
+		return nil, err
+	}
+	dbInstance, err := e.getActiveDatabase()
+	if err != nil {
+		return nil, err
+	}
+	table, exists := e.getTable(dbInstance, stmt.TableName)
+	if !exists {
+		return nil, errUndefinedTable(stmt.TableName)
+	}
+	return copyTargetColumns(table, stmt.Columns)
+}
+
+// copyTargetColumns resolves the column list of a COPY statement, which
+// defaults to all columns of the table
+func copyTargetColumns(table *storage.Table, names []string) ([]storage.Column, error) {
+	if len(names) == 0 {
+		return table.Columns, nil
+	}
+	columns := make([]storage.Column, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, col := range table.Columns {
+			if strings.EqualFold(col.Name, name) {
+				columns = append(columns, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, util.NewSQLError(util.SQLStateUndefinedColumn, "column \"%s\" of relation \"%s\" does not exist", name, table.Name).WithColumn(table.Name, name)
+		}
+	}
+	return columns, nil
+}
+
+func (e *Executor) executeCopy(stmt *parser.CopyStmt) (*Result, error) {
+	if stmt.IsFrom {
+		return e.executeCopyFrom(stmt)
+	}
+	return e.executeCopyTo(stmt)
+}
+
+// executeCopyTo runs the source query of COPY TO STDOUT; the client protocol
+// formats the rows
+func (e *Executor) executeCopyTo(stmt *parser.CopyStmt) (*Result, error) {
+	query := stmt.Query
+	if query == nil {
+		// COPY table TO STDOUT reads the table like SELECT would
+		dbInstance, err := e.getActiveDatabase()
+		if err != nil {
+			return nil, err
+		}
+		table, exists := e.getTable(dbInstance, stmt.TableName)
+		if !exists {
+			return nil, errUndefinedTable(stmt.TableName)
+		}
+		columns, err := copyTargetColumns(table, stmt.Columns)
+		if err != nil {
+			return nil, err
+		}
+		sel := &parser.SelectStmt{TableName: stmt.TableName}
+		for _, col := range columns {
+			sel.Columns = append(sel.Columns, col.Name)
+			sel.SelectColumns = append(sel.SelectColumns, parser.SelectColumn{Expression: col.Name})
+		}
+		query = sel
+	}
+
+	result, err := e.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	e.describeResult(query, result)
+	result.Message = fmt.Sprintf("COPY %d", len(result.Rows))
+	return result, nil
+}
+
+// executeCopyFrom adds the rows received by COPY FROM STDIN to the table a
+// batch at a time, as the client sends them. Outside a transaction block the
+// rows go to a copy of the table that replaces it once all of them are in,
+// so a failed COPY adds nothing.
+func (e *Executor) executeCopyFrom(stmt *parser.CopyStmt) (*Result, error) {
+	if err := e.checkPrivilege("TABLE", stmt.TableName, "INSERT"); err != nil {
+		return nil, err
+	}
+	dbInstance, err := e.getActiveDatabase()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
+		return nil, err
+	}
+	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
+	if !exists {
+		return nil, errUndefinedTable(stmt.TableName)
+	}
+	inTransaction := e.session != nil && e.session.TxActive
+	if !inTransaction {
+		table = table.Clone()
+	}
+
+	copied := 0
+	for stmt.Next != nil {
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
+		rows, err := stmt.Next()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		if err := e.checkCopyRows(dbInstance, table, rows); err != nil {
+			return nil, err
+		}
+		if err := table.InsertBatch(rows); err != nil {
+			return nil, err
+		}
+		copied += len(rows)
+	}
+
+	if !inTransaction {
+		dbInstance.SetTable(stmt.TableName, table)
+		if err := e.db.SaveTableToDisk(dbInstance, table); err != nil {
+			return nil, fmt.Errorf("failed to persist table: %w", err)
+		}
+	}
+	return &Result{Message: fmt.Sprintf("COPY %d", copied)}, nil
+}
+
+// checkCopyRows validates a batch of COPY rows before they are added. The
+// keys of the batch are looked up with one scan of the table, and of each
+// referenced table, instead of the per-row scans INSERT does.
+func (e *Executor) checkCopyRows(dbInstance *storage.DatabaseInstance, table *storage.Table, rows []storage.Row) error {
+	// Key columns map the keys of the batch to their values
+	primaryKeys := make(map[string]map[string]interface{})
+	foreignKeys := make(map[string]map[string]interface{})
+	for _, row := range rows {
+		e.fillColumnDefaults(dbInstance, table, row)
+
+		for _, col := range table.Columns {
+			val := row[col.Name]
+			if val == nil {
+				if col.IsPrimary || !col.Nullable {
+					return errNotNullViolation(table.Name, col)
+				}
+				continue
+			}
+
+			if col.Type == storage.TypeVarChar && col.Length > 0 {
+				if strVal, ok := val.(string); ok && len(strVal) > col.Length {
+					return errValueTooLong(table.Name, col, len(strVal))
+				}
+			}
+			if col.IsPrimary {
+				keys, ok := primaryKeys[col.Name]
+				if !ok {
+					keys = make(map[string]interface{}, len(rows))
+					primaryKeys[col.Name] = keys
+				}
+				key := copyKey(val)
+				if _, dup := keys[key]; dup {
+					return errUniqueViolation(table.Name, col, val)
+				}
+				keys[key] = val
+			}
+			if col.ForeignKey != nil {
+				keys, ok := foreignKeys[col.Name]
+				if !ok {
+					keys = make(map[string]interface{}, len(rows))
+					foreignKeys[col.Name] = keys
+				}
+				keys[copyKey(val)] = val
+			}
+		}
+	}
+
+	for _, col := range table.Columns {
+		if keys, ok := primaryKeys[col.Name]; ok {
+			err := table.Scan([]string{col.Name}, func(row storage.Row) error {
+				if val, dup := keys[copyKey(row[col.Name])]; dup {
+					return errUniqueViolation(table.Name, col, val)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		keys, ok := foreignKeys[col.Name]
+		if !ok {
+			continue
+		}
+		refTable, exists := e.getTable(dbInstance, col.ForeignKey.RefTable)
+		if !exists {
+			return fmt.Errorf("referenced table %s does not exist", col.ForeignKey.RefTable)
+		}
+		refColumn := col.ForeignKey.RefColumn
+		err := refTable.Scan([]string{refColumn}, func(row storage.Row) error {
+			delete(keys, copyKey(row[refColumn]))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Report the first row whose key was not found
+		for _, row := range rows {
+			if val := row[col.Name]; val != nil {
+				if _, missing := keys[copyKey(val)]; missing {
+					return errForeignKeyViolation(table.Name, col, val)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// copyKey returns a map key under which values that compareValues considers
+// equal collide
+func copyKey(val interface{}) string {
+	if n, ok := toComparableInt(val); ok {
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf("%v", val)
+}
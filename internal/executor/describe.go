@@ -0,0 +1,411 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// Describe derives the columns a statement returns from its target list and
+// the catalog, without running it. Columns whose type is only known once the
+// statement runs are described as text. It returns nil for statements that
+// return no rows or whose columns are only known once they run.
+func (e *Executor) Describe(stmt parser.Statement) *Result {
+	described := e.describeColumns(stmt)
+	if described == nil {
+		return nil
+	}
+	for i, ct := range described.ColumnTypes {
+		if ct.Type == storage.TypeInvalid {
+			described.ColumnTypes[i] = ColumnType{Type: storage.TypeText}
+		}
+	}
+	return described
+}
+
+// describeColumns derives the columns of a statement for Describe and
+// describeResult. Columns whose type cannot be derived without running the
+// statement have TypeInvalid.
+func (e *Executor) describeColumns(stmt parser.Statement) *Result {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		return e.describeSelect(s, nil)
+	case *parser.CompoundSelectStmt:
+		return e.describeSelect(s.Left, nil)
+	case *parser.InsertStmt:
+		return e.describeReturning(s.TableName, s.Returning)
+	case *parser.UpdateStmt:
+		return e.describeReturning(s.TableName, s.Returning)
+	case *parser.DeleteStmt:
+		return e.describeReturning(s.TableName, s.Returning)
+	case *parser.ShowVarStmt:
+		return textColumns(strings.ToLower(s.Name))
+	case *parser.ShowStmt:
+		switch s.ShowType {
+		case "DATABASES":
+			return textColumns("Database", "Current")
+		case "TABLES":
+			return textColumns("Table")
+		case "COLUMNS":
+			return textColumns("Column", "Type", "Nullable", "Comment")
+		}
+	}
+	return nil
+}
+
+// describeSelect derives the output columns of a SELECT, using the same
+// naming rules as executeSelect. ctes holds the shapes of the CTEs in scope.
+func (e *Executor) describeSelect(stmt *parser.SelectStmt, ctes map[string]*Result) *Result {
+	if len(stmt.CTEs) > 0 {
+		scoped := make(map[string]*Result, len(ctes)+len(stmt.CTEs))
+		for name, shape := range ctes {
+			scoped[name] = shape
+		}
+		for _, cte := range stmt.CTEs {
+			var shape *Result
+			switch q := cte.Query.(type) {
+			case *parser.SelectStmt:
+				shape = e.describeSelect(q, scoped)
+			case *parser.CompoundSelectStmt:
+				shape = e.describeSelect(q.Left, scoped)
+			}
+			if shape == nil {
+				return nil
+			}
+			scoped[cte.Name] = shape
+		}
+		ctes = scoped
+	}
+
+	// Shapes of the FROM and JOIN sources by table name and alias
+	sources := make(map[string]*Result)
+	var main *Result
+	if stmt.TableName != "" {
+		main = e.describeSource(stmt.TableName, ctes)
+		if main == nil {
+			return nil
+		}
+		sources[stmt.TableName] = main
+		if stmt.TableAlias != "" {
+			sources[stmt.TableAlias] = main
+		}
+	}
+	var joined []*Result
+	for _, join := range stmt.Joins {
+		var shape *Result
+		if join.Lateral && join.Subquery != nil {
+			shape = e.describeSelect(join.Subquery, ctes)
+		} else {
+			shape = e.describeSource(join.Table, ctes)
+		}
+		if shape == nil {
+			return nil
+		}
+		joined = append(joined, shape)
+		if join.Table != "" {
+			sources[join.Table] = shape
+		}
+		if join.Alias != "" {
+			sources[join.Alias] = shape
+		}
+	}
+
+	resolve := func(expr string) ColumnType {
+		if ct, ok := resolveShapeColumn(expr, main, joined, sources); ok {
+			return ct
+		}
+		return expressionColumnType(expr)
+	}
+
+	result := &Result{}
+	add := func(name string, ct ColumnType) {
+		result.Columns = append(result.Columns, name)
+		result.ColumnTypes = append(result.ColumnTypes, ct)
+	}
+	isStar := len(stmt.SelectColumns) == 0 || (len(stmt.SelectColumns) == 1 && stmt.SelectColumns[0].Expression == "*")
+
+	switch {
+	case stmt.VectorOrderBy != nil:
+		if len(stmt.Columns) == 1 && stmt.Columns[0] == "*" {
+			if main != nil {
+				result.Columns = append(result.Columns, main.Columns...)
+				result.ColumnTypes = append(result.ColumnTypes, main.ColumnTypes...)
+			}
+		} else {
+			for _, col := range stmt.Columns {
+				add(col, resolve(col))
+			}
+		}
+		add("_distance", ColumnType{Type: storage.TypeText})
+
+	case len(stmt.Aggregates) > 0:
+		columns := stmt.GroupBy
+		if len(columns) == 0 {
+			for _, col := range stmt.Columns {
+				if col != "" && col != "*" {
+					columns = append(columns, col)
+				}
+			}
+		}
+		for _, col := range columns {
+			add(col, resolve(col))
+		}
+		for _, agg := range stmt.Aggregates {
+			add(agg.Alias, describeAggregate(agg, resolve))
+		}
+
+	case !isStar:
+		nameCount := make(map[string]int)
+		for _, sc := range stmt.SelectColumns {
+			name := sc.Expression
+			if sc.Alias != "" {
+				name = sc.Alias
+			} else if strings.Contains(name, ".") && !strings.ContainsAny(name, "( '\"") {
+				name = name[strings.LastIndex(name, ".")+1:]
+			}
+			if count := nameCount[name]; count > 0 {
+				nameCount[name]++
+				name = fmt.Sprintf("%s_%d", name, count)
+			} else {
+				nameCount[name]++
+			}
+
+			var ct ColumnType
+			switch {
+			case sc.Subquery != nil:
+				if sub := e.describeSelect(sc.Subquery, ctes); sub != nil && len(sub.ColumnTypes) > 0 {
+					ct = sub.ColumnTypes[0]
+					ct.TableOID, ct.AttNum = 0, 0
+				}
+			case sc.Window != nil:
+				ct = windowColumnType(sc.Expression)
+			default:
+				ct = resolve(sc.Expression)
+			}
+			add(name, ct)
+		}
+
+	case main != nil:
+		result.Columns = append(result.Columns, main.Columns...)
+		result.ColumnTypes = append(result.ColumnTypes, main.ColumnTypes...)
+		for i, join := range stmt.Joins {
+			if join.Lateral {
+				continue
+			}
+			for j, col := range joined[i].Columns {
+				add(join.Table+"."+col, joined[i].ColumnTypes[j])
+			}
+		}
+	}
+	return result
+}
+
+// describeSource returns the shape of a CTE, view or table named in FROM or
+// JOIN, or nil if there is no such relation
+func (e *Executor) describeSource(name string, ctes map[string]*Result) *Result {
+	if shape, ok := ctes[name]; ok {
+		return shape
+	}
+	if result, ok := e.cteResults[name]; ok {
+		return &Result{Columns: result.Columns, ColumnTypes: make([]ColumnType, len(result.Columns))}
+	}
+
+	dbInstance, err := e.getActiveDatabase()
+	if err != nil {
+		return nil
+	}
+	if viewQuery, isView := viewRegistry[dbInstance.Name+"."+name]; isView {
+		return e.describeSelect(viewQuery, nil)
+	}
+	table, ok := e.getTable(dbInstance, name)
+	if !ok {
+		return nil
+	}
+	return e.tableShape(table)
+}
+
+// describeReturning derives the columns of a DML statement's RETURNING list,
+// named as in projectReturning
+func (e *Executor) describeReturning(tableName string, returning []parser.SelectColumn) *Result {
+	if len(returning) == 0 {
+		return nil
+	}
+	dbInstance, err := e.getActiveDatabase()
+	if err != nil {
+		return nil
+	}
+	table, ok := e.getTable(dbInstance, tableName)
+	if !ok {
+		return nil
+	}
+	shape := e.tableShape(table)
+	if len(returning) == 1 && returning[0].Expression == "*" {
+		return shape
+	}
+
+	result := &Result{}
+	for _, sc := range returning {
+		name := sc.Alias
+		if name == "" {
+			name = sc.Expression
+		}
+		ct, ok := resolveShapeColumn(sc.Expression, shape, nil, nil)
+		if !ok {
+			ct = expressionColumnType(sc.Expression)
+		}
+		result.Columns = append(result.Columns, name)
+		result.ColumnTypes = append(result.ColumnTypes, ct)
+	}
+	return result
+}
+
+// tableShape returns the columns of a table with their declared types
+func (e *Executor) tableShape(table *storage.Table) *Result {
+	oid := e.db.Catalog.GenerateOID(table.Name)
+	shape := &Result{}
+	for i, col := range table.Columns {
+		shape.Columns = append(shape.Columns, col.Name)
+		shape.ColumnTypes = append(shape.ColumnTypes, ColumnType{
+			Type:     col.Type,
+			Length:   col.Length,
+			TableOID: oid,
+			AttNum:   int16(i + 1),
+		})
+	}
+	return shape
+}
+
+// resolveShapeColumn resolves a plain or qualified column reference against
+// the main source, then the joined ones
+func resolveShapeColumn(expr string, main *Result, joined []*Result, sources map[string]*Result) (ColumnType, bool) {
+	if !isPlainColumnRef(expr) {
+		return ColumnType{}, false
+	}
+
+	candidates := append([]*Result{main}, joined...)
+	colName := expr
+	if idx := strings.LastIndex(expr, "."); idx >= 0 {
+		candidates = []*Result{sources[expr[:idx]]}
+		colName = expr[idx+1:]
+	}
+	for _, shape := range candidates {
+		if shape == nil {
+			continue
+		}
+		for i, col := range shape.Columns {
+			if col == colName && i < len(shape.ColumnTypes) {
+				return shape.ColumnTypes[i], true
+			}
+		}
+	}
+	return ColumnType{}, false
+}
+
+// describeAggregate returns the result type of an aggregate function
+func describeAggregate(agg parser.AggregateFunc, resolve func(string) ColumnType) ColumnType {
+	switch strings.ToUpper(agg.Function) {
+	case "COUNT":
+		return ColumnType{Type: storage.TypeBigInt}
+	case "SUM", "AVG":
+		return ColumnType{Type: storage.TypeFloat}
+	case "MIN", "MAX":
+		ct := resolve(agg.Column)
+		return ColumnType{Type: ct.Type, Length: ct.Length}
+	}
+	return ColumnType{}
+}
+
+// windowColumnType returns the result type of a window function
+func windowColumnType(expr string) ColumnType {
+	fn := strings.ToUpper(strings.TrimSpace(expr))
+	if idx := strings.Index(fn, "("); idx >= 0 {
+		fn = strings.TrimSpace(fn[:idx])
+	}
+	switch fn {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK", "NTILE", "COUNT":
+		return ColumnType{Type: storage.TypeBigInt}
+	case "PERCENT_RANK", "CUME_DIST", "SUM", "AVG":
+		return ColumnType{Type: storage.TypeFloat}
+	}
+	return ColumnType{}
+}
+
+// expressionColumnType derives the type of a computed column from its
+// expression alone: literals and casts keep their type, anything else is
+// unknown
+func expressionColumnType(expr string) ColumnType {
+	s := strings.TrimSpace(expr)
+	if idx := strings.LastIndex(s, "::"); idx > 0 {
+		switch strings.ToUpper(strings.TrimSpace(s[idx+2:])) {
+		case "INT", "INTEGER", "INT4", "SMALLINT", "INT2":
+			return ColumnType{Type: storage.TypeInt}
+		case "BIGINT", "INT8":
+			return ColumnType{Type: storage.TypeBigInt}
+		case "FLOAT", "FLOAT8", "FLOAT4", "REAL", "DOUBLE", "NUMERIC", "DECIMAL":
+			return ColumnType{Type: storage.TypeFloat}
+		case "BOOL", "BOOLEAN":
+			return ColumnType{Type: storage.TypeBoolean}
+		case "JSON", "JSONB":
+			return ColumnType{Type: storage.TypeJSONB}
+		}
+		return ColumnType{Type: storage.TypeText}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > math.MaxInt32 || n < math.MinInt32 {
+			return ColumnType{Type: storage.TypeBigInt}
+		}
+		return ColumnType{Type: storage.TypeInt}
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return ColumnType{Type: storage.TypeFloat}
+	}
+	if upper := strings.ToUpper(s); upper == "TRUE" || upper == "FALSE" {
+		return ColumnType{Type: storage.TypeBoolean}
+	}
+	return ColumnType{}
+}
+
+// textColumns describes a result made of text columns
+func textColumns(names ...string) *Result {
+	result := &Result{Columns: names}
+	for range names {
+		result.ColumnTypes = append(result.ColumnTypes, ColumnType{Type: storage.TypeText})
+	}
+	return result
+}
+
+// ConformColumnTypes gives a result the column types it was described with,
+// which the client already has in a RowDescription. Values are converted to
+// those types as they are sent; it fails if the result has other columns or
+// a value that cannot be converted.
+func ConformColumnTypes(result, described *Result) error {
+	if result == nil || described == nil {
+		return nil
+	}
+	if len(result.Columns) != len(described.Columns) {
+		return util.NewSQLError(util.SQLStateFeatureNotSupported, "cached plan must not change result type")
+	}
+	for i, name := range result.Columns {
+		ct := described.ColumnTypes[i]
+		if ct.Type == storage.TypeText || ct.Type == storage.TypeVarChar {
+			continue // Any value has a text form
+		}
+		for _, row := range result.Rows {
+			val := row[name]
+			if val == nil || representable(val, ct.Type) {
+				continue
+			}
+			if ct.Type == storage.TypeInt && representable(val, storage.TypeBigInt) {
+				return util.NewSQLError(util.SQLStateNumericValueOutOfRange, "integer out of range")
+			}
+			return util.NewSQLError(util.SQLStateDatatypeMismatch, "value %v of column \"%s\" cannot be converted to type %s", val, name, ct.Type)
+		}
+	}
+	result.ColumnTypes = described.ColumnTypes
+	return nil
+}
@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// errUndefinedTable reports a table that does not exist in the active database
+func errUndefinedTable(name string) error {
+	return util.NewSQLError(util.SQLStateUndefinedTable, "table %s does not exist", name).WithTable(name)
+}
+
+// errUndefinedRole reports a role that does not exist
+func errUndefinedRole(name string) error {
+	return util.NewSQLError(util.SQLStateUndefinedObject, "role %s does not exist", name)
+}
+
+// errInvalidConnLimit reports a CONNECTION LIMIT below -1
+func errInvalidConnLimit(limit int) error {
+	return util.NewSQLError(util.SQLStateInvalidParameterValue, "invalid connection limit: %d", limit)
+}
+
+// errAdminShutdown reports a session terminated by pg_terminate_backend
+func errAdminShutdown() error {
+	return util.NewSQLError(util.SQLStateAdminShutdown, "terminating connection due to administrator command")
+}
+
+// errInsufficientPrivilege reports a missing privilege or role attribute
+func errInsufficientPrivilege(format string, args ...interface{}) error {
+	return util.NewSQLError(util.SQLStateInsufficientPrivilege, format, args...)
+}
+
+// errTableLocked reports a table held by an explicit LOCK of another session
+func errTableLocked(table, owner string) error {
+	return util.NewSQLError(util.SQLStateLockNotAvailable, "table %s is locked by session %s", table, owner).
+		WithTable(table)
+}
+
+// errNotNullViolation reports a NULL value in a NOT NULL column
+func errNotNullViolation(table string, col storage.Column) error {
+	format := "column %s cannot be NULL"
+	if col.IsPrimary {
+		format = "PRIMARY KEY column %s cannot be NULL"
+	}
+	return util.NewSQLError(util.SQLStateNotNullViolation, format, col.Name).WithColumn(table, col.Name)
+}
+
+// errUniqueViolation reports a duplicate primary key value. Constraint names
+// follow the PostgreSQL defaults since the catalog does not store them.
+func errUniqueViolation(table string, col storage.Column, val interface{}) error {
+	return util.NewSQLError(util.SQLStateUniqueViolation, "duplicate value for PRIMARY KEY column %s: %v", col.Name, val).
+		WithConstraint(table, table+"_pkey").
+		WithDetail("Key (%s)=(%v) already exists.", col.Name, val)
+}
+
+// errForeignKeyViolation reports a value missing from the referenced table
+func errForeignKeyViolation(table string, col storage.Column, val interface{}) error {
+	fk := col.ForeignKey
+	return util.NewSQLError(util.SQLStateForeignKeyViolation, "foreign key constraint failed: value %v not found in %s.%s",
+		val, fk.RefTable, fk.RefColumn).
+		WithConstraint(table, fmt.Sprintf("%s_%s_fkey", table, col.Name)).
+		WithDetail("Key (%s)=(%v) is not present in table \"%s\".", col.Name, val, fk.RefTable)
+}
+
+// errValueTooLong reports a string that exceeds a VARCHAR length
+func errValueTooLong(table string, col storage.Column, length int) error {
+	return util.NewSQLError(util.SQLStateStringDataRightTruncation, "value too long for column %s (max %d, got %d)",
+		col.Name, col.Length, length).WithColumn(table, col.Name)
+}
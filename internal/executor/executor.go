@@ -3,16 +3,16 @@ package executor
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ghosecorp/ghostsql/internal/metadata"
 	"github.com/ghosecorp/ghostsql/internal/parser"
 	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
 )
 
 type Executor struct {
@@ -21,6 +21,7 @@ type Executor struct {
 	cteResults      map[string]*Result // For CTE virtual tables
 	currentOuterRow storage.Row        // For LATERAL joins correlation
 	currentStmt     *parser.SelectStmt // For WHERE clause alias resolution
+	deadline        time.Time          // statement_timeout of the running statement
 }
 
 func NewExecutor(db *storage.Database, session *storage.Session) *Executor {
@@ -40,9 +41,11 @@ func (e *Executor) SetSession(s *storage.Session) {
 }
 
 type Result struct {
-	Message string
-	Rows    []storage.Row
-	Columns []string
+	Message     string
+	Rows        []storage.Row
+	Columns     []string
+	ColumnTypes []ColumnType // Parallel to Columns, filled in by Execute
+	Notices     []Notice     // Sent to the client before the command completes
 }
 
 func (e *Executor) getActiveDatabase() (*storage.DatabaseInstance, error) {
@@ -53,7 +56,36 @@ func (e *Executor) getActiveDatabase() (*storage.DatabaseInstance, error) {
 	return e.db.GetDatabaseInstance(dbName)
 }
 
+// Execute runs a statement and describes the types of its result columns
 func (e *Executor) Execute(stmt parser.Statement) (*Result, error) {
+	e.db.BeginStatement()
+	defer e.db.EndStatement()
+
+	if e.session != nil {
+		if err := e.checkFailedTransaction(stmt); err != nil {
+			return nil, err
+		}
+		e.session.BeginQuery()
+		defer e.session.EndQuery()
+		defer e.releaseStatementLocks()
+		if timeout := e.session.Timeout(storage.StatementTimeout); timeout > 0 {
+			e.deadline = time.Now().Add(timeout)
+			defer func() { e.deadline = time.Time{} }()
+		}
+	}
+
+	result, err := e.execute(stmt)
+	if err != nil {
+		if e.session != nil {
+			e.session.AbortTransaction()
+		}
+		return nil, err
+	}
+	e.describeResult(stmt, result)
+	return result, nil
+}
+
+func (e *Executor) execute(stmt parser.Statement) (*Result, error) {
 	switch s := stmt.(type) {
 	case *parser.CreateDatabaseStmt:
 		return e.executeCreateDatabase(s)
@@ -143,6 +175,18 @@ func (e *Executor) Execute(stmt parser.Statement) (*Result, error) {
 		return e.executeMoveCursor(s)
 	case *parser.CloseCursorStmt:
 		return e.executeCloseCursor(s)
+	case *parser.CopyStmt:
+		return e.executeCopy(s)
+	case *parser.ListenStmt:
+		return e.executeListen(s)
+	case *parser.UnlistenStmt:
+		return e.executeUnlisten(s)
+	case *parser.NotifyStmt:
+		return e.executeNotify(s)
+	case *parser.CheckpointStmt:
+		return e.executeCheckpoint()
+	case *parser.VacuumStmt:
+		return e.executeVacuum(s)
 	default:
 		return nil, fmt.Errorf("unsupported statement type")
 	}
@@ -174,7 +218,7 @@ func (e *Executor) checkPrivilege(objectType, objectName, privilege string) erro
 		return nil
 	}
 
-	return fmt.Errorf("permission denied for %s on %s %s", privilege, objectType, objectName)
+	return errInsufficientPrivilege("permission denied for %s on %s %s", privilege, objectType, objectName)
 }
 
 func (e *Executor) executeCreateDatabase(stmt *parser.CreateDatabaseStmt) (*Result, error) {
@@ -275,7 +319,7 @@ func (e *Executor) executeShowColumns(tableName string) (*Result, error) {
 
 	table, exists := e.getTable(dbInstance, tableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", tableName)
+		return nil, errUndefinedTable(tableName)
 	}
 
 	rows := make([]storage.Row, len(table.Columns))
@@ -401,13 +445,13 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TableName); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
 		return nil, err
 	}
 
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	var sourceRows []storage.Row
@@ -452,62 +496,23 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 	insertedCount := 0
 	var lastInsertedRows []storage.Row
 
-	for _, row := range sourceRows {
-		// Fill in missing columns with defaults or sequence values
-		for _, col := range table.Columns {
-			if _, exists := row[col.Name]; !exists || row[col.Name] == nil {
-				var defaultVal interface{}
-				exprUpper := strings.ToUpper(col.DefaultExpr)
-				if exprUpper == "NOW()" || exprUpper == "CURRENT_TIMESTAMP" || exprUpper == "NOW" {
-					defaultVal = "2026-05-17 15:00:00"
-				} else if col.DefaultExpr == "nextval" || strings.HasPrefix(exprUpper, "NEXTVAL") {
-					seqName := col.DefaultExpr
-					if strings.Contains(seqName, "'") || strings.Contains(seqName, "\"") {
-						seqName = strings.TrimPrefix(seqName, "nextval('")
-						seqName = strings.TrimPrefix(seqName, "nextval(\"")
-						seqName = strings.TrimSuffix(seqName, "')")
-						seqName = strings.TrimSuffix(seqName, "\")")
-						seqName = strings.TrimSuffix(seqName, ")")
-						seqName = strings.TrimSpace(seqName)
-					} else {
-						seqName = table.Name + "_" + col.Name + "_seq"
-					}
+	// Rows inserted below are added to existing as they go in
+	existing, err := table.Tuples()
+	if err != nil {
+		return nil, err
+	}
 
-					seqKey := dbInstance.Name + "." + seqName
-					state, hasSeq := sequenceRegistry[seqKey]
-					if !hasSeq {
-						state = &SequenceState{Current: 1, Start: 1, Increment: 1}
-						sequenceRegistry[seqKey] = state
-					}
-					val := state.Current
-					state.Current += state.Increment
-					defaultVal = val
-				} else if col.DefaultExpr != "" {
-					if strings.HasPrefix(col.DefaultExpr, "'") && strings.HasSuffix(col.DefaultExpr, "'") {
-						defaultVal = strings.Trim(col.DefaultExpr, "'")
-					} else if strings.HasPrefix(col.DefaultExpr, "\"") && strings.HasSuffix(col.DefaultExpr, "\"") {
-						defaultVal = strings.Trim(col.DefaultExpr, "\"")
-					} else if iv, err := strconv.Atoi(col.DefaultExpr); err == nil {
-						defaultVal = iv
-					} else if fv, err := strconv.ParseFloat(col.DefaultExpr, 64); err == nil {
-						defaultVal = fv
-					} else if col.DefaultExpr == "NULL" || col.DefaultExpr == "null" {
-						defaultVal = nil
-					} else {
-						defaultVal = col.DefaultExpr
-					}
-				}
-				row[col.Name] = defaultVal
-			}
-		}
+	for _, row := range sourceRows {
+		e.fillColumnDefaults(dbInstance, table, row)
 
 		// Check for conflict
 		hasConflict := false
 		var conflictingRow storage.Row
-		var conflictingIdx = -1
+		var conflictingTID storage.TID
 
 		if stmt.OnConflict != nil {
-			for i, r := range table.Rows {
+			for _, tuple := range existing {
+				r := tuple.Row
 				match := false
 				if stmt.OnConflict.TargetColumn != "" {
 					if compareValues(r[stmt.OnConflict.TargetColumn], row[stmt.OnConflict.TargetColumn]) == 0 {
@@ -526,7 +531,7 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 				if match {
 					hasConflict = true
 					conflictingRow = r
-					conflictingIdx = i
+					conflictingTID = tuple.TID
 					break
 				}
 			}
@@ -549,7 +554,9 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 					}
 					conflictingRow[k] = finalVal
 				}
-				table.Rows[conflictingIdx] = conflictingRow
+				if err := table.UpdateTuple(conflictingTID, conflictingRow); err != nil {
+					return nil, err
+				}
 				insertedCount++
 				lastInsertedRows = append(lastInsertedRows, conflictingRow)
 				continue
@@ -563,8 +570,7 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 			if col.Type == storage.TypeVarChar && col.Length > 0 {
 				if strVal, ok := val.(string); ok {
 					if len(strVal) > col.Length {
-						return nil, fmt.Errorf("value too long for column %s (max %d, got %d)",
-							col.Name, col.Length, len(strVal))
+						return nil, errValueTooLong(table.Name, col, len(strVal))
 					}
 				}
 			}
@@ -586,7 +592,7 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 			if !col.Nullable {
 				val, exists := row[col.Name]
 				if !exists || val == nil {
-					return nil, fmt.Errorf("column %s cannot be NULL", col.Name)
+					return nil, errNotNullViolation(table.Name, col)
 				}
 			}
 		}
@@ -596,13 +602,13 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 			if col.IsPrimary {
 				newVal := row[col.Name]
 				if newVal == nil {
-					return nil, fmt.Errorf("PRIMARY KEY column %s cannot be NULL", col.Name)
+					return nil, errNotNullViolation(table.Name, col)
 				}
 
-				for _, existingRow := range table.Rows {
-					existingVal := existingRow[col.Name]
+				for _, tuple := range existing {
+					existingVal := tuple.Row[col.Name]
 					if compareValues(newVal, existingVal) == 0 {
-						return nil, fmt.Errorf("duplicate value for PRIMARY KEY column %s: %v", col.Name, newVal)
+						return nil, errUniqueViolation(table.Name, col, newVal)
 					}
 				}
 			}
@@ -621,8 +627,12 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 					return nil, fmt.Errorf("referenced table %s does not exist", col.ForeignKey.RefTable)
 				}
 
+				refRows, err := refTable.Select([]string{"*"}, nil)
+				if err != nil {
+					return nil, err
+				}
 				found := false
-				for _, refRow := range refTable.Rows {
+				for _, refRow := range refRows {
 					if compareValues(refRow[col.ForeignKey.RefColumn], fkValue) == 0 {
 						found = true
 						break
@@ -630,15 +640,16 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 				}
 
 				if !found {
-					return nil, fmt.Errorf("foreign key constraint failed: value %v not found in %s.%s",
-						fkValue, col.ForeignKey.RefTable, col.ForeignKey.RefColumn)
+					return nil, errForeignKeyViolation(table.Name, col, fkValue)
 				}
 			}
 		}
 
-		if err := table.Insert(row); err != nil {
+		tid, err := table.InsertTuple(row)
+		if err != nil {
 			return nil, err
 		}
+		existing = append(existing, storage.Tuple{TID: tid, Row: row})
 		insertedCount++
 		lastInsertedRows = append(lastInsertedRows, row)
 	}
@@ -657,6 +668,57 @@ func (e *Executor) executeInsert(stmt *parser.InsertStmt) (*Result, error) {
 	}, nil
 }
 
+// fillColumnDefaults sets the columns missing from row to their default or
+// next sequence value
+func (e *Executor) fillColumnDefaults(dbInstance *storage.DatabaseInstance, table *storage.Table, row storage.Row) {
+	for _, col := range table.Columns {
+		if _, exists := row[col.Name]; !exists || row[col.Name] == nil {
+			var defaultVal interface{}
+			exprUpper := strings.ToUpper(col.DefaultExpr)
+			if exprUpper == "NOW()" || exprUpper == "CURRENT_TIMESTAMP" || exprUpper == "NOW" {
+				defaultVal = "2026-05-17 15:00:00"
+			} else if col.DefaultExpr == "nextval" || strings.HasPrefix(exprUpper, "NEXTVAL") {
+				seqName := col.DefaultExpr
+				if strings.Contains(seqName, "'") || strings.Contains(seqName, "\"") {
+					seqName = strings.TrimPrefix(seqName, "nextval('")
+					seqName = strings.TrimPrefix(seqName, "nextval(\"")
+					seqName = strings.TrimSuffix(seqName, "')")
+					seqName = strings.TrimSuffix(seqName, "\")")
+					seqName = strings.TrimSuffix(seqName, ")")
+					seqName = strings.TrimSpace(seqName)
+				} else {
+					seqName = table.Name + "_" + col.Name + "_seq"
+				}
+
+				seqKey := dbInstance.Name + "." + seqName
+				state, hasSeq := sequenceRegistry[seqKey]
+				if !hasSeq {
+					state = &SequenceState{Current: 1, Start: 1, Increment: 1}
+					sequenceRegistry[seqKey] = state
+				}
+				val := state.Current
+				state.Current += state.Increment
+				defaultVal = val
+			} else if col.DefaultExpr != "" {
+				if strings.HasPrefix(col.DefaultExpr, "'") && strings.HasSuffix(col.DefaultExpr, "'") {
+					defaultVal = strings.Trim(col.DefaultExpr, "'")
+				} else if strings.HasPrefix(col.DefaultExpr, "\"") && strings.HasSuffix(col.DefaultExpr, "\"") {
+					defaultVal = strings.Trim(col.DefaultExpr, "\"")
+				} else if iv, err := strconv.Atoi(col.DefaultExpr); err == nil {
+					defaultVal = iv
+				} else if fv, err := strconv.ParseFloat(col.DefaultExpr, 64); err == nil {
+					defaultVal = fv
+				} else if col.DefaultExpr == "NULL" || col.DefaultExpr == "null" {
+					defaultVal = nil
+				} else {
+					defaultVal = col.DefaultExpr
+				}
+			}
+			row[col.Name] = defaultVal
+		}
+	}
+}
+
 func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 	// Set current statement for context (aliases in WHERE, etc.)
 	prevStmt := e.currentStmt
@@ -706,6 +768,9 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 				if e.session == nil {
 					return nil, fmt.Errorf("no active session")
 				}
+				if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
+					return nil, err
+				}
 				dbInstance.SetLock(stmt.TableName, e.session.ID)
 			}
 
@@ -723,7 +788,7 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 				var exists bool
 				table, exists = e.getTable(dbInstance, stmt.TableName)
 				if !exists {
-					return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+					return nil, errUndefinedTable(stmt.TableName)
 				}
 			}
 		}
@@ -800,10 +865,16 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
 
 		if (e.currentOuterRow != nil || hasNonTableCol) && where != nil && len(stmt.Joins) == 0 {
 			filteredRows := make([]storage.Row, 0)
 			for _, row := range rows {
+				if err := e.checkCanceled(); err != nil {
+					return nil, err
+				}
 				if e.evaluateWhereOnRow(row, where) {
 					filteredRows = append(filteredRows, row)
 				}
@@ -871,6 +942,9 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 		if len(stmt.Joins) > 0 && where != nil {
 			filteredRows := make([]storage.Row, 0)
 			for _, row := range rows {
+				if err := e.checkCanceled(); err != nil {
+					return nil, err
+				}
 				if e.evaluateWhereOnRow(row, where) {
 					filteredRows = append(filteredRows, row)
 				}
@@ -939,7 +1013,11 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 
 	// Apply ORDER BY
 	if len(stmt.OrderBy) > 0 {
-		rows = e.applyOrderBy(rows, stmt.OrderBy)
+		sorted, err := e.applyOrderBy(rows, stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		rows = sorted
 	}
 
 	// Apply LIMIT and OFFSET
@@ -988,6 +1066,9 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 		// Rewrite rows: map expression keys to output names
 		rewritten := make([]storage.Row, len(rows))
 		for i, row := range rows {
+			if err := e.checkCanceled(); err != nil {
+				return nil, err
+			}
 			newRow := make(storage.Row)
 			for j, sc := range stmt.SelectColumns {
 				outName := columns[j]
@@ -1038,6 +1119,12 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 							}
 						}
 					}
+					if !ok {
+						val, ok, err = e.callSystemFunction(expr, row)
+						if err != nil {
+							return nil, err
+						}
+					}
 					if !ok {
 						// Try evaluate as arithmetic/function expression
 						// Use a sentinel to know it was evaluated (even if result is nil)
@@ -1085,11 +1172,7 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 									for _, colName := range res.Columns {
 										cols = append(cols, storage.Column{Name: colName, Type: storage.TypeText, Nullable: true})
 									}
-									joinTable = &storage.Table{
-										Name: join.Table,
-										Columns: cols,
-										Rows: res.Rows,
-									}
+									joinTable = storage.NewVirtualTable(join.Table, cols, res.Rows)
 									ok = true
 								}
 							}
@@ -1129,6 +1212,7 @@ func (e *Executor) executeSelect(stmt *parser.SelectStmt) (*Result, error) {
 
 func (e *Executor) executeJoins(leftTable string, leftRows []storage.Row, joins []parser.JoinClause, dbInstance *storage.DatabaseInstance) ([]storage.Row, error) {
 	resultRows := leftRows
+	var err error
 
 	for _, join := range joins {
 		var rightTableRef string
@@ -1182,18 +1266,21 @@ func (e *Executor) executeJoins(leftTable string, leftRows []storage.Row, joins
 				var singleRowResult []storage.Row
 				switch join.Type {
 				case "INNER":
-					singleRowResult = e.executeInnerJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
+					singleRowResult, err = e.executeInnerJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
 				case "LEFT":
-					singleRowResult = e.executeLeftJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
+					singleRowResult, err = e.executeLeftJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
 				case "RIGHT":
-					singleRowResult = e.executeRightJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
+					singleRowResult, err = e.executeRightJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
 				case "FULL":
-					singleRowResult = e.executeFullJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
+					singleRowResult, err = e.executeFullJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows, join.Condition)
 				case "CROSS":
-					singleRowResult = e.executeCrossJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows)
+					singleRowResult, err = e.executeCrossJoin(leftTable, []storage.Row{leftRow}, rightTableRef, rightRows)
 				default:
 					return nil, fmt.Errorf("unsupported join type: %s", join.Type)
 				}
+				if err != nil {
+					return nil, err
+				}
 				
 				mergedResultRows = append(mergedResultRows, singleRowResult...)
 			}
@@ -1209,11 +1296,7 @@ func (e *Executor) executeJoins(leftTable string, leftRows []storage.Row, joins
 						for _, colName := range res.Columns {
 							cols = append(cols, storage.Column{Name: colName, Type: storage.TypeText, Nullable: true})
 						}
-						rightTable = &storage.Table{
-							Name: join.Table,
-							Columns: cols,
-							Rows: res.Rows,
-						}
+						rightTable = storage.NewVirtualTable(join.Table, cols, res.Rows)
 						exists = true
 					}
 				}
@@ -1236,20 +1319,23 @@ func (e *Executor) executeJoins(leftTable string, leftRows []storage.Row, joins
 					
 					switch join.Type {
 					case "INNER":
-						resultRows = e.executeInnerJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+						resultRows, err = e.executeInnerJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 					case "LEFT":
-						resultRows = e.executeLeftJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+						resultRows, err = e.executeLeftJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 					case "RIGHT":
-						resultRows = e.executeRightJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+						resultRows, err = e.executeRightJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 					case "FULL":
-						resultRows = e.executeFullJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+						resultRows, err = e.executeFullJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 					case "CROSS":
-						resultRows = e.executeCrossJoin(leftTable, resultRows, rightTableRef, rightRows)
+						resultRows, err = e.executeCrossJoin(leftTable, resultRows, rightTableRef, rightRows)
 					default:
 						return nil, fmt.Errorf("unsupported join type: %s", join.Type)
 					}
+					if err != nil {
+						return nil, err
+					}
 				} else {
-					return nil, fmt.Errorf("table %s does not exist", join.Table)
+					return nil, errUndefinedTable(join.Table)
 				}
 			} else {
 				rightRows, err := rightTable.Select([]string{"*"}, nil)
@@ -1264,18 +1350,21 @@ func (e *Executor) executeJoins(leftTable string, leftRows []storage.Row, joins
 
 				switch join.Type {
 				case "INNER":
-					resultRows = e.executeInnerJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+					resultRows, err = e.executeInnerJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 				case "LEFT":
-					resultRows = e.executeLeftJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+					resultRows, err = e.executeLeftJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 				case "RIGHT":
-					resultRows = e.executeRightJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+					resultRows, err = e.executeRightJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 				case "FULL":
-					resultRows = e.executeFullJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
+					resultRows, err = e.executeFullJoin(leftTable, resultRows, rightTableRef, rightRows, join.Condition)
 				case "CROSS":
-					resultRows = e.executeCrossJoin(leftTable, resultRows, rightTableRef, rightRows)
+					resultRows, err = e.executeCrossJoin(leftTable, resultRows, rightTableRef, rightRows)
 				default:
 					return nil, fmt.Errorf("unsupported join type: %s", join.Type)
 				}
+				if err != nil {
+					return nil, err
+				}
 			}
 		}
 
@@ -1285,10 +1374,13 @@ func (e *Executor) executeJoins(leftTable string, leftRows []storage.Row, joins
 	return resultRows, nil
 }
 
-func (e *Executor) executeInnerJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) []storage.Row {
+func (e *Executor) executeInnerJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) ([]storage.Row, error) {
 	result := make([]storage.Row, 0)
 
 	for _, leftRow := range leftRows {
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
 		for _, rightRow := range rightRows {
 			if e.evaluateJoinCondition(leftTable, leftRow, rightTable, rightRow, condition) {
 				merged := make(storage.Row)
@@ -1319,13 +1411,16 @@ func (e *Executor) executeInnerJoin(leftTable string, leftRows []storage.Row, ri
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (e *Executor) executeLeftJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) []storage.Row {
+func (e *Executor) executeLeftJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) ([]storage.Row, error) {
 	result := make([]storage.Row, 0)
 
 	for _, leftRow := range leftRows {
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
 		matched := false
 		for _, rightRow := range rightRows {
 			if e.evaluateJoinCondition(leftTable, leftRow, rightTable, rightRow, condition) {
@@ -1368,13 +1463,16 @@ func (e *Executor) executeLeftJoin(leftTable string, leftRows []storage.Row, rig
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (e *Executor) executeRightJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) []storage.Row {
+func (e *Executor) executeRightJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) ([]storage.Row, error) {
 	result := make([]storage.Row, 0)
 
 	for _, rightRow := range rightRows {
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
 		matched := false
 		for _, leftRow := range leftRows {
 			if e.evaluateJoinCondition(leftTable, leftRow, rightTable, rightRow, condition) {
@@ -1414,14 +1512,17 @@ func (e *Executor) executeRightJoin(leftTable string, leftRows []storage.Row, ri
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (e *Executor) executeFullJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) []storage.Row {
+func (e *Executor) executeFullJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row, condition *parser.JoinCondition) ([]storage.Row, error) {
 	result := make([]storage.Row, 0)
 	rightMatched := make(map[int]bool)
 
 	for _, leftRow := range leftRows {
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
 		matched := false
 		for i, rightRow := range rightRows {
 			if e.evaluateJoinCondition(leftTable, leftRow, rightTable, rightRow, condition) {
@@ -1476,13 +1577,16 @@ func (e *Executor) executeFullJoin(leftTable string, leftRows []storage.Row, rig
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (e *Executor) executeCrossJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row) []storage.Row {
+func (e *Executor) executeCrossJoin(leftTable string, leftRows []storage.Row, rightTable string, rightRows []storage.Row) ([]storage.Row, error) {
 	result := make([]storage.Row, 0)
 
 	for _, leftRow := range leftRows {
+		if err := e.checkCanceled(); err != nil {
+			return nil, err
+		}
 		for _, rightRow := range rightRows {
 			merged := make(storage.Row)
 
@@ -1506,7 +1610,7 @@ func (e *Executor) executeCrossJoin(leftTable string, leftRows []storage.Row, ri
 		}
 	}
 
-	return result
+	return result, nil
 }
 
 func (e *Executor) evaluateJoinCondition(leftTable string, leftRow storage.Row, rightTable string, rightRow storage.Row, condition *parser.JoinCondition) bool {
@@ -1676,7 +1780,11 @@ func (e *Executor) executeGroupBy(stmt *parser.SelectStmt, rows []storage.Row, a
 	}
 
 	if len(stmt.OrderBy) > 0 {
-		resultRows = e.applyOrderBy(resultRows, stmt.OrderBy)
+		sorted, err := e.applyOrderBy(resultRows, stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		resultRows = sorted
 	}
 
 	if stmt.Offset > 0 && stmt.Offset < len(resultRows) {
@@ -1841,13 +1949,13 @@ func (e *Executor) executeUpdate(stmt *parser.UpdateStmt) (*Result, error) {
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TableName); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
 		return nil, err
 	}
 
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	var where *storage.WhereClause
@@ -1858,14 +1966,24 @@ func (e *Executor) executeUpdate(stmt *parser.UpdateStmt) (*Result, error) {
 	if stmt.FromTable != "" {
 		fromTable, ok := e.getTable(dbInstance, stmt.FromTable)
 		if !ok {
-			return nil, fmt.Errorf("table %s does not exist", stmt.FromTable)
+			return nil, errUndefinedTable(stmt.FromTable)
+		}
+
+		targets, err := table.Tuples()
+		if err != nil {
+			return nil, err
+		}
+		fromRows, err := fromTable.Select([]string{"*"}, nil)
+		if err != nil {
+			return nil, err
 		}
 
 		updatedCount := 0
 		var updatedRows []storage.Row
-		for idx, targetRow := range table.Rows {
+		for _, target := range targets {
+			targetRow := target.Row
 			var matchedFromRow storage.Row
-			for _, fromRow := range fromTable.Rows {
+			for _, fromRow := range fromRows {
 				combined := make(storage.Row)
 				for k, v := range targetRow {
 					combined[k] = v
@@ -1896,10 +2014,13 @@ func (e *Executor) executeUpdate(stmt *parser.UpdateStmt) (*Result, error) {
 							finalVal = val
 						}
 					}
-					table.Rows[idx][colName] = finalVal
+					targetRow[colName] = finalVal
+				}
+				if err := table.UpdateTuple(target.TID, targetRow); err != nil {
+					return nil, err
 				}
 				updatedCount++
-				updatedRows = append(updatedRows, table.Rows[idx])
+				updatedRows = append(updatedRows, targetRow)
 			}
 		}
 
@@ -1941,13 +2062,13 @@ func (e *Executor) executeDelete(stmt *parser.DeleteStmt) (*Result, error) {
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TableName); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
 		return nil, err
 	}
 
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	var where *storage.WhereClause
@@ -1958,16 +2079,25 @@ func (e *Executor) executeDelete(stmt *parser.DeleteStmt) (*Result, error) {
 	if stmt.UsingTable != "" {
 		usingTable, ok := e.getTable(dbInstance, stmt.UsingTable)
 		if !ok {
-			return nil, fmt.Errorf("table %s does not exist", stmt.UsingTable)
+			return nil, errUndefinedTable(stmt.UsingTable)
+		}
+
+		targets, err := table.Tuples()
+		if err != nil {
+			return nil, err
+		}
+		usingRows, err := usingTable.Select([]string{"*"}, nil)
+		if err != nil {
+			return nil, err
 		}
 
-		var newRows []storage.Row
 		deletedCount := 0
 		var deletedRows []storage.Row
 
-		for _, targetRow := range table.Rows {
+		for _, target := range targets {
+			targetRow := target.Row
 			matched := false
-			for _, usingRow := range usingTable.Rows {
+			for _, usingRow := range usingRows {
 				combined := make(storage.Row)
 				for k, v := range targetRow {
 					combined[k] = v
@@ -1985,15 +2115,14 @@ func (e *Executor) executeDelete(stmt *parser.DeleteStmt) (*Result, error) {
 			}
 
 			if matched {
+				if err := table.DeleteTuple(target.TID); err != nil {
+					return nil, err
+				}
 				deletedCount++
 				deletedRows = append(deletedRows, targetRow)
-			} else {
-				newRows = append(newRows, targetRow)
 			}
 		}
 
-		table.Rows = newRows
-
 		if err := e.saveTableToDisk(dbInstance, table); err != nil {
 			return nil, fmt.Errorf("failed to persist table: %w", err)
 		}
@@ -2036,22 +2165,24 @@ func (e *Executor) executeDropTable(stmt *parser.DropTableStmt) (*Result, error)
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TableName); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
 		return nil, err
 	}
 
 	if _, exists := e.getTable(dbInstance, stmt.TableName); !exists {
 		if stmt.IfExists {
-			return &Result{Message: fmt.Sprintf("NOTICE: table %s does not exist, skipping", stmt.TableName)}, nil
+			return &Result{
+				Message: "DROP TABLE",
+				Notices: []Notice{newNotice(SeverityNotice, util.SQLStateSuccessfulCompletion, "table %s does not exist, skipping", stmt.TableName)},
+			}, nil
 		}
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	e.deleteTable(dbInstance, stmt.TableName)
 
 	if e.session == nil || !e.session.TxActive {
-		tablePath := filepath.Join(dbInstance.BasePath, "tables", stmt.TableName+".tbl")
-		if err := os.Remove(tablePath); err != nil && !os.IsNotExist(err) {
+		if err := e.db.CommitTables(dbInstance, nil, []string{stmt.TableName}); err != nil {
 			return nil, fmt.Errorf("failed to remove table file: %w", err)
 		}
 	}
@@ -2064,7 +2195,10 @@ func (e *Executor) executeDropTable(stmt *parser.DropTableStmt) (*Result, error)
 func (e *Executor) executeDropDatabase(stmt *parser.DropDatabaseStmt) (*Result, error) {
 	if err := e.db.DropDatabase(stmt.DatabaseName); err != nil {
 		if stmt.IfExists && strings.Contains(err.Error(), "does not exist") {
-			return &Result{Message: fmt.Sprintf("NOTICE: database %s does not exist, skipping", stmt.DatabaseName)}, nil
+			return &Result{
+				Message: "DROP DATABASE",
+				Notices: []Notice{newNotice(SeverityNotice, util.SQLStateSuccessfulCompletion, "database %s does not exist, skipping", stmt.DatabaseName)},
+			}, nil
 		}
 		return nil, err
 	}
@@ -2080,13 +2214,13 @@ func (e *Executor) executeTruncate(stmt *parser.TruncateStmt) (*Result, error) {
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TableName); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
 		return nil, err
 	}
 
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	if err := table.Truncate(); err != nil {
@@ -2108,13 +2242,13 @@ func (e *Executor) executeAlterTable(stmt *parser.AlterTableStmt) (*Result, erro
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TableName); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
 		return nil, err
 	}
 
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	if stmt.Action == "ADD_COLUMN" {
@@ -2146,12 +2280,9 @@ func (e *Executor) executeAlterTable(stmt *parser.AlterTableStmt) (*Result, erro
 		e.setTable(dbInstance, newName, table)
 		
 		if e.session == nil || !e.session.TxActive {
-			oldPath := filepath.Join(dbInstance.BasePath, "tables", oldName+".tbl")
-			os.Remove(oldPath)
-		}
-
-		if err := e.saveTableToDisk(dbInstance, table); err != nil {
-			return nil, fmt.Errorf("failed to persist table: %w", err)
+			if err := e.db.CommitTables(dbInstance, []*storage.Table{table}, []string{oldName}); err != nil {
+				return nil, fmt.Errorf("failed to persist table: %w", err)
+			}
 		}
 		return &Result{Message: fmt.Sprintf("ALTER TABLE %s RENAME TO %s", oldName, newName)}, nil
 	}
@@ -2245,9 +2376,12 @@ func (e *Executor) executeCommentTable(stmt *parser.CommentStmt) (*Result, error
 		return nil, err
 	}
 
+	if err := e.lockTableForWrite(dbInstance, stmt.ObjectName); err != nil {
+		return nil, err
+	}
 	table, exists := e.getTableForModification(dbInstance, stmt.ObjectName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.ObjectName)
+		return nil, errUndefinedTable(stmt.ObjectName)
 	}
 
 	if table.Metadata == nil {
@@ -2282,9 +2416,12 @@ func (e *Executor) executeCommentColumn(stmt *parser.CommentStmt) (*Result, erro
 		return nil, fmt.Errorf("column comments require format: COMMENT ON COLUMN table.column IS 'comment'")
 	}
 
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
+		return nil, err
+	}
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	found := false
@@ -2403,9 +2540,12 @@ func (e *Executor) executeCreateIndex(stmt *parser.CreateIndexStmt) (*Result, er
 		return nil, err
 	}
 
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
+		return nil, err
+	}
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 
 	if table.VectorIndexes == nil {
@@ -2436,7 +2576,11 @@ func (e *Executor) executeCreateIndex(stmt *parser.CreateIndexStmt) (*Result, er
 
 		index := storage.NewHNSWIndex(m, efConstruction, storage.DistanceCosine)
 
-		for i, row := range table.Rows {
+		rows, err := table.Select([]string{"*"}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
 			if vec, ok := row[stmt.ColumnName].(*storage.Vector); ok {
 				if err := index.Add(vec, i); err != nil {
 					return nil, fmt.Errorf("failed to build index: %w", err)
@@ -2483,9 +2627,9 @@ func convertWhereClause(where *parser.WhereClause) *storage.WhereClause {
 	return sw
 }
 
-func (e *Executor) applyOrderBy(rows []storage.Row, orderBy []parser.OrderByClause) []storage.Row {
+func (e *Executor) applyOrderBy(rows []storage.Row, orderBy []parser.OrderByClause) ([]storage.Row, error) {
 	if len(orderBy) == 0 {
-		return rows
+		return rows, nil
 	}
 
 	sorted := make([]storage.Row, len(rows))
@@ -2501,7 +2645,7 @@ func (e *Executor) applyOrderBy(rows []storage.Row, orderBy []parser.OrderByClau
 		sort.Strings(colNames)
 	}
 
-	sort.SliceStable(sorted, func(i, j int) bool {
+	less := &cancelableLess{e: e, less: func(i, j int) bool {
 		for _, order := range orderBy {
 			col := order.Column
 			// Handle positional ORDER BY (e.g. ORDER BY 1, 2)
@@ -2524,9 +2668,13 @@ func (e *Executor) applyOrderBy(rows []storage.Row, orderBy []parser.OrderByClau
 			}
 		}
 		return false
-	})
+	}}
+	sort.SliceStable(sorted, less.compare)
+	if less.canceled {
+		return nil, e.checkCanceled()
+	}
 
-	return sorted
+	return sorted, nil
 }
 
 func (e *Executor) validateWhereColumns(table *storage.Table, where *storage.WhereClause) error {
@@ -2578,7 +2726,7 @@ func (e *Executor) validateWhereColumns(table *storage.Table, where *storage.Whe
 			}
 		}
 		if !exists {
-			return fmt.Errorf("column \"%s\" does not exist", where.Column)
+			return util.NewSQLError(util.SQLStateUndefinedColumn, "column \"%s\" does not exist", where.Column)
 		}
 	}
 
@@ -2642,7 +2790,15 @@ func (e *Executor) executeCreateRole(stmt *parser.CreateRoleStmt) (*Result, erro
 	user := e.session.GetUser()
 	role, exists := e.db.RoleStore.GetRole(user)
 	if user != "ghost" && (!exists || !role.CanCreateRole) {
-		return nil, fmt.Errorf("permission denied to create roles")
+		return nil, errInsufficientPrivilege("permission denied to create roles")
+	}
+
+	if stmt.ConnLimit < -1 {
+		return nil, errInvalidConnLimit(stmt.ConnLimit)
+	}
+	validUntil, err := parseValidUntil(stmt.ValidUntil)
+	if err != nil {
+		return nil, err
 	}
 
 	newRole := &storage.Role{
@@ -2652,6 +2808,8 @@ func (e *Executor) executeCreateRole(stmt *parser.CreateRoleStmt) (*Result, erro
 		CanLogin:      stmt.CanLogin,
 		CanCreateRole: stmt.CanCreateRole,
 		CanCreateDB:   stmt.CanCreateDB,
+		ConnLimit:     stmt.ConnLimit,
+		ValidUntil:    validUntil,
 		PasswordHash:  storage.HashPassword(stmt.Password),
 		Privileges:    make(map[string]map[string]bool),
 	}
@@ -2670,14 +2828,17 @@ func (e *Executor) executeDropRole(stmt *parser.DropRoleStmt) (*Result, error) {
 	user := e.session.GetUser()
 	role, exists := e.db.RoleStore.GetRole(user)
 	if user != "ghost" && (!exists || !role.CanCreateRole) {
-		return nil, fmt.Errorf("permission denied to drop role")
+		return nil, errInsufficientPrivilege("permission denied to drop role")
 	}
 
 	if _, exists := e.db.RoleStore.GetRole(stmt.RoleName); !exists {
 		if stmt.IfExists {
-			return &Result{Message: fmt.Sprintf("NOTICE: role %s does not exist, skipping", stmt.RoleName)}, nil
+			return &Result{
+				Message: "DROP ROLE",
+				Notices: []Notice{newNotice(SeverityNotice, util.SQLStateSuccessfulCompletion, "role %s does not exist, skipping", stmt.RoleName)},
+			}, nil
 		}
-		return nil, fmt.Errorf("role %s does not exist", stmt.RoleName)
+		return nil, errUndefinedRole(stmt.RoleName)
 	}
 
 	if err := e.db.RoleStore.DeleteRole(stmt.RoleName); err != nil {
@@ -2697,14 +2858,34 @@ func (e *Executor) executeAlterRole(stmt *parser.AlterRoleStmt) (*Result, error)
 	user := e.session.GetUser()
 	if user != "ghost" && user != stmt.RoleName {
 		// Only superuser or the role itself can alter its password for now
-		return nil, fmt.Errorf("permission denied to alter role %s", stmt.RoleName)
+		return nil, errInsufficientPrivilege("permission denied to alter role %s", stmt.RoleName)
 	}
 
 	role, exists := e.db.RoleStore.GetRole(stmt.RoleName)
 	if !exists {
-		return nil, fmt.Errorf("role %s does not exist", stmt.RoleName)
+		return nil, errUndefinedRole(stmt.RoleName)
 	}
 
+	// A role may change its own password, but not its limits
+	if stmt.ConnLimit != nil || stmt.ValidUntil != nil {
+		current, ok := e.db.RoleStore.GetRole(user)
+		if !e.isSuperuser() && (!ok || !current.CanCreateRole) {
+			return nil, errInsufficientPrivilege("permission denied to alter role %s", stmt.RoleName)
+		}
+	}
+	if stmt.ConnLimit != nil && *stmt.ConnLimit < -1 {
+		return nil, errInvalidConnLimit(*stmt.ConnLimit)
+	}
+	if stmt.ValidUntil != nil {
+		validUntil, err := parseValidUntil(*stmt.ValidUntil)
+		if err != nil {
+			return nil, err
+		}
+		role.ValidUntil = validUntil
+	}
+	if stmt.ConnLimit != nil {
+		role.ConnLimit = *stmt.ConnLimit
+	}
 	if stmt.Password != "" {
 		role.PasswordHash = storage.HashPassword(stmt.Password)
 	}
@@ -2719,13 +2900,13 @@ func (e *Executor) executeGrant(stmt *parser.GrantStmt) (*Result, error) {
 	// Simple implementation: only superuser can GRANT for now
 	user := e.session.GetUser()
 	if user != "ghost" {
-		return nil, fmt.Errorf("only superuser can GRANT privileges")
+		return nil, errInsufficientPrivilege("only superuser can GRANT privileges")
 	}
 
 	if stmt.ObjectType == "ROLE" {
 		targetRole, exists := e.db.RoleStore.GetRole(stmt.ToRole)
 		if !exists {
-			return nil, fmt.Errorf("role %s does not exist", stmt.ToRole)
+			return nil, errUndefinedRole(stmt.ToRole)
 		}
 		// Grant membership: targetRole inherits stmt.ObjectName (parent role)
 		found := false
@@ -2782,13 +2963,13 @@ func (e *Executor) executeGrant(stmt *parser.GrantStmt) (*Result, error) {
 func (e *Executor) executeRevoke(stmt *parser.RevokeStmt) (*Result, error) {
 	user := e.session.GetUser()
 	if user != "ghost" {
-		return nil, fmt.Errorf("only superuser can REVOKE privileges")
+		return nil, errInsufficientPrivilege("only superuser can REVOKE privileges")
 	}
 
 	if stmt.ObjectType == "ROLE" {
 		targetRole, exists := e.db.RoleStore.GetRole(stmt.FromRole)
 		if !exists {
-			return nil, fmt.Errorf("role %s does not exist", stmt.FromRole)
+			return nil, errUndefinedRole(stmt.FromRole)
 		}
 		// Remove membership from MemberOf
 		var newMemberOf []string
@@ -2809,7 +2990,7 @@ func (e *Executor) executeRevoke(stmt *parser.RevokeStmt) (*Result, error) {
 			objectKey := fmt.Sprintf("%s:%s:%s", stmt.ObjectType, stmt.ObjectName, col)
 			role, exists := e.db.RoleStore.GetRole(stmt.FromRole)
 			if !exists {
-				return nil, fmt.Errorf("role %s does not exist", stmt.FromRole)
+				return nil, errUndefinedRole(stmt.FromRole)
 			}
 			if stmt.GrantOptionOnly {
 				if role.Privileges != nil && role.Privileges[objectKey] != nil {
@@ -2834,7 +3015,7 @@ func (e *Executor) executeRevoke(stmt *parser.RevokeStmt) (*Result, error) {
 		objectKey := fmt.Sprintf("%s:%s", stmt.ObjectType, stmt.ObjectName)
 		role, exists := e.db.RoleStore.GetRole(stmt.FromRole)
 		if !exists {
-			return nil, fmt.Errorf("role %s does not exist", stmt.FromRole)
+			return nil, errUndefinedRole(stmt.FromRole)
 		}
 		if stmt.GrantOptionOnly {
 			if role.Privileges != nil && role.Privileges[objectKey] != nil {
@@ -2866,7 +3047,7 @@ func (e *Executor) executeAlterDefaultPrivileges(stmt *parser.AlterDefaultPrivil
 	// Only superuser can run ALTER DEFAULT PRIVILEGES
 	user := e.session.GetUser()
 	if user != "ghost" {
-		return nil, fmt.Errorf("only superuser can ALTER DEFAULT PRIVILEGES")
+		return nil, errInsufficientPrivilege("only superuser can ALTER DEFAULT PRIVILEGES")
 	}
 
 	if !stmt.IsGrant {
@@ -2947,9 +3128,12 @@ func (e *Executor) executeCreatePolicy(stmt *parser.CreatePolicyStmt) (*Result,
 		return nil, err
 	}
 	
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
+		return nil, err
+	}
 	table, exists := e.getTableForModification(dbInstance, stmt.TableName)
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", stmt.TableName)
+		return nil, errUndefinedTable(stmt.TableName)
 	}
 	
 	policy := storage.Policy{
@@ -3128,7 +3312,11 @@ func (e *Executor) executeCompoundSelect(stmt *parser.CompoundSelectStmt) (*Resu
 	}
 
 	if len(stmt.OrderBy) > 0 {
-		resultRows = e.applyOrderBy(resultRows, stmt.OrderBy)
+		sorted, err := e.applyOrderBy(resultRows, stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		resultRows = sorted
 	}
 	if stmt.Offset > 0 && stmt.Offset < len(resultRows) {
 		resultRows = resultRows[stmt.Offset:]
@@ -3364,14 +3552,14 @@ func (e *Executor) executeSelectWithCTEs(stmt *parser.SelectStmt) (*Result, erro
 	// If the main query references a CTE as its table name, resolve it
 	if result, ok := e.cteResults[stmt.TableName]; ok {
 		// Filter + project from the CTE result
-		return e.applySelectOnRows(stmt, result.Rows, result.Columns), nil
+		return e.applySelectOnRows(stmt, result.Rows, result.Columns)
 	}
 
 	return e.executeSelectCore(stmt)
 }
 
 // applySelectOnRows applies WHERE/ORDER BY/LIMIT/OFFSET/DISTINCT on an in-memory row set
-func (e *Executor) applySelectOnRows(stmt *parser.SelectStmt, rows []storage.Row, _ []string) *Result {
+func (e *Executor) applySelectOnRows(stmt *parser.SelectStmt, rows []storage.Row, _ []string) (*Result, error) {
 	var where *storage.WhereClause
 	if stmt.Where != nil {
 		where = e.convertWhereClauseWithSubquery(stmt.Where)
@@ -3389,7 +3577,11 @@ func (e *Executor) applySelectOnRows(stmt *parser.SelectStmt, rows []storage.Row
 	}
 
 	if len(stmt.OrderBy) > 0 {
-		rows = e.applyOrderBy(rows, stmt.OrderBy)
+		sorted, err := e.applyOrderBy(rows, stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		rows = sorted
 	}
 
 	if stmt.Offset > 0 && stmt.Offset < len(rows) {
@@ -3437,7 +3629,7 @@ func (e *Executor) applySelectOnRows(stmt *parser.SelectStmt, rows []storage.Row
 		rows = applyDistinct(rows, columns)
 	}
 
-	return &Result{Rows: rows, Columns: columns}
+	return &Result{Rows: rows, Columns: columns}, nil
 }
 
 // executeSelectCore is the original executeSelect — we need this alias to avoid infinite recursion
@@ -3481,7 +3673,7 @@ func (e *Executor) executeCreateView(stmt *parser.CreateViewStmt) (*Result, erro
 
 	if !stmt.OrReplace {
 		if _, exists := viewRegistry[viewKey]; exists {
-			return nil, fmt.Errorf("view %s already exists", stmt.ViewName)
+			return nil, util.NewSQLError(util.SQLStateDuplicateTable, "view %s already exists", stmt.ViewName)
 		}
 	}
 
@@ -3504,7 +3696,7 @@ func (e *Executor) executeDropView(stmt *parser.DropViewStmt) (*Result, error) {
 		if stmt.IfExists {
 			return &Result{Message: "DROP VIEW"}, nil
 		}
-		return nil, fmt.Errorf("view %s does not exist", stmt.ViewName)
+		return nil, util.NewSQLError(util.SQLStateUndefinedTable, "view %s does not exist", stmt.ViewName)
 	}
 
 	delete(viewRegistry, viewKey)
@@ -3531,9 +3723,12 @@ func (e *Executor) executeCreateSchema(stmt *parser.CreateSchemaStmt) (*Result,
 
 	if schemaRegistry[schemaKey] {
 		if stmt.IfNotExists {
-			return &Result{Message: "CREATE SCHEMA"}, nil
+			return &Result{
+				Message: "CREATE SCHEMA",
+				Notices: []Notice{newNotice(SeverityNotice, util.SQLStateDuplicateSchema, "schema %s already exists, skipping", stmt.SchemaName)},
+			}, nil
 		}
-		return nil, fmt.Errorf("schema %s already exists", stmt.SchemaName)
+		return nil, util.NewSQLError(util.SQLStateDuplicateSchema, "schema %s already exists", stmt.SchemaName)
 	}
 
 	schemaRegistry[schemaKey] = true
@@ -3551,9 +3746,12 @@ func (e *Executor) executeCreateSequence(stmt *parser.CreateSequenceStmt) (*Resu
 
 	if _, exists := sequenceRegistry[seqKey]; exists {
 		if stmt.IfNotExists {
-			return &Result{Message: "CREATE SEQUENCE"}, nil
+			return &Result{
+				Message: "CREATE SEQUENCE",
+				Notices: []Notice{newNotice(SeverityNotice, util.SQLStateDuplicateTable, "sequence %s already exists, skipping", stmt.SequenceName)},
+			}, nil
 		}
-		return nil, fmt.Errorf("sequence %s already exists", stmt.SequenceName)
+		return nil, util.NewSQLError(util.SQLStateDuplicateTable, "sequence %s already exists", stmt.SequenceName)
 	}
 
 	sequenceRegistry[seqKey] = &SequenceState{
@@ -3575,7 +3773,7 @@ func (e *Executor) executeCreateType(stmt *parser.CreateTypeStmt) (*Result, erro
 	typeKey := dbName + "." + stmt.TypeName
 
 	if _, exists := typeRegistry[typeKey]; exists {
-		return nil, fmt.Errorf("type %s already exists", stmt.TypeName)
+		return nil, util.NewSQLError(util.SQLStateDuplicateObject, "type %s already exists", stmt.TypeName)
 	}
 
 	typeRegistry[typeKey] = stmt.Values
@@ -3593,9 +3791,12 @@ func (e *Executor) executeCreateMaterializedView(stmt *parser.CreateMaterialized
 
 	if _, exists := e.getTable(dbInstance, stmt.ViewName); exists {
 		if stmt.IfNotExists {
-			return &Result{Message: "CREATE MATERIALIZED VIEW"}, nil
+			return &Result{
+				Message: "CREATE MATERIALIZED VIEW",
+				Notices: []Notice{newNotice(SeverityNotice, util.SQLStateDuplicateTable, "materialized view %s already exists, skipping", stmt.ViewName)},
+			}, nil
 		}
-		return nil, fmt.Errorf("materialized view %s already exists", stmt.ViewName)
+		return nil, util.NewSQLError(util.SQLStateDuplicateTable, "materialized view %s already exists", stmt.ViewName)
 	}
 
 	res, err := e.executeSelect(stmt.Query)
@@ -3636,9 +3837,12 @@ func (e *Executor) executeRefreshMaterializedView(stmt *parser.RefreshMaterializ
 
 	query, exists := materializedViewRegistry[mvKey]
 	if !exists {
-		return nil, fmt.Errorf("materialized view %s does not exist", stmt.ViewName)
+		return nil, util.NewSQLError(util.SQLStateUndefinedTable, "materialized view %s does not exist", stmt.ViewName)
 	}
 
+	if err := e.lockTableForWrite(dbInstance, stmt.ViewName); err != nil {
+		return nil, err
+	}
 	table, ok := e.getTableForModification(dbInstance, stmt.ViewName)
 	if !ok {
 		return nil, fmt.Errorf("materialized view physical table %s not found", stmt.ViewName)
@@ -3665,7 +3869,7 @@ func (e *Executor) executeMerge(stmt *parser.MergeStmt) (*Result, error) {
 		return nil, err
 	}
 
-	if err := e.checkTableLock(dbInstance, stmt.TargetTable); err != nil {
+	if err := e.lockTableForWrite(dbInstance, stmt.TargetTable); err != nil {
 		return nil, err
 	}
 	if stmt.SourceTable != "" {
@@ -3691,7 +3895,10 @@ func (e *Executor) executeMerge(stmt *parser.MergeStmt) (*Result, error) {
 		if !ok {
 			return nil, fmt.Errorf("source table %s does not exist", stmt.SourceTable)
 		}
-		sourceRows = srcTab.Rows
+		sourceRows, err = srcTab.Select([]string{"*"}, nil)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var onCond *storage.WhereClause
@@ -3699,12 +3906,19 @@ func (e *Executor) executeMerge(stmt *parser.MergeStmt) (*Result, error) {
 		onCond = e.convertWhereClauseWithSubquery(stmt.OnCondition)
 	}
 
+	// Kept in step with the table as source rows are merged
+	targets, err := targetTable.Tuples()
+	if err != nil {
+		return nil, err
+	}
+
 	matchedCount := 0
 	notMatchedCount := 0
 
 	for _, sourceRow := range sourceRows {
 		matchedIdx := -1
-		for idx, targetRow := range targetTable.Rows {
+		for idx, target := range targets {
+			targetRow := target.Row
 			combined := make(storage.Row)
 			for k, v := range targetRow {
 				combined[k] = v
@@ -3724,7 +3938,7 @@ func (e *Executor) executeMerge(stmt *parser.MergeStmt) (*Result, error) {
 		if matchedIdx != -1 {
 			for _, action := range stmt.WhenMatched {
 				if action.Action == "UPDATE" {
-					targetRow := targetTable.Rows[matchedIdx]
+					targetRow := targets[matchedIdx].Row
 					for k, v := range action.Updates {
 						finalVal := v
 						if sVal, ok := v.(string); ok {
@@ -3740,10 +3954,15 @@ func (e *Executor) executeMerge(stmt *parser.MergeStmt) (*Result, error) {
 						}
 						targetRow[k] = finalVal
 					}
-					targetTable.Rows[matchedIdx] = targetRow
+					if err := targetTable.UpdateTuple(targets[matchedIdx].TID, targetRow); err != nil {
+						return nil, err
+					}
 					matchedCount++
 				} else if action.Action == "DELETE" {
-					targetTable.Rows = append(targetTable.Rows[:matchedIdx], targetTable.Rows[matchedIdx+1:]...)
+					if err := targetTable.DeleteTuple(targets[matchedIdx].TID); err != nil {
+						return nil, err
+					}
+					targets = append(targets[:matchedIdx], targets[matchedIdx+1:]...)
 					matchedCount++
 				}
 			}
@@ -3769,7 +3988,9 @@ func (e *Executor) executeMerge(stmt *parser.MergeStmt) (*Result, error) {
 							newRow[colName] = finalVal
 						}
 					}
-					targetTable.Insert(newRow)
+					if tid, err := targetTable.InsertTuple(newRow); err == nil {
+						targets = append(targets, storage.Tuple{TID: tid, Row: newRow})
+					}
 					notMatchedCount++
 				}
 			}
@@ -3787,12 +4008,18 @@ func (e *Executor) checkTableLock(dbInstance *storage.DatabaseInstance, name str
 	if e.session == nil {
 		return nil
 	}
-	if lockOwner, locked := dbInstance.GetLock(name); locked {
-		if lockOwner != e.session.ID {
-			return fmt.Errorf("table %s is locked by session %s", name, lockOwner)
-		}
+	return e.waitForTableLock(dbInstance, name)
+}
+
+// releaseStatementLocks releases the write locks taken by a statement run
+// outside a transaction block, whose changes are committed by now
+func (e *Executor) releaseStatementLocks() {
+	if e.session == nil || e.session.TxActive {
+		return
+	}
+	if dbInstance, err := e.getActiveDatabase(); err == nil {
+		dbInstance.ReleaseWriteLocks(e.session.ID)
 	}
-	return nil
 }
 
 func (e *Executor) getTable(dbInstance *storage.DatabaseInstance, name string) (*storage.Table, bool) {
@@ -3808,17 +4035,20 @@ func (e *Executor) getTable(dbInstance *storage.DatabaseInstance, name string) (
 }
 
 func (e *Executor) getTableForModification(dbInstance *storage.DatabaseInstance, name string) (*storage.Table, bool) {
-	table, exists := dbInstance.GetTable(name)
-	if !exists {
-		return nil, false
-	}
 	if e.session != nil && e.session.TxActive {
+		// Tables created earlier in the transaction only exist in TxTables
 		if t, ok := e.session.TxTables[name]; ok {
 			if t == nil {
 				return nil, false
 			}
 			return t, true
 		}
+	}
+	table, exists := dbInstance.GetTable(name)
+	if !exists {
+		return nil, false
+	}
+	if e.session != nil && e.session.TxActive {
 		// Clone and store in TxTables
 		cloned := table.Clone()
 		e.session.TxTables[name] = cloned
@@ -3857,56 +4087,103 @@ func (e *Executor) executeTransaction(stmt *parser.TransactionStmt) (*Result, er
 
 	switch stmt.Command {
 	case "BEGIN":
+		if e.session.TxActive {
+			// Already in a transaction block, keep its changes. An implicit
+			// block of a multi-statement query becomes a regular one.
+			result := &Result{Message: "BEGIN"}
+			if !e.session.TxImplicit {
+				result.Notices = []Notice{newNotice(SeverityWarning, util.SQLStateActiveTransaction, "there is already a transaction in progress")}
+			}
+			e.session.TxImplicit = false
+			return result, nil
+		}
 		e.session.TxActive = true
+		e.session.TxAborted = false
 		e.session.TxTables = make(map[string]*storage.Table)
 		e.session.TxSavepoints = make(map[string]map[string]*storage.Table)
 		return &Result{Message: "BEGIN"}, nil
 
 	case "COMMIT":
 		if !e.session.TxActive {
-			return &Result{Message: "COMMIT"}, nil
+			return &Result{
+				Message: "COMMIT",
+				Notices: []Notice{newNotice(SeverityWarning, util.SQLStateNoActiveTransaction, "there is no transaction in progress")},
+			}, nil
+		}
+		if e.session.TxAborted {
+			// A failed transaction block can only be rolled back
+			e.rollbackTransaction()
+			return &Result{Message: "ROLLBACK"}, nil
 		}
 		dbInstance, err := e.getActiveDatabase()
 		if err != nil {
 			return nil, err
 		}
+		var saved []*storage.Table
+		var dropped []string
 		for name, t := range e.session.TxTables {
 			if t == nil {
 				dbInstance.DeleteTable(name)
-				tablePath := filepath.Join(dbInstance.BasePath, "tables", name+".tbl")
-				_ = os.Remove(tablePath)
+				dropped = append(dropped, name)
 			} else {
 				dbInstance.SetTable(name, t)
-				if err := e.db.SaveTableToDisk(dbInstance, t); err != nil {
-					return nil, err
-				}
+				saved = append(saved, t)
 			}
 		}
+		if err := e.db.CommitTables(dbInstance, saved, dropped); err != nil {
+			return nil, err
+		}
 		e.session.TxActive = false
+		e.session.TxImplicit = false
 		dbInstance.ReleaseAllSessionLocks(e.session.ID)
 		e.session.TxTables = make(map[string]*storage.Table)
 		e.session.TxSavepoints = make(map[string]map[string]*storage.Table)
 		e.session.TxLocalVariables = make(map[string]string)
+		e.db.SessionMgr.Notify(e.session.TxNotifications...)
+		e.session.TxNotifications = nil
 		return &Result{Message: "COMMIT"}, nil
 
 	case "ROLLBACK":
-		e.session.TxActive = false
-		for name, originalVal := range e.session.TxLocalVariables {
-			e.session.Variables[name] = originalVal
-		}
-		if dbInstance, err := e.getActiveDatabase(); err == nil {
-			dbInstance.ReleaseAllSessionLocks(e.session.ID)
+		result := &Result{Message: "ROLLBACK"}
+		if !e.session.TxActive {
+			result.Notices = []Notice{newNotice(SeverityWarning, util.SQLStateNoActiveTransaction, "there is no transaction in progress")}
 		}
-		e.session.TxTables = make(map[string]*storage.Table)
-		e.session.TxSavepoints = make(map[string]map[string]*storage.Table)
-		e.session.TxLocalVariables = make(map[string]string)
-		return &Result{Message: "ROLLBACK"}, nil
+		e.rollbackTransaction()
+		return result, nil
 
 	default:
 		return nil, fmt.Errorf("unknown transaction command: %s", stmt.Command)
 	}
 }
 
+// Close releases what the session holds when its connection ends. An open
+// transaction block is rolled back, which releases its table locks, and the
+// session's cursors are closed.
+func (e *Executor) Close() {
+	if e.session == nil {
+		return
+	}
+	e.rollbackTransaction()
+	e.session.CloseCursors()
+}
+
+// rollbackTransaction discards the changes of the transaction block
+func (e *Executor) rollbackTransaction() {
+	e.session.TxActive = false
+	e.session.TxAborted = false
+	e.session.TxImplicit = false
+	e.session.TxNotifications = nil
+	for name, originalVal := range e.session.TxLocalVariables {
+		e.session.Variables[name] = originalVal
+	}
+	if dbInstance, err := e.getActiveDatabase(); err == nil {
+		dbInstance.ReleaseAllSessionLocks(e.session.ID)
+	}
+	e.session.TxTables = make(map[string]*storage.Table)
+	e.session.TxSavepoints = make(map[string]map[string]*storage.Table)
+	e.session.TxLocalVariables = make(map[string]string)
+}
+
 func (e *Executor) executeSavepoint(stmt *parser.SavepointStmt) (*Result, error) {
 	if e.session == nil {
 		return nil, fmt.Errorf("no active session")
@@ -3932,7 +4209,7 @@ func (e *Executor) executeSavepoint(stmt *parser.SavepointStmt) (*Result, error)
 	case "ROLLBACK TO":
 		snapshot, exists := e.session.TxSavepoints[stmt.Name]
 		if !exists {
-			return nil, fmt.Errorf("savepoint %s does not exist", stmt.Name)
+			return nil, util.NewSQLError(util.SQLStateInvalidSavepoint, "savepoint %s does not exist", stmt.Name)
 		}
 		// Restore e.session.TxTables from snapshot
 		e.session.TxTables = make(map[string]*storage.Table)
@@ -3943,7 +4220,8 @@ func (e *Executor) executeSavepoint(stmt *parser.SavepointStmt) (*Result, error)
 				e.session.TxTables[name] = t.Clone()
 			}
 		}
-		return &Result{Message: "ROLLBACK TO SAVEPOINT"}, nil
+		e.session.TxAborted = false
+		return &Result{Message: "ROLLBACK"}, nil
 
 	default:
 		return nil, fmt.Errorf("unknown savepoint command: %s", stmt.Command)
@@ -3955,12 +4233,39 @@ func (e *Executor) executeSet(stmt *parser.SetStmt) (*Result, error) {
 		return nil, fmt.Errorf("no active session")
 	}
 	name := strings.ToLower(stmt.Name)
+	if name == "client_min_messages" && !storage.IsMessageLevel(stmt.Value) {
+		return nil, util.NewSQLError(util.SQLStateInvalidParameterValue, "invalid value for parameter \"%s\": \"%s\"", name, stmt.Value)
+	}
+	if storage.IsTimeoutVariable(name) {
+		if _, err := storage.ParseTimeout(stmt.Value); err != nil {
+			return nil, util.NewSQLError(util.SQLStateInvalidParameterValue, "invalid value for parameter \"%s\": \"%s\"", name, stmt.Value)
+		}
+	}
+	result := &Result{Message: "SET"}
+	if !e.isKnownVariable(name) {
+		// Unknown variables are kept so that SHOW returns them, as custom
+		// options would be
+		result.Notices = []Notice{newNotice(SeverityWarning, util.SQLStateUndefinedObject, "unrecognized configuration parameter \"%s\"", name)}
+	}
 	if stmt.IsLocal {
 		e.session.SetLocalVariable(name, stmt.Value)
 	} else {
 		e.session.SetVariable(name, stmt.Value)
 	}
-	return &Result{Message: "SET"}, nil
+	return result, nil
+}
+
+// isKnownVariable reports whether name is a session variable or server
+// setting. Names qualified with a prefix are custom options, as in
+// PostgreSQL.
+func (e *Executor) isKnownVariable(name string) bool {
+	if _, ok := storage.DefaultSessionVariables[name]; ok {
+		return true
+	}
+	if _, ok := e.db.Config.Setting(name); ok {
+		return true
+	}
+	return strings.Contains(name, ".")
 }
 
 func (e *Executor) executeShowVar(stmt *parser.ShowVarStmt) (*Result, error) {
@@ -3972,6 +4277,9 @@ func (e *Executor) executeShowVar(stmt *parser.ShowVarStmt) (*Result, error) {
 	if val == "" {
 		val = storage.DefaultSessionVariables[name]
 	}
+	if setting, ok := e.db.Config.Setting(name); ok && val == "" {
+		val = setting
+	}
 
 	rows := []storage.Row{
 		{name: val},
@@ -4030,9 +4338,9 @@ func (e *Executor) executeLockTable(stmt *parser.LockTableStmt) (*Result, error)
 		return nil, fmt.Errorf("no active session")
 	}
 
-	// Check if already locked by another session
-	if owner, locked := dbInstance.GetLock(stmt.TableName); locked && owner != e.session.ID {
-		return nil, fmt.Errorf("table %s is locked by session %s", stmt.TableName, owner)
+	// Wait for a lock held by another session and for its changes
+	if err := e.lockTableForWrite(dbInstance, stmt.TableName); err != nil {
+		return nil, err
 	}
 
 	// Lock it for our session
@@ -4073,7 +4381,7 @@ func (e *Executor) executeFetchCursor(stmt *parser.FetchCursorStmt) (*Result, er
 
 	cursor, ok := e.session.GetCursor(stmt.Name)
 	if !ok {
-		return nil, fmt.Errorf("cursor %s does not exist", stmt.Name)
+		return nil, util.NewSQLError(util.SQLStateInvalidCursorName, "cursor %s does not exist", stmt.Name)
 	}
 
 	// Determine how many rows to fetch
@@ -4121,7 +4429,7 @@ func (e *Executor) executeMoveCursor(stmt *parser.MoveCursorStmt) (*Result, erro
 
 	cursor, ok := e.session.GetCursor(stmt.Name)
 	if !ok {
-		return nil, fmt.Errorf("cursor %s does not exist", stmt.Name)
+		return nil, util.NewSQLError(util.SQLStateInvalidCursorName, "cursor %s does not exist", stmt.Name)
 	}
 
 	totalRows := len(cursor.Rows)
@@ -4150,7 +4458,7 @@ func (e *Executor) executeCloseCursor(stmt *parser.CloseCursorStmt) (*Result, er
 
 	ok := e.session.DeleteCursor(stmt.Name)
 	if !ok {
-		return nil, fmt.Errorf("cursor %s does not exist", stmt.Name)
+		return nil, util.NewSQLError(util.SQLStateInvalidCursorName, "cursor %s does not exist", stmt.Name)
 	}
 
 	return &Result{
@@ -4166,7 +4474,7 @@ func (e *Executor) checkTableOrColumnPrivilege(tableName string, columns []strin
 
 	// Table level failed. Let's see if we have column-level privileges for all requested columns!
 	if len(columns) == 0 {
-		return fmt.Errorf("permission denied for %s on TABLE %s", privilege, tableName)
+		return errInsufficientPrivilege("permission denied for %s on TABLE %s", privilege, tableName)
 	}
 
 	dbInstance, err := e.getActiveDatabase()
@@ -4176,7 +4484,7 @@ func (e *Executor) checkTableOrColumnPrivilege(tableName string, columns []strin
 
 	table, exists := e.getTable(dbInstance, tableName)
 	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+		return errUndefinedTable(tableName)
 	}
 
 	// Determine the actual columns being projected
@@ -4211,7 +4519,7 @@ func (e *Executor) checkTableOrColumnPrivilege(tableName string, columns []strin
 		for _, col := range table.Columns {
 			colKey := fmt.Sprintf("TABLE:%s:%s", tableName, col.Name)
 			if !e.db.RoleStore.HasPrivilege(user, colKey, privilege) {
-				return fmt.Errorf("permission denied for %s on COLUMN %s.%s", privilege, tableName, col.Name)
+				return errInsufficientPrivilege("permission denied for %s on COLUMN %s.%s", privilege, tableName, col.Name)
 			}
 		}
 		return nil
@@ -4221,7 +4529,7 @@ func (e *Executor) checkTableOrColumnPrivilege(tableName string, columns []strin
 	for _, colName := range colsToCheck {
 		colKey := fmt.Sprintf("TABLE:%s:%s", tableName, colName)
 		if !e.db.RoleStore.HasPrivilege(user, colKey, privilege) {
-			return fmt.Errorf("permission denied for %s on COLUMN %s.%s", privilege, tableName, colName)
+			return errInsufficientPrivilege("permission denied for %s on COLUMN %s.%s", privilege, tableName, colName)
 		}
 	}
 
@@ -0,0 +1,36 @@
+package executor
+
+import (
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// systemFunction is a function that needs the executor, because it has
+// side effects or depends on server state, so storage.EvaluateExpression
+// cannot run it
+type systemFunction func(e *Executor, args []interface{}) (interface{}, error)
+
+var systemFunctions = map[string]systemFunction{
+	"PG_NOTIFY":            (*Executor).pgNotify,
+	"PG_RELOAD_CONF":       (*Executor).pgReloadConf,
+	"PG_CANCEL_BACKEND":    (*Executor).pgCancelBackend,
+	"PG_TERMINATE_BACKEND": (*Executor).pgTerminateBackend,
+	"PG_CURRENT_WAL_LSN":   (*Executor).pgCurrentWALLSN,
+}
+
+// callSystemFunction evaluates expr if it is a call to a system function.
+// It reports false for any other expression.
+func (e *Executor) callSystemFunction(expr string, row storage.Row) (interface{}, bool, error) {
+	expr = strings.TrimSpace(expr)
+	idx := strings.Index(expr, "(")
+	if idx <= 0 || !strings.HasSuffix(expr, ")") {
+		return nil, false, nil
+	}
+	fn, ok := systemFunctions[strings.ToUpper(strings.TrimSpace(expr[:idx]))]
+	if !ok {
+		return nil, false, nil
+	}
+	val, err := fn(e, storage.EvaluateArguments(expr[idx+1:len(expr)-1], row))
+	return val, true, err
+}
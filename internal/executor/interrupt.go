@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// lockPollInterval is how often a session waiting on a lock checks whether
+// its statement has been canceled
+const lockPollInterval = 50 * time.Millisecond
+
+// checkCanceled is called at safe points of long-running loops and returns
+// an error once the running statement has been canceled by a CancelRequest
+// or pg_cancel_backend, has run past statement_timeout, or its session has
+// been terminated by pg_terminate_backend
+func (e *Executor) checkCanceled() error {
+	if e.session != nil && e.session.Terminating() {
+		return errAdminShutdown()
+	}
+	if e.session != nil && e.session.CancelPending() {
+		return util.NewSQLError(util.SQLStateQueryCanceled, "canceling statement due to user request")
+	}
+	if !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		return util.NewSQLError(util.SQLStateQueryCanceled, "canceling statement due to statement timeout")
+	}
+	return nil
+}
+
+// waitForTableLock waits until no other session holds the table's lock. With
+// lock_timeout set to 0 a lock held by another session fails the statement
+// at once; otherwise the session waits up to lock_timeout, or until the
+// statement is canceled.
+func (e *Executor) waitForTableLock(dbInstance *storage.DatabaseInstance, name string) error {
+	timeout := e.session.Timeout(storage.LockTimeout)
+	deadline := time.Now().Add(timeout)
+	for {
+		released := dbInstance.LockReleased()
+		owner, locked := dbInstance.GetLock(name)
+		if !locked || owner == e.session.ID {
+			return nil
+		}
+		if timeout == 0 {
+			return errTableLocked(name, owner)
+		}
+		if err := e.checkCanceled(); err != nil {
+			return err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return util.NewSQLError(util.SQLStateLockNotAvailable, "canceling statement due to lock timeout").WithTable(name)
+		}
+		select {
+		case <-released:
+		case <-time.After(min(wait, lockPollInterval)):
+		}
+	}
+}
+
+// lockTableForWrite takes the table's write lock before the session changes
+// the table. It is held until the transaction block ends, or until the
+// statement ends outside of one. Explicit locks of other sessions are
+// handled as by checkTableLock. A write lock held by another session is
+// waited for like a row lock in PostgreSQL: with lock_timeout set to 0 the
+// session waits until the lock is released, and a wait that would never end
+// because the owner waits for this session fails with a deadlock error.
+func (e *Executor) lockTableForWrite(dbInstance *storage.DatabaseInstance, name string) error {
+	if e.session == nil {
+		return nil
+	}
+	if err := e.waitForTableLock(dbInstance, name); err != nil {
+		return err
+	}
+	defer dbInstance.StopWaiting(e.session.ID)
+
+	timeout := e.session.Timeout(storage.LockTimeout)
+	deadline := time.Now().Add(timeout)
+	for {
+		released := dbInstance.LockReleased()
+		owner, acquired, deadlock := dbInstance.AcquireWriteLock(name, e.session.ID)
+		if acquired {
+			return nil
+		}
+		if deadlock {
+			return util.NewSQLError(util.SQLStateDeadlockDetected, "deadlock detected").
+				WithDetail("Session %s waits for table %s, which is being changed by session %s, which waits for session %s.", e.session.ID, name, owner, e.session.ID).
+				WithTable(name)
+		}
+		if err := e.checkCanceled(); err != nil {
+			return err
+		}
+		wait := lockPollInterval
+		if timeout > 0 {
+			wait = time.Until(deadline)
+			if wait <= 0 {
+				return util.NewSQLError(util.SQLStateLockNotAvailable, "canceling statement due to lock timeout").WithTable(name)
+			}
+		}
+		select {
+		case <-released:
+		case <-time.After(min(wait, lockPollInterval)):
+		}
+	}
+}
+
+// cancelableLess wraps a sort comparator so that a canceled sort finishes
+// quickly; the caller must check canceled() once sorting returns
+type cancelableLess struct {
+	e        *Executor
+	less     func(i, j int) bool
+	calls    int
+	canceled bool
+}
+
+// compare calls the wrapped comparator, polling for cancellation every
+// 1024 comparisons
+func (c *cancelableLess) compare(i, j int) bool {
+	if c.canceled {
+		return false
+	}
+	c.calls++
+	if c.calls%1024 == 0 && c.e.checkCanceled() != nil {
+		c.canceled = true
+		return false
+	}
+	return c.less(i, j)
+}
@@ -0,0 +1,22 @@
+package executor
+
+import "github.com/ghosecorp/ghostsql/internal/util"
+
+// Severities of notices
+const (
+	SeverityWarning = "WARNING"
+	SeverityNotice  = "NOTICE"
+	SeverityInfo    = "INFO"
+)
+
+// Notice is a warning or informational message reported to the client
+// along with a result. It carries the same fields as an error.
+type Notice struct {
+	Severity string
+	*util.SQLError
+}
+
+// newNotice builds a notice with the given severity and SQLSTATE
+func newNotice(severity, code, format string, args ...interface{}) Notice {
+	return Notice{Severity: severity, SQLError: util.NewSQLError(code, format, args...)}
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+func (e *Executor) executeListen(stmt *parser.ListenStmt) (*Result, error) {
+	if e.session == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+	e.session.Listen(stmt.Channel)
+	return &Result{Message: "LISTEN"}, nil
+}
+
+func (e *Executor) executeUnlisten(stmt *parser.UnlistenStmt) (*Result, error) {
+	if e.session == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+	if stmt.Channel == "" {
+		e.session.UnlistenAll()
+	} else {
+		e.session.Unlisten(stmt.Channel)
+	}
+	return &Result{Message: "UNLISTEN"}, nil
+}
+
+func (e *Executor) executeNotify(stmt *parser.NotifyStmt) (*Result, error) {
+	if err := e.notify(stmt.Channel, stmt.Payload); err != nil {
+		return nil, err
+	}
+	return &Result{Message: "NOTIFY"}, nil
+}
+
+// notify sends a notification to the listeners of channel. Inside a
+// transaction block it is held until COMMIT and dropped on ROLLBACK.
+func (e *Executor) notify(channel, payload string) error {
+	if e.session == nil {
+		return fmt.Errorf("no active session")
+	}
+	if channel == "" {
+		return util.NewSQLError(util.SQLStateInvalidParameterValue, "channel name cannot be empty")
+	}
+	if len(payload) > storage.MaxNotifyPayload {
+		return util.NewSQLError(util.SQLStateInvalidParameterValue, "payload string too long")
+	}
+
+	n := storage.Notification{ProcessID: e.session.ProcessID, Channel: channel, Payload: payload}
+	if e.session.TxActive {
+		e.session.QueueNotification(n)
+		return nil
+	}
+	e.db.SessionMgr.Notify(n)
+	return nil
+}
+
+// pgNotify implements pg_notify(channel, payload)
+func (e *Executor) pgNotify(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("function pg_notify expects 2 arguments, got %d", len(args))
+	}
+	if args[0] == nil {
+		return nil, util.NewSQLError(util.SQLStateInvalidParameterValue, "channel name cannot be empty")
+	}
+	payload := ""
+	if args[1] != nil {
+		payload = fmt.Sprintf("%v", args[1])
+	}
+	return nil, e.notify(fmt.Sprintf("%v", args[0]), payload)
+}
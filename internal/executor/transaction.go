@@ -0,0 +1,56 @@
+package executor
+
+import (
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// isTransactionExit reports whether stmt may run in a failed transaction
+// block: statements that end the transaction or roll back to a savepoint
+func isTransactionExit(stmt parser.Statement) bool {
+	switch s := stmt.(type) {
+	case *parser.TransactionStmt:
+		return s.Command == "ROLLBACK" || s.Command == "COMMIT"
+	case *parser.SavepointStmt:
+		return s.Command == "ROLLBACK TO"
+	}
+	return false
+}
+
+// checkFailedTransaction rejects stmt while the transaction block is in the
+// failed state
+func (e *Executor) checkFailedTransaction(stmt parser.Statement) error {
+	if e.session != nil && e.session.TxAborted && !isTransactionExit(stmt) {
+		return util.NewSQLError(util.SQLStateInFailedTransaction, "current transaction is aborted, commands ignored until end of transaction block")
+	}
+	return nil
+}
+
+// BeginImplicitTransaction opens the transaction block that wraps the
+// statements of a multi-statement simple query. It does nothing if a block
+// is already open.
+func (e *Executor) BeginImplicitTransaction() {
+	if e.session == nil || e.session.TxActive {
+		return
+	}
+	e.executeTransaction(&parser.TransactionStmt{Command: "BEGIN"})
+	e.session.TxImplicit = true
+}
+
+// EndImplicitTransaction closes the implicit transaction block of a
+// multi-statement query: it is committed when every statement succeeded and
+// rolled back otherwise. Explicit blocks opened by BEGIN are left alone.
+func (e *Executor) EndImplicitTransaction(failed bool) error {
+	if e.session == nil || !e.session.TxActive || !e.session.TxImplicit {
+		return nil
+	}
+	if failed {
+		e.rollbackTransaction()
+		return nil
+	}
+	if _, err := e.executeTransaction(&parser.TransactionStmt{Command: "COMMIT"}); err != nil {
+		e.rollbackTransaction()
+		return err
+	}
+	return nil
+}
@@ -299,14 +299,18 @@ type CreateRoleStmt struct {
 	CanCreateRole bool
 	CanCreateDB   bool
 	Password      string
+	ConnLimit     int    // CONNECTION LIMIT, -1 for no limit
+	ValidUntil    string // VALID UNTIL timestamp, empty if not specified
 }
 
 func (s *CreateRoleStmt) StatementNode() {}
 
 // AlterRoleStmt represents ALTER ROLE
 type AlterRoleStmt struct {
-	RoleName string
-	Password string // New password if specified
+	RoleName   string
+	Password   string  // New password if specified
+	ConnLimit  *int    // New CONNECTION LIMIT if specified
+	ValidUntil *string // New VALID UNTIL timestamp if specified
 }
 
 func (s *AlterRoleStmt) StatementNode() {}
@@ -545,4 +549,60 @@ type CloseCursorStmt struct {
 
 func (s *CloseCursorStmt) StatementNode() {}
 
+// CopyStmt represents COPY table [(cols)] FROM STDIN and
+// COPY {table [(cols)] | (query)} TO STDOUT
+type CopyStmt struct {
+	TableName string
+	Columns   []string
+	Query     Statement // Source query of COPY (query) TO STDOUT
+	IsFrom    bool      // FROM STDIN, otherwise TO STDOUT
+	Options   CopyOptions
+	Next      func() ([]storage.Row, error) // Reads the next batch of rows sent for FROM STDIN, empty at the end
+}
+
+func (s *CopyStmt) StatementNode() {}
+
+// CopyOptions holds the data format options of a COPY statement
+type CopyOptions struct {
+	Format    string // "text", "csv" or "binary"
+	Header    bool
+	Delimiter string
+	Null      string
+	Quote     string
+}
+
+
+// ListenStmt represents LISTEN channel
+type ListenStmt struct {
+	Channel string
+}
+
+func (s *ListenStmt) StatementNode() {}
+
+// UnlistenStmt represents UNLISTEN channel and UNLISTEN *
+type UnlistenStmt struct {
+	Channel string // Empty for UNLISTEN *
+}
+
+func (s *UnlistenStmt) StatementNode() {}
+
+// NotifyStmt represents NOTIFY channel [, 'payload']
+type NotifyStmt struct {
+	Channel string
+	Payload string
+}
+
+func (s *NotifyStmt) StatementNode() {}
+
+// CheckpointStmt represents CHECKPOINT
+type CheckpointStmt struct{}
+
+func (s *CheckpointStmt) StatementNode() {}
+
+// VacuumStmt represents VACUUM [FULL] [table]
+type VacuumStmt struct {
+	Full      bool
+	TableName string // Empty for every table
+}
 
+func (s *VacuumStmt) StatementNode() {}
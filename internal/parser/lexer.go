@@ -26,11 +26,11 @@ func (l *Lexer) NextToken() Token {
 	l.skipWhitespace()
 
 	if l.pos >= len(l.input) {
-		return Token{Type: TOKEN_EOF, Line: l.line, Column: l.column}
+		return Token{Type: TOKEN_EOF, Line: l.line, Column: l.column, Pos: l.pos}
 	}
 
 	ch := l.input[l.pos]
-	token := Token{Line: l.line, Column: l.column}
+	token := Token{Line: l.line, Column: l.column, Pos: l.pos}
 
 	switch ch {
 	case ',':
@@ -186,6 +186,20 @@ func (l *Lexer) NextToken() Token {
 			token.Literal = ":"
 			l.advance()
 		}
+	case '$':
+		if unicode.IsDigit(rune(l.peek())) {
+			l.advance() // skip $
+			start := l.pos
+			for l.pos < len(l.input) && unicode.IsDigit(rune(l.input[l.pos])) {
+				l.advance()
+			}
+			token.Type = TOKEN_PARAM
+			token.Literal = l.input[start:l.pos]
+		} else {
+			token.Type = TOKEN_ILLEGAL
+			token.Literal = "$"
+			l.advance()
+		}
 	case '.':
 		token.Type = TOKEN_DOT
 		token.Literal = "."
@@ -0,0 +1,100 @@
+// internal/parser/params.go
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// NewParserWithParams creates a parser that substitutes positional
+// parameters ($1..$n) with the given bound values. Each placeholder is
+// replaced by the literal token the value would have produced had it been
+// written inline, so the resulting AST is identical to the one built from
+// the equivalent literal query.
+func NewParserWithParams(input string, params []interface{}) *Parser {
+	lexer := NewLexer(input)
+	p := &Parser{lexer: lexer, params: params}
+	p.nextToken()
+	p.nextToken()
+	return p
+}
+
+// CountParams returns the highest parameter number ($n) referenced by the query
+func CountParams(input string) int {
+	lexer := NewLexer(input)
+	count := 0
+	for {
+		tok := lexer.NextToken()
+		if tok.Type == TOKEN_EOF {
+			return count
+		}
+		if tok.Type == TOKEN_PARAM {
+			if n, err := strconv.Atoi(tok.Literal); err == nil && n > count {
+				count = n
+			}
+		}
+	}
+}
+
+// bindParam replaces a parameter placeholder token with its bound value
+func (p *Parser) bindParam(tok Token) Token {
+	if tok.Type != TOKEN_PARAM || p.params == nil {
+		return tok
+	}
+
+	n, err := strconv.Atoi(tok.Literal)
+	if err != nil || n < 1 || n > len(p.params) {
+		// Leave unbound placeholders illegal so the parser reports them
+		return Token{Type: TOKEN_ILLEGAL, Literal: "$" + tok.Literal, Line: tok.Line, Column: tok.Column}
+	}
+
+	bound := paramToken(p.params[n-1])
+	bound.Line = tok.Line
+	bound.Column = tok.Column
+	return bound
+}
+
+// paramToken converts a bound parameter value into a literal token
+func paramToken(val interface{}) Token {
+	switch v := val.(type) {
+	case nil:
+		return Token{Type: TOKEN_NULL, Literal: "NULL"}
+	case int:
+		return Token{Type: TOKEN_NUMBER, Literal: strconv.Itoa(v)}
+	case int32:
+		return Token{Type: TOKEN_NUMBER, Literal: strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return Token{Type: TOKEN_NUMBER, Literal: strconv.FormatInt(v, 10)}
+	case float32:
+		return floatToken(float64(v), 32)
+	case float64:
+		return floatToken(v, 64)
+	case bool:
+		// Boolean literals are written as strings ('true'/'false') in GhostSQL
+		return Token{Type: TOKEN_STRING, Literal: strconv.FormatBool(v)}
+	case string:
+		return Token{Type: TOKEN_STRING, Literal: v}
+	case []byte:
+		return Token{Type: TOKEN_STRING, Literal: string(v)}
+	case *storage.Vector:
+		parts := make([]string, len(v.Values))
+		for i, f := range v.Values {
+			parts[i] = strconv.FormatFloat(float64(f), 'f', -1, 32)
+		}
+		return Token{Type: TOKEN_STRING, Literal: "[" + strings.Join(parts, ",") + "]"}
+	default:
+		return Token{Type: TOKEN_STRING, Literal: fmt.Sprintf("%v", v)}
+	}
+}
+
+// floatToken formats a float so that the parser keeps it as a float literal
+func floatToken(f float64, bitSize int) Token {
+	lit := strconv.FormatFloat(f, 'f', -1, bitSize)
+	if !strings.Contains(lit, ".") {
+		lit += ".0"
+	}
+	return Token{Type: TOKEN_NUMBER, Literal: lit}
+}
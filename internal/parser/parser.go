@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
 )
 
 type Parser struct {
 	lexer   *Lexer
 	current Token
 	peek    Token
+	params  []interface{} // Bound values for $n placeholders (extended query protocol)
 }
 
 func NewParser(input string) *Parser {
@@ -25,10 +28,34 @@ func NewParser(input string) *Parser {
 
 func (p *Parser) nextToken() {
 	p.current = p.peek
-	p.peek = p.lexer.NextToken()
+	p.peek = p.bindParam(p.lexer.NextToken())
 }
 
+// Parse parses a single statement. Errors are reported as syntax errors at
+// the token where parsing stopped.
 func (p *Parser) Parse() (Statement, error) {
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, p.syntaxError(err)
+	}
+	return stmt, nil
+}
+
+// syntaxError attaches SQLSTATE 42601 and the position of the current token
+// to a parse error
+func (p *Parser) syntaxError(err error) error {
+	sqlErr := util.AsSQLError(err)
+	if sqlErr.Code == util.SQLStateInternalError {
+		sqlErr.Code = util.SQLStateSyntaxError
+	}
+	if sqlErr.Position == 0 {
+		pos := min(p.current.Pos, len(p.lexer.input))
+		sqlErr.Position = utf8.RuneCountInString(p.lexer.input[:pos]) + 1
+	}
+	return sqlErr
+}
+
+func (p *Parser) parseStatement() (Statement, error) {
 	var stmt Statement
 	var err error
 
@@ -103,6 +130,19 @@ func (p *Parser) Parse() (Statement, error) {
 		stmt, err = p.parseMoveCursor()
 	case TOKEN_CLOSE:
 		stmt, err = p.parseCloseCursor()
+	case TOKEN_COPY:
+		stmt, err = p.parseCopy()
+	case TOKEN_LISTEN:
+		stmt, err = p.parseListen()
+	case TOKEN_UNLISTEN:
+		stmt, err = p.parseUnlisten()
+	case TOKEN_NOTIFY:
+		stmt, err = p.parseNotify()
+	case TOKEN_CHECKPOINT:
+		p.nextToken()
+		stmt = &CheckpointStmt{}
+	case TOKEN_VACUUM:
+		stmt, err = p.parseVacuum()
 	default:
 		return nil, fmt.Errorf("unexpected token: %s", p.current.Type)
 	}
@@ -119,6 +159,26 @@ func (p *Parser) Parse() (Statement, error) {
 	return stmt, nil
 }
 
+// ParseAll parses a semicolon separated list of statements, as sent in a
+// single simple Query message. Empty statements are skipped.
+func (p *Parser) ParseAll() ([]Statement, error) {
+	var stmts []Statement
+	for {
+		for p.current.Type == TOKEN_SEMICOLON {
+			p.nextToken()
+		}
+		if p.current.Type == TOKEN_EOF {
+			return stmts, nil
+		}
+
+		stmt, err := p.Parse()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+}
+
 // parseSelectOrCompound parses SELECT or SELECT ... UNION/INTERSECT/EXCEPT SELECT
 func (p *Parser) parseSelectOrCompound() (Statement, error) {
 	left, err := p.parseSelect()
@@ -3042,7 +3102,7 @@ func (p *Parser) parseJoin(joinType string) (JoinClause, error) {
 }
 
 func (p *Parser) parseCreateRole() (*CreateRoleStmt, error) {
-	stmt := &CreateRoleStmt{CanLogin: true}
+	stmt := &CreateRoleStmt{CanLogin: true, ConnLimit: -1}
 	p.nextToken() // consume ROLE
 	if p.current.Type != TOKEN_IDENT && p.current.Type != TOKEN_ALL {
 		return nil, fmt.Errorf("expected role name")
@@ -3070,6 +3130,22 @@ func (p *Parser) parseCreateRole() (*CreateRoleStmt, error) {
 		case TOKEN_SEMICOLON, TOKEN_EOF:
 			return stmt, nil
 		default:
+			if p.isIdentKeyword("CONNECTION") {
+				limit, err := p.parseConnectionLimit()
+				if err != nil {
+					return nil, err
+				}
+				stmt.ConnLimit = limit
+				continue
+			}
+			if p.isIdentKeyword("VALID") {
+				validUntil, err := p.parseValidUntil()
+				if err != nil {
+					return nil, err
+				}
+				stmt.ValidUntil = validUntil
+				continue
+			}
 			return stmt, nil
 		}
 	}
@@ -3086,15 +3162,76 @@ func (p *Parser) parseAlterRole() (*AlterRoleStmt, error) {
 	if p.current.Type == TOKEN_WITH {
 		p.nextToken()
 	}
-	if p.current.Type == TOKEN_PASSWORD {
-		p.nextToken()
-		if p.current.Type != TOKEN_STRING {
-			return nil, fmt.Errorf("expected password string")
+	for {
+		switch {
+		case p.current.Type == TOKEN_PASSWORD:
+			p.nextToken()
+			if p.current.Type != TOKEN_STRING {
+				return nil, fmt.Errorf("expected password string")
+			}
+			stmt.Password = p.current.Literal
+			p.nextToken()
+		case p.isIdentKeyword("CONNECTION"):
+			limit, err := p.parseConnectionLimit()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ConnLimit = &limit
+		case p.isIdentKeyword("VALID"):
+			validUntil, err := p.parseValidUntil()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ValidUntil = &validUntil
+		default:
+			return stmt, nil
 		}
-		stmt.Password = p.current.Literal
+	}
+}
+
+// isIdentKeyword reports whether the current token is the unreserved
+// keyword kw, which the lexer returns as an identifier
+func (p *Parser) isIdentKeyword(kw string) bool {
+	return p.current.Type == TOKEN_IDENT && strings.ToUpper(p.current.Literal) == kw
+}
+
+// parseConnectionLimit parses CONNECTION LIMIT n of a role
+func (p *Parser) parseConnectionLimit() (int, error) {
+	p.nextToken() // consume CONNECTION
+	if p.current.Type != TOKEN_LIMIT {
+		return 0, fmt.Errorf("expected LIMIT after CONNECTION")
+	}
+	p.nextToken()
+
+	sign := 1
+	if p.current.Type == TOKEN_MINUS {
+		sign = -1
 		p.nextToken()
 	}
-	return stmt, nil
+	if p.current.Type != TOKEN_NUMBER {
+		return 0, fmt.Errorf("expected connection limit, got %s", p.current.Literal)
+	}
+	limit, err := strconv.Atoi(p.current.Literal)
+	if err != nil {
+		return 0, fmt.Errorf("invalid connection limit %s", p.current.Literal)
+	}
+	p.nextToken()
+	return sign * limit, nil
+}
+
+// parseValidUntil parses VALID UNTIL 'timestamp' of a role
+func (p *Parser) parseValidUntil() (string, error) {
+	p.nextToken() // consume VALID
+	if !p.isIdentKeyword("UNTIL") {
+		return "", fmt.Errorf("expected UNTIL after VALID")
+	}
+	p.nextToken()
+	if p.current.Type != TOKEN_STRING {
+		return "", fmt.Errorf("expected timestamp string after VALID UNTIL")
+	}
+	validUntil := p.current.Literal
+	p.nextToken()
+	return validUntil, nil
 }
 
 func (p *Parser) parseAlterDefaultPrivileges() (Statement, error) {
@@ -3593,6 +3730,12 @@ func (p *Parser) parseSet() (Statement, error) {
 	}
 	name := p.current.Literal
 	p.nextToken()
+	// Custom options are qualified, as in myapp.setting
+	for p.current.Type == TOKEN_DOT && p.peek.Type == TOKEN_IDENT {
+		name += "." + p.peek.Literal
+		p.nextToken()
+		p.nextToken()
+	}
 
 	if p.current.Type == TOKEN_TO || p.current.Type == TOKEN_EQUALS {
 		p.nextToken()
@@ -4231,3 +4374,275 @@ func (p *Parser) parseCloseCursor() (*CloseCursorStmt, error) {
 	return &CloseCursorStmt{Name: cursorName}, nil
 }
 
+// parseCopy parses COPY table [(cols)] FROM STDIN and
+// COPY {table [(cols)] | (query)} TO STDOUT, followed by options in either
+// the parenthesized form or the legacy keyword form
+func (p *Parser) parseCopy() (*CopyStmt, error) {
+	p.nextToken() // consume COPY
+	stmt := &CopyStmt{}
+
+	if p.current.Type == TOKEN_LPAREN {
+		p.nextToken()
+		var query Statement
+		var err error
+		switch p.current.Type {
+		case TOKEN_SELECT:
+			query, err = p.parseSelectOrCompound()
+		case TOKEN_WITH:
+			query, err = p.parseWithCTE()
+		default:
+			return nil, fmt.Errorf("expected SELECT query in COPY")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.current.Type != TOKEN_RPAREN {
+			return nil, fmt.Errorf("expected ) after COPY query")
+		}
+		p.nextToken()
+		stmt.Query = query
+	} else {
+		if p.current.Type != TOKEN_IDENT {
+			return nil, fmt.Errorf("expected table name after COPY")
+		}
+		stmt.TableName = p.current.Literal
+		p.nextToken()
+
+		if p.current.Type == TOKEN_LPAREN {
+			p.nextToken()
+			for p.current.Type != TOKEN_RPAREN {
+				if p.current.Type != TOKEN_IDENT {
+					return nil, fmt.Errorf("expected column name in COPY column list")
+				}
+				stmt.Columns = append(stmt.Columns, p.current.Literal)
+				p.nextToken()
+				if p.current.Type == TOKEN_COMMA {
+					p.nextToken()
+				} else if p.current.Type != TOKEN_RPAREN {
+					return nil, fmt.Errorf("expected , or ) in COPY column list")
+				}
+			}
+			p.nextToken()
+		}
+	}
+
+	switch p.current.Type {
+	case TOKEN_FROM:
+		stmt.IsFrom = true
+	case TOKEN_TO:
+	default:
+		return nil, fmt.Errorf("expected FROM or TO in COPY")
+	}
+	if stmt.IsFrom && stmt.Query != nil {
+		return nil, fmt.Errorf("COPY FROM does not support a query source")
+	}
+	p.nextToken()
+
+	target := strings.ToUpper(p.current.Literal)
+	if p.current.Type == TOKEN_STRING {
+		return nil, fmt.Errorf("COPY to or from a file is not supported, use STDIN or STDOUT")
+	}
+	if (stmt.IsFrom && target != "STDIN") || (!stmt.IsFrom && target != "STDOUT") {
+		return nil, fmt.Errorf("expected STDIN or STDOUT in COPY, got %s", p.current.Literal)
+	}
+	p.nextToken()
+
+	var opts CopyOptions
+	var delimiterSet, nullSet, quoteSet bool
+	if p.current.Type == TOKEN_WITH {
+		p.nextToken()
+	}
+
+	if p.current.Type == TOKEN_LPAREN {
+		p.nextToken()
+		for p.current.Type != TOKEN_RPAREN {
+			name := strings.ToUpper(p.current.Literal)
+			p.nextToken()
+
+			// Option values are identifiers, keywords or string literals
+			var value string
+			hasValue := p.current.Type != TOKEN_COMMA && p.current.Type != TOKEN_RPAREN
+			if hasValue {
+				value = p.current.Literal
+				p.nextToken()
+			}
+
+			switch name {
+			case "FORMAT":
+				opts.Format = strings.ToLower(value)
+			case "HEADER":
+				header, ok := true, true
+				if hasValue {
+					header, ok = storage.ParseBool(value)
+				}
+				if !ok {
+					return nil, fmt.Errorf("header requires a Boolean value")
+				}
+				opts.Header = header
+			case "DELIMITER":
+				opts.Delimiter, delimiterSet = value, true
+			case "NULL":
+				opts.Null, nullSet = value, true
+			case "QUOTE":
+				opts.Quote, quoteSet = value, true
+			default:
+				return nil, fmt.Errorf("option \"%s\" not recognized", strings.ToLower(name))
+			}
+
+			if p.current.Type == TOKEN_COMMA {
+				p.nextToken()
+			} else if p.current.Type != TOKEN_RPAREN {
+				return nil, fmt.Errorf("expected , or ) in COPY options")
+			}
+		}
+		p.nextToken()
+	} else {
+		// Legacy syntax: BINARY, CSV, HEADER, DELIMITER [AS] 'c', NULL [AS] 's', QUOTE [AS] 'c'
+		for p.current.Type != TOKEN_EOF && p.current.Type != TOKEN_SEMICOLON {
+			name := strings.ToUpper(p.current.Literal)
+			p.nextToken()
+			switch name {
+			case "BINARY":
+				opts.Format = "binary"
+			case "CSV":
+				opts.Format = "csv"
+			case "HEADER":
+				opts.Header = true
+			case "DELIMITER", "NULL", "QUOTE":
+				if p.current.Type == TOKEN_AS {
+					p.nextToken()
+				}
+				if p.current.Type != TOKEN_STRING {
+					return nil, fmt.Errorf("expected string after %s", name)
+				}
+				value := p.current.Literal
+				p.nextToken()
+				switch name {
+				case "DELIMITER":
+					opts.Delimiter, delimiterSet = value, true
+				case "NULL":
+					opts.Null, nullSet = value, true
+				case "QUOTE":
+					opts.Quote, quoteSet = value, true
+				}
+			default:
+				return nil, fmt.Errorf("unexpected COPY option: %s", name)
+			}
+		}
+	}
+
+	if opts.Format == "" {
+		opts.Format = "text"
+	}
+	switch opts.Format {
+	case "text":
+		if !delimiterSet {
+			opts.Delimiter = "\t"
+		}
+		if !nullSet {
+			opts.Null = `\N`
+		}
+	case "csv":
+		if !delimiterSet {
+			opts.Delimiter = ","
+		}
+		if !quoteSet {
+			opts.Quote = `"`
+		}
+	case "binary":
+		if delimiterSet || nullSet || opts.Header {
+			return nil, fmt.Errorf("cannot specify DELIMITER, NULL or HEADER in BINARY mode")
+		}
+	default:
+		return nil, fmt.Errorf("COPY format \"%s\" not recognized", opts.Format)
+	}
+	if quoteSet && opts.Format != "csv" {
+		return nil, fmt.Errorf("COPY quote available only in CSV mode")
+	}
+	if opts.Format != "binary" && len(opts.Delimiter) != 1 {
+		return nil, fmt.Errorf("COPY delimiter must be a single one-byte character")
+	}
+	if opts.Format == "csv" && len(opts.Quote) != 1 {
+		return nil, fmt.Errorf("COPY quote must be a single one-byte character")
+	}
+	if opts.Format == "csv" && opts.Delimiter == opts.Quote {
+		return nil, fmt.Errorf("COPY delimiter and quote must be different")
+	}
+
+	stmt.Options = opts
+	return stmt, nil
+}
+
+// parseChannel parses the channel name of LISTEN, UNLISTEN and NOTIFY.
+// Unquoted names are case-insensitive.
+func (p *Parser) parseChannel() (string, error) {
+	var channel string
+	switch p.current.Type {
+	case TOKEN_IDENT:
+		channel = strings.ToLower(p.current.Literal)
+	case TOKEN_STRING:
+		channel = p.current.Literal
+	default:
+		return "", fmt.Errorf("expected channel name, got %s", p.current.Literal)
+	}
+	p.nextToken()
+	return channel, nil
+}
+
+// parseListen parses LISTEN channel
+func (p *Parser) parseListen() (*ListenStmt, error) {
+	p.nextToken() // consume LISTEN
+	channel, err := p.parseChannel()
+	if err != nil {
+		return nil, err
+	}
+	return &ListenStmt{Channel: channel}, nil
+}
+
+// parseUnlisten parses UNLISTEN channel and UNLISTEN *
+func (p *Parser) parseUnlisten() (*UnlistenStmt, error) {
+	p.nextToken() // consume UNLISTEN
+	if p.current.Type == TOKEN_ASTERISK {
+		p.nextToken()
+		return &UnlistenStmt{}, nil
+	}
+	channel, err := p.parseChannel()
+	if err != nil {
+		return nil, err
+	}
+	return &UnlistenStmt{Channel: channel}, nil
+}
+
+// parseVacuum parses VACUUM [FULL] [table]
+func (p *Parser) parseVacuum() (*VacuumStmt, error) {
+	p.nextToken() // consume VACUUM
+	stmt := &VacuumStmt{}
+	if p.current.Type == TOKEN_FULL {
+		stmt.Full = true
+		p.nextToken()
+	}
+	if p.current.Type == TOKEN_IDENT {
+		stmt.TableName = p.current.Literal
+		p.nextToken()
+	}
+	return stmt, nil
+}
+
+// parseNotify parses NOTIFY channel [, 'payload']
+func (p *Parser) parseNotify() (*NotifyStmt, error) {
+	p.nextToken() // consume NOTIFY
+	channel, err := p.parseChannel()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &NotifyStmt{Channel: channel}
+	if p.current.Type == TOKEN_COMMA {
+		p.nextToken()
+		if p.current.Type != TOKEN_STRING {
+			return nil, fmt.Errorf("expected payload string after NOTIFY %s,", channel)
+		}
+		stmt.Payload = p.current.Literal
+		p.nextToken()
+	}
+	return stmt, nil
+}
@@ -82,6 +82,7 @@ const (
 	TOKEN_IDENT
 	TOKEN_NUMBER
 	TOKEN_STRING
+	TOKEN_PARAM // Positional parameter placeholder ($1, $2, ...)
 
 	// Symbols
 	TOKEN_COMMA
@@ -183,6 +184,12 @@ const (
 	TOKEN_JSON_ARROW
 	TOKEN_JSON_TEXT_ARROW
 	TOKEN_JSON_CONTAIN
+	TOKEN_COPY
+	TOKEN_LISTEN
+	TOKEN_UNLISTEN
+	TOKEN_NOTIFY
+	TOKEN_CHECKPOINT
+	TOKEN_VACUUM
 )
 
 type Token struct {
@@ -190,6 +197,7 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	Pos     int // Byte offset of the token in the input
 }
 
 func (t TokenType) String() string {
@@ -245,6 +253,7 @@ func (t TokenType) String() string {
 		TOKEN_IDENT:           "IDENT",
 		TOKEN_NUMBER:          "NUMBER",
 		TOKEN_STRING:          "STRING",
+		TOKEN_PARAM:           "PARAM",
 		TOKEN_COMMA:           "COMMA",
 		TOKEN_SEMICOLON:       "SEMICOLON",
 		TOKEN_LPAREN:          "LPAREN",
@@ -357,6 +366,12 @@ func (t TokenType) String() string {
 		TOKEN_JSON_ARROW:   "->",
 		TOKEN_JSON_TEXT_ARROW: "->>",
 		TOKEN_JSON_CONTAIN: "@>",
+		TOKEN_COPY:         "COPY",
+		TOKEN_LISTEN:       "LISTEN",
+		TOKEN_UNLISTEN:     "UNLISTEN",
+		TOKEN_NOTIFY:       "NOTIFY",
+		TOKEN_CHECKPOINT:   "CHECKPOINT",
+		TOKEN_VACUUM:       "VACUUM",
 	}
 	if name, ok := names[t]; ok {
 		return name
@@ -493,6 +508,12 @@ var keywords = map[string]TokenType{
 	"RESET":           TOKEN_RESET,
 	"LOCK":            TOKEN_LOCK,
 	"JSONB":           TOKEN_JSONB,
+	"COPY":            TOKEN_COPY,
+	"LISTEN":          TOKEN_LISTEN,
+	"UNLISTEN":        TOKEN_UNLISTEN,
+	"NOTIFY":          TOKEN_NOTIFY,
+	"CHECKPOINT":      TOKEN_CHECKPOINT,
+	"VACUUM":          TOKEN_VACUUM,
 }
 
 func LookupKeyword(ident string) TokenType {
@@ -0,0 +1,63 @@
+package pg
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// errCancelRequest is returned by handleStartup when the connection carried
+// a CancelRequest instead of a StartupMessage
+var errCancelRequest = errors.New("cancel request")
+
+// errTerminated is returned by sendReadyForQuery once the session has been
+// terminated by pg_terminate_backend
+var errTerminated = errors.New("terminated by administrator command")
+
+// sendBackendKeyData sends the process ID and secret key a client needs to
+// cancel queries of this session
+func (h *Handler) sendBackendKeyData() error {
+	msg := []byte{ResBackendKeyData}
+	msg = binary.BigEndian.AppendUint32(msg, 12)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(h.session.ProcessID))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(h.session.SecretKey))
+	_, err := h.conn.Write(msg)
+	return err
+}
+
+// handleCancelRequest interrupts the running statement of the session
+// identified by the backend key. As in PostgreSQL, nothing is sent back:
+// the client learns the outcome from its original connection.
+func (h *Handler) handleCancelRequest(processID, secretKey int32) {
+	session, ok := h.db.SessionMgr.FindByBackendKey(processID, secretKey)
+	if !ok {
+		h.db.Logger.Info("Ignoring CancelRequest for unknown backend %d", processID)
+		return
+	}
+	if session.Cancel() {
+		h.db.Logger.Info("Canceling statement of backend %d", processID)
+	}
+}
+
+// errAdminShutdown is sent to a session terminated by pg_terminate_backend
+func errAdminShutdown() *util.SQLError {
+	return util.NewSQLError(util.SQLStateAdminShutdown, "terminating connection due to administrator command")
+}
+
+// watchTermination closes the connection when the session is terminated by
+// pg_terminate_backend while idle, until done is closed. A running statement
+// is interrupted instead, and the connection is closed in place of its
+// ReadyForQuery.
+func (h *Handler) watchTermination(done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-h.session.TerminateSignal():
+		h.idleMu.Lock()
+		defer h.idleMu.Unlock()
+		if h.idle {
+			h.db.Logger.Info("Terminating idle backend %d", h.session.ProcessID)
+			h.closeConnection(errAdminShutdown())
+		}
+	}
+}
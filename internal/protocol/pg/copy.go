@@ -0,0 +1,646 @@
+package pg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// copyBinarySignature starts every binary COPY stream
+var copyBinarySignature = []byte("PGCOPY\n\377\r\n\000")
+
+// copyOutFlushSize is the amount of CopyData buffered before writing to the
+// connection during COPY TO STDOUT
+const copyOutFlushSize = 64 * 1024
+
+// copyInBatchSize is the number of rows COPY FROM STDIN adds to the table at
+// a time
+const copyInBatchSize = 1000
+
+// handleCopy runs a COPY statement, exchanging the rows with the client
+// through the COPY sub-protocol
+func (h *Handler) handleCopy(stmt *parser.CopyStmt) error {
+	if stmt.IsFrom {
+		return h.copyIn(stmt)
+	}
+	return h.copyOut(stmt)
+}
+
+// copyIn receives the rows of COPY FROM STDIN. After CopyInResponse the
+// client streams CopyData until CopyDone or CopyFail. The executor reads the
+// rows in batches of copyInBatchSize as they are decoded; when the statement
+// fails early, the rest of the stream is still consumed.
+func (h *Handler) copyIn(stmt *parser.CopyStmt) error {
+	columns, err := h.executor.CopyColumns(stmt)
+	if err != nil {
+		return err
+	}
+	if err := h.sendCopyResponse(ResCopyInResponse, stmt.Options.Format == "binary", len(columns)); err != nil {
+		return err
+	}
+
+	dec := &copyDecoder{opts: stmt.Options, columns: columns}
+	done := false // No more messages of the stream to read
+	copied := 0
+	stmt.Next = func() ([]storage.Row, error) {
+		for len(dec.rows) < copyInBatchSize && !done {
+			msgType, payload, err := h.readMessage()
+			if err != nil {
+				done = true
+				return nil, err
+			}
+
+			switch msgType {
+			case MsgCopyData:
+				err = dec.feed(payload)
+			case MsgCopyDone:
+				done = true
+				err = dec.finish()
+			case MsgCopyFail:
+				done = true
+				reason := string(bytes.TrimRight(payload, "\x00"))
+				return nil, util.NewSQLError(util.SQLStateQueryCanceled, "COPY from stdin failed: %s", reason)
+			case MsgFlush, MsgSync:
+				// Ignored while copying, as PostgreSQL does
+			default:
+				done = true
+				return nil, fmt.Errorf("unexpected message type 0x%02X during COPY from stdin", msgType)
+			}
+			if err != nil {
+				return nil, util.AsSQLError(err).WithWhere("COPY %s, line %d", stmt.TableName, dec.line)
+			}
+		}
+
+		n := min(len(dec.rows), copyInBatchSize)
+		batch := dec.rows[:n:n]
+		dec.rows = dec.rows[n:]
+		copied += n
+		return batch, nil
+	}
+
+	result, err := h.executor.Execute(stmt)
+	for !done {
+		msgType, _, readErr := h.readMessage()
+		if readErr != nil {
+			return readErr
+		}
+		done = msgType == MsgCopyDone || msgType == MsgCopyFail
+	}
+	if err != nil {
+		return err
+	}
+	h.db.Logger.Info("Copied %d row(s) into %s", copied, stmt.TableName)
+	return h.sendCommandComplete(result.Message)
+}
+
+// copyOut sends the rows of COPY TO STDOUT, one CopyData message per row
+func (h *Handler) copyOut(stmt *parser.CopyStmt) error {
+	result, err := h.executor.Execute(stmt)
+	if err != nil {
+		return err
+	}
+
+	opts := stmt.Options
+	binaryFormat := opts.Format == "binary"
+	if err := h.sendCopyResponse(ResCopyOutResponse, binaryFormat, len(result.Columns)); err != nil {
+		return err
+	}
+
+	var out []byte
+	appendCopyData := func(data []byte) error {
+		out = append(out, ResCopyData)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(data)+4))
+		out = append(out, data...)
+		if len(out) >= copyOutFlushSize {
+			if _, err := h.conn.Write(out); err != nil {
+				return err
+			}
+			out = out[:0]
+		}
+		return nil
+	}
+
+	if binaryFormat {
+		header := append([]byte{}, copyBinarySignature...)
+		header = binary.BigEndian.AppendUint32(header, 0) // Flags
+		header = binary.BigEndian.AppendUint32(header, 0) // Header extension length
+		if err := appendCopyData(header); err != nil {
+			return err
+		}
+	} else if opts.Header {
+		var line []byte
+		for i, col := range result.Columns {
+			if i > 0 {
+				line = append(line, opts.Delimiter[0])
+			}
+			line = appendCopyField(line, col, opts)
+		}
+		if err := appendCopyData(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range result.Rows {
+		data, err := encodeCopyRow(result, row, opts)
+		if err != nil {
+			return err
+		}
+		if err := appendCopyData(data); err != nil {
+			return err
+		}
+	}
+
+	if binaryFormat {
+		if err := appendCopyData([]byte{0xFF, 0xFF}); err != nil { // Trailer: field count -1
+			return err
+		}
+	}
+	out = append(out, ResCopyDone, 0, 0, 0, 4)
+	if _, err := h.conn.Write(out); err != nil {
+		return err
+	}
+	return h.sendCommandComplete(result.Message)
+}
+
+// sendCopyResponse sends CopyInResponse or CopyOutResponse. All columns
+// use the overall format.
+func (h *Handler) sendCopyResponse(msgType byte, binaryFormat bool, numColumns int) error {
+	format := byte(0)
+	if binaryFormat {
+		format = 1
+	}
+	body := []byte{format}
+	body = binary.BigEndian.AppendUint16(body, uint16(numColumns))
+	for i := 0; i < numColumns; i++ {
+		body = binary.BigEndian.AppendUint16(body, uint16(format))
+	}
+	return h.sendMessage(msgType, body)
+}
+
+// encodeCopyRow renders one row of COPY TO STDOUT
+func encodeCopyRow(result *executor.Result, row storage.Row, opts parser.CopyOptions) ([]byte, error) {
+	var buf []byte
+	if opts.Format == "binary" {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(result.Columns)))
+		for i, col := range result.Columns {
+			val := row[col]
+			if val == nil {
+				buf = binary.BigEndian.AppendUint32(buf, 0xFFFFFFFF)
+				continue
+			}
+			data, err := encodeBinaryValue(val, columnTypeAt(result, i))
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", col, err)
+			}
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+			buf = append(buf, data...)
+		}
+		return buf, nil
+	}
+
+	for i, col := range result.Columns {
+		if i > 0 {
+			buf = append(buf, opts.Delimiter[0])
+		}
+		val := row[col]
+		if val == nil {
+			buf = append(buf, opts.Null...)
+			continue
+		}
+		buf = appendCopyField(buf, formatTextValue(val, columnTypeAt(result, i)), opts)
+	}
+	return append(buf, '\n'), nil
+}
+
+// appendCopyField appends a non-NULL value in text or CSV format
+func appendCopyField(buf []byte, s string, opts parser.CopyOptions) []byte {
+	delim := opts.Delimiter[0]
+	if opts.Format == "csv" {
+		quote := opts.Quote[0]
+		// Quote values that could be mistaken for NULL or the end marker
+		needsQuote := s == opts.Null || s == `\.` || bytes.ContainsAny([]byte(s), string([]byte{delim, quote, '\r', '\n'}))
+		if !needsQuote {
+			return append(buf, s...)
+		}
+		buf = append(buf, quote)
+		for i := 0; i < len(s); i++ {
+			if s[i] == quote {
+				buf = append(buf, quote)
+			}
+			buf = append(buf, s[i])
+		}
+		return append(buf, quote)
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			if c == delim {
+				buf = append(buf, '\\')
+			}
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// copyDecoder converts the CopyData stream of COPY FROM STDIN into rows.
+// CopyData boundaries need not match row boundaries, so an incomplete row
+// is kept until the next message.
+type copyDecoder struct {
+	opts    parser.CopyOptions
+	columns []storage.Column
+	pending []byte
+	rows    []storage.Row
+	line    int  // Records read so far
+	started bool // Binary header consumed
+	ended   bool // End-of-data marker seen
+}
+
+// feed consumes one CopyData message
+func (d *copyDecoder) feed(data []byte) error {
+	if d.ended {
+		return nil
+	}
+	d.pending = append(d.pending, data...)
+
+	var consumed int
+	var err error
+	if d.opts.Format == "binary" {
+		consumed, err = d.decodeBinary()
+	} else {
+		consumed, err = d.decodeRecords(false)
+	}
+	d.pending = append(d.pending[:0], d.pending[consumed:]...)
+	return err
+}
+
+// finish is called on CopyDone and decodes a final row that lacks its
+// newline
+func (d *copyDecoder) finish() error {
+	if d.ended || len(d.pending) == 0 {
+		return nil
+	}
+	if d.opts.Format == "binary" {
+		return util.NewSQLError(util.SQLStateBadCopyFileFormat, "unexpected EOF in COPY data")
+	}
+	_, err := d.decodeRecords(true)
+	return err
+}
+
+// decodeRecords decodes the complete text or CSV records in d.pending and
+// returns the number of bytes consumed. With final set, trailing data
+// without a newline is a record too.
+func (d *copyDecoder) decodeRecords(final bool) (int, error) {
+	pos := 0
+	for pos < len(d.pending) && !d.ended {
+		end := d.recordEnd(d.pending[pos:])
+		if end < 0 {
+			if !final {
+				break
+			}
+			if d.opts.Format == "csv" && csvInQuote(d.pending[pos:], d.opts.Quote[0]) {
+				return pos, util.NewSQLError(util.SQLStateBadCopyFileFormat, "unterminated CSV quoted field")
+			}
+			end = len(d.pending) - pos
+		}
+		record := d.pending[pos : pos+end]
+		pos += end + 1
+		if pos > len(d.pending) {
+			pos = len(d.pending)
+		}
+		record = bytes.TrimSuffix(record, []byte{'\r'})
+
+		d.line++
+		if d.line == 1 && d.opts.Header {
+			continue
+		}
+		if string(record) == `\.` {
+			d.ended = true
+			break
+		}
+		if err := d.decodeRecord(record); err != nil {
+			return pos, err
+		}
+	}
+	return pos, nil
+}
+
+// recordEnd returns the index of the newline ending the first record of
+// data, or -1 if it is incomplete. CSV quoted fields may contain newlines.
+func (d *copyDecoder) recordEnd(data []byte) int {
+	if d.opts.Format != "csv" {
+		return bytes.IndexByte(data, '\n')
+	}
+	quote := d.opts.Quote[0]
+	inQuote := false
+	for i, c := range data {
+		switch {
+		case c == quote:
+			inQuote = !inQuote
+		case c == '\n' && !inQuote:
+			return i
+		}
+	}
+	return -1
+}
+
+// csvInQuote reports whether data ends inside a quoted field
+func csvInQuote(data []byte, quote byte) bool {
+	return bytes.Count(data, []byte{quote})%2 == 1
+}
+
+// decodeRecord converts one text or CSV record into a row
+func (d *copyDecoder) decodeRecord(record []byte) error {
+	var fields []*string
+	var err error
+	if d.opts.Format == "csv" {
+		fields, err = splitCopyCSV(record, d.opts)
+	} else {
+		fields, err = splitCopyText(record, d.opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > len(d.columns) {
+		return util.NewSQLError(util.SQLStateBadCopyFileFormat, "extra data after last expected column")
+	}
+	if len(fields) < len(d.columns) {
+		return util.NewSQLError(util.SQLStateBadCopyFileFormat, "missing data for column \"%s\"", d.columns[len(fields)].Name)
+	}
+
+	row := make(storage.Row, len(d.columns))
+	for i, col := range d.columns {
+		if fields[i] == nil {
+			row[col.Name] = nil
+			continue
+		}
+		val, err := decodeCopyText(col, *fields[i])
+		if err != nil {
+			return util.NewSQLError(util.SQLStateInvalidTextRepresentation, "%v", err)
+		}
+		row[col.Name] = val
+	}
+	d.rows = append(d.rows, row)
+	return nil
+}
+
+// splitCopyText splits a text-format record into its fields; nil marks NULL
+func splitCopyText(record []byte, opts parser.CopyOptions) ([]*string, error) {
+	delim := opts.Delimiter[0]
+	var fields []*string
+	start := 0
+	for i := 0; i <= len(record); i++ {
+		if i < len(record)-1 && record[i] == '\\' {
+			i++ // An escaped delimiter does not end the field
+			continue
+		}
+		if i < len(record) && record[i] != delim {
+			continue
+		}
+
+		raw := record[start:i]
+		start = i + 1
+		// The NULL string is matched before de-escaping
+		if string(raw) == opts.Null {
+			fields = append(fields, nil)
+			continue
+		}
+		s := unescapeCopyText(raw)
+		fields = append(fields, &s)
+	}
+	return fields, nil
+}
+
+// unescapeCopyText resolves the backslash sequences of the text format
+func unescapeCopyText(raw []byte) string {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw)
+	}
+	buf := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 == len(raw) {
+			buf = append(buf, c)
+			continue
+		}
+		i++
+		switch c = raw[i]; c {
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case 'x':
+			val, n := 0, 0
+			for n < 2 && i+1 < len(raw) && isHexDigit(raw[i+1]) {
+				i++
+				val = val*16 + hexValue(raw[i])
+				n++
+			}
+			if n == 0 {
+				buf = append(buf, 'x')
+			} else {
+				buf = append(buf, byte(val))
+			}
+		default:
+			if c >= '0' && c <= '7' {
+				val := int(c - '0')
+				for n := 1; n < 3 && i+1 < len(raw) && raw[i+1] >= '0' && raw[i+1] <= '7'; n++ {
+					i++
+					val = val*8 + int(raw[i]-'0')
+				}
+				buf = append(buf, byte(val))
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return string(buf)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= 'a':
+		return int(c-'a') + 10
+	case c >= 'A':
+		return int(c-'A') + 10
+	default:
+		return int(c - '0')
+	}
+}
+
+// splitCopyCSV splits a CSV record into its fields; nil marks NULL. A quoted
+// value is never NULL, even if it matches the NULL string.
+func splitCopyCSV(record []byte, opts parser.CopyOptions) ([]*string, error) {
+	delim, quote := opts.Delimiter[0], opts.Quote[0]
+	var fields []*string
+	var field []byte
+	quoted, inQuote := false, false
+
+	endField := func() {
+		if !quoted && string(field) == opts.Null {
+			fields = append(fields, nil)
+		} else {
+			s := string(field)
+			fields = append(fields, &s)
+		}
+		field, quoted = field[:0], false
+	}
+
+	for i := 0; i < len(record); i++ {
+		c := record[i]
+		switch {
+		case inQuote && c == quote && i+1 < len(record) && record[i+1] == quote:
+			field = append(field, quote)
+			i++
+		case c == quote:
+			inQuote = !inQuote
+			quoted = true
+		case c == delim && !inQuote:
+			endField()
+		default:
+			field = append(field, c)
+		}
+	}
+	if inQuote {
+		return nil, util.NewSQLError(util.SQLStateBadCopyFileFormat, "unterminated CSV quoted field")
+	}
+	endField()
+	return fields, nil
+}
+
+// decodeCopyText parses a text or CSV field according to the column type
+func decodeCopyText(col storage.Column, s string) (interface{}, error) {
+	switch col.Type {
+	case storage.TypeVector:
+		return storage.ParseVector(s)
+	case storage.TypeText, storage.TypeVarChar, storage.TypeJSONB:
+		return s, nil
+	}
+	val, err := decodeTextParam(dataTypeOID(col.Type), s)
+	if err != nil {
+		return nil, err
+	}
+	return copyValue(val), nil
+}
+
+// copyValue converts decoded integers to the int the parser produces for
+// INSERT literals
+func copyValue(val interface{}) interface{} {
+	if n, ok := val.(int64); ok {
+		return int(n)
+	}
+	return val
+}
+
+// decodeBinary decodes the complete binary tuples in d.pending and returns
+// the number of bytes consumed
+func (d *copyDecoder) decodeBinary() (int, error) {
+	data := d.pending
+	pos := 0
+
+	if !d.started {
+		headerLen := len(copyBinarySignature) + 8
+		if len(data) < headerLen {
+			return 0, nil
+		}
+		if !bytes.Equal(data[:len(copyBinarySignature)], copyBinarySignature) {
+			return 0, util.NewSQLError(util.SQLStateBadCopyFileFormat, "COPY file signature not recognized")
+		}
+		extLen := int(int32(binary.BigEndian.Uint32(data[len(copyBinarySignature)+4:])))
+		if extLen < 0 {
+			return 0, util.NewSQLError(util.SQLStateBadCopyFileFormat, "invalid COPY file header (negative length)")
+		}
+		if len(data) < headerLen+extLen {
+			return 0, nil
+		}
+		pos = headerLen + extLen
+		d.started = true
+	}
+
+	for !d.ended {
+		if len(data)-pos < 2 {
+			break
+		}
+		count := int16(binary.BigEndian.Uint16(data[pos:]))
+		if count == -1 {
+			d.ended = true
+			pos += 2
+			break
+		}
+		if int(count) != len(d.columns) {
+			return pos, util.NewSQLError(util.SQLStateBadCopyFileFormat, "row field count is %d, expected %d", count, len(d.columns))
+		}
+
+		// Only decode the tuple once all of its fields have arrived
+		off := pos + 2
+		values := make([][]byte, count)
+		complete := true
+		for i := range values {
+			if len(data)-off < 4 {
+				complete = false
+				break
+			}
+			n := int32(binary.BigEndian.Uint32(data[off:]))
+			off += 4
+			if n == -1 {
+				continue
+			}
+			if n < -1 {
+				return pos, util.NewSQLError(util.SQLStateBadCopyFileFormat, "invalid field size %d", n)
+			}
+			if len(data)-off < int(n) {
+				complete = false
+				break
+			}
+			values[i] = data[off : off+int(n)]
+			off += int(n)
+		}
+		if !complete {
+			break
+		}
+
+		row := make(storage.Row, len(d.columns))
+		for i, col := range d.columns {
+			if values[i] == nil {
+				row[col.Name] = nil
+				continue
+			}
+			val, err := decodeBinaryParam(dataTypeOID(col.Type), values[i])
+			if err != nil {
+				return pos, util.NewSQLError(util.SQLStateInvalidTextRepresentation, "%v", err)
+			}
+			row[col.Name] = copyValue(val)
+		}
+		d.rows = append(d.rows, row)
+		d.line++
+		pos = off
+	}
+	return pos, nil
+}
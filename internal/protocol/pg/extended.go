@@ -0,0 +1,641 @@
+package pg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/parser"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// preparedStatement is a statement created by a Parse message
+type preparedStatement struct {
+	name      string
+	query     string
+	paramOIDs []uint32
+	described *executor.Result // Columns sent by Describe, if any
+}
+
+// portal is a prepared statement bound to parameter values by a Bind message
+type portal struct {
+	name          string
+	stmt          *preparedStatement
+	params        []interface{}
+	resultFormats []int16
+	described     *executor.Result // Columns sent by Describe of the portal or its statement
+	result        *executor.Result // Set once the portal has been run
+	sent          int              // Rows already returned by Execute
+}
+
+// handleExtended dispatches a single extended query protocol message
+func (h *Handler) handleExtended(msgType byte, payload []byte) error {
+	switch msgType {
+	case MsgParse:
+		return h.handleParse(payload)
+	case MsgBind:
+		return h.handleBind(payload)
+	case MsgDescribe:
+		return h.handleDescribe(payload)
+	case MsgExecute:
+		return h.handleExecute(payload)
+	case MsgClose:
+		return h.handleClose(payload)
+	default:
+		return fmt.Errorf("unexpected extended query message: %c", msgType)
+	}
+}
+
+// handleParse creates a named or unnamed prepared statement
+func (h *Handler) handleParse(payload []byte) error {
+	data := payload
+	name := h.readString(&data)
+	query := h.readString(&data)
+
+	numTypes, err := readCount(&data)
+	if err != nil {
+		return err
+	}
+	declared := make([]uint32, numTypes)
+	for i := range declared {
+		oid, err := readInt32(&data)
+		if err != nil {
+			return err
+		}
+		declared[i] = uint32(oid)
+	}
+
+	if name != "" {
+		if _, exists := h.statements[name]; exists {
+			return util.NewSQLError(util.SQLStateDuplicatePreparedStatement, "prepared statement \"%s\" already exists", name)
+		}
+	}
+
+	numParams := parser.CountParams(query)
+	if len(declared) > numParams {
+		numParams = len(declared)
+	}
+	paramOIDs := make([]uint32, numParams)
+	copy(paramOIDs, declared)
+
+	// Without placeholders the query can be validated right away
+	if numParams == 0 && strings.TrimSpace(query) != "" {
+		if _, err := parser.NewParser(query).Parse(); err != nil {
+			return err
+		}
+	}
+
+	h.statements[name] = &preparedStatement{
+		name:      name,
+		query:     query,
+		paramOIDs: h.inferParamTypes(query, paramOIDs),
+	}
+
+	h.db.Logger.Info("Prepared statement %q: %s", name, query)
+	return h.sendMessage(ResParseComplete, nil)
+}
+
+// handleBind binds parameter values to a prepared statement, creating a portal
+func (h *Handler) handleBind(payload []byte) error {
+	data := payload
+	portalName := h.readString(&data)
+	stmtName := h.readString(&data)
+
+	stmt, exists := h.statements[stmtName]
+	if !exists {
+		return util.NewSQLError(util.SQLStateInvalidStatementName, "prepared statement \"%s\" does not exist", stmtName)
+	}
+
+	paramFormats, err := readFormatCodes(&data)
+	if err != nil {
+		return err
+	}
+	for _, f := range paramFormats {
+		if f != 0 && f != 1 {
+			return fmt.Errorf("unsupported format code: %d", f)
+		}
+	}
+
+	numParams, err := readCount(&data)
+	if err != nil {
+		return err
+	}
+	if numParams != len(stmt.paramOIDs) {
+		return util.NewSQLError(util.SQLStateProtocolViolation, "bind message supplies %d parameters, but prepared statement \"%s\" requires %d", numParams, stmtName, len(stmt.paramOIDs))
+	}
+	if len(paramFormats) > 1 && len(paramFormats) != numParams {
+		return util.NewSQLError(util.SQLStateProtocolViolation, "bind message has %d parameter formats but %d parameters", len(paramFormats), numParams)
+	}
+
+	params := make([]interface{}, numParams)
+	for i := range params {
+		length, err := readInt32(&data)
+		if err != nil {
+			return err
+		}
+		if length == -1 {
+			params[i] = nil
+			continue
+		}
+		if length < 0 || int(length) > len(data) {
+			return fmt.Errorf("invalid parameter length %d for parameter $%d", length, i+1)
+		}
+		raw := data[:length]
+		data = data[length:]
+
+		val, err := decodeParam(stmt.paramOIDs[i], formatFor(paramFormats, i), raw)
+		if err != nil {
+			return fmt.Errorf("parameter $%d: %w", i+1, err)
+		}
+		params[i] = val
+	}
+
+	resultFormats, err := readFormatCodes(&data)
+	if err != nil {
+		return err
+	}
+	for _, f := range resultFormats {
+		if f != 0 && f != 1 {
+			return fmt.Errorf("unsupported format code: %d", f)
+		}
+	}
+
+	if portalName != "" {
+		if _, exists := h.portals[portalName]; exists {
+			return util.NewSQLError(util.SQLStateDuplicateCursor, "portal \"%s\" already exists", portalName)
+		}
+	}
+
+	h.portals[portalName] = &portal{
+		name:          portalName,
+		stmt:          stmt,
+		params:        params,
+		resultFormats: resultFormats,
+		described:     stmt.described,
+	}
+	return h.sendMessage(ResBindComplete, nil)
+}
+
+// handleDescribe describes a prepared statement ('S') or a portal ('P')
+func (h *Handler) handleDescribe(payload []byte) error {
+	if len(payload) < 1 {
+		return fmt.Errorf("invalid Describe message")
+	}
+	kind := payload[0]
+	data := payload[1:]
+	name := h.readString(&data)
+
+	switch kind {
+	case 'S':
+		stmt, exists := h.statements[name]
+		if !exists {
+			return util.NewSQLError(util.SQLStateInvalidStatementName, "prepared statement \"%s\" does not exist", name)
+		}
+		if err := h.sendParameterDescription(stmt.paramOIDs); err != nil {
+			return err
+		}
+		stmt.described = h.describeStatement(stmt)
+		if stmt.described == nil {
+			return h.sendMessage(ResNoData, nil)
+		}
+		return h.sendRowDescription(stmt.described, nil)
+
+	case 'P':
+		p, exists := h.portals[name]
+		if !exists {
+			return util.NewSQLError(util.SQLStateInvalidCursorName, "portal \"%s\" does not exist", name)
+		}
+		p.described = h.describeStatement(p.stmt)
+		if p.described == nil {
+			return h.sendMessage(ResNoData, nil)
+		}
+		return h.sendRowDescription(p.described, p.resultFormats)
+
+	default:
+		return fmt.Errorf("invalid Describe message subtype %d", kind)
+	}
+}
+
+// handleExecute runs a portal and returns up to maxRows rows
+func (h *Handler) handleExecute(payload []byte) error {
+	data := payload
+	name := h.readString(&data)
+	maxRows, err := readInt32(&data)
+	if err != nil {
+		return err
+	}
+
+	p, exists := h.portals[name]
+	if !exists {
+		return util.NewSQLError(util.SQLStateInvalidCursorName, "portal \"%s\" does not exist", name)
+	}
+
+	if strings.TrimSpace(p.stmt.query) == "" {
+		return h.sendMessage(ResEmptyQueryResponse, nil)
+	}
+	h.session.StartQuery(p.stmt.query)
+
+	if err := h.runPortal(p); err != nil {
+		return err
+	}
+
+	result := p.result
+	if len(result.Columns) == 0 {
+		return h.sendCommandComplete(result.Message)
+	}
+
+	rows := result.Rows[p.sent:]
+	if maxRows > 0 && len(rows) > int(maxRows) {
+		rows = rows[:maxRows]
+	}
+	for _, row := range rows {
+		if err := h.sendDataRow(result, row, p.resultFormats); err != nil {
+			return err
+		}
+	}
+	p.sent += len(rows)
+
+	if p.sent < len(result.Rows) {
+		return h.sendMessage(ResPortalSuspended, nil)
+	}
+
+	tag := result.Message
+	if tag == "" {
+		tag = fmt.Sprintf("SELECT %d", len(rows))
+	}
+	return h.sendCommandComplete(tag)
+}
+
+// handleClose closes a prepared statement ('S') or a portal ('P')
+func (h *Handler) handleClose(payload []byte) error {
+	if len(payload) < 1 {
+		return fmt.Errorf("invalid Close message")
+	}
+	kind := payload[0]
+	data := payload[1:]
+	name := h.readString(&data)
+
+	switch kind {
+	case 'S':
+		delete(h.statements, name)
+	case 'P':
+		delete(h.portals, name)
+	default:
+		return fmt.Errorf("invalid Close message subtype %d", kind)
+	}
+	return h.sendMessage(ResCloseComplete, nil)
+}
+
+// runPortal executes the portal's statement once, keeping the result for Execute
+func (h *Handler) runPortal(p *portal) error {
+	if p.result != nil {
+		return nil
+	}
+
+	h.db.Logger.Info("Executing portal %q: %s", p.name, p.stmt.query)
+
+	stmt, err := parser.NewParserWithParams(p.stmt.query, p.params).Parse()
+	if err != nil {
+		return err
+	}
+	if _, isCopy := stmt.(*parser.CopyStmt); isCopy {
+		return util.NewSQLError(util.SQLStateFeatureNotSupported, "COPY is only supported in the simple query protocol")
+	}
+
+	result, err := h.executor.Execute(stmt)
+	if err != nil {
+		return err
+	}
+	if err := h.sendNotices(result); err != nil {
+		return err
+	}
+	// Rows are sent with the types the client was told about
+	if err := executor.ConformColumnTypes(result, p.described); err != nil {
+		return err
+	}
+	p.result = result
+	return nil
+}
+
+// describeStatement returns the result columns of a prepared statement, or
+// nil if it returns no rows. The statement is parsed with all parameters
+// bound to NULL and described from its target list without being run.
+func (h *Handler) describeStatement(stmt *preparedStatement) *executor.Result {
+	if strings.TrimSpace(stmt.query) == "" {
+		return nil
+	}
+
+	parsed, err := parser.NewParserWithParams(stmt.query, make([]interface{}, len(stmt.paramOIDs))).Parse()
+	if err != nil {
+		return nil
+	}
+
+	described := h.executor.Describe(parsed)
+	if described == nil || len(described.Columns) == 0 {
+		return nil
+	}
+	return described
+}
+
+// inferParamTypes resolves unspecified parameter types from the columns the
+// placeholders are compared with or inserted into, falling back to text.
+func (h *Handler) inferParamTypes(query string, oids []uint32) []uint32 {
+	if len(oids) == 0 {
+		return oids
+	}
+
+	var tokens []parser.Token
+	lexer := parser.NewLexer(query)
+	for {
+		tok := lexer.NextToken()
+		if tok.Type == parser.TOKEN_EOF {
+			break
+		}
+		tokens = append(tokens, tok)
+	}
+
+	// Collect the tables referenced by the statement
+	var tables []*storage.Table
+	if dbInstance, err := h.db.GetDatabaseInstance(h.session.GetDatabase()); err == nil {
+		for i := 0; i+1 < len(tokens); i++ {
+			switch tokens[i].Type {
+			case parser.TOKEN_FROM, parser.TOKEN_JOIN, parser.TOKEN_INTO, parser.TOKEN_UPDATE:
+				if tokens[i+1].Type == parser.TOKEN_IDENT {
+					if t, ok := dbInstance.GetTable(tokens[i+1].Literal); ok {
+						tables = append(tables, t)
+					}
+				}
+			}
+		}
+	}
+
+	columnOID := func(name string) (uint32, bool) {
+		if idx := strings.LastIndex(name, "."); idx >= 0 {
+			name = name[idx+1:]
+		}
+		for _, t := range tables {
+			for _, col := range t.Columns {
+				if col.Name == name {
+					return dataTypeOID(col.Type), true
+				}
+			}
+		}
+		return 0, false
+	}
+
+	isComparison := func(t parser.TokenType) bool {
+		switch t {
+		case parser.TOKEN_EQUALS, parser.TOKEN_LT, parser.TOKEN_GT, parser.TOKEN_LE,
+			parser.TOKEN_GE, parser.TOKEN_NE, parser.TOKEN_LIKE, parser.TOKEN_ILIKE:
+			return true
+		}
+		return false
+	}
+
+	insertColumns := h.insertTargetColumns(tokens, tables)
+
+	for i, tok := range tokens {
+		if tok.Type != parser.TOKEN_PARAM {
+			continue
+		}
+		n, err := strconv.Atoi(tok.Literal)
+		if err != nil || n < 1 || n > len(oids) || oids[n-1] != OIDUnspecified {
+			continue
+		}
+
+		var oid uint32
+		found := false
+
+		// $1::type
+		if i+2 < len(tokens) && tokens[i+1].Type == parser.TOKEN_CAST {
+			oid, found = typeNameOID(tokens[i+2].Literal)
+		}
+		// column <op> $1
+		if !found && i >= 2 && isComparison(tokens[i-1].Type) && tokens[i-2].Type == parser.TOKEN_IDENT {
+			oid, found = columnOID(tokens[i-2].Literal)
+		}
+		// $1 <op> column
+		if !found && i+2 < len(tokens) && isComparison(tokens[i+1].Type) && tokens[i+2].Type == parser.TOKEN_IDENT {
+			oid, found = columnOID(tokens[i+2].Literal)
+		}
+		// column IN ($1, $2, ...)
+		if !found {
+			j := i - 1
+			for j >= 0 && (tokens[j].Type == parser.TOKEN_PARAM || tokens[j].Type == parser.TOKEN_COMMA) {
+				j--
+			}
+			if j >= 2 && tokens[j].Type == parser.TOKEN_LPAREN && tokens[j-1].Type == parser.TOKEN_IN && tokens[j-2].Type == parser.TOKEN_IDENT {
+				oid, found = columnOID(tokens[j-2].Literal)
+			}
+		}
+		// LIMIT $1 / OFFSET $1
+		if !found && i >= 1 && (tokens[i-1].Type == parser.TOKEN_LIMIT || tokens[i-1].Type == parser.TOKEN_OFFSET) {
+			oid, found = OIDInt8, true
+		}
+		// INSERT INTO t (cols) VALUES ($1, ...)
+		if !found {
+			if colName, ok := insertColumns[i]; ok {
+				oid, found = columnOID(colName)
+			}
+		}
+
+		if !found {
+			oid = OIDText
+		}
+		oids[n-1] = oid
+	}
+
+	return oids
+}
+
+// insertTargetColumns maps the token index of each VALUES entry in an INSERT
+// statement to the column it is inserted into
+func (h *Handler) insertTargetColumns(tokens []parser.Token, tables []*storage.Table) map[int]string {
+	targets := make(map[int]string)
+	if len(tokens) < 3 || tokens[0].Type != parser.TOKEN_INSERT || len(tables) == 0 {
+		return targets
+	}
+
+	i := 3 // INSERT INTO name
+	var columns []string
+	if i < len(tokens) && tokens[i].Type == parser.TOKEN_LPAREN {
+		for i++; i < len(tokens) && tokens[i].Type != parser.TOKEN_RPAREN; i++ {
+			if tokens[i].Type == parser.TOKEN_IDENT {
+				columns = append(columns, tokens[i].Literal)
+			}
+		}
+		i++
+	} else {
+		columns = tables[0].GetColumnNames()
+	}
+
+	if i >= len(tokens) || tokens[i].Type != parser.TOKEN_VALUES {
+		return targets
+	}
+
+	depth, pos := 0, 0
+	for i++; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case parser.TOKEN_LPAREN:
+			depth++
+			if depth == 1 {
+				pos = 0
+			}
+		case parser.TOKEN_RPAREN:
+			depth--
+		case parser.TOKEN_COMMA:
+			if depth == 1 {
+				pos++
+			}
+		default:
+			if depth == 1 && pos < len(columns) {
+				targets[i] = columns[pos]
+			}
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	return targets
+}
+
+// decodeParam converts a raw Bind parameter into a value for the parser
+func decodeParam(oid uint32, format int16, raw []byte) (interface{}, error) {
+	if format == 1 {
+		return decodeBinaryParam(oid, raw)
+	}
+	return decodeTextParam(oid, string(raw))
+}
+
+// decodeTextParam parses a text-format parameter according to its type
+func decodeTextParam(oid uint32, s string) (interface{}, error) {
+	switch oid {
+	case OIDInt2, OIDInt4, OIDInt8:
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, util.NewSQLError(util.SQLStateInvalidTextRepresentation, "invalid input syntax for type integer: \"%s\"", s)
+		}
+		return v, nil
+	case OIDFloat4, OIDFloat8, OIDNumeric:
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, util.NewSQLError(util.SQLStateInvalidTextRepresentation, "invalid input syntax for type double precision: \"%s\"", s)
+		}
+		return v, nil
+	case OIDBool:
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+		return nil, util.NewSQLError(util.SQLStateInvalidTextRepresentation, "invalid input syntax for type boolean: \"%s\"", s)
+	default:
+		return s, nil
+	}
+}
+
+// typeNameOID maps a SQL type name used in a cast to its type OID
+func typeNameOID(name string) (uint32, bool) {
+	switch strings.ToLower(name) {
+	case "int", "integer", "int4":
+		return OIDInt4, true
+	case "smallint", "int2":
+		return OIDInt2, true
+	case "bigint", "int8":
+		return OIDInt8, true
+	case "float", "float8", "double", "real", "float4", "numeric", "decimal":
+		return OIDFloat8, true
+	case "bool", "boolean":
+		return OIDBool, true
+	case "varchar":
+		return OIDVarchar, true
+	case "text":
+		return OIDText, true
+	case "jsonb", "json":
+		return OIDJSONB, true
+	case "vector":
+		return OIDVector, true
+	}
+	return 0, false
+}
+
+// formatFor returns the format code that applies to the i-th value
+func formatFor(formats []int16, i int) int16 {
+	switch {
+	case len(formats) == 0:
+		return 0
+	case len(formats) == 1:
+		return formats[0]
+	case i < len(formats):
+		return formats[i]
+	default:
+		return 0
+	}
+}
+
+// readFormatCodes reads a count-prefixed list of format codes
+func readFormatCodes(data *[]byte) ([]int16, error) {
+	n, err := readCount(data)
+	if err != nil {
+		return nil, err
+	}
+	formats := make([]int16, n)
+	for i := range formats {
+		if formats[i], err = readInt16(data); err != nil {
+			return nil, err
+		}
+	}
+	return formats, nil
+}
+
+// readCount reads the int16 length of a list in a message
+func readCount(data *[]byte) (int, error) {
+	n, err := readInt16(data)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, util.NewSQLError(util.SQLStateProtocolViolation, "invalid list length %d in message", n)
+	}
+	return int(n), nil
+}
+
+func readInt16(data *[]byte) (int16, error) {
+	if len(*data) < 2 {
+		return 0, fmt.Errorf("insufficient data left in message")
+	}
+	v := int16(binary.BigEndian.Uint16(*data))
+	*data = (*data)[2:]
+	return v, nil
+}
+
+func readInt32(data *[]byte) (int32, error) {
+	if len(*data) < 4 {
+		return 0, fmt.Errorf("insufficient data left in message")
+	}
+	v := int32(binary.BigEndian.Uint32(*data))
+	*data = (*data)[4:]
+	return v, nil
+}
+
+func (h *Handler) sendParameterDescription(oids []uint32) error {
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(oids)))
+	for _, oid := range oids {
+		body = binary.BigEndian.AppendUint32(body, oid)
+	}
+	return h.sendMessage(ResParameterDescription, body)
+}
+
+// sendMessage writes a single backend message with the given body
+func (h *Handler) sendMessage(msgType byte, body []byte) error {
+	buf := make([]byte, 0, 5+len(body))
+	buf = append(buf, msgType)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(body)+4))
+	buf = append(buf, body...)
+	_, err := h.conn.Write(buf)
+	return err
+}
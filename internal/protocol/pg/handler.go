@@ -1,33 +1,48 @@
 package pg
 
 import (
+	"crypto/tls"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ghosecorp/ghostsql/internal/executor"
 	"github.com/ghosecorp/ghostsql/internal/parser"
 	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
 )
 
 // Handler handles a single PostgreSQL connection
 type Handler struct {
-	conn     net.Conn
-	db       *storage.Database
-	session  *storage.Session
-	executor *executor.Executor
-	user     string
-	role     *storage.Role
+	conn       net.Conn
+	db         *storage.Database
+	session    *storage.Session
+	executor   *executor.Executor
+	user       string
+	role       *storage.Role
+	statements map[string]*preparedStatement // Prepared statements by name ("" is unnamed)
+	portals    map[string]*portal            // Bound portals by name ("" is unnamed)
+	skipToSync bool                          // Discard extended query messages until Sync after an error
+	tlsConfig  *tls.Config                   // Accept SSLRequests when set
+	idleMu     sync.Mutex                    // Guards writes made while idle
+	idle       bool                          // Waiting for the next client message
+	idleTimer  *time.Timer                   // Fires after idle_in_transaction_session_timeout
+	closed     bool                          // Closed by the server while idle
 }
 
 // NewHandler creates a new PG protocol handler
 func NewHandler(conn net.Conn, db *storage.Database, session *storage.Session) *Handler {
 	return &Handler{
-		conn:     conn,
-		db:       db,
-		session:  session,
-		executor: executor.NewExecutor(db, session),
+		conn:       conn,
+		db:         db,
+		session:    session,
+		executor:   executor.NewExecutor(db, session),
+		statements: make(map[string]*preparedStatement),
+		portals:    make(map[string]*portal),
 	}
 }
 
@@ -35,29 +50,35 @@ func NewHandler(conn net.Conn, db *storage.Database, session *storage.Session) *
 func (h *Handler) Handle() error {
 	// 1. Initial Handshake (Startup/SSL)
 	if err := h.handleStartup(); err != nil {
+		if err == errCancelRequest {
+			return nil // The connection only carried a CancelRequest
+		}
 		return err
 	}
-
-	// 2. HBA Check
-	var remoteIP net.IP
-	if tcpAddr, ok := h.conn.RemoteAddr().(*net.TCPAddr); ok {
-		remoteIP = tcpAddr.IP
-	} else {
-		remoteIP = net.ParseIP("127.0.0.1") // Fallback for pipes/local
+	if h.db.ShuttingDown() {
+		err := util.NewSQLError(util.SQLStateCannotConnectNow, "the database system is shutting down")
+		h.sendMessage(ResErrorResponse, encodeErrorFields("FATAL", err))
+		return err
 	}
 
-	hba, _ := LoadHBAConfig("pg_hba.conf") // Reload for now or cache?
-	method, err := hba.Check(remoteIP, h.session.GetDatabase(), h.user)
+	// 2. HBA Check
+	conn := h.hbaConnection()
+	rule, err := h.db.HBA().Check(conn, h.db.RoleStore)
 	if err != nil {
 		h.sendError(err)
 		return err
 	}
 
-	if method == MethodReject {
-		err := fmt.Errorf("connection rejected by pg_hba.conf")
+	if rule.Method == storage.MethodReject {
+		err := util.NewSQLError(util.SQLStateInvalidAuthorization, "pg_hba.conf rejects connection for %s", conn)
 		h.sendError(err)
 		return err
 	}
+	if err := h.checkClientCert(rule); err != nil {
+		h.sendError(err)
+		return err
+	}
+	method := rule.Method
 
 	// 3. Authentication
 	role, exists := h.db.RoleStore.GetRole(h.user)
@@ -65,27 +86,27 @@ func (h *Handler) Handle() error {
 		// If user doesn't exist, we can either reject or trust.
 		// PostgreSQL by default rejects. We'll trust if not 'ghost' for now (per user req)
 		if h.user == "ghost" {
-			h.sendError(fmt.Errorf("role 'ghost' not found in system catalog"))
+			h.sendError(util.NewSQLError(util.SQLStateInvalidAuthorization, "role 'ghost' not found in system catalog"))
 			return fmt.Errorf("ghost role missing")
 		}
 		
 		// If HBA says trust, we trust. If it says password, we might need a password even for non-existent?
 		// Actually if HBA says password, we MUST have a role to check against.
-		if method == MethodTrust {
+		if method == storage.MethodTrust {
 			if err := h.sendAuthenticationOk(); err != nil {
 				return err
 			}
 		} else {
-			h.sendError(fmt.Errorf("role %s does not exist and trust is not enabled", h.user))
+			h.sendError(util.NewSQLError(util.SQLStateInvalidAuthorization, "role %s does not exist and trust is not enabled", h.user))
 			return fmt.Errorf("role not found")
 		}
 	} else if role.CanLogin {
-		if method == MethodTrust {
+		if method == storage.MethodTrust {
 			if err := h.sendAuthenticationOk(); err != nil {
 				return err
 			}
 		} else {
-			if err := h.requestPassword(role); err != nil {
+			if err := h.authenticate(method, role); err != nil {
 				h.sendError(err)
 				return err
 			}
@@ -94,10 +115,17 @@ func (h *Handler) Handle() error {
 		h.session.SetUser(h.user)
 	} else {
 		// Role cannot login
-		err := fmt.Errorf("role %s is not permitted to log in", h.user)
+		err := util.NewSQLError(util.SQLStateInvalidAuthorization, "role %s is not permitted to log in", h.user)
+		h.sendError(err)
+		return err
+	}
+
+	// Count the connection against max_connections and the role's limit
+	if err := h.db.SessionMgr.Admit(h.session, h.user, h.role, &h.db.Config); err != nil {
 		h.sendError(err)
 		return err
 	}
+	h.session.SetSessionUser(h.user)
 
 	// 3. Send Parameter Status & ReadyForQuery
 	if err := h.sendParameterStatus("server_version", "0.1.0"); err != nil {
@@ -109,6 +137,18 @@ func (h *Handler) Handle() error {
 	if err := h.sendParameterStatus("standard_conforming_strings", "on"); err != nil {
 		return err
 	}
+	if err := h.sendBackendKeyData(); err != nil {
+		return err
+	}
+
+	// Whatever way the connection ends, its transaction is rolled back
+	defer h.executor.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	defer h.setIdle(false) // Stops the idle timer
+	go h.watchNotifications(done)
+	go h.watchTermination(done)
 
 	if err := h.sendReadyForQuery(); err != nil {
 		return err
@@ -118,17 +158,40 @@ func (h *Handler) Handle() error {
 	for {
 		msgType, payload, err := h.readMessage()
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || h.closedByServer() {
 				return nil
 			}
 			return err
 		}
+		h.setIdle(false)
 
 		switch msgType {
 		case MsgQuery:
+			// A simple query replaces the unnamed statement and portal
+			delete(h.statements, "")
+			delete(h.portals, "")
 			if err := h.handleQuery(payload); err != nil {
+				h.session.AbortTransaction()
+				h.sendError(err)
+			}
+		case MsgParse, MsgBind, MsgDescribe, MsgExecute, MsgClose:
+			if h.skipToSync {
+				continue
+			}
+			if err := h.handleExtended(msgType, payload); err != nil {
+				h.session.AbortTransaction()
 				h.sendError(err)
+				h.skipToSync = true
 			}
+			continue
+		case MsgFlush:
+			// Responses are written directly to the connection, nothing is buffered
+			continue
+		case MsgCopyData, MsgCopyDone, MsgCopyFail:
+			// Left over from a COPY that already failed
+			continue
+		case MsgSync:
+			h.skipToSync = false
 		case MsgTerminate:
 			return nil
 		default:
@@ -136,6 +199,9 @@ func (h *Handler) Handle() error {
 		}
 
 		if err := h.sendReadyForQuery(); err != nil {
+			if err == errTerminated {
+				return nil
+			}
 			return err
 		}
 	}
@@ -172,11 +238,25 @@ func (h *Handler) handleStartup() error {
 	}
 
 	protocol := binary.BigEndian.Uint32(payload[:4])
+	if protocol == 80877102 && len(payload) >= 12 { // CancelRequest
+		h.handleCancelRequest(int32(binary.BigEndian.Uint32(payload[4:8])), int32(binary.BigEndian.Uint32(payload[8:12])))
+		return errCancelRequest
+	}
 	if protocol == 80877103 { // SSLRequest
-		// We don't support SSL yet, send 'N'
-		h.conn.Write([]byte{'N'})
+		if h.tlsConfig != nil && !h.isTLS() && !h.isLocal() {
+			if err := h.startTLS(); err != nil {
+				return err
+			}
+		} else {
+			h.conn.Write([]byte{'N'})
+		}
 		return h.handleStartup() // Read the real StartupMessage
 	}
+	if protocol == 80877104 { // GSSENCRequest
+		// GSSAPI encryption is not supported, the client may fall back to SSL
+		h.conn.Write([]byte{'N'})
+		return h.handleStartup()
+	}
 
 	// Parse StartupMessage (key-value pairs)
 	params := make(map[string]string)
@@ -198,6 +278,10 @@ func (h *Handler) handleStartup() error {
 		h.user = user
 	}
 
+	if appName, ok := params["application_name"]; ok {
+		h.session.SetVariable("application_name", appName)
+	}
+
 	return nil
 }
 
@@ -213,21 +297,31 @@ func (h *Handler) readString(data *[]byte) string {
 }
 
 func (h *Handler) sendAuthenticationOk() error {
-	msg := make([]byte, 9)
-	msg[0] = ResAuthentication
-	binary.BigEndian.PutUint32(msg[1:5], 8)
-	binary.BigEndian.PutUint32(msg[5:9], 0) // Auth OK
-	_, err := h.conn.Write(msg)
-	return err
+	return h.sendAuthentication(AuthOK, nil)
+}
+
+// authenticate runs the password authentication required by an HBA method
+func (h *Handler) authenticate(method storage.HBAMethod, role *storage.Role) error {
+	if method != storage.MethodPeer && role.PasswordExpired(time.Now()) {
+		// Like PostgreSQL, the client is not told why the password was refused
+		h.db.Logger.Info("User %s has an expired password", role.Name)
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "password authentication failed for user \"%s\"", role.Name)
+	}
+
+	switch method {
+	case storage.MethodSCRAM, storage.MethodMD5:
+		return h.authenticateSCRAM(role)
+	case storage.MethodPassword:
+		return h.requestPassword(role)
+	case storage.MethodPeer:
+		return h.authenticatePeer(role)
+	default:
+		return fmt.Errorf("unsupported authentication method %q in pg_hba.conf", method)
+	}
 }
 
 func (h *Handler) requestPassword(role *storage.Role) error {
-	// Send AuthenticationCleartextPassword (3)
-	msg := make([]byte, 9)
-	msg[0] = ResAuthentication
-	binary.BigEndian.PutUint32(msg[1:5], 8)
-	binary.BigEndian.PutUint32(msg[5:9], 3) 
-	if _, err := h.conn.Write(msg); err != nil {
+	if err := h.sendAuthentication(AuthCleartextPassword, nil); err != nil {
 		return err
 	}
 
@@ -243,7 +337,17 @@ func (h *Handler) requestPassword(role *storage.Role) error {
 
 	password := string(payload[:len(payload)-1]) // Remove null terminator
 	if !role.VerifyPassword(password) {
-		return fmt.Errorf("invalid password for user %s", h.user)
+		return util.NewSQLError(util.SQLStateInvalidPassword, "invalid password for user %s", h.user)
+	}
+
+	if role.NeedsPasswordUpgrade() {
+		// Replace the legacy unsalted hash now that we know the password
+		role.PasswordHash = storage.HashPassword(password)
+		if err := h.db.RoleStore.Save(); err != nil {
+			h.db.Logger.Info("Failed to persist SCRAM verifier for role %s: %v", role.Name, err)
+		} else {
+			h.db.Logger.Info("Upgraded password of role %s to SCRAM-SHA-256", role.Name)
+		}
 	}
 
 	return h.sendAuthenticationOk()
@@ -266,47 +370,100 @@ func (h *Handler) sendParameterStatus(name, value string) error {
 	return err
 }
 
+// sendReadyForQuery sends the pending notifications and ReadyForQuery, after
+// which the connection is idle
 func (h *Handler) sendReadyForQuery() error {
-	msg := []byte{ResReadyForQuery, 0, 0, 0, 5, 'I'} // 'I' for Idle
-	_, err := h.conn.Write(msg)
-	return err
+	h.idleMu.Lock()
+	defer h.idleMu.Unlock()
+	if h.session.Terminating() {
+		h.db.Logger.Info("Terminating backend %d", h.session.ProcessID)
+		h.sendMessage(ResErrorResponse, encodeErrorFields("FATAL", errAdminShutdown()))
+		return errTerminated
+	}
+	if err := h.sendNotifications(); err != nil {
+		return err
+	}
+	msg := []byte{ResReadyForQuery, 0, 0, 0, 5, h.session.TransactionStatus()}
+	if _, err := h.conn.Write(msg); err != nil {
+		return err
+	}
+	h.idle = true
+	h.session.SetIdle()
+	h.startIdleTimer()
+	return nil
 }
 
 func (h *Handler) handleQuery(payload []byte) error {
 	query := string(payload[:len(payload)-1]) // Remove null terminator
 	h.db.Logger.Info("Executing query: %s", query)
+	h.session.StartQuery(query)
 
-	p := parser.NewParser(query)
-	stmt, err := p.Parse()
+	stmts, err := parser.NewParser(query).ParseAll()
 	if err != nil {
 		return err
 	}
+	if len(stmts) == 0 {
+		return h.sendMessage(ResEmptyQueryResponse, nil)
+	}
+
+	// As in PostgreSQL, the statements of a multi-statement query run in one
+	// implicit transaction and the first error stops the batch
+	multi := len(stmts) > 1
+	for _, stmt := range stmts {
+		if multi {
+			h.executor.BeginImplicitTransaction()
+		}
+		if err := h.executeSimpleStatement(stmt); err != nil {
+			h.executor.EndImplicitTransaction(true)
+			return err
+		}
+	}
+	if multi {
+		return h.executor.EndImplicitTransaction(false)
+	}
+	return nil
+}
+
+// executeSimpleStatement runs one statement of a simple Query and sends its
+// RowDescription, DataRows and CommandComplete
+func (h *Handler) executeSimpleStatement(stmt parser.Statement) error {
+	if copyStmt, ok := stmt.(*parser.CopyStmt); ok {
+		return h.handleCopy(copyStmt)
+	}
 
 	result, err := h.executor.Execute(stmt)
 	if err != nil {
 		return err
 	}
+	if err := h.sendNotices(result); err != nil {
+		return err
+	}
 
 	// 1. Send RowDescription if it's a SELECT
 	if len(result.Columns) > 0 {
-		if err := h.sendRowDescription(result.Columns); err != nil {
+		if err := h.sendRowDescription(result, nil); err != nil {
 			return err
 		}
 
 		// 2. Send DataRows
 		for _, row := range result.Rows {
-			if err := h.sendDataRow(result.Columns, row); err != nil {
+			if err := h.sendDataRow(result, row, nil); err != nil {
 				return err
 			}
 		}
+
+		if result.Message == "" {
+			return h.sendCommandComplete(fmt.Sprintf("SELECT %d", len(result.Rows)))
+		}
 	}
 
 	// 3. Send CommandComplete
 	return h.sendCommandComplete(result.Message)
 }
 
-func (h *Handler) sendRowDescription(columns []string) error {
-	// Placeholder implementation - will map types later
+// sendRowDescription describes the result columns; formats holds the
+// result format codes requested by Bind (empty means text for all)
+func (h *Handler) sendRowDescription(result *executor.Result, formats []int16) error {
 	buf := make([]byte, 0)
 	buf = append(buf, ResRowDescription)
 	
@@ -315,17 +472,20 @@ func (h *Handler) sendRowDescription(columns []string) error {
 	buf = append(buf, 0, 0, 0, 0)
 
 	// Field count
-	buf = binary.BigEndian.AppendUint16(buf, uint16(len(columns)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(result.Columns)))
+
+	for i, col := range result.Columns {
+		ct := columnTypeAt(result, i)
+		oid, size, typmod := columnTypeInfo(ct)
 
-	for _, col := range columns {
 		buf = append(buf, col...)
 		buf = append(buf, 0) // Null terminator
-		buf = binary.BigEndian.AppendUint32(buf, 0) // Table OID
-		buf = binary.BigEndian.AppendUint16(buf, 0) // Column index
-		buf = binary.BigEndian.AppendUint32(buf, OIDText) // Type OID (default to text)
-		buf = binary.BigEndian.AppendUint16(buf, 65535) // Type size
-		buf = binary.BigEndian.AppendUint32(buf, 0) // Typmod
-		buf = binary.BigEndian.AppendUint16(buf, 0) // Format code (0 = text)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(ct.TableOID)) // Table OID
+		buf = binary.BigEndian.AppendUint16(buf, uint16(ct.AttNum)) // Column index
+		buf = binary.BigEndian.AppendUint32(buf, oid) // Type OID
+		buf = binary.BigEndian.AppendUint16(buf, uint16(size)) // Type size
+		buf = binary.BigEndian.AppendUint32(buf, uint32(typmod)) // Typmod
+		buf = binary.BigEndian.AppendUint16(buf, uint16(formatFor(formats, i))) // Format code (0 = text)
 	}
 
 	// Set length
@@ -334,21 +494,32 @@ func (h *Handler) sendRowDescription(columns []string) error {
 	return err
 }
 
-func (h *Handler) sendDataRow(columns []string, row storage.Row) error {
+func (h *Handler) sendDataRow(result *executor.Result, row storage.Row, formats []int16) error {
 	buf := make([]byte, 0)
 	buf = append(buf, ResDataRow)
 	
 	lenPos := len(buf)
 	buf = append(buf, 0, 0, 0, 0)
 
-	buf = binary.BigEndian.AppendUint16(buf, uint16(len(columns)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(result.Columns)))
 
-	for _, col := range columns {
+	for i, col := range result.Columns {
 		val := row[col]
 		if val == nil {
 			buf = binary.BigEndian.AppendUint32(buf, 0xFFFFFFFF) // Null
+			continue
+		}
+
+		ct := columnTypeAt(result, i)
+		if formatFor(formats, i) == 1 {
+			data, err := encodeBinaryValue(val, ct)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", col, err)
+			}
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+			buf = append(buf, data...)
 		} else {
-			strVal := fmt.Sprintf("%v", val)
+			strVal := formatTextValue(val, ct)
 			buf = binary.BigEndian.AppendUint32(buf, uint32(len(strVal)))
 			buf = append(buf, strVal...)
 		}
@@ -379,23 +550,52 @@ func (h *Handler) sendCommandComplete(tag string) error {
 }
 
 func (h *Handler) sendError(err error) {
-	// Simplified ErrorResponse
-	buf := make([]byte, 0)
-	buf = append(buf, ResErrorResponse)
-	
-	lenPos := len(buf)
-	buf = append(buf, 0, 0, 0, 0)
-	
-	buf = append(buf, 'S') // Severity
-	buf = append(buf, "ERROR"...)
-	buf = append(buf, 0)
-	
-	buf = append(buf, 'M') // Message
-	buf = append(buf, err.Error()...)
-	buf = append(buf, 0)
-	
-	buf = append(buf, 0) // Terminator
+	if h.session.Terminating() {
+		return // Replaced by the FATAL error that closes the connection
+	}
+	h.sendMessage(ResErrorResponse, encodeErrorFields("ERROR", util.AsSQLError(err)))
+}
 
-	binary.BigEndian.PutUint32(buf[lenPos:], uint32(len(buf)-lenPos))
-	h.conn.Write(buf)
+// sendNotices sends the notices of a result that pass the session's
+// client_min_messages filter
+func (h *Handler) sendNotices(result *executor.Result) error {
+	for _, n := range result.Notices {
+		if !h.session.WantsNotice(n.Severity) {
+			continue
+		}
+		if err := h.sendMessage(ResNoticeResponse, encodeErrorFields(n.Severity, n.SQLError)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeErrorFields builds the body of an ErrorResponse or NoticeResponse.
+// Optional fields are only included when set.
+func encodeErrorFields(severity string, e *util.SQLError) []byte {
+	var buf []byte
+	field := func(code byte, value string) {
+		if value == "" {
+			return
+		}
+		buf = append(buf, code)
+		buf = append(buf, value...)
+		buf = append(buf, 0)
+	}
+
+	field('S', severity)
+	field('V', severity) // Non-localized severity
+	field('C', e.Code)
+	field('M', e.Message)
+	field('D', e.Detail)
+	field('H', e.Hint)
+	if e.Position > 0 {
+		field('P', strconv.Itoa(e.Position))
+	}
+	field('W', e.Where)
+	field('s', e.Schema)
+	field('t', e.Table)
+	field('c', e.Column)
+	field('n', e.Constraint)
+	return append(buf, 0) // Terminator
 }
@@ -1,112 +1,45 @@
-package pg
-
-import (
-	"bufio"
-	"fmt"
-	"net"
-	"os"
-	"strings"
-)
-
-// HBAMethod represents the authentication method
-type HBAMethod string
-
-const (
-	MethodTrust    HBAMethod = "trust"
-	MethodReject   HBAMethod = "reject"
-	MethodPassword HBAMethod = "password" // scram-sha-256 or cleartext
-)
-
-// HBARule represents a single rule in pg_hba.conf
-type HBARule struct {
-	Type     string // "local", "host"
-	Database string // "all", "ghostsql", etc.
-	User     string // "all", "ghost", etc.
-	Address  *net.IPNet
-	Method   HBAMethod
-}
-
-// HBAConfig stores all loaded rules
-type HBAConfig struct {
-	Rules []HBARule
-}
-
-// LoadHBAConfig loads rules from a file
-func LoadHBAConfig(path string) (*HBAConfig, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Return default rules if file doesn't exist
-			return DefaultHBAConfig(), nil
-		}
-		return nil, err
-	}
-	defer file.Close()
-
-	config := &HBAConfig{}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		parts := strings.Fields(line)
-		if len(parts) < 5 {
-			continue // Invalid line
-		}
-
-		rule := HBARule{
-			Type:     parts[0],
-			Database: parts[1],
-			User:     parts[2],
-			Method:   HBAMethod(parts[4]),
-		}
-
-		_, ipNet, err := net.ParseCIDR(parts[3])
-		if err == nil {
-			rule.Address = ipNet
-		}
-
-		config.Rules = append(config.Rules, rule)
-	}
-
-	return config, nil
-}
-
-// DefaultHBAConfig returns a permissive configuration
-func DefaultHBAConfig() *HBAConfig {
-	_, anyIP, _ := net.ParseCIDR("0.0.0.0/0")
-	_, localIP, _ := net.ParseCIDR("127.0.0.1/32")
-	return &HBAConfig{
-		Rules: []HBARule{
-			{Type: "host", Database: "all", User: "ghost", Address: anyIP, Method: MethodPassword},
-			{Type: "host", Database: "all", User: "all", Address: localIP, Method: MethodTrust},
-			{Type: "host", Database: "all", User: "all", Address: anyIP, Method: MethodPassword},
-		},
-	}
-}
-
-// Check verifies if a connection is allowed
-func (c *HBAConfig) Check(remoteIP net.IP, dbName, user string) (HBAMethod, error) {
-	for _, rule := range c.Rules {
-		// Check database
-		if rule.Database != "all" && rule.Database != dbName {
-			continue
-		}
-
-		// Check user
-		if rule.User != "all" && rule.User != user {
-			continue
-		}
-
-		// Check address
-		if rule.Address != nil && !rule.Address.Contains(remoteIP) {
-			continue
-		}
-
-		return rule.Method, nil
-	}
-
-	return MethodReject, fmt.Errorf("no pg_hba.conf entry for host %s, user %s, database %s", remoteIP, user, dbName)
-}
+package pg
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// hbaConnection describes the connection for matching pg_hba.conf rules
+func (h *Handler) hbaConnection() storage.HBAConnection {
+	conn := storage.HBAConnection{
+		SSL:      h.isTLS(),
+		Database: h.session.GetDatabase(),
+		User:     h.user,
+	}
+	if h.isLocal() {
+		conn.Local = true
+	} else if addr, ok := h.conn.RemoteAddr().(*net.TCPAddr); ok {
+		conn.RemoteIP = addr.IP
+	} else {
+		conn.RemoteIP = net.ParseIP("127.0.0.1") // Fallback for pipes
+	}
+	return conn
+}
+
+// checkClientCert enforces the clientcert option of the matched rule. Both
+// modes need a certificate signed by a CA in ssl_ca_file; verify-full also
+// needs its common name to be the user name.
+func (h *Handler) checkClientCert(rule *storage.HBARule) error {
+	mode := rule.Options["clientcert"]
+	if mode == "" {
+		return nil
+	}
+
+	tlsConn, ok := h.conn.(*tls.Conn)
+	if !ok || len(tlsConn.ConnectionState().VerifiedChains) == 0 {
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "connection requires a valid client certificate")
+	}
+	if mode == "verify-full" && tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName != h.user {
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "certificate authentication failed for user \"%s\"", h.user)
+	}
+	return nil
+}
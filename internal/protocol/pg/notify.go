@@ -0,0 +1,54 @@
+package pg
+
+import "encoding/binary"
+
+// sendNotifications sends the notifications waiting for the session as
+// NotificationResponse messages. They are held while a transaction block is
+// open, as PostgreSQL only delivers them between transactions.
+func (h *Handler) sendNotifications() error {
+	if h.session.TransactionStatus() != 'I' {
+		return nil
+	}
+	for _, n := range h.session.TakeNotifications() {
+		body := binary.BigEndian.AppendUint32(nil, uint32(n.ProcessID))
+		body = append(body, n.Channel...)
+		body = append(body, 0)
+		body = append(body, n.Payload...)
+		body = append(body, 0)
+		if err := h.sendMessage(ResNotificationResponse, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setIdle records whether the connection is waiting for the next client
+// message
+func (h *Handler) setIdle(idle bool) {
+	h.idleMu.Lock()
+	defer h.idleMu.Unlock()
+	h.idle = idle
+	if !idle {
+		h.stopIdleTimer()
+	}
+}
+
+// watchNotifications delivers notifications that arrive while the
+// connection is idle, until done is closed. Notifications that arrive while
+// a query runs are sent before its ReadyForQuery instead.
+func (h *Handler) watchNotifications(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-h.session.NotificationSignal():
+			h.idleMu.Lock()
+			if h.idle {
+				if err := h.sendNotifications(); err != nil {
+					h.db.Logger.Info("Failed to send notifications: %v", err)
+				}
+			}
+			h.idleMu.Unlock()
+		}
+	}
+}
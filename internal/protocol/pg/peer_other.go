@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pg
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerUID is only implemented with Linux's SO_PEERCRED
+func peerUID(conn *net.UnixConn) (uint32, error) {
+	return 0, fmt.Errorf("peer authentication is not supported on this platform")
+}
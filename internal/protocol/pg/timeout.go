@@ -0,0 +1,58 @@
+package pg
+
+import (
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// startIdleTimer enforces idle_in_transaction_session_timeout once the
+// session is idle inside a transaction block. h.idleMu must be held.
+func (h *Handler) startIdleTimer() {
+	h.stopIdleTimer()
+	if h.session.TransactionStatus() == 'I' {
+		return
+	}
+	timeout := h.session.Timeout(storage.IdleInTransactionSessionTimeout)
+	if timeout <= 0 {
+		return
+	}
+	// A timer stopped too late to keep its function from running is no
+	// longer h.idleTimer and does nothing
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		h.idleMu.Lock()
+		defer h.idleMu.Unlock()
+		if h.idle && h.idleTimer == timer {
+			h.db.Logger.Info("Terminating backend %d after %v idle in transaction", h.session.ProcessID, timeout)
+			h.closeConnection(util.NewSQLError(util.SQLStateIdleInTransactionTimeout, "terminating connection due to idle-in-transaction timeout"))
+		}
+	})
+	h.idleTimer = timer
+}
+
+// stopIdleTimer stops the idle_in_transaction_session_timeout timer.
+// h.idleMu must be held.
+func (h *Handler) stopIdleTimer() {
+	if h.idleTimer != nil {
+		h.idleTimer.Stop()
+		h.idleTimer = nil
+	}
+}
+
+// closeConnection sends a FATAL error and closes the idle connection from
+// the server side. The main loop then ends when its read fails, and the
+// session's transaction is rolled back. h.idleMu must be held.
+func (h *Handler) closeConnection(err *util.SQLError) {
+	h.sendMessage(ResErrorResponse, encodeErrorFields("FATAL", err))
+	h.conn.Close()
+	h.closed = true
+}
+
+// closedByServer reports whether closeConnection has been called
+func (h *Handler) closedByServer() bool {
+	h.idleMu.Lock()
+	defer h.idleMu.Unlock()
+	return h.closed
+}
@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// LoadTLSConfig builds the TLS configuration for client connections from the
+// ssl, ssl_cert_file and ssl_key_file settings. It returns nil if ssl is off.
+// With ssl_ca_file set, clients may present a certificate signed by one of
+// its CAs, which clientcert rules in pg_hba.conf can require.
+func LoadTLSConfig(db *storage.Database) (*tls.Config, error) {
+	if !db.Config.SSL {
+		return nil, nil
+	}
+
+	certFile := resolveDataPath(db, db.Config.SSLCertFile)
+	keyFile := resolveDataPath(db, db.Config.SSLKeyFile)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate %q and key %q: %w", certFile, keyFile, err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if db.Config.SSLCAFile != "" {
+		caFile := resolveDataPath(db, db.Config.SSLCAFile)
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load root certificate file %q: %w", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("could not load root certificate file %q: no certificates found", caFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// resolveDataPath resolves a setting's file path against the data directory
+func resolveDataPath(db *storage.Database, path string) string {
+	if path == "" || filepath.IsAbs(path) || db.DataDir == nil {
+		return path
+	}
+	return filepath.Join(db.DataDir.RootPath, path)
+}
+
+// SetTLSConfig enables SSL negotiation on the connection; with a nil config
+// SSLRequests are declined
+func (h *Handler) SetTLSConfig(config *tls.Config) {
+	h.tlsConfig = config
+}
+
+// startTLS answers an SSLRequest with 'S' and upgrades the connection
+func (h *Handler) startTLS() error {
+	if _, err := h.conn.Write([]byte{'S'}); err != nil {
+		return err
+	}
+	tlsConn := tls.Server(h.conn, h.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("SSL handshake failed: %w", err)
+	}
+	h.conn = tlsConn
+	return nil
+}
+
+// isTLS reports whether the connection has been upgraded to TLS
+func (h *Handler) isTLS() bool {
+	_, ok := h.conn.(*tls.Conn)
+	return ok
+}
@@ -1,5 +1,7 @@
 package pg
 
+import "github.com/ghosecorp/ghostsql/internal/storage"
+
 // PostgreSQL Message Types
 const (
 	MsgStartup         = 0  // Not a single byte char
@@ -13,6 +15,10 @@ const (
 	MsgExecute         = 'E'
 	MsgSync            = 'S'
 	MsgFlush           = 'H'
+	MsgClose           = 'C'
+	MsgCopyData        = 'd'
+	MsgCopyDone        = 'c'
+	MsgCopyFail        = 'f'
 )
 
 // PostgreSQL Backend Response Types
@@ -26,13 +32,47 @@ const (
 	ResCommandComplete = 'C'
 	ResErrorResponse   = 'E'
 	ResNoticeResponse  = 'N'
+
+	// Extended query protocol responses
+	ResParseComplete        = '1'
+	ResBindComplete         = '2'
+	ResCloseComplete        = '3'
+	ResNoData               = 'n'
+	ResParameterDescription = 't'
+	ResPortalSuspended      = 's'
+	ResEmptyQueryResponse   = 'I'
+
+	// COPY sub-protocol responses
+	ResCopyInResponse  = 'G'
+	ResCopyOutResponse = 'H'
+	ResCopyData        = 'd'
+	ResCopyDone        = 'c'
+
+	// Asynchronous notification from LISTEN/NOTIFY
+	ResNotificationResponse = 'A'
+)
+
+// Authentication request codes
+const (
+	AuthOK                = 0
+	AuthCleartextPassword = 3
+	AuthSASL              = 10
+	AuthSASLContinue      = 11
+	AuthSASLFinal         = 12
 )
 
 // PostgreSQL Type OIDs (Object Identifiers)
 const (
-	OIDInt4    = 23
-	OIDText    = 25
-	OIDFloat8  = 701
-	OIDBool    = 16
-	OIDVarchar = 1043
+	OIDUnspecified = 0
+	OIDBool        = 16
+	OIDInt8        = 20
+	OIDInt2        = 21
+	OIDInt4        = 23
+	OIDText        = 25
+	OIDFloat4      = 700
+	OIDFloat8      = 701
+	OIDVarchar     = 1043
+	OIDNumeric     = 1700
+	OIDJSONB       = 3802
+	OIDVector      = storage.VectorTypeOID
 )
@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// UnixSocketPath returns the path of the socket for port in dir, named as
+// PostgreSQL names it so clients find it from the host directory and port
+func UnixSocketPath(dir string, port int) string {
+	return filepath.Join(dir, fmt.Sprintf(".s.PGSQL.%d", port))
+}
+
+// ListenUnix creates the Unix-domain socket for port in dir. A socket file
+// left behind by a server that is no longer running is replaced.
+func ListenUnix(dir string, port int) (net.Listener, error) {
+	path := UnixSocketPath(dir, port)
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not bind Unix socket %q: another server is listening on it", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not remove stale Unix socket %q: %w", path, err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Access is controlled by pg_hba.conf, like PostgreSQL's default
+	// unix_socket_permissions of 0777
+	if err := os.Chmod(path, 0777); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// isLocal reports whether the client connected over a Unix-domain socket
+func (h *Handler) isLocal() bool {
+	_, ok := h.conn.(*net.UnixConn)
+	return ok
+}
+
+// authenticatePeer checks that the OS user of the client process has the
+// name of the requested role
+func (h *Handler) authenticatePeer(role *storage.Role) error {
+	unixConn, ok := h.conn.(*net.UnixConn)
+	if !ok {
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "peer authentication is only supported on local sockets")
+	}
+	uid, err := peerUID(unixConn)
+	if err != nil {
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "could not get peer credentials: %v", err)
+	}
+	osUser, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "could not look up local user ID %d: %v", uid, err)
+	}
+
+	if osUser.Username != role.Name {
+		h.db.Logger.Info("Provided user name (%s) and authenticated user name (%s) do not match", role.Name, osUser.Username)
+		return util.NewSQLError(util.SQLStateInvalidAuthorization, "Peer authentication failed for user \"%s\"", role.Name)
+	}
+	return h.sendAuthenticationOk()
+}
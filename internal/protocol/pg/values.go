@@ -0,0 +1,287 @@
+package pg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// dataTypeOID maps a GhostSQL column type to its PostgreSQL type OID
+func dataTypeOID(t storage.DataType) uint32 {
+	switch t {
+	case storage.TypeInt:
+		return OIDInt4
+	case storage.TypeBigInt:
+		return OIDInt8
+	case storage.TypeFloat:
+		return OIDFloat8
+	case storage.TypeBoolean:
+		return OIDBool
+	case storage.TypeVarChar:
+		return OIDVarchar
+	case storage.TypeJSONB:
+		return OIDJSONB
+	case storage.TypeVector:
+		return OIDVector
+	default:
+		return OIDText
+	}
+}
+
+// columnTypeAt returns the type of the i-th result column, defaulting to text
+func columnTypeAt(result *executor.Result, i int) executor.ColumnType {
+	if i < len(result.ColumnTypes) {
+		return result.ColumnTypes[i]
+	}
+	return executor.ColumnType{Type: storage.TypeText}
+}
+
+// columnTypeInfo returns the type OID, type size and type modifier advertised
+// for a result column in RowDescription
+func columnTypeInfo(ct executor.ColumnType) (uint32, int16, int32) {
+	oid := dataTypeOID(ct.Type)
+	typmod := int32(-1)
+
+	switch ct.Type {
+	case storage.TypeVarChar:
+		if ct.Length > 0 {
+			typmod = int32(ct.Length) + 4 // VARHDRSZ is included in varchar typmods
+		}
+	case storage.TypeVector:
+		if ct.Length > 0 {
+			typmod = int32(ct.Length) // pgvector stores the dimensions as is
+		}
+	}
+
+	size := int16(-1) // Variable length
+	if ct.Type.IsFixedSize() {
+		size = int16(ct.Type.FixedSize())
+	}
+	return oid, size, typmod
+}
+
+// formatTextValue renders a value in the PostgreSQL text output format of
+// the column's type
+func formatTextValue(val interface{}, ct executor.ColumnType) string {
+	switch ct.Type {
+	case storage.TypeInt, storage.TypeBigInt:
+		if f, ok := val.(float64); ok && f == math.Trunc(f) {
+			return strconv.FormatInt(int64(f), 10)
+		}
+	case storage.TypeFloat:
+		if f, err := storage.ConvertToFloat64(val); err == nil {
+			return formatFloat(f, 64)
+		}
+	case storage.TypeBoolean:
+		b, ok := val.(bool)
+		if s, isString := val.(string); isString {
+			b, ok = storage.ParseBool(s)
+		}
+		if ok {
+			if b {
+				return "t"
+			}
+			return "f"
+		}
+	case storage.TypeJSONB:
+		switch v := val.(type) {
+		case map[string]interface{}, []interface{}:
+			if data, err := json.Marshal(v); err == nil {
+				return string(data)
+			}
+		}
+	}
+
+	if vec, ok := val.(*storage.Vector); ok {
+		return formatVector(vec)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// formatFloat renders a float the way PostgreSQL does with extra_float_digits = 1
+func formatFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+// formatVector renders a vector in pgvector's text format: [1,2,3]
+func formatVector(vec *storage.Vector) string {
+	parts := make([]string, len(vec.Values))
+	for i, v := range vec.Values {
+		parts[i] = formatFloat(float64(v), 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// encodeBinaryValue renders a value in the PostgreSQL binary format of the
+// column's type
+func encodeBinaryValue(val interface{}, ct executor.ColumnType) ([]byte, error) {
+	switch ct.Type {
+	case storage.TypeInt:
+		n, err := integerValue(val)
+		if err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("cannot encode %v as int4", val)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(n))), nil
+
+	case storage.TypeBigInt:
+		n, err := integerValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %v as int8", val)
+		}
+		return binary.BigEndian.AppendUint64(nil, uint64(n)), nil
+
+	case storage.TypeFloat:
+		f, err := storage.ConvertToFloat64(val)
+		if s, isString := val.(string); isString {
+			f, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %v as float8", val)
+		}
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(f)), nil
+
+	case storage.TypeBoolean:
+		b, ok := val.(bool)
+		if s, isString := val.(string); isString {
+			b, ok = storage.ParseBool(s)
+		}
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as bool", val)
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+
+	case storage.TypeJSONB:
+		// jsonb binary format: a version byte followed by the JSON text
+		return append([]byte{1}, formatTextValue(val, ct)...), nil
+
+	case storage.TypeVector:
+		vec, ok := val.(*storage.Vector)
+		if s, isString := val.(string); isString {
+			parsed, err := storage.ParseVector(s)
+			if err != nil {
+				return nil, err
+			}
+			vec, ok = parsed, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %v as vector", val)
+		}
+		return encodeVector(vec), nil
+
+	default:
+		return []byte(formatTextValue(val, ct)), nil
+	}
+}
+
+// encodeVector renders a vector in pgvector's binary format: int16
+// dimensions, int16 unused, then one big-endian float4 per dimension
+func encodeVector(vec *storage.Vector) []byte {
+	buf := make([]byte, 0, 4+4*len(vec.Values))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(vec.Values)))
+	buf = binary.BigEndian.AppendUint16(buf, 0)
+	for _, v := range vec.Values {
+		buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeBinaryParam parses a binary-format Bind parameter according to its type
+func decodeBinaryParam(oid uint32, raw []byte) (interface{}, error) {
+	switch oid {
+	case OIDInt2:
+		if len(raw) != 2 {
+			return nil, fmt.Errorf("incorrect binary data format for type smallint")
+		}
+		return int64(int16(binary.BigEndian.Uint16(raw))), nil
+	case OIDInt4:
+		if len(raw) != 4 {
+			return nil, fmt.Errorf("incorrect binary data format for type integer")
+		}
+		return int64(int32(binary.BigEndian.Uint32(raw))), nil
+	case OIDInt8:
+		if len(raw) != 8 {
+			return nil, fmt.Errorf("incorrect binary data format for type bigint")
+		}
+		return int64(binary.BigEndian.Uint64(raw)), nil
+	case OIDFloat4:
+		if len(raw) != 4 {
+			return nil, fmt.Errorf("incorrect binary data format for type real")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), nil
+	case OIDFloat8:
+		if len(raw) != 8 {
+			return nil, fmt.Errorf("incorrect binary data format for type double precision")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), nil
+	case OIDBool:
+		if len(raw) != 1 {
+			return nil, fmt.Errorf("incorrect binary data format for type boolean")
+		}
+		return raw[0] != 0, nil
+	case OIDJSONB:
+		if len(raw) < 1 || raw[0] != 1 {
+			return nil, fmt.Errorf("unsupported jsonb version number")
+		}
+		return string(raw[1:]), nil
+	case OIDVector:
+		return decodeVector(raw)
+	case OIDText, OIDVarchar, OIDUnspecified:
+		return string(raw), nil
+	default:
+		return nil, fmt.Errorf("binary format is not supported for type OID %d", oid)
+	}
+}
+
+// decodeVector parses pgvector's binary format
+func decodeVector(raw []byte) (*storage.Vector, error) {
+	if len(raw) < 4 {
+		return nil, fmt.Errorf("incorrect binary data format for type vector")
+	}
+	dim := int(binary.BigEndian.Uint16(raw))
+	if len(raw) != 4+4*dim {
+		return nil, fmt.Errorf("incorrect binary data format for type vector")
+	}
+	values := make([]float32, dim)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.BigEndian.Uint32(raw[4+4*i:]))
+	}
+	return storage.NewVector(values), nil
+}
+
+// integerValue converts a stored value to an int64 for binary encoding
+func integerValue(val interface{}) (int64, error) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	}
+	return 0, fmt.Errorf("not an integer: %v", val)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// Session states shown in pg_stat_activity
+const (
+	StateActive                   = "active"
+	StateIdle                     = "idle"
+	StateIdleInTransaction        = "idle in transaction"
+	StateIdleInTransactionAborted = "idle in transaction (aborted)"
+)
+
+// SessionActivity describes what a session is doing. State is empty until
+// the session has finished its startup.
+type SessionActivity struct {
+	State       string
+	Query       string // The running query, or the last one when idle
+	QueryStart  time.Time
+	StateChange time.Time
+}
+
+// SetClientAddr records the address the session's client connected from.
+// Unix-domain socket connections have no client address.
+func (s *Session) SetClientAddr(addr net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		s.ClientAddr = tcp.IP.String()
+		s.ClientPort = tcp.Port
+	} else {
+		s.ClientAddr = ""
+		s.ClientPort = -1
+	}
+}
+
+// StartQuery marks the session active running query
+func (s *Session) StartQuery(query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.activity.State = StateActive
+	s.activity.Query = query
+	s.activity.QueryStart = now
+	s.activity.StateChange = now
+}
+
+// SetIdle marks the session as waiting for the client, inside or outside a
+// transaction block
+func (s *Session) SetIdle() {
+	state := StateIdle
+	switch s.TransactionStatus() {
+	case 'T':
+		state = StateIdleInTransaction
+	case 'E':
+		state = StateIdleInTransactionAborted
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activity.State != state {
+		s.activity.State = state
+		s.activity.StateChange = time.Now()
+	}
+}
+
+// Activity returns a snapshot of the session's activity
+func (s *Session) Activity() SessionActivity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.activity
+}
+
+// Sessions returns the open sessions ordered by process ID
+func (sm *SessionManager) Sessions() []*Session {
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		sessions = append(sessions, s)
+	}
+	sm.mu.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ProcessID < sessions[j].ProcessID
+	})
+	return sessions
+}
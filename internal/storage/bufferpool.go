@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxUsageCount caps how many sweeps of the clock a page survives unused
+const maxUsageCount = 5
+
+// minBufferPoolSize is the smallest number of buffers shared_buffers allows
+const minBufferPoolSize = 16
+
+// bufferTag identifies a page in the buffer pool
+type bufferTag struct {
+	pm     *PageManager
+	pageID uint64
+}
+
+// bufferFrame is a slot of the buffer pool
+type bufferFrame struct {
+	tag   bufferTag
+	page  *Page // nil when the frame is free
+	usage int
+}
+
+// BufferPoolStats counts the activity of the buffer pool
+type BufferPoolStats struct {
+	Buffers   int   // Frames in the pool
+	Used      int   // Frames holding a page
+	Dirty     int   // Pages changed since they were read or written
+	Hits      int64 // Page requests served from the pool
+	Reads     int64 // Pages read from disk
+	Writes    int64 // Dirty pages written back to make room
+	Evictions int64
+}
+
+// BufferPool caches table pages in a fixed number of frames shared by all
+// tables. Committed changes are stored in the pool as dirty pages. When the
+// pool is full, a clock sweep picks an unpinned page that has not been used
+// recently to evict, and a dirty page is written back to its table file
+// first; the WAL already holds it, so the write needs no sync.
+type BufferPool struct {
+	mu     sync.Mutex
+	frames []bufferFrame
+	lookup map[bufferTag]int
+	hand   int
+	stats  BufferPoolStats
+}
+
+// NewBufferPool creates a buffer pool of size pages
+func NewBufferPool(size int) *BufferPool {
+	if size < minBufferPoolSize {
+		size = minBufferPoolSize
+	}
+	return &BufferPool{
+		frames: make([]bufferFrame, size),
+		lookup: make(map[bufferTag]int),
+	}
+}
+
+// Stats returns the current counters of the pool
+func (bp *BufferPool) Stats() BufferPoolStats {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	stats := bp.stats
+	stats.Buffers = len(bp.frames)
+	for _, f := range bp.frames {
+		if f.page != nil {
+			stats.Used++
+			f.page.mu.RLock()
+			if f.page.Dirty {
+				stats.Dirty++
+			}
+			f.page.mu.RUnlock()
+		}
+	}
+	return stats
+}
+
+// fetch returns a page of pm pinned, reading it into the pool if needed
+func (bp *BufferPool) fetch(pm *PageManager, pageID uint64) (*Page, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	tag := bufferTag{pm, pageID}
+	if i, ok := bp.lookup[tag]; ok {
+		f := &bp.frames[i]
+		if f.usage < maxUsageCount {
+			f.usage++
+		}
+		f.page.Pin()
+		bp.stats.Hits++
+		return f.page, nil
+	}
+
+	i, err := bp.victim()
+	if err != nil {
+		return nil, err
+	}
+	page := NewPage(pageID, PageTypeData)
+	if err := pm.readFromDisk(page); err != nil {
+		return nil, err
+	}
+	bp.stats.Reads++
+	bp.install(i, tag, page)
+	page.Pin()
+	return page, nil
+}
+
+// store puts a new version of a page in the pool, marked dirty
+func (bp *BufferPool) store(pm *PageManager, pageID uint64, data *[PageSize]byte) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	tag := bufferTag{pm, pageID}
+	if i, ok := bp.lookup[tag]; ok {
+		page := bp.frames[i].page
+		page.mu.Lock()
+		page.Data = *data
+		page.Dirty = true
+		page.mu.Unlock()
+		return nil
+	}
+
+	i, err := bp.victim()
+	if err != nil {
+		return err
+	}
+	page := NewPage(pageID, PageTypeData)
+	page.Data = *data
+	page.Dirty = true
+	bp.install(i, tag, page)
+	return nil
+}
+
+// install puts page in frame i. The caller holds bp.mu.
+func (bp *BufferPool) install(i int, tag bufferTag, page *Page) {
+	bp.frames[i] = bufferFrame{tag: tag, page: page, usage: 1}
+	bp.lookup[tag] = i
+}
+
+// victim returns a free frame, evicting a page if there is none. The caller
+// holds bp.mu.
+func (bp *BufferPool) victim() (int, error) {
+	// Every page is pinned or used within maxUsageCount+1 full sweeps
+	for n := 0; n < (maxUsageCount+1)*len(bp.frames); n++ {
+		i := bp.hand
+		bp.hand = (bp.hand + 1) % len(bp.frames)
+		f := &bp.frames[i]
+		if f.page == nil {
+			return i, nil
+		}
+
+		f.page.mu.RLock()
+		pinned, dirty := f.page.PinCount > 0, f.page.Dirty
+		f.page.mu.RUnlock()
+		if pinned {
+			continue
+		}
+		if f.usage > 0 {
+			f.usage--
+			continue
+		}
+
+		if dirty {
+			if err := f.tag.pm.WritePage(f.page); err != nil {
+				return 0, err
+			}
+			bp.stats.Writes++
+		}
+		delete(bp.lookup, f.tag)
+		*f = bufferFrame{}
+		bp.stats.Evictions++
+		return i, nil
+	}
+	return 0, fmt.Errorf("no unpinned buffers available")
+}
+
+// drop removes the pages of pm from pageID on without writing them, for
+// pages that were truncated away or a table that was dropped
+func (bp *BufferPool) drop(pm *PageManager, pageID uint64) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for tag, i := range bp.lookup {
+		if tag.pm == pm && tag.pageID >= pageID {
+			delete(bp.lookup, tag)
+			bp.frames[i] = bufferFrame{}
+		}
+	}
+}
+
+// flush writes the dirty pages of pm, or of every table if pm is nil
+func (bp *BufferPool) flush(pm *PageManager) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for _, f := range bp.frames {
+		if f.page == nil || (pm != nil && f.tag.pm != pm) {
+			continue
+		}
+		f.page.mu.RLock()
+		dirty := f.page.Dirty
+		f.page.mu.RUnlock()
+		if dirty {
+			if err := f.tag.pm.WritePage(f.page); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markClean marks every page clean once a checkpoint has written the
+// logged pages to the table files
+func (bp *BufferPool) markClean() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for _, f := range bp.frames {
+		if f.page != nil {
+			f.page.mu.Lock()
+			f.page.Dirty = false
+			f.page.mu.Unlock()
+		}
+	}
+}
@@ -2,6 +2,10 @@ package storage
 
 import (
 	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+	"time"
 )
 
 // CatalogProvider provides virtualized system tables for pg_catalog
@@ -38,8 +42,8 @@ func (cp *CatalogProvider) GetPGClassRows(dbInstance *DatabaseInstance) []Row {
 			"relam":         int64(0),
 			"relfilenode":   int64(0),
 			"reltablespace": int64(0),
-			"relpages":      int32(0),
-			"reltuples":     float32(len(table.Rows)),
+			"relpages":      int32(table.NumPages()),
+			"reltuples":     float32(table.TupleCount()),
 			"relallvisible": int32(0),
 			"reltoastrelid": int64(0),
 			"relhasindex":   false,
@@ -86,7 +90,7 @@ func (cp *CatalogProvider) GetPGAttributeRows(dbInstance *DatabaseInstance) []Ro
 				"attlen":    int16(col.Length),
 				"attnum":    int16(i + 1),
 				"attndims":  int32(0),
-				"atttypmod": int32(-1),
+				"atttypmod": attTypMod(col),
 				"attnotnull": !col.Nullable,
 				"atthasdef":  false,
 				"attisdropped": false,
@@ -119,12 +123,20 @@ func (cp *CatalogProvider) GetPGAuthIDRows() []Row {
 			"rolbypassrls":    role.BypassRLS,
 			"rolconnlimit":    int32(role.ConnLimit),
 			"rolpassword":     role.PasswordHash,
-			"rolvaliduntil":   role.ValidUntil.Format("2006-01-02 15:04:05"),
+			"rolvaliduntil":   formatValidUntil(role.ValidUntil),
 		})
 	}
 	return rows
 }
 
+// formatValidUntil formats a role's VALID UNTIL time, NULL if it never expires
+func formatValidUntil(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02 15:04:05-07")
+}
+
 // GetPGRolesRows returns rows for pg_catalog.pg_roles (sanitized pg_authid)
 func (cp *CatalogProvider) GetPGRolesRows() []Row {
 	rows := cp.GetPGAuthIDRows()
@@ -155,23 +167,214 @@ func (cp *CatalogProvider) GetPGRolesColumns() []Column {
 	return cp.GetPGAuthIDColumns()
 }
 
+// GetPGHBAFileRulesRows returns rows for pg_catalog.pg_hba_file_rules. The
+// file is read again, so the rows show what the next reload would load.
+func (cp *CatalogProvider) GetPGHBAFileRulesRows() []Row {
+	rows := make([]Row, 0)
+	config, err := LoadHBAConfig(cp.db.HBAFilePath())
+	if err != nil {
+		return append(rows, Row{"error": err.Error()})
+	}
+
+	for _, rule := range config.Rules {
+		row := Row{
+			"type":        rule.Type,
+			"database":    formatHBATokens(rule.Databases),
+			"user_name":   formatHBATokens(rule.Users),
+			"auth_method": string(rule.Method),
+		}
+		if rule.LineNumber > 0 {
+			row["line_number"] = int32(rule.LineNumber)
+		}
+		if rule.Address != nil {
+			row["address"] = rule.Address.IP.String()
+			row["netmask"] = net.IP(rule.Address.Mask).String()
+		} else if rule.Host != "" {
+			row["address"] = rule.Host
+		}
+		if len(rule.Options) > 0 {
+			row["options"] = strings.Join(rule.FormatOptions(), ",")
+		}
+		rows = append(rows, row)
+	}
+	for _, lineErr := range config.Errors {
+		rows = append(rows, Row{
+			"line_number": int32(lineErr.LineNumber),
+			"error":       lineErr.Message,
+		})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, _ := rows[i]["line_number"].(int32)
+		b, _ := rows[j]["line_number"].(int32)
+		return a < b
+	})
+	return rows
+}
+
+// formatHBATokens renders a pg_hba.conf list as it was written
+func formatHBATokens(tokens []HBAToken) string {
+	values := make([]string, len(tokens))
+	for i, t := range tokens {
+		values[i] = t.String()
+	}
+	return strings.Join(values, ",")
+}
+
+func (cp *CatalogProvider) GetPGHBAFileRulesColumns() []Column {
+	return []Column{
+		{Name: "line_number", Type: TypeInt},
+		{Name: "type", Type: TypeText},
+		{Name: "database", Type: TypeText},
+		{Name: "user_name", Type: TypeText},
+		{Name: "address", Type: TypeText},
+		{Name: "netmask", Type: TypeText},
+		{Name: "auth_method", Type: TypeText},
+		{Name: "options", Type: TypeText},
+		{Name: "error", Type: TypeText},
+	}
+}
+
+// formatTimestamp formats a timestamptz value, NULL for the zero time
+func formatTimestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02 15:04:05.999999-07")
+}
+
+// GetPGStatActivityRows returns one row of pg_catalog.pg_stat_activity per
+// open session
+func (cp *CatalogProvider) GetPGStatActivityRows() []Row {
+	rows := make([]Row, 0)
+	for _, s := range cp.db.SessionMgr.Sessions() {
+		s.mu.RLock()
+		row := Row{
+			"datname":          s.CurrentDatabase,
+			"pid":              s.ProcessID,
+			"application_name": s.Variables["application_name"],
+			"client_port":      int32(s.ClientPort),
+			"backend_start":    formatTimestamp(s.BackendStart),
+			"query_start":      formatTimestamp(s.activity.QueryStart),
+			"state_change":     formatTimestamp(s.activity.StateChange),
+			"query":            s.activity.Query,
+		}
+		if s.SessionUser != "" {
+			row["usename"] = s.SessionUser
+		}
+		if s.ClientAddr != "" {
+			row["client_addr"] = s.ClientAddr
+		}
+		if s.activity.State != "" {
+			row["state"] = s.activity.State
+		}
+		s.mu.RUnlock()
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (cp *CatalogProvider) GetPGStatActivityColumns() []Column {
+	return []Column{
+		{Name: "datname", Type: TypeText},
+		{Name: "pid", Type: TypeInt},
+		{Name: "usename", Type: TypeText},
+		{Name: "application_name", Type: TypeText},
+		{Name: "client_addr", Type: TypeText},
+		{Name: "client_port", Type: TypeInt},
+		{Name: "backend_start", Type: TypeText},
+		{Name: "query_start", Type: TypeText},
+		{Name: "state_change", Type: TypeText},
+		{Name: "state", Type: TypeText},
+		{Name: "query", Type: TypeText},
+	}
+}
+
+// GetPGStatUserTablesRows returns one row of pg_catalog.pg_stat_user_tables
+// per table of the database
+func (cp *CatalogProvider) GetPGStatUserTablesRows(dbInstance *DatabaseInstance) []Row {
+	dbInstance.mu.RLock()
+	names := make([]string, 0, len(dbInstance.Tables))
+	tables := make(map[string]*Table, len(dbInstance.Tables))
+	for name, table := range dbInstance.Tables {
+		names = append(names, name)
+		tables[name] = table
+	}
+	dbInstance.mu.RUnlock()
+	sort.Strings(names)
+
+	rows := make([]Row, 0, len(names))
+	for _, name := range names {
+		activity, err := tables[name].activity()
+		if err != nil {
+			cp.db.Logger.Error("Failed to read statistics of %s: %v", name, err)
+			continue
+		}
+		rows = append(rows, Row{
+			"relid":        cp.GenerateOID(name),
+			"schemaname":   "public",
+			"relname":      name,
+			"n_tup_ins":    activity.Inserted,
+			"n_tup_upd":    activity.Updated,
+			"n_tup_del":    activity.Deleted,
+			"n_live_tup":   int64(activity.LiveTuples),
+			"n_dead_tup":   int64(activity.DeadTuples),
+			"last_vacuum":  formatTimestamp(activity.LastVacuum),
+			"vacuum_count": activity.VacuumCount,
+		})
+	}
+	return rows
+}
+
+func (cp *CatalogProvider) GetPGStatUserTablesColumns() []Column {
+	return []Column{
+		{Name: "relid", Type: TypeInt},
+		{Name: "schemaname", Type: TypeText},
+		{Name: "relname", Type: TypeText},
+		{Name: "n_tup_ins", Type: TypeBigInt},
+		{Name: "n_tup_upd", Type: TypeBigInt},
+		{Name: "n_tup_del", Type: TypeBigInt},
+		{Name: "n_live_tup", Type: TypeBigInt},
+		{Name: "n_dead_tup", Type: TypeBigInt},
+		{Name: "last_vacuum", Type: TypeText},
+		{Name: "vacuum_count", Type: TypeBigInt},
+	}
+}
+
 func (cp *CatalogProvider) mapTypeToOID(t DataType) int64 {
 	switch t {
 	case TypeInt:
 		return 23 // int4
+	case TypeBigInt:
+		return 20 // int8
 	case TypeText:
 		return 25 // text
 	case TypeVarChar:
 		return 1043 // varchar
+	case TypeFloat:
+		return 701 // float8
 	case TypeBoolean:
 		return 16 // bool
+	case TypeJSONB:
+		return 3802 // jsonb
 	case TypeVector:
-		return 25 // Map to text for now for compatibility
+		return VectorTypeOID
 	default:
 		return 25 // Default to text
 	}
 }
 
+// attTypMod returns the type modifier of a column as stored in pg_attribute
+func attTypMod(col Column) int32 {
+	switch {
+	case col.Type == TypeVarChar && col.Length > 0:
+		return int32(col.Length) + 4
+	case col.Type == TypeVector && col.Length > 0:
+		return int32(col.Length)
+	}
+	return -1
+}
+
 func (cp *CatalogProvider) GetPGClassColumns() []Column {
 	return []Column{
 		{Name: "oid", Type: TypeInt},
@@ -234,12 +437,21 @@ func (cp *CatalogProvider) GetPGAttrDefColumns() []Column {
 	}
 }
 
+// VectorTypeOID is the OID under which the VECTOR type is registered in
+// pg_type, the first OID available to user-defined types (as with pgvector)
+const VectorTypeOID = 16385
+
 // GetPGTypeRows returns rows for pg_catalog.pg_type
 func (cp *CatalogProvider) GetPGTypeRows() []Row {
 	return []Row{
+		{"oid": int64(16), "typname": "bool", "typlen": int16(1), "typnamespace": cp.GenerateOID("pg_catalog")},
+		{"oid": int64(20), "typname": "int8", "typlen": int16(8), "typnamespace": cp.GenerateOID("pg_catalog")},
 		{"oid": int64(23), "typname": "int4", "typlen": int16(4), "typnamespace": cp.GenerateOID("pg_catalog")},
 		{"oid": int64(25), "typname": "text", "typlen": int16(-1), "typnamespace": cp.GenerateOID("pg_catalog")},
+		{"oid": int64(701), "typname": "float8", "typlen": int16(8), "typnamespace": cp.GenerateOID("pg_catalog")},
 		{"oid": int64(1043), "typname": "varchar", "typlen": int16(-1), "typnamespace": cp.GenerateOID("pg_catalog")},
+		{"oid": int64(3802), "typname": "jsonb", "typlen": int16(-1), "typnamespace": cp.GenerateOID("pg_catalog")},
+		{"oid": int64(VectorTypeOID), "typname": "vector", "typlen": int16(-1), "typnamespace": cp.GenerateOID("public")},
 	}
 }
 
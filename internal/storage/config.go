@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// ConfigFileName is the server configuration file in the data directory
+const ConfigFileName = "postgresql.conf"
+
+// LoadFile applies the settings of a postgresql.conf style file: one
+// "name = value" per line, with '#' comments and optionally quoted values.
+// A missing file leaves the defaults in place.
+func (c *DatabaseConfig) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 && !strings.Contains(line[:idx], "'") {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			// "name value" is accepted as well
+			name, value, ok = strings.Cut(line, " ")
+		}
+		if !ok {
+			return fmt.Errorf("%s:%d: syntax error", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+		if err := c.Set(strings.TrimSpace(name), value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Set changes a server setting by its PostgreSQL name
+func (c *DatabaseConfig) Set(name, value string) error {
+	switch strings.ToLower(name) {
+	case "ssl":
+		b, ok := ParseBool(value)
+		if !ok {
+			return fmt.Errorf("parameter \"ssl\" requires a Boolean value")
+		}
+		c.SSL = b
+	case "ssl_cert_file":
+		c.SSLCertFile = value
+	case "ssl_key_file":
+		c.SSLKeyFile = value
+	case "ssl_ca_file":
+		c.SSLCAFile = value
+	case "unix_socket_directories":
+		c.UnixSocketDirectories = value
+	case "max_connections":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid value for parameter \"max_connections\": \"%s\"", value)
+		}
+		c.MaxConnections = n
+	case "superuser_reserved_connections":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for parameter \"superuser_reserved_connections\": \"%s\"", value)
+		}
+		c.SuperuserReservedConnections = n
+	case "shutdown_timeout":
+		d, err := ParseTimeout(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for parameter \"shutdown_timeout\": \"%s\"", value)
+		}
+		c.ShutdownTimeout = d
+	case "max_wal_size":
+		n, err := parseSize(value)
+		if err != nil || n < 1<<20 {
+			return fmt.Errorf("invalid value for parameter \"max_wal_size\": \"%s\"", value)
+		}
+		c.MaxWALSize = n
+	case "shared_buffers":
+		n, err := parseSize(value)
+		if err != nil || n < minBufferPoolSize*PageSize {
+			return fmt.Errorf("invalid value for parameter \"shared_buffers\": \"%s\"", value)
+		}
+		c.SharedBuffers = n
+	default:
+		return util.NewSQLError(util.SQLStateUndefinedObject, "unrecognized configuration parameter \"%s\"", name)
+	}
+	return nil
+}
+
+// Setting returns the current value of a server setting as shown by SHOW
+func (c *DatabaseConfig) Setting(name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case "ssl":
+		return formatOnOff(c.SSL), true
+	case "ssl_cert_file":
+		return c.SSLCertFile, true
+	case "ssl_key_file":
+		return c.SSLKeyFile, true
+	case "ssl_ca_file":
+		return c.SSLCAFile, true
+	case "unix_socket_directories":
+		return c.UnixSocketDirectories, true
+	case "max_connections":
+		return strconv.Itoa(c.MaxConnections), true
+	case "superuser_reserved_connections":
+		return strconv.Itoa(c.SuperuserReservedConnections), true
+	case "shutdown_timeout":
+		return FormatTimeout(c.ShutdownTimeout), true
+	case "max_wal_size":
+		return formatSize(c.MaxWALSize), true
+	case "shared_buffers":
+		return formatSize(c.SharedBuffers), true
+	}
+	return "", false
+}
+
+// SocketDirectories returns the directories listed in unix_socket_directories
+func (c *DatabaseConfig) SocketDirectories() []string {
+	var dirs []string
+	for _, dir := range strings.Split(c.UnixSocketDirectories, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// sizeUnits are the units accepted in memory and disk sizes, as in
+// PostgreSQL
+var sizeUnits = []struct {
+	name string
+	size int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"kB", 1 << 10},
+}
+
+// parseSize parses a size such as '64MB' or '1GB' into bytes. Values
+// without a unit are in megabytes.
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimRightFunc(value, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	unit := int64(1 << 20)
+	if suffix := strings.TrimSpace(value[len(number):]); suffix != "" {
+		found := false
+		for _, u := range sizeUnits {
+			if suffix == u.name {
+				unit, found = u.size, true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid unit %q", suffix)
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * unit, nil
+}
+
+// formatSize formats a size in the largest unit that represents it exactly
+func formatSize(n int64) string {
+	for _, u := range sizeUnits {
+		if n != 0 && n%u.size == 0 {
+			return fmt.Sprintf("%d%s", n/u.size, u.name)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+func formatOnOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
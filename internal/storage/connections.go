@@ -0,0 +1,38 @@
+package storage
+
+import "github.com/ghosecorp/ghostsql/internal/util"
+
+// Admit counts the session's login as user against the connection limits.
+// role is nil for a user that has no role, which pg_hba.conf can trust.
+// Superusers may use the slots kept by superuser_reserved_connections and
+// are not subject to their CONNECTION LIMIT. The count is released when the
+// session is closed.
+func (sm *SessionManager) Admit(s *Session, user string, role *Role, config *DatabaseConfig) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	total, forUser := 0, 0
+	for _, other := range sm.sessions {
+		if other.admittedUser == "" {
+			continue
+		}
+		total++
+		if other.admittedUser == user {
+			forUser++
+		}
+	}
+
+	superuser := role != nil && role.IsSuperuser
+	if total >= config.MaxConnections {
+		return util.NewSQLError(util.SQLStateTooManyConnections, "sorry, too many clients already")
+	}
+	if !superuser && total >= config.MaxConnections-config.SuperuserReservedConnections {
+		return util.NewSQLError(util.SQLStateTooManyConnections, "remaining connection slots are reserved for roles with the SUPERUSER attribute")
+	}
+	if !superuser && role != nil && role.ConnLimit >= 0 && forUser >= role.ConnLimit {
+		return util.NewSQLError(util.SQLStateTooManyConnections, "too many connections for role \"%s\"", user)
+	}
+
+	s.admittedUser = user
+	return nil
+}
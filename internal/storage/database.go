@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ghosecorp/ghostsql/internal/metadata"
 	"github.com/ghosecorp/ghostsql/internal/util"
@@ -20,9 +23,12 @@ type DatabaseInstance struct {
 	Name       string
 	Tables     map[string]*Table
 	TableLocks map[string]string // maps tableName -> sessionID
+	WriteLocks map[string]string // maps tableName -> sessionID changing it
 	BasePath   string
 	mu         sync.RWMutex
 	db         *Database
+	released   chan struct{}     // Closed and replaced whenever a lock is released
+	waits      map[string]string // maps sessionID -> session whose write lock it waits for
 }
 
 // GetTable retrieves a table by name safely, including virtual system tables
@@ -30,39 +36,51 @@ func (di *DatabaseInstance) GetTable(name string) (*Table, bool) {
 	// Handle pg_catalog virtualization
 	if name == "pg_class" || name == "pg_catalog.pg_class" {
 		rows := di.db.Catalog.GetPGClassRows(di)
-		return &Table{Name: "pg_class", Rows: rows, Columns: di.db.Catalog.GetPGClassColumns()}, true
+		return NewVirtualTable("pg_class", di.db.Catalog.GetPGClassColumns(), rows), true
 	}
 	if name == "pg_namespace" || name == "pg_catalog.pg_namespace" {
 		rows := di.db.Catalog.GetPGNamespaceRows()
-		return &Table{Name: "pg_namespace", Rows: rows, Columns: di.db.Catalog.GetPGNamespaceColumns()}, true
+		return NewVirtualTable("pg_namespace", di.db.Catalog.GetPGNamespaceColumns(), rows), true
 	}
 	if name == "pg_attribute" || name == "pg_catalog.pg_attribute" {
 		rows := di.db.Catalog.GetPGAttributeRows(di)
-		return &Table{Name: "pg_attribute", Rows: rows, Columns: di.db.Catalog.GetPGAttributeColumns()}, true
+		return NewVirtualTable("pg_attribute", di.db.Catalog.GetPGAttributeColumns(), rows), true
 	}
 	if name == "pg_attrdef" || name == "pg_catalog.pg_attrdef" {
 		rows := di.db.Catalog.GetPGAttrDefRows()
-		return &Table{Name: "pg_attrdef", Rows: rows, Columns: di.db.Catalog.GetPGAttrDefColumns()}, true
+		return NewVirtualTable("pg_attrdef", di.db.Catalog.GetPGAttrDefColumns(), rows), true
 	}
 	if name == "pg_type" || name == "pg_catalog.pg_type" {
 		rows := di.db.Catalog.GetPGTypeRows()
-		return &Table{Name: "pg_type", Rows: rows, Columns: di.db.Catalog.GetPGTypeColumns()}, true
+		return NewVirtualTable("pg_type", di.db.Catalog.GetPGTypeColumns(), rows), true
 	}
 	if name == "pg_collation" || name == "pg_catalog.pg_collation" {
 		rows := di.db.Catalog.GetPGCollationRows()
-		return &Table{Name: "pg_collation", Rows: rows, Columns: di.db.Catalog.GetPGCollationColumns()}, true
+		return NewVirtualTable("pg_collation", di.db.Catalog.GetPGCollationColumns(), rows), true
 	}
 	if name == "pg_constraint" || name == "pg_catalog.pg_constraint" {
 		rows := di.db.Catalog.GetPGConstraintRows()
-		return &Table{Name: "pg_constraint", Rows: rows, Columns: di.db.Catalog.GetPGConstraintColumns()}, true
+		return NewVirtualTable("pg_constraint", di.db.Catalog.GetPGConstraintColumns(), rows), true
 	}
 	if name == "pg_authid" || name == "pg_catalog.pg_authid" {
 		rows := di.db.Catalog.GetPGAuthIDRows()
-		return &Table{Name: "pg_authid", Rows: rows, Columns: di.db.Catalog.GetPGAuthIDColumns()}, true
+		return NewVirtualTable("pg_authid", di.db.Catalog.GetPGAuthIDColumns(), rows), true
 	}
 	if name == "pg_roles" || name == "pg_catalog.pg_roles" {
 		rows := di.db.Catalog.GetPGRolesRows()
-		return &Table{Name: "pg_roles", Rows: rows, Columns: di.db.Catalog.GetPGRolesColumns()}, true
+		return NewVirtualTable("pg_roles", di.db.Catalog.GetPGRolesColumns(), rows), true
+	}
+	if name == "pg_hba_file_rules" || name == "pg_catalog.pg_hba_file_rules" {
+		rows := di.db.Catalog.GetPGHBAFileRulesRows()
+		return NewVirtualTable("pg_hba_file_rules", di.db.Catalog.GetPGHBAFileRulesColumns(), rows), true
+	}
+	if name == "pg_stat_activity" || name == "pg_catalog.pg_stat_activity" {
+		rows := di.db.Catalog.GetPGStatActivityRows()
+		return NewVirtualTable("pg_stat_activity", di.db.Catalog.GetPGStatActivityColumns(), rows), true
+	}
+	if name == "pg_stat_user_tables" || name == "pg_catalog.pg_stat_user_tables" {
+		rows := di.db.Catalog.GetPGStatUserTablesRows(di)
+		return NewVirtualTable("pg_stat_user_tables", di.db.Catalog.GetPGStatUserTablesColumns(), rows), true
 	}
 
 	di.mu.RLock()
@@ -71,6 +89,18 @@ func (di *DatabaseInstance) GetTable(name string) (*Table, bool) {
 	return t, ok
 }
 
+// TableNames returns the names of the database's tables in order
+func (di *DatabaseInstance) TableNames() []string {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+	names := make([]string, 0, len(di.Tables))
+	for name := range di.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // SetTable adds or updates a table safely
 func (di *DatabaseInstance) SetTable(name string, table *Table) {
 	di.mu.Lock()
@@ -105,6 +135,7 @@ func (di *DatabaseInstance) ReleaseLock(table string) {
 	di.mu.Lock()
 	defer di.mu.Unlock()
 	delete(di.TableLocks, table)
+	di.signalRelease()
 }
 
 // ReleaseAllSessionLocks releases all locks owned by a session
@@ -116,6 +147,85 @@ func (di *DatabaseInstance) ReleaseAllSessionLocks(sessionID string) {
 			delete(di.TableLocks, k)
 		}
 	}
+	for k, v := range di.WriteLocks {
+		if v == sessionID {
+			delete(di.WriteLocks, k)
+		}
+	}
+	di.signalRelease()
+}
+
+// AcquireWriteLock takes the write lock of a table for a session. A table is
+// changed by one session at a time, so that a transaction's copy of the
+// table stays what it was when the transaction first changed it. If another
+// session holds the write lock or an explicit lock, the session is recorded
+// as waiting for it and its owner is returned; deadlock reports that the
+// owner is itself waiting, directly or not, for the session.
+func (di *DatabaseInstance) AcquireWriteLock(table, sessionID string) (owner string, acquired, deadlock bool) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+
+	owner, locked := di.TableLocks[table]
+	if !locked || owner == sessionID {
+		owner, locked = di.WriteLocks[table]
+	}
+	if !locked || owner == sessionID {
+		di.WriteLocks[table] = sessionID
+		delete(di.waits, sessionID)
+		return "", true, false
+	}
+
+	for waiter, seen := owner, 0; seen <= len(di.waits); seen++ {
+		next, waiting := di.waits[waiter]
+		if !waiting {
+			break
+		}
+		if next == sessionID {
+			delete(di.waits, sessionID)
+			return owner, false, true
+		}
+		waiter = next
+	}
+	di.waits[sessionID] = owner
+	return owner, false, false
+}
+
+// StopWaiting records that a session no longer waits for a write lock
+func (di *DatabaseInstance) StopWaiting(sessionID string) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	delete(di.waits, sessionID)
+}
+
+// ReleaseWriteLocks releases the write locks a session took outside a
+// transaction block once its statement is done
+func (di *DatabaseInstance) ReleaseWriteLocks(sessionID string) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	released := false
+	for k, v := range di.WriteLocks {
+		if v == sessionID {
+			delete(di.WriteLocks, k)
+			released = true
+		}
+	}
+	if released {
+		di.signalRelease()
+	}
+}
+
+// LockReleased returns a channel that is closed the next time a lock is
+// released, for sessions waiting on a lock
+func (di *DatabaseInstance) LockReleased() <-chan struct{} {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+	return di.released
+}
+
+// signalRelease wakes the sessions waiting on a lock. di.mu must be held.
+func (di *DatabaseInstance) signalRelease() {
+	close(di.released)
+	di.released = make(chan struct{})
 }
 
 // NewDatabaseInstance creates a new database instance
@@ -124,8 +234,11 @@ func NewDatabaseInstance(name string, basePath string, db *Database) *DatabaseIn
 		Name:       name,
 		Tables:     make(map[string]*Table),
 		TableLocks: make(map[string]string),
+		WriteLocks: make(map[string]string),
 		BasePath:   basePath,
 		db:         db,
+		released:   make(chan struct{}),
+		waits:      make(map[string]string),
 	}
 }
 
@@ -133,6 +246,30 @@ func NewDatabaseInstance(name string, basePath string, db *Database) *DatabaseIn
 type DatabaseConfig struct {
 	Username string
 	Password string
+
+	// TLS for client connections; relative file paths are resolved
+	// against the data directory
+	SSL         bool
+	SSLCertFile string
+	SSLKeyFile  string
+	SSLCAFile   string // CAs trusted for client certificates
+
+	// Comma-separated directories for Unix-domain sockets; empty disables them
+	UnixSocketDirectories string
+
+	// Limits on concurrent client connections; the reserved slots can only
+	// be used by superusers
+	MaxConnections               int
+	SuperuserReservedConnections int
+
+	// How long a fast shutdown waits for open transactions to finish
+	ShutdownTimeout time.Duration
+
+	// WAL size in bytes that triggers a checkpoint
+	MaxWALSize int64
+
+	// Memory in bytes for caching table pages; only read at startup
+	SharedBuffers int64
 }
 
 // Database represents the GhostSQL server managing multiple databases
@@ -147,6 +284,11 @@ type Database struct {
 	Catalog       *CatalogProvider
 	RoleStore     *RoleStore
 	Config        DatabaseConfig
+	hba           atomic.Pointer[HBAConfig] // Rules from pg_hba.conf, swapped on reload
+	shutdownMode  atomic.Int32              // ShutdownMode, set by RequestShutdown
+	statementMu   sync.RWMutex              // Held for reading by running statements
+	Buffers       *BufferPool               // Shared cache of table pages
+	wal           *WAL
 }
 
 // Initialize sets up the database with persistent storage
@@ -168,17 +310,42 @@ func Initialize(rootPath string) (*Database, error) {
 		SessionMgr: NewSessionManager(),
 		RoleStore:  NewRoleStore(dd.RootPath),
 		Config: DatabaseConfig{
-			Username: "ghost",
-			Password: "ghost",
+			Username:    "ghost",
+			Password:    "ghost",
+			SSLCertFile: "server.crt",
+			SSLKeyFile:  "server.key",
+
+			UnixSocketDirectories: "/tmp",
+
+			MaxConnections:               100,
+			SuperuserReservedConnections: 3,
+
+			ShutdownTimeout: 30 * time.Second,
+
+			MaxWALSize: 64 << 20,
+
+			SharedBuffers: 128 << 20,
 		},
 	}
 	db.Catalog = NewCatalogProvider(db)
 
+	// Load client authentication rules
+	if err := db.ReloadHBA(); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", HBAFileName, err)
+	}
+
 	// Acquire lock file
 	if err := db.acquireLock(); err != nil {
 		return nil, fmt.Errorf("failed to acquire lock: %w", err)
 	}
 
+	// Load server settings
+	if err := db.Config.LoadFile(filepath.Join(dd.RootPath, ConfigFileName)); err != nil {
+		logger.Error("Failed to load %s: %v", ConfigFileName, err)
+	}
+
+	db.Buffers = NewBufferPool(int(db.Config.SharedBuffers / PageSize))
+
 	// Load roles (cluster-wide)
 	if err := db.RoleStore.Load(); err != nil {
 		logger.Error("Failed to load roles: %v", err)
@@ -189,6 +356,7 @@ func Initialize(rootPath string) (*Database, error) {
 		logger.Info("Creating default superuser 'ghost'...")
 		ghost := &Role{
 			OID:           db.Catalog.GenerateOID("ghost"),
+			ConnLimit:     -1,
 			Name:          "ghost",
 			IsSuperuser:   true,
 			CanLogin:      true,
@@ -206,11 +374,17 @@ func Initialize(rootPath string) (*Database, error) {
 	// Ensure 'all' role exists
 	if _, exists := db.RoleStore.GetRole("all"); !exists {
 		allRole := &Role{
-			Name: "all",
+			Name:      "all",
+			ConnLimit: -1,
 		}
 		db.RoleStore.CreateRole(allRole)
 	}
 
+	// Bring the table files up to date with the committed transactions
+	if err := db.recoverWAL(); err != nil {
+		return nil, fmt.Errorf("failed to recover from WAL: %w", err)
+	}
+
 	// Load databases from disk
 	logger.Info("Loading databases from disk...")
 	if err := db.LoadAllDatabases(); err != nil {
@@ -236,7 +410,7 @@ func (db *Database) CreateDatabase(dbName string) error {
 	defer db.mu.Unlock()
 
 	if _, exists := db.Databases[dbName]; exists {
-		return fmt.Errorf("database %s already exists", dbName)
+		return util.NewSQLError(util.SQLStateDuplicateDatabase, "database %s already exists", dbName)
 	}
 
 	// Create database directory
@@ -273,7 +447,7 @@ func (db *Database) GetDatabaseInstance(dbName string) (*DatabaseInstance, error
 
 	dbInstance, exists := db.Databases[dbName]
 	if !exists {
-		return nil, fmt.Errorf("database %s does not exist", dbName)
+		return nil, util.NewSQLError(util.SQLStateInvalidCatalogName, "database %s does not exist", dbName)
 	}
 
 	return dbInstance, nil
@@ -299,11 +473,11 @@ func (db *Database) DropDatabase(dbName string) error {
 	db.mu.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("database %s does not exist", dbName)
+		return util.NewSQLError(util.SQLStateInvalidCatalogName, "database %s does not exist", dbName)
 	}
 
 	// Remove directory
-	if err := os.RemoveAll(dbInstance.BasePath); err != nil {
+	if err := db.removeDatabaseFiles(dbInstance); err != nil {
 		return fmt.Errorf("failed to remove database directory: %w", err)
 	}
 
@@ -369,6 +543,7 @@ func (db *Database) loadTablesForDatabase(dbInstance *DatabaseInstance) error {
 		}
 
 		dbInstance.Tables[tableName] = table
+		db.wal.track(dbInstance.Name, table)
 	}
 
 	db.Logger.Info("Loaded %d table(s) for database %s", len(dbInstance.Tables), dbInstance.Name)
@@ -381,12 +556,6 @@ func (db *Database) loadTableForDatabase(dbInstance *DatabaseInstance, tableName
 	return db.loadTableBinaryFromPath(tablePath, tableName)
 }
 
-// saveTableForDatabase saves a table for a specific database
-func (db *Database) saveTableForDatabase(dbInstance *DatabaseInstance, table *Table) error {
-	tablePath := filepath.Join(dbInstance.BasePath, "tables", table.Name+".tbl")
-	return db.saveTableBinaryToPath(table, tablePath)
-}
-
 // acquireLock creates a lock file
 func (db *Database) acquireLock() error {
 	lockFile, err := os.OpenFile(db.LockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
@@ -406,19 +575,26 @@ func (db *Database) acquireLock() error {
 	return nil
 }
 
-// Shutdown cleanly shuts down the database
+// Shutdown cleanly shuts down the database. It waits for running
+// statements to finish, so sessions should be drained first.
 func (db *Database) Shutdown() error {
 	db.Logger.Info("Shutting down database...")
+	db.statementMu.Lock()
+	defer db.statementMu.Unlock()
 
 	// Save all tables in all databases
-	db.Logger.Info("Saving all databases...")
-	for _, dbInstance := range db.Databases {
-		for _, table := range dbInstance.Tables {
-			if err := db.saveTableForDatabase(dbInstance, table); err != nil {
-				db.Logger.Error("Failed to save table %s: %v", table.Name, err)
-			}
+	if db.ShutdownMode() == ShutdownImmediate {
+		db.Logger.Info("Immediate shutdown, skipping the final checkpoint")
+	} else {
+		db.Logger.Info("Saving all databases...")
+		if err := db.SaveAllTables(); err != nil {
+			db.Logger.Error("Failed to save tables: %v", err)
+		}
+		if err := db.Checkpoint(); err != nil {
+			db.Logger.Error("Checkpoint failed: %v", err)
 		}
 	}
+	db.wal.close()
 
 	// Remove lock file
 	if err := os.Remove(db.LockFile); err != nil {
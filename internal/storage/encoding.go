@@ -3,8 +3,11 @@ package storage
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // EncodeRow encodes a row into binary format
@@ -15,6 +18,10 @@ func EncodeRow(columns []Column, row Row) ([]byte, error) {
 	for _, col := range columns {
 		size += 2 // 2 bytes for null flag
 		if val, exists := row[col.Name]; exists && val != nil {
+			if _, ok := val.(toastPointer); ok {
+				size += toastPointerSize
+				continue
+			}
 			switch col.Type {
 			case TypeInt:
 				size += 4
@@ -24,8 +31,8 @@ func EncodeRow(columns []Column, row Row) ([]byte, error) {
 				size += 8
 			case TypeBoolean:
 				size += 1
-			case TypeText, TypeVarChar:
-				str := fmt.Sprintf("%v", val)
+			case TypeText, TypeVarChar, TypeJSONB:
+				str := textValue(col.Type, val)
 				size += 4 + len(str) // 4 bytes for length + string data
 			case TypeVector:
 				vec, ok := val.(*Vector)
@@ -54,6 +61,14 @@ func EncodeRow(columns []Column, row Row) ([]byte, error) {
 			continue
 		}
 
+		if p, ok := val.(toastPointer); ok {
+			binary.LittleEndian.PutUint16(buf[offset:], toastedFlag) // Out of line
+			offset += 2
+			encodeToastPointer(buf[offset:], p)
+			offset += toastPointerSize
+			continue
+		}
+
 		binary.LittleEndian.PutUint16(buf[offset:], 0) // NOT NULL
 		offset += 2
 
@@ -83,8 +98,8 @@ func EncodeRow(columns []Column, row Row) ([]byte, error) {
 			}
 			offset += 1
 
-		case TypeText, TypeVarChar:
-			str := fmt.Sprintf("%v", val)
+		case TypeText, TypeVarChar, TypeJSONB:
+			str := textValue(col.Type, val)
 			binary.LittleEndian.PutUint32(buf[offset:], uint32(len(str)))
 			offset += 4
 			copy(buf[offset:], []byte(str))
@@ -142,6 +157,14 @@ func DecodeRow(columns []Column, data []byte) (Row, error) {
 			row[col.Name] = nil
 			continue
 		}
+		if isNull == toastedFlag {
+			if offset+toastPointerSize > len(data) {
+				return nil, fmt.Errorf("unexpected end of data for out-of-line value")
+			}
+			row[col.Name] = decodeToastPointer(data[offset:])
+			offset += toastPointerSize
+			continue
+		}
 
 		// Read value based on type
 		switch col.Type {
@@ -177,7 +200,7 @@ func DecodeRow(columns []Column, data []byte) (Row, error) {
 			row[col.Name] = data[offset] == 1
 			offset += 1
 
-		case TypeText, TypeVarChar:
+		case TypeText, TypeVarChar, TypeJSONB:
 			if offset+4 > len(data) {
 				return nil, fmt.Errorf("unexpected end of data for string length")
 			}
@@ -216,6 +239,20 @@ func DecodeRow(columns []Column, data []byte) (Row, error) {
 	return row, nil
 }
 
+// textValue returns the stored text of a value. JSONB documents that have
+// been parsed are stored as JSON text.
+func textValue(typ DataType, val interface{}) string {
+	if typ == TypeJSONB {
+		switch v := val.(type) {
+		case map[string]interface{}, []interface{}:
+			if data, err := json.Marshal(v); err == nil {
+				return string(data)
+			}
+		}
+	}
+	return fmt.Sprintf("%v", val)
+}
+
 // Helper conversion functions
 func toInt(val interface{}) int {
 	switch v := val.(type) {
@@ -227,6 +264,8 @@ func toInt(val interface{}) int {
 		return int(v)
 	case float64:
 		return int(v)
+	case string:
+		return int(toInt64(v))
 	default:
 		return 0
 	}
@@ -242,6 +281,13 @@ func toInt64(val interface{}) int64 {
 		return v
 	case float64:
 		return int64(v)
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		f, _ := strconv.ParseFloat(s, 64)
+		return int64(f)
 	default:
 		return 0
 	}
@@ -257,6 +303,10 @@ func toFloat64(val interface{}) (float64, error) {
 		return float64(v), nil
 	case int64:
 		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
 	default:
 		return 0, fmt.Errorf("cannot convert to float64")
 	}
@@ -268,6 +318,12 @@ func toBool(val interface{}) bool {
 		return v
 	case int:
 		return v != 0
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true
+		}
+		return false
 	default:
 		return false
 	}
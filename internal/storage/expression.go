@@ -601,6 +601,15 @@ func evaluateCast(expr string, row Row) interface{} {
 	}
 }
 
+// EvaluateArguments evaluates the comma-separated arguments of a function
+// call on a row
+func EvaluateArguments(argsStr string, row Row) []interface{} {
+	if strings.TrimSpace(argsStr) == "" {
+		return nil
+	}
+	return splitArgs(argsStr, row)
+}
+
 // splitArgs splits a comma-separated argument string, evaluating each arg
 func splitArgs(argsStr string, row Row) []interface{} {
 	raw := splitRawArgs(argsStr)
@@ -612,12 +621,21 @@ func splitArgs(argsStr string, row Row) []interface{} {
 	return result
 }
 
-// splitRawArgs splits on commas that are not inside parentheses
+// splitRawArgs splits on commas that are not inside parentheses or string
+// literals
 func splitRawArgs(s string) []string {
 	var parts []string
 	depth := 0
 	start := 0
+	inString := false
 	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' {
+			inString = !inString
+			continue
+		}
+		if inString {
+			continue
+		}
 		switch s[i] {
 		case '(':
 			depth++
@@ -848,12 +866,8 @@ func applyTypeCast(val interface{}, castType string) interface{} {
 		}
 		return nil
 	case castType == "BOOLEAN" || castType == "BOOL":
-		lower := strings.ToLower(strVal)
-		if lower == "true" || lower == "t" || lower == "1" || lower == "yes" || lower == "y" {
-			return true
-		}
-		if lower == "false" || lower == "f" || lower == "0" || lower == "no" || lower == "n" {
-			return false
+		if b, ok := ParseBool(strVal); ok {
+			return b
 		}
 		return nil
 	case strings.Contains(castType, "CHAR") || strings.Contains(castType, "TEXT"):
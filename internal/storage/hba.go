@@ -0,0 +1,581 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// HBAFileName is the name of the client authentication file in the data directory
+const HBAFileName = "pg_hba.conf"
+
+// maxHBAIncludeDepth limits nested @file inclusions
+const maxHBAIncludeDepth = 10
+
+// HBAMethod represents the authentication method
+type HBAMethod string
+
+const (
+	MethodTrust    HBAMethod = "trust"
+	MethodReject   HBAMethod = "reject"
+	MethodPassword HBAMethod = "password" // Cleartext password
+	MethodSCRAM    HBAMethod = "scram-sha-256"
+	MethodMD5      HBAMethod = "md5"  // Performs SCRAM, as all passwords are stored as SCRAM verifiers
+	MethodPeer     HBAMethod = "peer" // OS user of the client process; Unix-domain sockets only
+)
+
+// HBAToken is one item of a comma-separated pg_hba.conf list. Quoted items
+// never have a special meaning, so "all" names a database or role called all.
+type HBAToken struct {
+	Value  string
+	Quoted bool
+}
+
+// String returns the token as written in pg_hba.conf
+func (t HBAToken) String() string {
+	if t.Quoted {
+		return `"` + strings.ReplaceAll(t.Value, `"`, `""`) + `"`
+	}
+	return t.Value
+}
+
+// keyword reports whether the token is the unquoted keyword kw
+func (t HBAToken) keyword(kw string) bool {
+	return !t.Quoted && t.Value == kw
+}
+
+// HBARule represents a single rule in pg_hba.conf
+type HBARule struct {
+	LineNumber int        // Line in pg_hba.conf, 0 for built-in defaults
+	Type       string     // "local", "host", "hostssl", "hostnossl"
+	Databases  []HBAToken // Names, "all", "sameuser", "samerole" or "replication"
+	Users      []HBAToken // Names, "all" or "+group"
+	Address    *net.IPNet
+	Host       string // "all", "samehost", "samenet" or a host name, when Address is nil
+	Method     HBAMethod
+	Options    map[string]string // Authentication options such as clientcert
+}
+
+// HBALineError describes a line of pg_hba.conf that could not be parsed
+type HBALineError struct {
+	LineNumber int
+	Message    string
+}
+
+// HBAConfig stores all loaded rules
+type HBAConfig struct {
+	Rules  []HBARule
+	Errors []HBALineError // Lines left out of Rules
+}
+
+// HBAConnection describes a connection attempt checked against the rules
+type HBAConnection struct {
+	Local    bool // Unix-domain socket; RemoteIP is unset
+	SSL      bool
+	RemoteIP net.IP
+	Database string
+	User     string
+}
+
+// String describes the connection like PostgreSQL's authentication errors
+func (c HBAConnection) String() string {
+	host := "[local]"
+	if !c.Local {
+		host = c.RemoteIP.String()
+	}
+	encryption := "no encryption"
+	if c.SSL {
+		encryption = "SSL encryption"
+	}
+	return fmt.Sprintf("host \"%s\", user \"%s\", database \"%s\", %s", host, c.User, c.Database, encryption)
+}
+
+// LoadHBAConfig loads rules from a file. Lines that cannot be parsed are
+// reported in Errors; the error result is only set if the file is unreadable.
+func LoadHBAConfig(path string) (*HBAConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Return default rules if file doesn't exist
+			return DefaultHBAConfig(), nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseHBAConfig(file, filepath.Dir(path))
+}
+
+// ParseHBAConfig reads rules in pg_hba.conf format. Files included with
+// @file are resolved against dir.
+func ParseHBAConfig(r io.Reader, dir string) (*HBAConfig, error) {
+	config := &HBAConfig{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields, err := tokenizeHBALine(scanner.Text())
+		if err == nil && len(fields) == 0 {
+			continue
+		}
+
+		var rule HBARule
+		if err == nil {
+			rule, err = parseHBARule(fields, dir)
+		}
+		if err != nil {
+			config.Errors = append(config.Errors, HBALineError{LineNumber: lineNumber, Message: err.Error()})
+			continue
+		}
+		rule.LineNumber = lineNumber
+		config.Rules = append(config.Rules, rule)
+	}
+
+	return config, scanner.Err()
+}
+
+// tokenizeHBALine splits a line into whitespace-separated fields, each a
+// comma-separated list of tokens. A list may continue after whitespace that
+// follows a comma. A '#' outside quotes starts a comment.
+func tokenizeHBALine(line string) ([][]HBAToken, error) {
+	var fields [][]HBAToken
+	var field []HBAToken
+	var value strings.Builder
+	inToken, quoted, inQuotes, afterComma := false, false, false, false
+
+	endToken := func() {
+		if inToken {
+			field = append(field, HBAToken{Value: value.String(), Quoted: quoted})
+		}
+		value.Reset()
+		inToken, quoted = false, false
+	}
+	endField := func() {
+		endToken()
+		if len(field) > 0 {
+			fields = append(fields, field)
+		}
+		field = nil
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		isSpace := ch == ' ' || ch == '\t' || ch == '\r'
+		if afterComma && !isSpace {
+			afterComma = false
+		}
+		switch {
+		case inQuotes && ch == '"':
+			if i+1 < len(line) && line[i+1] == '"' {
+				value.WriteByte('"')
+				i++
+			} else {
+				inQuotes = false
+			}
+		case inQuotes:
+			value.WriteByte(ch)
+		case ch == '"':
+			inToken, quoted, inQuotes = true, true, true
+		case ch == '#':
+			endField()
+			return fields, nil
+		case ch == ',':
+			endToken()
+			afterComma = true
+		case isSpace:
+			if afterComma {
+				endToken()
+			} else {
+				endField()
+			}
+		default:
+			inToken = true
+			value.WriteByte(ch)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	endField()
+	return fields, nil
+}
+
+// parseHBARule parses the fields of one pg_hba.conf line
+func parseHBARule(fields [][]HBAToken, dir string) (HBARule, error) {
+	field := 0
+	next := func(what string) (HBAToken, error) {
+		if field >= len(fields) {
+			return HBAToken{}, fmt.Errorf("end-of-line before %s", what)
+		}
+		tokens := fields[field]
+		field++
+		if len(tokens) > 1 {
+			return HBAToken{}, fmt.Errorf("multiple values specified for %s", what)
+		}
+		return tokens[0], nil
+	}
+
+	typ, err := next("connection type")
+	if err != nil {
+		return HBARule{}, err
+	}
+	rule := HBARule{Type: typ.Value}
+	switch rule.Type {
+	case "local", "host", "hostssl", "hostnossl":
+	default:
+		return rule, fmt.Errorf("invalid connection type \"%s\"", typ.Value)
+	}
+
+	if field >= len(fields) {
+		return rule, fmt.Errorf("end-of-line before database specification")
+	}
+	if rule.Databases, err = expandHBAIncludes(fields[field], dir, 0); err != nil {
+		return rule, err
+	}
+	field++
+	if field >= len(fields) {
+		return rule, fmt.Errorf("end-of-line before role specification")
+	}
+	if rule.Users, err = expandHBAIncludes(fields[field], dir, 0); err != nil {
+		return rule, err
+	}
+	field++
+
+	if rule.Type != "local" {
+		addr, err := next("IP address specification")
+		if err != nil {
+			return rule, err
+		}
+		switch {
+		case addr.keyword("all"), addr.keyword("samehost"), addr.keyword("samenet"):
+			rule.Host = addr.Value
+		case strings.Contains(addr.Value, "/"):
+			_, ipNet, err := net.ParseCIDR(addr.Value)
+			if err != nil {
+				return rule, fmt.Errorf("invalid IP address \"%s\"", addr.Value)
+			}
+			rule.Address = ipNet
+		case net.ParseIP(addr.Value) != nil:
+			mask, err := next("netmask specification")
+			if err != nil {
+				return rule, err
+			}
+			if rule.Address, err = parseHBANetmask(net.ParseIP(addr.Value), mask.Value); err != nil {
+				return rule, err
+			}
+		default:
+			rule.Host = strings.ToLower(addr.Value)
+		}
+	}
+
+	method, err := next("authentication method")
+	if err != nil {
+		return rule, err
+	}
+	rule.Method = HBAMethod(method.Value)
+	switch rule.Method {
+	case MethodTrust, MethodReject, MethodPassword, MethodSCRAM, MethodMD5:
+	case MethodPeer:
+		if rule.Type != "local" {
+			return rule, fmt.Errorf("peer authentication is only supported on local sockets")
+		}
+	default:
+		return rule, fmt.Errorf("invalid authentication method \"%s\"", method.Value)
+	}
+
+	for ; field < len(fields); field++ {
+		if err := rule.parseOption(fields[field]); err != nil {
+			return rule, err
+		}
+	}
+
+	return rule, nil
+}
+
+// parseHBANetmask combines an address with the netmask column that follows it
+func parseHBANetmask(ip net.IP, maskStr string) (*net.IPNet, error) {
+	maskIP := net.ParseIP(maskStr)
+	if maskIP == nil {
+		return nil, fmt.Errorf("invalid IP mask \"%s\"", maskStr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if maskIP = maskIP.To4(); maskIP == nil {
+			return nil, fmt.Errorf("IP address and mask do not match")
+		}
+		ip = ip4
+	} else if maskIP.To4() != nil {
+		return nil, fmt.Errorf("IP address and mask do not match")
+	}
+
+	mask := net.IPMask(maskIP)
+	if _, bits := mask.Size(); bits == 0 {
+		return nil, fmt.Errorf("invalid IP mask \"%s\"", maskStr)
+	}
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// parseOption parses a name=value authentication option
+func (r *HBARule) parseOption(tokens []HBAToken) error {
+	values := make([]string, len(tokens))
+	for i, t := range tokens {
+		values[i] = t.Value
+	}
+	option := strings.Join(values, ",")
+	name, value, ok := strings.Cut(option, "=")
+	if !ok {
+		return fmt.Errorf("authentication option not in name=value format: %s", option)
+	}
+
+	switch name {
+	case "clientcert":
+		if r.Type != "hostssl" {
+			return fmt.Errorf("clientcert can only be configured for \"hostssl\" rows")
+		}
+		if value != "verify-ca" && value != "verify-full" {
+			return fmt.Errorf("invalid value for clientcert: \"%s\"", value)
+		}
+	default:
+		return fmt.Errorf("unrecognized authentication option name: \"%s\"", name)
+	}
+
+	if r.Options == nil {
+		r.Options = make(map[string]string)
+	}
+	r.Options[name] = value
+	return nil
+}
+
+// expandHBAIncludes replaces @file tokens with the tokens listed in the file
+func expandHBAIncludes(tokens []HBAToken, dir string, depth int) ([]HBAToken, error) {
+	var expanded []HBAToken
+	for _, t := range tokens {
+		if t.Quoted || !strings.HasPrefix(t.Value, "@") {
+			expanded = append(expanded, t)
+			continue
+		}
+		if depth >= maxHBAIncludeDepth {
+			return nil, fmt.Errorf("could not open file \"%s\": too many levels of inclusion", t.Value[1:])
+		}
+
+		path := t.Value[1:]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open file \"%s\": %v", path, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields, err := tokenizeHBALine(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			for _, field := range fields {
+				included, err := expandHBAIncludes(field, filepath.Dir(path), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, included...)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// DefaultHBAConfig returns a permissive configuration
+func DefaultHBAConfig() *HBAConfig {
+	_, anyIP, _ := net.ParseCIDR("0.0.0.0/0")
+	_, localIP, _ := net.ParseCIDR("127.0.0.1/32")
+	all := []HBAToken{{Value: "all"}}
+	return &HBAConfig{
+		Rules: []HBARule{
+			{Type: "host", Databases: all, Users: []HBAToken{{Value: "ghost"}}, Address: anyIP, Method: MethodSCRAM},
+			{Type: "host", Databases: all, Users: all, Address: localIP, Method: MethodTrust},
+			{Type: "host", Databases: all, Users: all, Address: anyIP, Method: MethodSCRAM},
+		},
+	}
+}
+
+// Check returns the first rule matching the connection. Role membership for
+// samerole and +group is looked up in roles.
+func (c *HBAConfig) Check(conn HBAConnection, roles *RoleStore) (*HBARule, error) {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if rule.matchType(conn) && rule.matchDatabase(conn, roles) &&
+			rule.matchUser(conn, roles) && rule.matchAddress(conn) {
+			return rule, nil
+		}
+	}
+
+	return nil, util.NewSQLError(util.SQLStateInvalidAuthorization, "no pg_hba.conf entry for %s", conn)
+}
+
+func (r *HBARule) matchType(conn HBAConnection) bool {
+	switch r.Type {
+	case "local":
+		return conn.Local
+	case "host":
+		return !conn.Local
+	case "hostssl":
+		return !conn.Local && conn.SSL
+	case "hostnossl":
+		return !conn.Local && !conn.SSL
+	}
+	return false
+}
+
+func (r *HBARule) matchDatabase(conn HBAConnection, roles *RoleStore) bool {
+	for _, t := range r.Databases {
+		switch {
+		case t.keyword("all"):
+			return true
+		case t.keyword("sameuser"):
+			if conn.Database == conn.User {
+				return true
+			}
+		case t.keyword("samerole"), t.keyword("samegroup"):
+			if roles.IsMemberOf(conn.User, conn.Database) {
+				return true
+			}
+		case t.keyword("replication"):
+			// Replication connections are not supported
+		case t.Value == conn.Database:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *HBARule) matchUser(conn HBAConnection, roles *RoleStore) bool {
+	for _, t := range r.Users {
+		switch {
+		case t.keyword("all"):
+			return true
+		case !t.Quoted && strings.HasPrefix(t.Value, "+"):
+			if roles.IsMemberOf(conn.User, t.Value[1:]) {
+				return true
+			}
+		case t.Value == conn.User:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *HBARule) matchAddress(conn HBAConnection) bool {
+	if r.Type == "local" {
+		return true
+	}
+	if r.Address != nil {
+		return r.Address.Contains(conn.RemoteIP)
+	}
+
+	switch r.Host {
+	case "all":
+		return true
+	case "samehost", "samenet":
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return false
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if r.Host == "samehost" && ipNet.IP.Equal(conn.RemoteIP) {
+				return true
+			}
+			if r.Host == "samenet" && ipNet.Contains(conn.RemoteIP) {
+				return true
+			}
+		}
+		return false
+	}
+	return matchHBAHostname(r.Host, conn.RemoteIP)
+}
+
+// matchHBAHostname checks the client's host name like PostgreSQL: the reverse
+// lookup of its address must match pattern (a name, or a suffix starting with
+// '.'), and the forward lookup of that name must give the address back.
+func matchHBAHostname(pattern string, ip net.IP) bool {
+	names, err := net.LookupAddr(ip.String())
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if strings.HasPrefix(pattern, ".") {
+			if !strings.HasSuffix(name, pattern) {
+				continue
+			}
+		} else if name != pattern {
+			continue
+		}
+
+		addrs, err := net.LookupIP(name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FormatOptions returns the rule's options as name=value pairs, sorted by name
+func (r *HBARule) FormatOptions() []string {
+	options := make([]string, 0, len(r.Options))
+	for name, value := range r.Options {
+		options = append(options, name+"="+value)
+	}
+	sort.Strings(options)
+	return options
+}
+
+// HBAFilePath returns the path of pg_hba.conf in the data directory
+func (db *Database) HBAFilePath() string {
+	return filepath.Join(db.DataDir.RootPath, HBAFileName)
+}
+
+// HBA returns the client authentication rules in effect
+func (db *Database) HBA() *HBAConfig {
+	return db.hba.Load()
+}
+
+// ReloadHBA re-reads pg_hba.conf. The new rules replace the current ones
+// only if every line parses; otherwise the errors are logged and returned,
+// and the current rules stay in effect.
+func (db *Database) ReloadHBA() error {
+	config, err := LoadHBAConfig(db.HBAFilePath())
+	if err != nil {
+		db.Logger.Error("Could not read %s: %v", HBAFileName, err)
+		return err
+	}
+	if len(config.Errors) > 0 {
+		for _, lineErr := range config.Errors {
+			db.Logger.Error("%s line %d: %s", HBAFileName, lineErr.LineNumber, lineErr.Message)
+		}
+		return fmt.Errorf("%s contains %d invalid line(s), keeping the current rules", HBAFileName, len(config.Errors))
+	}
+
+	db.hba.Store(config)
+	return nil
+}
+
+// Reload re-reads the configuration files that can change while the server
+// runs. It is triggered by SIGHUP and pg_reload_conf().
+func (db *Database) Reload() error {
+	db.Logger.Info("Reloading configuration files")
+	return db.ReloadHBA()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+// MaxNotifyPayload is the longest NOTIFY payload accepted, in bytes
+const MaxNotifyPayload = 7999
+
+// Notification is an asynchronous message sent with NOTIFY
+type Notification struct {
+	ProcessID int32 // Backend of the sending session
+	Channel   string
+	Payload   string
+}
+
+// listenState holds the channels a session listens on and the
+// notifications waiting to be sent to its client
+type listenState struct {
+	mu       sync.Mutex
+	channels map[string]bool
+	queue    []Notification
+	signal   chan struct{} // Receives a value when queue becomes non-empty
+}
+
+func newListenState() listenState {
+	return listenState{
+		channels: make(map[string]bool),
+		signal:   make(chan struct{}, 1),
+	}
+}
+
+// Listen registers the session as a listener on channel
+func (s *Session) Listen(channel string) {
+	s.listen.mu.Lock()
+	defer s.listen.mu.Unlock()
+	s.listen.channels[channel] = true
+}
+
+// Unlisten stops listening on channel
+func (s *Session) Unlisten(channel string) {
+	s.listen.mu.Lock()
+	defer s.listen.mu.Unlock()
+	delete(s.listen.channels, channel)
+}
+
+// UnlistenAll stops listening on every channel
+func (s *Session) UnlistenAll() {
+	s.listen.mu.Lock()
+	defer s.listen.mu.Unlock()
+	s.listen.channels = make(map[string]bool)
+}
+
+// ListeningChannels returns the channels the session listens on, sorted
+func (s *Session) ListeningChannels() []string {
+	s.listen.mu.Lock()
+	defer s.listen.mu.Unlock()
+	channels := make([]string, 0, len(s.listen.channels))
+	for channel := range s.listen.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// QueueNotification holds a notification sent inside a transaction block
+// until COMMIT. Duplicates of a pending notification are dropped.
+func (s *Session) QueueNotification(n Notification) {
+	for _, pending := range s.TxNotifications {
+		if pending.Channel == n.Channel && pending.Payload == n.Payload {
+			return
+		}
+	}
+	s.TxNotifications = append(s.TxNotifications, n)
+}
+
+// TakeNotifications returns and clears the notifications waiting to be
+// sent to the client
+func (s *Session) TakeNotifications() []Notification {
+	s.listen.mu.Lock()
+	defer s.listen.mu.Unlock()
+	queue := s.listen.queue
+	s.listen.queue = nil
+	return queue
+}
+
+// NotificationSignal returns a channel that receives a value when
+// notifications are waiting
+func (s *Session) NotificationSignal() <-chan struct{} {
+	return s.listen.signal
+}
+
+// deliver queues n for the client if the session listens on its channel
+func (s *Session) deliver(n Notification) {
+	s.listen.mu.Lock()
+	defer s.listen.mu.Unlock()
+	if !s.listen.channels[n.Channel] {
+		return
+	}
+	s.listen.queue = append(s.listen.queue, n)
+	select {
+	case s.listen.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Notify delivers notifications to every session listening on their
+// channels, including the sender
+func (sm *SessionManager) Notify(notifications ...Notification) {
+	if len(notifications) == 0 {
+		return
+	}
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		sessions = append(sessions, s)
+	}
+	sm.mu.RUnlock()
+
+	for _, n := range notifications {
+		for _, s := range sessions {
+			s.deliver(n)
+		}
+	}
+}
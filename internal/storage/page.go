@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"encoding/binary"
 	"fmt"
 	"os"
 	"sync"
@@ -48,198 +47,114 @@ func (p *Page) MarkDirty() {
 	p.Dirty = true
 }
 
-// PageManager manages page I/O and buffering
+// PageManager reads and writes the data pages of a table file through the
+// shared buffer pool. The first page of the file holds the table header,
+// so page n is stored at file offset (n+1)*PageSize.
 type PageManager struct {
-	file      *os.File
-	pages     map[uint64]*Page
-	freePages []uint64
-	nextID    uint64
-	mu        sync.RWMutex
+	path string
+	pool *BufferPool
+	file *os.File // Opened on first use
+	gone bool     // The table was dropped
+	mu   sync.Mutex
 }
 
-// NewPageManager creates a new page manager
-func NewPageManager(filepath string) (*PageManager, error) {
-	file, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
-	}
-
-	pm := &PageManager{
-		file:      file,
-		pages:     make(map[uint64]*Page),
-		freePages: make([]uint64, 0),
-		nextID:    0,
-	}
-
-	// Initialize file if new
-	stat, err := file.Stat()
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to stat file: %w", err)
-	}
-
-	if stat.Size() == 0 {
-		if err := pm.initializeFile(); err != nil {
-			file.Close()
-			return nil, fmt.Errorf("failed to initialize file: %w", err)
-		}
-	} else {
-		// Read metadata from existing file
-		if err := pm.loadMetadata(); err != nil {
-			file.Close()
-			return nil, fmt.Errorf("failed to load metadata: %w", err)
-		}
-	}
-
-	return pm, nil
-}
-
-// initializeFile creates the initial file structure
-func (pm *PageManager) initializeFile() error {
-	// Write a header page (page 0)
-	header := make([]byte, PageSize)
-
-	// Magic number "GSQL"
-	copy(header[0:4], "GSQL")
-
-	// Version
-	binary.LittleEndian.PutUint32(header[4:8], 1)
-
-	// Next page ID
-	binary.LittleEndian.PutUint64(header[8:16], 1)
-
-	if _, err := pm.file.WriteAt(header, 0); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
-	}
-
-	pm.nextID = 1
-	return pm.file.Sync()
-}
-
-// loadMetadata loads metadata from the header page
-func (pm *PageManager) loadMetadata() error {
-	header := make([]byte, PageSize)
-	if _, err := pm.file.ReadAt(header, 0); err != nil {
-		return fmt.Errorf("failed to read header: %w", err)
-	}
-
-	// Verify magic number
-	magic := string(header[0:4])
-	if magic != "GSQL" {
-		return fmt.Errorf("invalid magic number: %s", magic)
+// NewPageManager creates a page manager for the table file at path
+func NewPageManager(path string, pool *BufferPool) *PageManager {
+	return &PageManager{
+		path: path,
+		pool: pool,
 	}
-
-	// Read next page ID
-	pm.nextID = binary.LittleEndian.Uint64(header[8:16])
-
-	return nil
 }
 
-// AllocatePage allocates a new page
-func (pm *PageManager) AllocatePage(pageType PageType) (*Page, error) {
+// openFile returns the table file, creating it if pages are written back
+// before the first checkpoint
+func (pm *PageManager) openFile() (*os.File, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
-
-	var pageID uint64
-
-	// Reuse free page if available
-	if len(pm.freePages) > 0 {
-		pageID = pm.freePages[len(pm.freePages)-1]
-		pm.freePages = pm.freePages[:len(pm.freePages)-1]
-	} else {
-		pageID = pm.nextID
-		pm.nextID++
+	if pm.gone {
+		return nil, fmt.Errorf("table file %s was dropped", pm.path)
 	}
-
-	page := NewPage(pageID, pageType)
-	pm.pages[pageID] = page
-
-	// Update header with new nextID
-	header := make([]byte, 16)
-	copy(header[0:4], "GSQL")
-	binary.LittleEndian.PutUint32(header[4:8], 1)
-	binary.LittleEndian.PutUint64(header[8:16], pm.nextID)
-
-	if _, err := pm.file.WriteAt(header, 0); err != nil {
-		return nil, fmt.Errorf("failed to update header: %w", err)
+	if pm.file == nil {
+		file, err := os.OpenFile(pm.path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		pm.file = file
 	}
-
-	return page, nil
+	return pm.file, nil
 }
 
-// ReadPage reads a page from disk
+// ReadPage returns a page pinned in the buffer pool, reading it from disk
+// if it is not cached. The caller must unpin it.
 func (pm *PageManager) ReadPage(pageID uint64) (*Page, error) {
-	pm.mu.RLock()
-	// Check if page is already in memory
-	if page, exists := pm.pages[pageID]; exists {
-		pm.mu.RUnlock()
-		return page, nil
-	}
-	pm.mu.RUnlock()
-
-	// Read from disk
-	page := &Page{ID: pageID}
-	offset := int64(pageID) * PageSize
+	return pm.pool.fetch(pm, pageID)
+}
 
-	if _, err := pm.file.ReadAt(page.Data[:], offset); err != nil {
-		return nil, fmt.Errorf("failed to read page %d: %w", pageID, err)
+// readFromDisk reads a page from the table file into page
+func (pm *PageManager) readFromDisk(page *Page) error {
+	file, err := pm.openFile()
+	if err != nil {
+		return err
 	}
-
-	// Determine page type from data
-	page.Type = PageType(page.Data[0])
-
-	pm.mu.Lock()
-	pm.pages[pageID] = page
-	pm.mu.Unlock()
-
-	return page, nil
+	offset := int64(page.ID+1) * PageSize
+	if _, err := file.ReadAt(page.Data[:], offset); err != nil {
+		return fmt.Errorf("failed to read page %d of %s: %w", page.ID, pm.path, err)
+	}
+	return nil
 }
 
 // WritePage writes a page to disk
 func (pm *PageManager) WritePage(page *Page) error {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
-
-	offset := int64(page.ID) * PageSize
-
-	// Write page type at the beginning
-	page.Data[0] = byte(page.Type)
+	file, err := pm.openFile()
+	if err != nil {
+		return err
+	}
 
-	if _, err := pm.file.WriteAt(page.Data[:], offset); err != nil {
-		return fmt.Errorf("failed to write page %d: %w", page.ID, err)
+	page.mu.Lock()
+	defer page.mu.Unlock()
+	offset := int64(page.ID+1) * PageSize
+	if _, err := file.WriteAt(page.Data[:], offset); err != nil {
+		return fmt.Errorf("failed to write page %d of %s: %w", page.ID, pm.path, err)
 	}
 
 	page.Dirty = false
 	return nil
 }
 
-// FlushAll flushes all dirty pages to disk
+// FlushAll flushes all dirty pages of the file to disk
 func (pm *PageManager) FlushAll() error {
-	pm.mu.RLock()
-	dirtyPages := make([]*Page, 0)
-	for _, page := range pm.pages {
-		if page.Dirty {
-			dirtyPages = append(dirtyPages, page)
-		}
+	if err := pm.pool.flush(pm); err != nil {
+		return err
 	}
-	pm.mu.RUnlock()
 
-	for _, page := range dirtyPages {
-		if err := pm.WritePage(page); err != nil {
-			return fmt.Errorf("failed to flush page %d: %w", page.ID, err)
-		}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.file == nil {
+		return nil
 	}
-
 	return pm.file.Sync()
 }
 
-// FreePage marks a page as free for reuse
-func (pm *PageManager) FreePage(pageID uint64) {
+// discard drops the file's pages from the buffer pool without writing them
+// and closes the file, for a table that was dropped
+func (pm *PageManager) discard() {
+	pm.pool.drop(pm, 0)
+	pm.close()
 	pm.mu.Lock()
-	defer pm.mu.Unlock()
+	pm.gone = true
+	pm.mu.Unlock()
+}
 
-	delete(pm.pages, pageID)
-	pm.freePages = append(pm.freePages, pageID)
+// close closes the file without flushing
+func (pm *PageManager) close() error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.file == nil {
+		return nil
+	}
+	err := pm.file.Close()
+	pm.file = nil
+	return err
 }
 
 // Close closes the page manager
@@ -249,5 +164,5 @@ func (pm *PageManager) Close() error {
 		return fmt.Errorf("failed to flush pages: %w", err)
 	}
 
-	return pm.file.Close()
+	return pm.close()
 }
@@ -5,9 +5,9 @@ import (
 	"fmt"
 )
 
-// SaveTableToDisk persists a table to disk in BINARY format
+// SaveTableToDisk persists a table through the WAL
 func (db *Database) SaveTableToDisk(dbInstance *DatabaseInstance, table *Table) error {
-	return db.saveTableForDatabase(dbInstance, table)
+	return db.CommitTables(dbInstance, []*Table{table}, nil)
 }
 
 // LoadTableFromDisk loads a table from disk
@@ -18,10 +18,12 @@ func (db *Database) LoadTableFromDisk(dbInstance *DatabaseInstance, tableName st
 // SaveAllTables persists all tables to disk
 func (db *Database) SaveAllTables() error {
 	for _, dbInstance := range db.Databases {
+		tables := make([]*Table, 0, len(dbInstance.Tables))
 		for _, table := range dbInstance.Tables {
-			if err := db.saveTableForDatabase(dbInstance, table); err != nil {
-				return fmt.Errorf("failed to save table %s: %w", table.Name, err)
-			}
+			tables = append(tables, table)
+		}
+		if err := db.CommitTables(dbInstance, tables, nil); err != nil {
+			return fmt.Errorf("failed to save tables of database %s: %w", dbInstance.Name, err)
 		}
 	}
 	return nil
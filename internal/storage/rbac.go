@@ -2,6 +2,7 @@ package storage
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"sync"
 	"time"
 	"encoding/binary"
+
+	"github.com/ghosecorp/ghostsql/internal/util"
 )
 
 // Role represents a PostgreSQL-compatible role
@@ -23,7 +26,7 @@ type Role struct {
 	CanLogin      bool      `json:"can_login"`
 	Replication   bool      `json:"replication"`
 	BypassRLS     bool      `json:"bypass_rls"`
-	ConnLimit     int       `json:"conn_limit"`
+	ConnLimit     int       `json:"connection_limit"` // -1 for no limit
 	PasswordHash  string    `json:"password_hash"`
 	ValidUntil    time.Time `json:"valid_until"`
 	
@@ -61,8 +64,13 @@ func NewRoleStore(dataDir string) *RoleStore {
 	}
 }
 
-// HashPassword creates a simple SHA-256 hash of the password
+// HashPassword creates a salted SCRAM-SHA-256 verifier of the password
 func HashPassword(password string) string {
+	return NewSCRAMVerifier(password).String()
+}
+
+// legacyHashPassword is the unsalted SHA-256 hash stored by older versions
+func legacyHashPassword(password string) string {
 	hash := sha256.Sum256([]byte(password))
 	return hex.EncodeToString(hash[:])
 }
@@ -72,7 +80,31 @@ func (r *Role) VerifyPassword(password string) bool {
 	if r.PasswordHash == "" {
 		return true // No password required
 	}
-	return HashPassword(password) == r.PasswordHash
+	if verifier, err := ParseSCRAMVerifier(r.PasswordHash); err == nil {
+		return verifier.VerifyPassword(password)
+	}
+	return subtle.ConstantTimeCompare([]byte(legacyHashPassword(password)), []byte(r.PasswordHash)) == 1
+}
+
+// SCRAMVerifier returns the role's SCRAM-SHA-256 verifier, or nil if the
+// role has no password or still has a legacy unsalted hash
+func (r *Role) SCRAMVerifier() *SCRAMVerifier {
+	verifier, err := ParseSCRAMVerifier(r.PasswordHash)
+	if err != nil {
+		return nil
+	}
+	return verifier
+}
+
+// PasswordExpired reports whether the role's VALID UNTIL time has passed
+func (r *Role) PasswordExpired(now time.Time) bool {
+	return !r.ValidUntil.IsZero() && now.After(r.ValidUntil)
+}
+
+// NeedsPasswordUpgrade reports whether the role's password is stored as a
+// legacy unsalted hash that should be replaced by a SCRAM verifier
+func (r *Role) NeedsPasswordUpgrade() bool {
+	return r.PasswordHash != "" && r.SCRAMVerifier() == nil
 }
 
 // Load loads roles and default privileges from disk
@@ -121,7 +153,8 @@ func (rs *RoleStore) Load() error {
 			return fmt.Errorf("malformed binary roles file: unexpected EOF")
 		}
 		
-		var role Role
+		// Roles saved before connection limits were enforced have no limit
+		role := Role{ConnLimit: -1}
 		if err := json.Unmarshal(data[offset : offset+int(roleLen)], &role); err != nil {
 			return fmt.Errorf("failed to unmarshal role at index %d: %w", i, err)
 		}
@@ -186,13 +219,42 @@ func (rs *RoleStore) GetRole(name string) (*Role, bool) {
 	return role, exists
 }
 
+// IsMemberOf reports whether roleName is groupName or a direct or indirect
+// member of it
+func (rs *RoleStore) IsMemberOf(roleName, groupName string) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.isMemberOf(roleName, groupName, make(map[string]bool))
+}
+
+func (rs *RoleStore) isMemberOf(roleName, groupName string, visited map[string]bool) bool {
+	if roleName == groupName {
+		return true
+	}
+	if visited[roleName] {
+		return false
+	}
+	visited[roleName] = true
+
+	role, exists := rs.Roles[roleName]
+	if !exists {
+		return false
+	}
+	for _, parent := range role.MemberOf {
+		if rs.isMemberOf(parent, groupName, visited) {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateRole adds a new role
 func (rs *RoleStore) CreateRole(role *Role) error {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
 
 	if _, exists := rs.Roles[role.Name]; exists {
-		return fmt.Errorf("role %s already exists", role.Name)
+		return util.NewSQLError(util.SQLStateDuplicateObject, "role %s already exists", role.Name)
 	}
 
 	rs.Roles[role.Name] = role
@@ -205,7 +267,7 @@ func (rs *RoleStore) DeleteRole(name string) error {
 	defer rs.mu.Unlock()
 
 	if _, exists := rs.Roles[name]; !exists {
-		return fmt.Errorf("role %s does not exist", name)
+		return util.NewSQLError(util.SQLStateUndefinedObject, "role %s does not exist", name)
 	}
 	delete(rs.Roles, name)
 	return nil
@@ -218,7 +280,7 @@ func (rs *RoleStore) GrantPrivilege(roleName, objectKey, privilege string) error
 
 	role, exists := rs.Roles[roleName]
 	if !exists {
-		return fmt.Errorf("role %s does not exist", roleName)
+		return util.NewSQLError(util.SQLStateUndefinedObject, "role %s does not exist", roleName)
 	}
 
 	if role.Privileges == nil {
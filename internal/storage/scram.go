@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SCRAMIterations is the PBKDF2 iteration count of new SCRAM verifiers,
+// the same default as PostgreSQL's scram_iterations
+const SCRAMIterations = 4096
+
+// scramSaltLength is the length in bytes of the random salt of new verifiers
+const scramSaltLength = 16
+
+// SCRAMVerifier holds the salted SCRAM-SHA-256 secret of a password. It is
+// stored in pg_authid in PostgreSQL's format:
+//
+//	SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+type SCRAMVerifier struct {
+	Iterations int
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewSCRAMVerifier derives a verifier for password with a fresh random salt
+func NewSCRAMVerifier(password string) *SCRAMVerifier {
+	salt := make([]byte, scramSaltLength)
+	rand.Read(salt)
+	return DeriveSCRAMVerifier(password, salt, SCRAMIterations)
+}
+
+// DeriveSCRAMVerifier derives the verifier of password for a given salt and
+// iteration count (RFC 5802)
+func DeriveSCRAMVerifier(password string, salt []byte, iterations int) *SCRAMVerifier {
+	salted := SCRAMSaltedPassword(password, salt, iterations)
+	clientKey := SCRAMHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	return &SCRAMVerifier{
+		Iterations: iterations,
+		Salt:       salt,
+		StoredKey:  storedKey[:],
+		ServerKey:  SCRAMHMAC(salted, "Server Key"),
+	}
+}
+
+// ParseSCRAMVerifier parses a verifier in PostgreSQL's format
+func ParseSCRAMVerifier(s string) (*SCRAMVerifier, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 3 || parts[0] != "SCRAM-SHA-256" {
+		return nil, fmt.Errorf("not a SCRAM-SHA-256 verifier")
+	}
+	iterSalt := strings.SplitN(parts[1], ":", 2)
+	keys := strings.SplitN(parts[2], ":", 2)
+	if len(iterSalt) != 2 || len(keys) != 2 {
+		return nil, fmt.Errorf("malformed SCRAM-SHA-256 verifier")
+	}
+
+	iterations, err := strconv.Atoi(iterSalt[0])
+	if err != nil || iterations <= 0 {
+		return nil, fmt.Errorf("invalid SCRAM iteration count %q", iterSalt[0])
+	}
+	v := &SCRAMVerifier{Iterations: iterations}
+	for _, field := range []struct {
+		dst *[]byte
+		src string
+	}{{&v.Salt, iterSalt[1]}, {&v.StoredKey, keys[0]}, {&v.ServerKey, keys[1]}} {
+		decoded, err := base64.StdEncoding.DecodeString(field.src)
+		if err != nil {
+			return nil, fmt.Errorf("malformed SCRAM-SHA-256 verifier: %w", err)
+		}
+		*field.dst = decoded
+	}
+	if len(v.StoredKey) != sha256.Size || len(v.ServerKey) != sha256.Size {
+		return nil, fmt.Errorf("malformed SCRAM-SHA-256 verifier: bad key length")
+	}
+	return v, nil
+}
+
+// String renders the verifier in PostgreSQL's format
+func (v *SCRAMVerifier) String() string {
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s",
+		v.Iterations, b64(v.Salt), b64(v.StoredKey), b64(v.ServerKey))
+}
+
+// VerifyPassword checks a cleartext password against the verifier
+func (v *SCRAMVerifier) VerifyPassword(password string) bool {
+	other := DeriveSCRAMVerifier(password, v.Salt, v.Iterations)
+	return subtle.ConstantTimeCompare(other.StoredKey, v.StoredKey) == 1
+}
+
+// SCRAMSaltedPassword computes Hi(password, salt, iterations), i.e. PBKDF2
+// with HMAC-SHA-256. Passwords are used as is, without SASLprep normalization.
+func SCRAMSaltedPassword(password string, salt []byte, iterations int) []byte {
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		// Only possible with FIPS 140-only restrictions on short passwords
+		panic(fmt.Sprintf("scram: %v", err))
+	}
+	return key
+}
+
+// SCRAMHMAC computes HMAC-SHA-256(key, message)
+func SCRAMHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Cursor represents a declared SQL cursor
@@ -22,16 +27,61 @@ type Session struct {
 	Variables        map[string]string
 	TxLocalVariables map[string]string            // Original variable values saved before SET LOCAL
 	TxActive         bool
+	TxAborted        bool                         // A statement failed inside the transaction block
+	TxImplicit       bool                         // Block opened for a multi-statement query, not by BEGIN
 	TxTables         map[string]*Table            // Table copies modified during transaction
 	TxSavepoints     map[string]map[string]*Table // Table copies cloned at savepoints
+	TxNotifications  []Notification               // Sent by NOTIFY, delivered at COMMIT
 	Cursors          map[string]*Cursor
+	ProcessID        int32 // Backend key sent to the client in BackendKeyData
+	SecretKey        int32
+	ClientAddr       string // Empty for Unix-domain socket connections
+	ClientPort       int
+	BackendStart     time.Time
+	activity         SessionActivity // Guarded by mu
+	queryActive      atomic.Bool
+	cancelPending    atomic.Bool
+	terminating      atomic.Bool
+	terminate        chan struct{} // Closed by Terminate
+	terminateOnce    sync.Once
+	listen           listenState
+	admittedUser     string // Login counted against connection limits, guarded by SessionManager.mu
 	mu               sync.RWMutex
 }
 
 var DefaultSessionVariables = map[string]string{
-	"search_path": "public",
-	"work_mem":    "4MB",
-	"timezone":    "UTC",
+	"search_path":                         "public",
+	"work_mem":                            "4MB",
+	"timezone":                            "UTC",
+	"client_min_messages":                 "notice",
+	"application_name":                    "",
+	"client_encoding":                     "UTF8",
+	"datestyle":                           "ISO, MDY",
+	"extra_float_digits":                  "1",
+	"standard_conforming_strings":         "on",
+	"statement_timeout":                   "0",
+	"lock_timeout":                        "0",
+	"idle_in_transaction_session_timeout": "0",
+}
+
+// messageLevels orders the values of client_min_messages
+var messageLevels = map[string]int{
+	"debug5":  0,
+	"debug4":  1,
+	"debug3":  2,
+	"debug2":  3,
+	"debug1":  4,
+	"debug":   4,
+	"log":     5,
+	"notice":  6,
+	"warning": 7,
+	"error":   8,
+}
+
+// IsMessageLevel reports whether level is a valid client_min_messages value
+func IsMessageLevel(level string) bool {
+	_, ok := messageLevels[strings.ToLower(level)]
+	return ok
 }
 
 // NewSession creates a new client session
@@ -48,6 +98,10 @@ func NewSession(id string) *Session {
 		TxTables:         make(map[string]*Table),
 		TxSavepoints:     make(map[string]map[string]*Table),
 		Cursors:          make(map[string]*Cursor),
+		BackendStart:     time.Now(),
+		ClientPort:       -1,
+		terminate:        make(chan struct{}),
+		listen:           newListenState(),
 	}
 }
 
@@ -89,9 +143,93 @@ func (s *Session) GetUser() string {
 	return s.User
 }
 
+// AbortTransaction puts an open transaction block into the failed state,
+// in which only ROLLBACK and ROLLBACK TO SAVEPOINT are accepted
+func (s *Session) AbortTransaction() {
+	if s.TxActive {
+		s.TxAborted = true
+	}
+}
+
+// TransactionStatus returns the ReadyForQuery status indicator: 'I' when
+// idle, 'T' inside a transaction block and 'E' inside a failed one
+func (s *Session) TransactionStatus() byte {
+	switch {
+	case s.TxActive && s.TxAborted:
+		return 'E'
+	case s.TxActive:
+		return 'T'
+	default:
+		return 'I'
+	}
+}
+
+// WantsNotice reports whether a notice of the given severity passes the
+// client_min_messages filter. INFO messages are always sent.
+func (s *Session) WantsNotice(severity string) bool {
+	severity = strings.ToLower(severity)
+	if severity == "info" {
+		return true
+	}
+	minLevel, ok := messageLevels[strings.ToLower(s.GetVariable("client_min_messages"))]
+	if !ok {
+		minLevel = messageLevels["notice"]
+	}
+	level, ok := messageLevels[severity]
+	return !ok || level >= minLevel
+}
+
+// BeginQuery marks the start of a statement that may be canceled
+func (s *Session) BeginQuery() {
+	s.cancelPending.Store(false)
+	s.queryActive.Store(true)
+}
+
+// EndQuery marks the end of the running statement; a cancel request that
+// arrives afterwards is ignored
+func (s *Session) EndQuery() {
+	s.queryActive.Store(false)
+	s.cancelPending.Store(false)
+}
+
+// Cancel requests cancellation of the running statement. It returns false if
+// the session is idle.
+func (s *Session) Cancel() bool {
+	if !s.queryActive.Load() {
+		return false
+	}
+	s.cancelPending.Store(true)
+	return true
+}
+
+// CancelPending reports whether the running statement has been canceled
+func (s *Session) CancelPending() bool {
+	return s.cancelPending.Load()
+}
+
+// Terminate asks the session's connection to close. The running statement
+// is interrupted and the connection is closed once it is idle.
+func (s *Session) Terminate() {
+	s.terminateOnce.Do(func() {
+		s.terminating.Store(true)
+		close(s.terminate)
+	})
+}
+
+// Terminating reports whether Terminate has been called
+func (s *Session) Terminating() bool {
+	return s.terminating.Load()
+}
+
+// TerminateSignal returns a channel that is closed by Terminate
+func (s *Session) TerminateSignal() <-chan struct{} {
+	return s.terminate
+}
+
 // SessionManager manages all active client sessions
 type SessionManager struct {
 	sessions map[string]*Session
+	lastPID  int32
 	mu       sync.RWMutex
 }
 
@@ -108,10 +246,41 @@ func (sm *SessionManager) CreateSession(id string) *Session {
 	defer sm.mu.Unlock()
 	
 	session := NewSession(id)
+	sm.lastPID++
+	session.ProcessID = sm.lastPID
+	var key [4]byte
+	rand.Read(key[:])
+	session.SecretKey = int32(binary.BigEndian.Uint32(key[:]))
 	sm.sessions[id] = session
 	return session
 }
 
+// FindByBackendKey returns the session identified by a CancelRequest
+func (sm *SessionManager) FindByBackendKey(processID, secretKey int32) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, session := range sm.sessions {
+		if session.ProcessID == processID && session.SecretKey == secretKey {
+			return session, true
+		}
+	}
+	return nil, false
+}
+
+// FindByPID returns the session with the given backend process ID
+func (sm *SessionManager) FindByPID(processID int32) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, session := range sm.sessions {
+		if session.ProcessID == processID {
+			return session, true
+		}
+	}
+	return nil, false
+}
+
 // GetSession retrieves a session by ID
 func (sm *SessionManager) GetSession(id string) (*Session, error) {
 	sm.mu.RLock()
@@ -191,6 +360,13 @@ func (s *Session) GetCursor(name string) (*Cursor, bool) {
 	return cursor, exists
 }
 
+// CloseCursors removes all cursors of the session
+func (s *Session) CloseCursors() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Cursors = make(map[string]*Cursor)
+}
+
 // DeleteCursor deletes a cursor from the session in a thread-safe manner
 func (s *Session) DeleteCursor(name string) bool {
 	s.mu.Lock()
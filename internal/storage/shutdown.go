@@ -0,0 +1,100 @@
+package storage
+
+import "time"
+
+// ShutdownMode is how the server ends client sessions when it stops, as
+// with pg_ctl stop -m
+type ShutdownMode int32
+
+const (
+	ShutdownNone ShutdownMode = iota
+	// ShutdownSmart waits for clients to disconnect
+	ShutdownSmart
+	// ShutdownFast waits up to shutdown_timeout for open transactions and
+	// running statements to finish, then terminates the sessions
+	ShutdownFast
+	// ShutdownImmediate terminates all sessions at once and skips the final
+	// checkpoint; the next start replays the WAL
+	ShutdownImmediate
+)
+
+// drainPollInterval is how often DrainSessions checks the open sessions
+const drainPollInterval = 20 * time.Millisecond
+
+func (m ShutdownMode) String() string {
+	switch m {
+	case ShutdownSmart:
+		return "smart"
+	case ShutdownFast:
+		return "fast"
+	case ShutdownImmediate:
+		return "immediate"
+	}
+	return "none"
+}
+
+// RequestShutdown starts a shutdown, or escalates one already in progress
+// to a faster mode. It reports false if mode is not faster than the current
+// one. New connections are refused from then on.
+func (db *Database) RequestShutdown(mode ShutdownMode) bool {
+	for {
+		current := db.shutdownMode.Load()
+		if int32(mode) <= current {
+			return false
+		}
+		if db.shutdownMode.CompareAndSwap(current, int32(mode)) {
+			db.Logger.Info("Received %s shutdown request", mode)
+			return true
+		}
+	}
+}
+
+// ShutdownMode returns the mode of the shutdown in progress
+func (db *Database) ShutdownMode() ShutdownMode {
+	return ShutdownMode(db.shutdownMode.Load())
+}
+
+// ShuttingDown reports whether a shutdown has been requested
+func (db *Database) ShuttingDown() bool {
+	return db.ShutdownMode() != ShutdownNone
+}
+
+// DrainSessions ends the client sessions as the shutdown mode requires and
+// returns once all of them are closed. The mode may be escalated while it
+// waits. Terminated sessions roll back their transactions as they close.
+func (db *Database) DrainSessions() {
+	var fastSince time.Time
+	for {
+		sessions := db.SessionMgr.Sessions()
+		if len(sessions) == 0 {
+			return
+		}
+
+		mode := db.ShutdownMode()
+		if mode >= ShutdownFast && fastSince.IsZero() {
+			fastSince = time.Now()
+		}
+		expired := !fastSince.IsZero() && time.Since(fastSince) >= db.Config.ShutdownTimeout
+		for _, s := range sessions {
+			switch {
+			case mode == ShutdownImmediate, mode == ShutdownFast && expired:
+				s.Terminate()
+			case mode == ShutdownFast && s.Activity().State == StateIdle:
+				// Nothing is lost by ending a session between transactions
+				s.Terminate()
+			}
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+// BeginStatement is called before a statement runs. Shutdown waits for
+// running statements to finish before it saves the tables.
+func (db *Database) BeginStatement() {
+	db.statementMu.RLock()
+}
+
+// EndStatement is called once a statement has finished
+func (db *Database) EndStatement() {
+	db.statementMu.RUnlock()
+}
@@ -19,6 +19,25 @@ const (
 	SlotSize              = 4  // Offset(2) + Length(2)
 )
 
+// Slot flags, kept in the top bits of the slot length and offset. A deleted
+// tuple is dead, keeping its space and its other flags until VACUUM makes
+// the slot unused, with offset and length 0, so that it can be reused.
+const (
+	slotRedirect = 0x8000 // The tuple moved to another page; the data is its TID
+	slotMoved    = 0x4000 // The data starts with the TID of the tuple's home slot
+	slotDead     = 0x2000 // The tuple was deleted
+	slotToast    = 0x1000 // The data is a chunk of an out-of-line value
+
+	slotLengthMask = 0x3FFF // Also masks the offset
+	// The flags in the offset are shifted down past those in the length
+	slotOffsetFlags     = slotDead | slotToast
+	slotOffsetFlagShift = 2
+
+	// Every tuple reserves room for a redirect, so that it can always be
+	// replaced by one
+	minTupleSize = tidSize
+)
+
 // NewSlottedPage creates a new slotted page
 func NewSlottedPage(pageID uint64) *SlottedPage {
 	sp := &SlottedPage{
@@ -47,12 +66,11 @@ func LoadSlottedPage(data [PageSize]byte) *SlottedPage {
 	sp.NumSlots = binary.LittleEndian.Uint16(data[8:10])
 	sp.FreeStart = binary.LittleEndian.Uint16(data[10:12])
 
-	// Calculate free end
+	// Calculate free end, skipping unused slots
 	sp.FreeEnd = PageSize
 	for i := uint16(0); i < sp.NumSlots; i++ {
-		slotOffset := SlottedPageHeaderSize + (i * SlotSize)
-		offset := binary.LittleEndian.Uint16(sp.Data[slotOffset : slotOffset+2])
-		if offset < sp.FreeEnd {
+		offset, _, _ := sp.slot(i)
+		if offset != 0 && offset < sp.FreeEnd {
 			sp.FreeEnd = offset
 		}
 	}
@@ -60,30 +78,68 @@ func LoadSlottedPage(data [PageSize]byte) *SlottedPage {
 	return sp
 }
 
+// slot returns the location, length and flags of a slot's data
+func (sp *SlottedPage) slot(slotID uint16) (offset, length, flags uint16) {
+	slotOffset := SlottedPageHeaderSize + (slotID * SlotSize)
+	rawOffset := binary.LittleEndian.Uint16(sp.Data[slotOffset : slotOffset+2])
+	raw := binary.LittleEndian.Uint16(sp.Data[slotOffset+2 : slotOffset+4])
+	flags = raw&^slotLengthMask | (rawOffset&^slotLengthMask)>>slotOffsetFlagShift
+	return rawOffset & slotLengthMask, raw & slotLengthMask, flags
+}
+
+// setSlot points a slot at its data
+func (sp *SlottedPage) setSlot(slotID, offset, length, flags uint16) {
+	slotOffset := SlottedPageHeaderSize + (slotID * SlotSize)
+	binary.LittleEndian.PutUint16(sp.Data[slotOffset:], offset|(flags&slotOffsetFlags)<<slotOffsetFlagShift)
+	binary.LittleEndian.PutUint16(sp.Data[slotOffset+2:], length|flags&^slotOffsetFlags)
+}
+
+// FreeSpace returns the bytes left between the slot array and the tuples
+func (sp *SlottedPage) FreeSpace() int {
+	return int(sp.FreeEnd) - int(sp.FreeStart)
+}
+
+// allocate reserves room for n bytes of tuple data and returns its offset
+func (sp *SlottedPage) allocate(n int) (uint16, bool) {
+	if n < minTupleSize {
+		n = minTupleSize
+	}
+	if n > sp.FreeSpace() {
+		return 0, false
+	}
+	sp.FreeEnd -= uint16(n)
+	return sp.FreeEnd, true
+}
+
 // InsertRow inserts a row into the page
 func (sp *SlottedPage) InsertRow(rowData []byte) (uint16, error) {
-	rowLen := uint16(len(rowData))
+	return sp.insertTuple(rowData, 0)
+}
 
+// insertTuple adds tuple data with the given slot flags in a new slot
+func (sp *SlottedPage) insertTuple(data []byte, flags uint16) (uint16, error) {
 	// Check if we have space
-	spaceNeeded := rowLen + SlotSize
-	freeSpace := sp.FreeEnd - sp.FreeStart
-
-	if freeSpace < spaceNeeded {
+	if sp.IsFull(uint16(len(data))) || len(data) > slotLengthMask {
 		return 0, fmt.Errorf("not enough space in page")
 	}
 
 	// Insert row data at the end (growing backwards)
-	sp.FreeEnd -= rowLen
-	copy(sp.Data[sp.FreeEnd:], rowData)
-
-	// Add slot entry
-	slotOffset := sp.FreeStart
-	binary.LittleEndian.PutUint16(sp.Data[slotOffset:], sp.FreeEnd) // Offset
-	binary.LittleEndian.PutUint16(sp.Data[slotOffset+2:], rowLen)   // Length
+	offset, _ := sp.allocate(len(data))
+	copy(sp.Data[offset:], data)
 
+	// Add slot entry, reusing an unused one
 	slotID := sp.NumSlots
-	sp.NumSlots++
-	sp.FreeStart += SlotSize
+	for i := uint16(0); i < sp.NumSlots; i++ {
+		if sp.unused(i) {
+			slotID = i
+			break
+		}
+	}
+	sp.setSlot(slotID, offset, uint16(len(data)), flags)
+	if slotID == sp.NumSlots {
+		sp.NumSlots++
+		sp.FreeStart += SlotSize
+	}
 
 	// Update header
 	sp.writeHeader()
@@ -91,22 +147,50 @@ func (sp *SlottedPage) InsertRow(rowData []byte) (uint16, error) {
 	return slotID, nil
 }
 
+// homeTuple reports whether slot flags are those of a row's home slot,
+// rather than of its moved version or of a chunk of an out-of-line value
+func homeTuple(flags uint16) bool {
+	return flags&(slotMoved|slotToast) == 0
+}
+
+// unused reports whether a slot holds nothing and can be reused
+func (sp *SlottedPage) unused(slotID uint16) bool {
+	offset, length, _ := sp.slot(slotID)
+	return offset == 0 && length == 0
+}
+
+// tuple returns the data and flags of a slot, or false for a dead or
+// unused slot. The data is not copied.
+func (sp *SlottedPage) tuple(slotID uint16) ([]byte, uint16, bool) {
+	if slotID >= sp.NumSlots {
+		return nil, 0, false
+	}
+	offset, length, flags := sp.slot(slotID)
+	if (offset == 0 && length == 0) || flags&slotDead != 0 {
+		return nil, 0, false
+	}
+	return sp.Data[offset : offset+length], flags, true
+}
+
 // GetRow retrieves a row by slot ID
 func (sp *SlottedPage) GetRow(slotID uint16) ([]byte, error) {
 	if slotID >= sp.NumSlots {
 		return nil, fmt.Errorf("invalid slot ID: %d", slotID)
 	}
 
-	slotOffset := SlottedPageHeaderSize + (slotID * SlotSize)
-	offset := binary.LittleEndian.Uint16(sp.Data[slotOffset : slotOffset+2])
-	length := binary.LittleEndian.Uint16(sp.Data[slotOffset+2 : slotOffset+4])
-
-	if offset == 0 && length == 0 {
+	data, flags, ok := sp.tuple(slotID)
+	if !ok {
 		return nil, fmt.Errorf("row has been deleted")
 	}
+	switch {
+	case flags&slotRedirect != 0:
+		return nil, fmt.Errorf("row has moved to another page")
+	case flags&slotMoved != 0:
+		data = data[tidSize:]
+	}
 
-	rowData := make([]byte, length)
-	copy(rowData, sp.Data[offset:offset+length])
+	rowData := make([]byte, len(data))
+	copy(rowData, data)
 
 	return rowData, nil
 }
@@ -125,9 +209,82 @@ func (sp *SlottedPage) GetAllRows() [][]byte {
 	return rows
 }
 
+// DeleteRow marks the tuple in a slot dead. Its space and the slot are
+// only reclaimed by VACUUM, so TIDs stay stable.
+func (sp *SlottedPage) DeleteRow(slotID uint16) error {
+	if _, _, ok := sp.tuple(slotID); !ok {
+		return fmt.Errorf("invalid slot ID: %d", slotID)
+	}
+	offset, length, flags := sp.slot(slotID)
+	sp.setSlot(slotID, offset, length, flags|slotDead)
+	return nil
+}
+
+// compact moves the tuples of the page together at its end, reclaiming the
+// space of dead tuples and of tuples that shrank. Dead slots become unused
+// and unused slots at the end of the slot array are removed; live tuples
+// keep their slots. It returns the number of dead rows removed.
+func (sp *SlottedPage) compact() int {
+	old := sp.Data
+	removed := 0
+	end := uint16(PageSize)
+	for i := uint16(0); i < sp.NumSlots; i++ {
+		offset, length, flags := sp.slot(i)
+		switch {
+		case flags&slotDead != 0:
+			sp.setSlot(i, 0, 0, 0)
+			if homeTuple(flags) {
+				removed++
+			}
+		case offset == 0 && length == 0:
+		default:
+			// Keep room for a redirect, as allocate does
+			size := length
+			if size < minTupleSize {
+				size = minTupleSize
+			}
+			end -= size
+			copy(sp.Data[end:], old[offset:offset+length])
+			sp.setSlot(i, end, length, flags)
+		}
+	}
+	for sp.NumSlots > 0 && sp.unused(sp.NumSlots-1) {
+		sp.NumSlots--
+	}
+	sp.FreeStart = SlottedPageHeaderSize + sp.NumSlots*SlotSize
+	sp.FreeEnd = end
+	clear(sp.Data[sp.FreeStart:sp.FreeEnd])
+	sp.writeHeader()
+	return removed
+}
+
+// UpdateRow replaces the data of a slot, in place if it fits in the old
+// tuple's space and otherwise in the page's free space. It reports false,
+// leaving the slot unchanged, if the page has no room.
+func (sp *SlottedPage) UpdateRow(slotID uint16, data []byte, flags uint16) bool {
+	offset, length, _ := sp.slot(slotID)
+	if _, _, ok := sp.tuple(slotID); !ok || len(data) > slotLengthMask {
+		return false
+	}
+	if length < minTupleSize {
+		length = minTupleSize
+	}
+	if len(data) > int(length) {
+		var ok bool
+		if offset, ok = sp.allocate(len(data)); !ok {
+			return false
+		}
+	}
+	copy(sp.Data[offset:], data)
+	sp.setSlot(slotID, offset, uint16(len(data)), flags)
+	return true
+}
+
 // IsFull checks if the page can fit more data
 func (sp *SlottedPage) IsFull(dataSize uint16) bool {
-	spaceNeeded := dataSize + SlotSize
-	freeSpace := sp.FreeEnd - sp.FreeStart
-	return freeSpace < spaceNeeded
+	if dataSize < minTupleSize {
+		dataSize = minTupleSize
+	}
+	spaceNeeded := int(dataSize) + SlotSize
+	return sp.FreeSpace() < spaceNeeded
 }
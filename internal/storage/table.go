@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/ghosecorp/ghostsql/internal/metadata"
+	"github.com/ghosecorp/ghostsql/internal/util"
 )
 
 // Column represents a table column definition
@@ -41,13 +42,17 @@ type Table struct {
 	Name          string
 	Owner         string                // PostgreSQL-standard: creator/owner of the table
 	Columns       []Column
-	Rows          []Row // In-memory cache
-	Pages         []*SlottedPage
-	PageMgr       *PageManager
+	PageMgr       *PageManager          // Table file, read through the buffer pool
 	Metadata      *metadata.Metadata
 	VectorIndexes map[string]*HNSWIndex // column_name -> index
 	RLSEnabled    bool                  // Row-Level Security enabled
 	Policies      []Policy              // RLS policies
+	numPages      int                     // Tuples, addressed by TID
+	modified      map[uint32]*SlottedPage // Pages changed since the last commit
+	freeSpace     []uint16                // Free space map: free bytes by page
+	stats         *tableStats             // Shared with clones
+	virtual       bool                    // Rows are computed, not stored in pages
+	rows          []Row                   // Rows of a virtual table
 	mu            sync.RWMutex
 }
 
@@ -63,54 +68,64 @@ func NewTable(name, owner string, columns []Column, meta *metadata.Metadata) *Ta
 		Name:          name,
 		Owner:         owner,
 		Columns:       columns,
-		Rows:          make([]Row, 0),
-		Pages:         make([]*SlottedPage, 0),
 		Metadata:      meta,
 		VectorIndexes: make(map[string]*HNSWIndex),
+		stats:         &tableStats{},
 	}
 }
 
 // Insert adds a new row to the table
 func (t *Table) Insert(row Row) error {
+	_, err := t.InsertTuple(row)
+	return err
+}
+
+// InsertBatch adds many rows at once, as COPY FROM does. All rows are
+// encoded before the table is modified, and they are packed into the last
+// page and new pages instead of searching every page for free space per row.
+func (t *Table) InsertBatch(rows []Row) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Validate row has all required columns
-	for _, col := range t.Columns {
-		if _, exists := row[col.Name]; !exists && !col.Nullable {
-			return fmt.Errorf("missing required column: %s", col.Name)
+	if t.virtual {
+		return fmt.Errorf("cannot modify %s", t.Name)
+	}
+	for _, row := range rows {
+		if err := t.checkRequired(row); err != nil {
+			return err
 		}
 	}
-
-	// Encode row to binary
-	rowData, err := EncodeRow(t.Columns, row)
-	if err != nil {
-		return fmt.Errorf("failed to encode row: %w", err)
+	encoded := make([][]byte, len(rows))
+	stored := make([]Row, 0, len(rows))
+	for i, row := range rows {
+		rowData, storedRow, err := t.encodeRow(row, nil)
+		if err != nil {
+			for _, row := range stored {
+				t.freeToast(row, nil)
+			}
+			return err
+		}
+		encoded[i] = rowData
+		stored = append(stored, storedRow)
 	}
 
-	// Find or create a page with space
 	var targetPage *SlottedPage
-	for _, page := range t.Pages {
-		if !page.IsFull(uint16(len(rowData))) {
-			targetPage = page
-			break
+	var pageNo uint32
+	for _, rowData := range encoded {
+		if targetPage == nil || targetPage.IsFull(uint16(len(rowData))) {
+			page, n, err := t.lastPageFor(len(rowData))
+			if err != nil {
+				return err
+			}
+			targetPage, pageNo = page, n
 		}
+		if _, err := targetPage.InsertRow(rowData); err != nil {
+			return fmt.Errorf("failed to insert into page: %w", err)
+		}
+		t.setFreeSpace(pageNo, targetPage)
 	}
+	t.stats.inserted.Add(int64(len(rows)))
 
-	if targetPage == nil {
-		// Create new page
-		pageID := uint64(len(t.Pages))
-		targetPage = NewSlottedPage(pageID)
-		t.Pages = append(t.Pages, targetPage)
-	}
-
-	// Insert into page
-	if _, err := targetPage.InsertRow(rowData); err != nil {
-		return fmt.Errorf("failed to insert into page: %w", err)
-	}
-
-	// Also keep in memory for now
-	t.Rows = append(t.Rows, row)
 	return nil
 }
 
@@ -119,23 +134,31 @@ func (t *Table) Select(columnNames []string, where *WhereClause) ([]Row, error)
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	// For now, scan from in-memory rows
-	// TODO: Scan from pages directly for true binary storage
 	results := make([]Row, 0)
 
-	for _, row := range t.Rows {
+	err := t.scan(func(tuple Tuple) error {
+		row := tuple.Row
 		// Apply WHERE filter
 		if where != nil {
+			if err := t.detoast(row, whereColumns(row, where)); err != nil {
+				return err
+			}
 			if !evaluateWhere(row, where) {
-				continue
+				return nil
 			}
 		}
 
 		if len(columnNames) == 1 && columnNames[0] == "*" {
 			// Return all columns
+			if err := t.detoast(row, nil); err != nil {
+				return err
+			}
 			results = append(results, row)
 		} else {
-			// Project specific columns
+			// Project specific columns, reading only their out-of-line values
+			if err := t.detoast(row, columnNames); err != nil {
+				return err
+			}
 			projected := make(Row)
 			for _, colName := range columnNames {
 				if val, exists := row[colName]; exists {
@@ -144,6 +167,10 @@ func (t *Table) Select(columnNames []string, where *WhereClause) ([]Row, error)
 			}
 			results = append(results, projected)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return results, nil
@@ -351,42 +378,24 @@ func (t *Table) GetColumnNames() []string {
 	return names
 }
 
-// LoadFromPages reconstructs the table from binary pages
-func (t *Table) LoadFromPages() error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	t.Rows = make([]Row, 0)
-
-	for _, page := range t.Pages {
-		rowsData := page.GetAllRows()
-		for _, rowData := range rowsData {
-			row, err := DecodeRow(t.Columns, rowData)
-			if err != nil {
-				return fmt.Errorf("failed to decode row: %w", err)
-			}
-			t.Rows = append(t.Rows, row)
-		}
-	}
-
-	return nil
-}
-
 // Update updates rows matching the WHERE clause
 func (t *Table) Update(updates map[string]interface{}, where *WhereClause) (int, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	tuples, err := t.matching(where)
+	if err != nil {
+		return 0, err
+	}
 	updatedCount := 0
 
-	for i := range t.Rows {
-		if where != nil && !evaluateWhere(t.Rows[i], where) {
-			continue
-		}
-
+	for _, tuple := range tuples {
 		// Update the row
 		for colName, newValue := range updates {
-			t.Rows[i][colName] = newValue
+			tuple.Row[colName] = newValue
+		}
+		if err := t.updateTuple(tuple.TID, tuple.Row); err != nil {
+			return updatedCount, err
 		}
 		updatedCount++
 	}
@@ -399,26 +408,19 @@ func (t *Table) Delete(where *WhereClause) (int, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if where == nil {
-		// Delete all rows
-		count := len(t.Rows)
-		t.Rows = make([]Row, 0)
-		return count, nil
+	tuples, err := t.matching(where)
+	if err != nil {
+		return 0, err
 	}
-
-	// Filter out rows that match the WHERE clause
-	newRows := make([]Row, 0)
 	deletedCount := 0
 
-	for _, row := range t.Rows {
-		if evaluateWhere(row, where) {
-			deletedCount++
-		} else {
-			newRows = append(newRows, row)
+	for _, tuple := range tuples {
+		if err := t.deleteTuple(tuple.TID); err != nil {
+			return deletedCount, err
 		}
+		deletedCount++
 	}
 
-	t.Rows = newRows
 	return deletedCount, nil
 }
 
@@ -427,8 +429,58 @@ func (t *Table) Truncate() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.Rows = make([]Row, 0)
-	t.Pages = make([]*SlottedPage, 0)
+	t.modified = make(map[uint32]*SlottedPage)
+	t.numPages = 0
+	t.freeSpace = nil
+	return nil
+}
+
+// matching collects the tuples matching where before any of them is
+// changed, so that a tuple moved by an update is not visited twice. Only
+// the out-of-line values where looks at are read. The caller holds t.mu.
+func (t *Table) matching(where *WhereClause) ([]Tuple, error) {
+	tuples := make([]Tuple, 0)
+	err := t.scan(func(tuple Tuple) error {
+		if where != nil {
+			if err := t.detoast(tuple.Row, whereColumns(tuple.Row, where)); err != nil {
+				return err
+			}
+		}
+		if where == nil || evaluateWhere(tuple.Row, where) {
+			tuples = append(tuples, tuple)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tuples, nil
+}
+
+// alter applies a schema change: the rows are decoded with the old columns,
+// passed through transform, and written back in new pages encoded with the
+// new columns. The caller holds t.mu.
+func (t *Table) alter(columns []Column, transform func(Row) error) error {
+	tuples, err := t.tuples()
+	if err != nil {
+		return err
+	}
+	rows := make([]Row, len(tuples))
+	for i, tuple := range tuples {
+		if transform != nil {
+			if err := transform(tuple.Row); err != nil {
+				return err
+			}
+		}
+		rows[i] = tuple.Row
+	}
+
+	oldColumns := t.Columns
+	t.Columns = columns
+	if err := t.rewrite(rows); err != nil {
+		t.Columns = oldColumns
+		return err
+	}
 	return nil
 }
 
@@ -440,19 +492,13 @@ func (t *Table) AddColumn(col Column) error {
 	// Check if column already exists
 	for _, existingCol := range t.Columns {
 		if existingCol.Name == col.Name {
-			return fmt.Errorf("column %s already exists", col.Name)
+			return util.NewSQLError(util.SQLStateDuplicateColumn, "column %s already exists", col.Name).WithColumn(t.Name, col.Name)
 		}
 	}
 
-	// Add column to schema
-	t.Columns = append(t.Columns, col)
-
-	// Add NULL values to existing rows
-	for i := range t.Rows {
-		t.Rows[i][col.Name] = nil
-	}
-
-	return nil
+	// Add column to schema; existing rows get NULL values
+	columns := append(append([]Column{}, t.Columns...), col)
+	return t.alter(columns, nil)
 }
 
 // matchLike performs SQL LIKE pattern matching
@@ -532,18 +578,12 @@ func (t *Table) DropColumn(colName string, ifExists bool) error {
 		if ifExists {
 			return nil
 		}
-		return fmt.Errorf("column %s does not exist", colName)
+		return util.NewSQLError(util.SQLStateUndefinedColumn, "column %s does not exist", colName).WithColumn(t.Name, colName)
 	}
 
 	// Remove from Columns
-	t.Columns = append(t.Columns[:foundIdx], t.Columns[foundIdx+1:]...)
-
-	// Remove from Rows
-	for i := range t.Rows {
-		delete(t.Rows[i], colName)
-	}
-
-	return nil
+	columns := append(append([]Column{}, t.Columns[:foundIdx]...), t.Columns[foundIdx+1:]...)
+	return t.alter(columns, nil)
 }
 
 // RenameColumn renames a column in the table
@@ -551,27 +591,27 @@ func (t *Table) RenameColumn(oldName, newName string) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	columns := append([]Column{}, t.Columns...)
 	found := false
-	for i, col := range t.Columns {
+	for i, col := range columns {
 		if col.Name == oldName {
-			t.Columns[i].Name = newName
+			columns[i].Name = newName
 			found = true
 			break
 		}
 	}
 
 	if !found {
-		return fmt.Errorf("column %s does not exist", oldName)
+		return util.NewSQLError(util.SQLStateUndefinedColumn, "column %s does not exist", oldName).WithColumn(t.Name, oldName)
 	}
 
-	for i := range t.Rows {
-		if val, exists := t.Rows[i][oldName]; exists {
-			t.Rows[i][newName] = val
-			delete(t.Rows[i], oldName)
+	return t.alter(columns, func(row Row) error {
+		if val, exists := row[oldName]; exists {
+			row[newName] = val
+			delete(row, oldName)
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
 // AlterColumnType alters a column's datatype, converting existing values
@@ -579,24 +619,25 @@ func (t *Table) AlterColumnType(colName string, newType DataType) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	columns := append([]Column{}, t.Columns...)
 	found := false
-	for i, col := range t.Columns {
+	for i, col := range columns {
 		if col.Name == colName {
-			t.Columns[i].Type = newType
+			columns[i].Type = newType
 			found = true
 			break
 		}
 	}
 
 	if !found {
-		return fmt.Errorf("column %s does not exist", colName)
+		return util.NewSQLError(util.SQLStateUndefinedColumn, "column %s does not exist", colName).WithColumn(t.Name, colName)
 	}
 
 	// Convert all existing values
-	for i := range t.Rows {
-		val, exists := t.Rows[i][colName]
+	return t.alter(columns, func(row Row) error {
+		val, exists := row[colName]
 		if !exists || val == nil {
-			continue
+			return nil
 		}
 
 		var converted interface{}
@@ -663,13 +704,14 @@ func (t *Table) AlterColumnType(colName string, newType DataType) error {
 		if err != nil {
 			return fmt.Errorf("failed to alter column type for column %s: %w", colName, err)
 		}
-		t.Rows[i][colName] = converted
-	}
-
-	return nil
+		row[colName] = converted
+		return nil
+	})
 }
 
-// Clone returns a deep copy of the Table
+// Clone returns a transaction copy of the Table. Pages are shared with the
+// original until they are modified, so callers must hold the table write lock
+// until the copy is committed or discarded
 func (t *Table) Clone() *Table {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -677,15 +719,15 @@ func (t *Table) Clone() *Table {
 	clonedCols := make([]Column, len(t.Columns))
 	copy(clonedCols, t.Columns)
 
-	clonedRows := make([]Row, len(t.Rows))
-	for i, r := range t.Rows {
-		clonedRow := make(Row)
-		for k, v := range r {
-			clonedRow[k] = v
-		}
-		clonedRows[i] = clonedRow
+	clonedPages := make(map[uint32]*SlottedPage, len(t.modified))
+	for n, p := range t.modified {
+		page := *p
+		clonedPages[n] = &page
 	}
 
+	clonedFreeSpace := make([]uint16, len(t.freeSpace))
+	copy(clonedFreeSpace, t.freeSpace)
+
 	clonedPolicies := make([]Policy, len(t.Policies))
 	copy(clonedPolicies, t.Policies)
 
@@ -693,11 +735,17 @@ func (t *Table) Clone() *Table {
 		Name:          t.Name,
 		Owner:         t.Owner,
 		Columns:       clonedCols,
-		Rows:          clonedRows,
+		PageMgr:       t.PageMgr,
+		numPages:      t.numPages,
+		modified:      clonedPages,
+		freeSpace:     clonedFreeSpace,
+		stats:         t.stats,
 		RLSEnabled:    t.RLSEnabled,
 		Policies:      clonedPolicies,
 		Metadata:      t.Metadata,
 		VectorIndexes: t.VectorIndexes,
+		virtual:       t.virtual,
+		rows:          t.rows,
 	}
 }
 
@@ -1,17 +1,18 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-
-	"github.com/ghosecorp/ghostsql/internal/metadata"
 )
 
 const (
 	TableFileMagic   = "GTBL" // GhostSQL Table
-	TableFileVersion = 1
+	TableFileVersion = 2
 )
 
 // TableFileHeader represents the table file header
@@ -23,106 +24,52 @@ type TableFileHeader struct {
 	RootPageID uint64
 }
 
-// SaveTableBinary saves table to binary format
-func (db *Database) SaveTableBinary(table *Table) error {
-	tablePath := filepath.Join(db.DataDir.DatabasesPath, "default", "tables", table.Name+".tbl")
-
-	// Ensure directory exists
-	dir := filepath.Dir(tablePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create table directory: %w", err)
+// loadTableBinaryFromPath opens a table file. Only the header is read; the
+// pages are read through the buffer pool as scans need them.
+func (db *Database) loadTableBinaryFromPath(tablePath string, tableName string) (*Table, error) {
+	if err := upgradeTableFile(tablePath); err != nil {
+		return nil, fmt.Errorf("failed to upgrade table file: %w", err)
 	}
 
-	// Create file
-	file, err := os.Create(tablePath)
+	file, err := os.Open(tablePath)
 	if err != nil {
-		return fmt.Errorf("failed to create table file: %w", err)
+		return nil, fmt.Errorf("failed to open table file: %w", err)
 	}
 	defer file.Close()
-
-	// Write header
-	header := make([]byte, 64) // Reserve 64 bytes for header
-	copy(header[0:4], TableFileMagic)
-	binary.LittleEndian.PutUint32(header[4:8], TableFileVersion)
-	binary.LittleEndian.PutUint16(header[8:10], uint16(len(table.Columns)))
-	binary.LittleEndian.PutUint32(header[10:14], uint32(len(table.Pages)))
-
-	if _, err := file.Write(header); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
-	}
-
-	// Write schema (columns)
-	for _, col := range table.Columns {
-		// Column name length + name
-		nameBytes := []byte(col.Name)
-		if err := binary.Write(file, binary.LittleEndian, uint16(len(nameBytes))); err != nil {
-			return err
-		}
-		if _, err := file.Write(nameBytes); err != nil {
-			return err
-		}
-
-		// Column type
-		if err := binary.Write(file, binary.LittleEndian, uint8(col.Type)); err != nil {
-			return err
-		}
-
-		// Nullable flag
-		nullable := uint8(0)
-		if col.Nullable {
-			nullable = 1
-		}
-		if err := binary.Write(file, binary.LittleEndian, nullable); err != nil {
-			return err
-		}
-	}
-
-	// Write pages
-	for _, page := range table.Pages {
-		if _, err := file.Write(page.Data[:]); err != nil {
-			return fmt.Errorf("failed to write page: %w", err)
-		}
+	columns, numPages, _, err := readTableHeader(bufio.NewReader(file))
+	if err != nil {
+		return nil, err
 	}
 
-	// Also save metadata separately
-	if table.Metadata != nil {
-		metaPath := filepath.Join(db.DataDir.MetadataPath, table.Name+".meta")
-		metaData := fmt.Sprintf("%s\n%s\n", table.Metadata.Purpose, table.Metadata.Description)
-		if err := os.WriteFile(metaPath, []byte(metaData), 0644); err != nil {
-			return fmt.Errorf("failed to write metadata: %w", err)
-		}
+	table := &Table{
+		Name:          tableName,
+		Columns:       columns,
+		PageMgr:       NewPageManager(tablePath, db.Buffers),
+		numPages:      int(numPages),
+		VectorIndexes: make(map[string]*HNSWIndex),
+		stats:         &tableStats{},
 	}
-
-	db.Logger.Info("Saved table %s to binary format (%d pages)", table.Name, len(table.Pages))
-	return nil
+	return table, nil
 }
 
-// LoadTableBinary loads table from binary format
-func (db *Database) LoadTableBinary(tableName string) (*Table, error) {
-	tablePath := filepath.Join(db.DataDir.DatabasesPath, "default", "tables", tableName+".tbl")
-
-	file, err := os.Open(tablePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open table file: %w", err)
-	}
-	defer file.Close()
-
+// readTableHeader reads the header and the schema of a table file. It
+// returns the columns, the number of pages and the file version.
+func readTableHeader(r io.Reader) ([]Column, uint32, uint32, error) {
 	// Read header
 	header := make([]byte, 64)
-	if _, err := file.Read(header); err != nil {
-		return nil, fmt.Errorf("failed to read header: %w", err)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read header: %w", err)
 	}
 
 	// Verify magic
 	magic := string(header[0:4])
 	if magic != TableFileMagic {
-		return nil, fmt.Errorf("invalid table file magic: %s", magic)
+		return nil, 0, 0, fmt.Errorf("invalid table file magic: %s", magic)
 	}
 
-	// Read header fields
 	version := binary.LittleEndian.Uint32(header[4:8])
-	if version != TableFileVersion {
-		return nil, fmt.Errorf("unsupported table file version: %d", version)
+	if version != 1 && version != TableFileVersion {
+		return nil, 0, 0, fmt.Errorf("unsupported table file version: %d", version)
 	}
 
 	numColumns := binary.LittleEndian.Uint16(header[8:10])
@@ -131,210 +78,167 @@ func (db *Database) LoadTableBinary(tableName string) (*Table, error) {
 	// Read schema
 	columns := make([]Column, numColumns)
 	for i := uint16(0); i < numColumns; i++ {
-		// Read column name length
 		var nameLen uint16
-		if err := binary.Read(file, binary.LittleEndian, &nameLen); err != nil {
-			return nil, err
+		if err := binary.Read(r, binary.LittleEndian, &nameLen); err != nil {
+			return nil, 0, 0, err
 		}
 
-		// Read column name
 		nameBytes := make([]byte, nameLen)
-		if _, err := file.Read(nameBytes); err != nil {
-			return nil, err
+		if _, err := io.ReadFull(r, nameBytes); err != nil {
+			return nil, 0, 0, err
 		}
 		columns[i].Name = string(nameBytes)
 
-		// Read column type
 		var colType uint8
-		if err := binary.Read(file, binary.LittleEndian, &colType); err != nil {
-			return nil, err
+		if err := binary.Read(r, binary.LittleEndian, &colType); err != nil {
+			return nil, 0, 0, err
 		}
 		columns[i].Type = DataType(colType)
 
-		// Read nullable flag
 		var nullable uint8
-		if err := binary.Read(file, binary.LittleEndian, &nullable); err != nil {
-			return nil, err
+		if err := binary.Read(r, binary.LittleEndian, &nullable); err != nil {
+			return nil, 0, 0, err
 		}
 		columns[i].Nullable = nullable == 1
 	}
 
-	// Create table
-	table := &Table{
-		Name:    tableName,
-		Columns: columns,
-		Pages:   make([]*SlottedPage, 0, numPages),
-		Rows:    make([]Row, 0),
-	}
-
-	// Read pages
-	for i := uint32(0); i < numPages; i++ {
-		var pageData [PageSize]byte
-		if _, err := file.Read(pageData[:]); err != nil {
-			return nil, fmt.Errorf("failed to read page %d: %w", i, err)
-		}
-
-		page := LoadSlottedPage(pageData)
-		table.Pages = append(table.Pages, page)
-	}
-
-	// Reconstruct rows from pages
-	if err := table.LoadFromPages(); err != nil {
-		return nil, fmt.Errorf("failed to load rows from pages: %w", err)
-	}
-
-	// Load metadata if exists
-	metaPath := filepath.Join(db.DataDir.MetadataPath, tableName+".meta")
-	if metaData, err := os.ReadFile(metaPath); err == nil {
-		lines := string(metaData)
-		var id [16]byte
-		copy(id[:], tableName)
-		table.Metadata = metadata.NewMetadata(
-			metadata.ObjTypeTable,
-			id,
-			"Loaded from disk",
-			lines,
-		)
-	}
-
-	db.Logger.Info("Loaded table %s from binary format (%d rows, %d pages)", tableName, len(table.Rows), len(table.Pages))
-	return table, nil
+	return columns, numPages, version, nil
 }
 
-func (db *Database) loadTableBinaryFromPath(tablePath string, tableName string) (*Table, error) {
+// readTableFile reads the schema and the raw pages of a table file
+func readTableFile(tablePath string) ([]Column, [][]byte, error) {
 	file, err := os.Open(tablePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open table file: %w", err)
+		return nil, nil, fmt.Errorf("failed to open table file: %w", err)
 	}
 	defer file.Close()
+	r := bufio.NewReader(file)
 
-	// Read header
-	header := make([]byte, 64)
-	if _, err := file.Read(header); err != nil {
-		return nil, fmt.Errorf("failed to read header: %w", err)
-	}
-
-	// Verify magic
-	magic := string(header[0:4])
-	if magic != TableFileMagic {
-		return nil, fmt.Errorf("invalid table file magic: %s", magic)
-	}
-
-	version := binary.LittleEndian.Uint32(header[4:8])
-	if version != TableFileVersion {
-		return nil, fmt.Errorf("unsupported table file version: %d", version)
+	columns, numPages, version, err := readTableHeader(r)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	numColumns := binary.LittleEndian.Uint16(header[8:10])
-	numPages := binary.LittleEndian.Uint32(header[10:14])
-
-	// Read schema
-	columns := make([]Column, numColumns)
-	for i := uint16(0); i < numColumns; i++ {
-		var nameLen uint16
-		if err := binary.Read(file, binary.LittleEndian, &nameLen); err != nil {
-			return nil, err
+	// Read pages. In version 1 they follow the schema; since version 2
+	// the header and schema take the first page.
+	pages := make([][]byte, numPages)
+	for i := range pages {
+		pages[i] = make([]byte, PageSize)
+		if version == 1 {
+			_, err = io.ReadFull(r, pages[i])
+		} else {
+			_, err = file.ReadAt(pages[i], int64(i+1)*PageSize)
 		}
-
-		nameBytes := make([]byte, nameLen)
-		if _, err := file.Read(nameBytes); err != nil {
-			return nil, err
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read page %d: %w", i, err)
 		}
-		columns[i].Name = string(nameBytes)
+	}
 
-		var colType uint8
-		if err := binary.Read(file, binary.LittleEndian, &colType); err != nil {
-			return nil, err
-		}
-		columns[i].Type = DataType(colType)
+	return columns, pages, nil
+}
 
-		var nullable uint8
-		if err := binary.Read(file, binary.LittleEndian, &nullable); err != nil {
-			return nil, err
+// upgradeTableFile rewrites a version 1 table file in the current format.
+// Other files are left alone.
+func upgradeTableFile(tablePath string) error {
+	file, err := os.Open(tablePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
 		}
-		columns[i].Nullable = nullable == 1
+		return err
 	}
-
-	table := &Table{
-		Name:          tableName,
-		Columns:       columns,
-		Pages:         make([]*SlottedPage, 0, numPages),
-		Rows:          make([]Row, 0),
-		VectorIndexes: make(map[string]*HNSWIndex),
+	_, _, version, err := readTableHeader(bufio.NewReader(file))
+	file.Close()
+	if err != nil || version != 1 {
+		return nil
 	}
 
-	// Read pages
-	for i := uint32(0); i < numPages; i++ {
-		var pageData [PageSize]byte
-		if _, err := file.Read(pageData[:]); err != nil {
-			return nil, fmt.Errorf("failed to read page %d: %w", i, err)
-		}
-
-		page := LoadSlottedPage(pageData)
-		table.Pages = append(table.Pages, page)
+	columns, pages, err := readTableFile(tablePath)
+	if err != nil {
+		return err
 	}
-
-	// Reconstruct rows
-	if err := table.LoadFromPages(); err != nil {
-		return nil, fmt.Errorf("failed to load rows from pages: %w", err)
+	if err := writeTableFile(tablePath, columns, pages); err != nil {
+		return err
 	}
+	return syncDir(filepath.Dir(tablePath))
+}
 
-	return table, nil
+// encodeTableHeader encodes the first page of a table file: the header
+// followed by the schema
+func encodeTableHeader(columns []Column, numPages uint32) ([]byte, error) {
+	header := make([]byte, PageSize)
+	copy(header[0:4], TableFileMagic)
+	binary.LittleEndian.PutUint32(header[4:8], TableFileVersion)
+	binary.LittleEndian.PutUint16(header[8:10], uint16(len(columns)))
+	binary.LittleEndian.PutUint32(header[10:14], numPages)
+
+	schema := encodeColumns(columns)
+	if 64+len(schema) > PageSize {
+		return nil, fmt.Errorf("table schema does not fit in a page")
+	}
+	copy(header[64:], schema)
+	return header, nil
 }
 
-// saveTableBinaryToPath saves a table to a specific path
-func (db *Database) saveTableBinaryToPath(table *Table, tablePath string) error {
+// writeTableFile writes a table file under a temporary name, syncs it and
+// renames it into place, so a crash leaves either the old or the new file.
+// Syncing the directory is left to the caller.
+func writeTableFile(tablePath string, columns []Column, pages [][]byte) error {
 	dir := filepath.Dir(tablePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	file, err := os.Create(tablePath)
+	header, err := encodeTableHeader(columns, uint32(len(pages)))
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tablePath + ".tmp"
+	file, err := os.Create(tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create table file: %w", err)
 	}
+	defer os.Remove(tmpPath)
 	defer file.Close()
+	w := bufio.NewWriter(file)
 
-	// Write header
-	header := make([]byte, 64)
-	copy(header[0:4], TableFileMagic)
-	binary.LittleEndian.PutUint32(header[4:8], TableFileVersion)
-	binary.LittleEndian.PutUint16(header[8:10], uint16(len(table.Columns)))
-	binary.LittleEndian.PutUint32(header[10:14], uint32(len(table.Pages)))
-
-	if _, err := file.Write(header); err != nil {
+	// Write header and schema
+	if _, err := w.Write(header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
-	// Write schema
-	for _, col := range table.Columns {
-		nameBytes := []byte(col.Name)
-		if err := binary.Write(file, binary.LittleEndian, uint16(len(nameBytes))); err != nil {
-			return err
-		}
-		if _, err := file.Write(nameBytes); err != nil {
-			return err
-		}
-
-		if err := binary.Write(file, binary.LittleEndian, uint8(col.Type)); err != nil {
-			return err
+	// Write pages
+	for _, page := range pages {
+		if _, err := w.Write(page); err != nil {
+			return fmt.Errorf("failed to write page: %w", err)
 		}
+	}
 
-		nullable := uint8(0)
-		if col.Nullable {
-			nullable = 1
-		}
-		if err := binary.Write(file, binary.LittleEndian, nullable); err != nil {
-			return err
-		}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write table file: %w", err)
 	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync table file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write table file: %w", err)
+	}
+	return os.Rename(tmpPath, tablePath)
+}
 
-	// Write pages
-	for _, page := range table.Pages {
-		if _, err := file.Write(page.Data[:]); err != nil {
-			return fmt.Errorf("failed to write page: %w", err)
+// encodeColumns encodes a table schema as it is stored in table files
+func encodeColumns(columns []Column) []byte {
+	var buf bytes.Buffer
+	for _, col := range columns {
+		binary.Write(&buf, binary.LittleEndian, uint16(len(col.Name)))
+		buf.WriteString(col.Name)
+		buf.WriteByte(uint8(col.Type))
+		if col.Nullable {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
 		}
 	}
-
-	return nil
+	return buf.Bytes()
 }
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session variables holding time limits. Values are in milliseconds unless
+// they carry a unit, and 0 disables the limit.
+const (
+	StatementTimeout                = "statement_timeout"
+	LockTimeout                     = "lock_timeout"
+	IdleInTransactionSessionTimeout = "idle_in_transaction_session_timeout"
+)
+
+// timeoutUnits are the units accepted in timeout values, as in PostgreSQL
+var timeoutUnits = map[string]time.Duration{
+	"us":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+// IsTimeoutVariable reports whether name is one of the timeout variables
+func IsTimeoutVariable(name string) bool {
+	switch strings.ToLower(name) {
+	case StatementTimeout, LockTimeout, IdleInTransactionSessionTimeout:
+		return true
+	}
+	return false
+}
+
+// ParseTimeout parses a timeout value such as 5000, '5s' or '1 min'
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimRightFunc(value, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	unit := time.Millisecond
+	if suffix := strings.TrimSpace(value[len(number):]); suffix != "" {
+		var ok bool
+		if unit, ok = timeoutUnits[suffix]; !ok {
+			return 0, fmt.Errorf("invalid unit %q", suffix)
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", value)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// FormatTimeout formats a timeout in the largest unit that represents it
+// exactly
+func FormatTimeout(d time.Duration) string {
+	for _, unit := range []string{"d", "h", "min", "s"} {
+		if size := timeoutUnits[unit]; d != 0 && d%size == 0 {
+			return fmt.Sprintf("%d%s", d/size, unit)
+		}
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// Timeout returns the session's value of a timeout variable, 0 if it is
+// disabled
+func (s *Session) Timeout(name string) time.Duration {
+	d, err := ParseTimeout(s.GetVariable(name))
+	if err != nil {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// Rows that encode to more than toastThreshold bytes have their largest
+// TEXT, VARCHAR, JSONB and VECTOR values moved out of line, until the row
+// fits. An out-of-line value is stored in chunk tuples in the table's own
+// pages, compressed if that saves a quarter of its size, and the row keeps
+// a toastPointer to it. Chunks are only read when the value is needed.
+const (
+	toastThreshold = PageSize / 4
+
+	// Values this small are not worth a pointer
+	toastMinValueSize = 64
+
+	// A chunk tuple is the TID of the next chunk and the data, in a slot
+	// flagged slotToast. Four chunks fill a page.
+	toastChunkHeaderSize = tidSize
+	toastChunkSize       = (PageSize-SlottedPageHeaderSize)/4 - SlotSize - toastChunkHeaderSize
+
+	// The null flag of an out-of-line value, and the size of its pointer
+	toastedFlag      = 2
+	toastPointerSize = 4 + 4 + 1 + tidSize
+
+	// The largest tuple a page holds, leaving room for the TID of a moved one
+	maxTupleSize = PageSize - SlottedPageHeaderSize - SlotSize - tidSize
+)
+
+// toastPointer refers to a value stored out of line
+type toastPointer struct {
+	rawSize    uint32 // Size of the encoded value
+	storedSize uint32 // Size of the chunk data
+	compressed bool   // The chunk data is deflated
+	first      TID    // First chunk
+}
+
+func encodeToastPointer(buf []byte, p toastPointer) {
+	binary.LittleEndian.PutUint32(buf[0:4], p.rawSize)
+	binary.LittleEndian.PutUint32(buf[4:8], p.storedSize)
+	buf[8] = 0
+	if p.compressed {
+		buf[8] = 1
+	}
+	copy(buf[9:], encodeTID(p.first))
+}
+
+func decodeToastPointer(data []byte) toastPointer {
+	return toastPointer{
+		rawSize:    binary.LittleEndian.Uint32(data[0:4]),
+		storedSize: binary.LittleEndian.Uint32(data[4:8]),
+		compressed: data[8] == 1,
+		first:      decodeTID(data[9:]),
+	}
+}
+
+// toastable reports whether values of a type can be moved out of line
+func toastable(typ DataType) bool {
+	switch typ {
+	case TypeText, TypeVarChar, TypeJSONB, TypeVector:
+		return true
+	}
+	return false
+}
+
+// encodeValue encodes a single value the way EncodeRow does
+func encodeValue(col Column, val interface{}) ([]byte, error) {
+	return EncodeRow([]Column{col}, Row{col.Name: val})
+}
+
+// encodeRow encodes a row for storage, moving its largest values out of
+// line while it is over toastThreshold. Values of old, the stored version
+// of the row, are reused when unchanged. It returns the encoded row and
+// the row as stored, with pointers for the out-of-line values. The caller
+// holds t.mu for writing.
+func (t *Table) encodeRow(row Row, old Row) ([]byte, Row, error) {
+	data, err := EncodeRow(t.Columns, row)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode row: %w", err)
+	}
+	if len(data) <= toastThreshold {
+		return data, row, nil
+	}
+
+	// Encode the candidates, largest first
+	type candidate struct {
+		col   Column
+		value []byte
+	}
+	var candidates []candidate
+	for _, col := range t.Columns {
+		val, ok := row[col.Name]
+		if _, toasted := val.(toastPointer); !ok || toasted || val == nil || !toastable(col.Type) {
+			continue
+		}
+		value, err := encodeValue(col, val)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode row: %w", err)
+		}
+		if len(value) >= toastMinValueSize {
+			candidates = append(candidates, candidate{col, value})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return len(candidates[i].value) > len(candidates[j].value) })
+
+	// Work out which values go out of line before writing any chunks
+	size := len(data)
+	n := 0
+	for n < len(candidates) && size > toastThreshold {
+		size -= len(candidates[n].value) - 4 - toastPointerSize
+		n++
+	}
+	if size > maxTupleSize {
+		return nil, nil, util.NewSQLError(util.SQLStateProgramLimitExceeded, "row is too big: size %d, maximum size %d", size, maxTupleSize)
+	}
+
+	stored := make(Row, len(row))
+	for name, val := range row {
+		stored[name] = val
+	}
+	var written []toastPointer
+	for _, c := range candidates[:n] {
+		if p, ok := old[c.col.Name].(toastPointer); ok {
+			if value, err := t.readToast(p); err == nil && bytes.Equal(value, c.value) {
+				stored[c.col.Name] = p
+				continue
+			}
+		}
+		p, err := t.writeToast(c.value)
+		if err != nil {
+			for _, p := range written {
+				t.freeChunks(p.first, p.storedSize)
+			}
+			return nil, nil, err
+		}
+		written = append(written, p)
+		stored[c.col.Name] = p
+	}
+	data, err = EncodeRow(t.Columns, stored)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode row: %w", err)
+	}
+	return data, stored, nil
+}
+
+// writeToast stores an encoded value out of line. The chunks are placed
+// last first, so that each can point at the next.
+func (t *Table) writeToast(value []byte) (toastPointer, error) {
+	p := toastPointer{rawSize: uint32(len(value))}
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(value)
+	w.Close()
+	if buf.Len() <= len(value)*3/4 {
+		value = buf.Bytes()
+		p.compressed = true
+	}
+	p.storedSize = uint32(len(value))
+
+	var next TID
+	for end := len(value); end > 0; {
+		start := (end - 1) / toastChunkSize * toastChunkSize
+		chunk := make([]byte, toastChunkHeaderSize, toastChunkHeaderSize+end-start)
+		copy(chunk, encodeTID(next))
+		chunk = append(chunk, value[start:end]...)
+
+		tid, err := t.placeTuple(chunk, slotToast)
+		if err != nil {
+			t.freeChunks(next, uint32(len(value)-end))
+			return toastPointer{}, err
+		}
+		next = tid
+		end = start
+	}
+	p.first = next
+	return p, nil
+}
+
+// readToast returns the encoded value a pointer refers to. The caller
+// holds t.mu.
+func (t *Table) readToast(p toastPointer) ([]byte, error) {
+	value := make([]byte, 0, p.storedSize)
+	for tid := p.first; uint32(len(value)) < p.storedSize; {
+		chunk, err := t.toastChunk(tid)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, chunk[toastChunkHeaderSize:]...)
+		tid = decodeTID(chunk)
+	}
+	if uint32(len(value)) != p.storedSize {
+		return nil, fmt.Errorf("out-of-line value at %s in %s is corrupted", p.first, t.Name)
+	}
+	if p.compressed {
+		raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(value)))
+		if err != nil || uint32(len(raw)) != p.rawSize {
+			return nil, fmt.Errorf("out-of-line value at %s in %s is corrupted", p.first, t.Name)
+		}
+		value = raw
+	}
+	return value, nil
+}
+
+// toastChunk returns the chunk tuple with the given TID
+func (t *Table) toastChunk(tid TID) ([]byte, error) {
+	if int(tid.Page) < t.numPages {
+		page, err := t.page(tid.Page)
+		if err != nil {
+			return nil, err
+		}
+		if data, flags, ok := page.tuple(tid.Slot); ok && flags&slotToast != 0 && len(data) >= toastChunkHeaderSize {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("out-of-line value chunk %s not found in %s", tid, t.Name)
+}
+
+// freeChunks marks the chunks holding size bytes of a value dead, from
+// first on, so that VACUUM reclaims them. The caller holds t.mu for
+// writing.
+func (t *Table) freeChunks(first TID, size uint32) {
+	for tid, freed := first, uint32(0); freed < size; {
+		chunk, err := t.toastChunk(tid)
+		if err != nil {
+			return
+		}
+		page, err := t.pageForWrite(tid.Page)
+		if err != nil {
+			return
+		}
+		page.DeleteRow(tid.Slot)
+		freed += uint32(len(chunk) - toastChunkHeaderSize)
+		tid = decodeTID(chunk)
+	}
+}
+
+// freeToast frees the out-of-line values of a stored row that the new
+// version of the row no longer points to. The caller holds t.mu for
+// writing.
+func (t *Table) freeToast(old, row Row) {
+	for name, val := range old {
+		if p, ok := val.(toastPointer); ok && row[name] != val {
+			t.freeChunks(p.first, p.storedSize)
+		}
+	}
+}
+
+// detoast replaces the pointers in the given columns of a row, or in all
+// of them if columns is nil, with the values they refer to. The caller
+// holds t.mu.
+func (t *Table) detoast(row Row, columns []string) error {
+	for _, col := range t.Columns {
+		p, ok := row[col.Name].(toastPointer)
+		if !ok || (columns != nil && !slices.Contains(columns, col.Name)) {
+			continue
+		}
+		value, err := t.readToast(p)
+		if err != nil {
+			return err
+		}
+		decoded, err := DecodeRow([]Column{col}, value)
+		if err != nil {
+			return fmt.Errorf("failed to decode out-of-line value: %w", err)
+		}
+		row[col.Name] = decoded[col.Name]
+	}
+	return nil
+}
+
+// whereColumns returns the columns a WHERE clause looks at, or nil if it
+// may look at any of them
+func whereColumns(row Row, where *WhereClause) []string {
+	var columns []string
+	for w := where; w != nil; {
+		if w.Column != "" {
+			if _, ok := row[w.Column]; !ok {
+				return nil
+			}
+			columns = append(columns, w.Column)
+		}
+		if w.And != nil {
+			w = w.And
+		} else {
+			w = w.Or
+		}
+	}
+	return columns
+}
@@ -0,0 +1,495 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ghosecorp/ghostsql/internal/util"
+)
+
+// TID identifies a tuple by the page and slot it was inserted in. Updates
+// keep a tuple's TID; only rewriting the whole table, as schema changes do,
+// assigns new ones.
+type TID struct {
+	Page uint32
+	Slot uint16
+}
+
+const tidSize = 6
+
+func (tid TID) String() string {
+	return fmt.Sprintf("(%d,%d)", tid.Page, tid.Slot)
+}
+
+func encodeTID(tid TID) []byte {
+	buf := make([]byte, tidSize)
+	binary.LittleEndian.PutUint32(buf[0:4], tid.Page)
+	binary.LittleEndian.PutUint16(buf[4:6], tid.Slot)
+	return buf
+}
+
+func decodeTID(data []byte) TID {
+	return TID{
+		Page: binary.LittleEndian.Uint32(data[0:4]),
+		Slot: binary.LittleEndian.Uint16(data[4:6]),
+	}
+}
+
+// Tuple is a row together with its TID
+type Tuple struct {
+	TID TID
+	Row Row
+}
+
+// NewVirtualTable creates a read-only table over rows computed on the fly,
+// such as a system view or the result of a view. It has no pages.
+func NewVirtualTable(name string, columns []Column, rows []Row) *Table {
+	return &Table{
+		Name:          name,
+		Columns:       columns,
+		VectorIndexes: make(map[string]*HNSWIndex),
+		stats:         &tableStats{},
+		virtual:       true,
+		rows:          rows,
+	}
+}
+
+// NumPages returns the number of pages of the table
+func (t *Table) NumPages() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.numPages
+}
+
+// page returns page n of the table. Pages changed since the last commit
+// are private to the table; the others are read through the buffer pool
+// and copied, so the buffer is only pinned while it is copied. The caller
+// holds t.mu.
+func (t *Table) page(n uint32) (*SlottedPage, error) {
+	if page, ok := t.modified[n]; ok {
+		return page, nil
+	}
+	if int(n) >= t.numPages || t.PageMgr == nil {
+		return nil, fmt.Errorf("page %d of %s not found", n, t.Name)
+	}
+	buf, err := t.PageMgr.ReadPage(uint64(n))
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Unpin()
+	buf.mu.RLock()
+	defer buf.mu.RUnlock()
+	return LoadSlottedPage(buf.Data), nil
+}
+
+// pageForWrite returns page n to be changed, keeping it with the table
+// until the change is committed. The caller holds t.mu for writing.
+func (t *Table) pageForWrite(n uint32) (*SlottedPage, error) {
+	page, err := t.page(n)
+	if err != nil {
+		return nil, err
+	}
+	t.setModified(n, page)
+	return page, nil
+}
+
+// setModified records that page n changed. The caller holds t.mu for
+// writing.
+func (t *Table) setModified(n uint32, page *SlottedPage) {
+	if t.modified == nil {
+		t.modified = make(map[uint32]*SlottedPage)
+	}
+	t.modified[n] = page
+}
+
+// newPage appends an empty page to the table
+func (t *Table) newPage() (*SlottedPage, uint32) {
+	n := uint32(t.numPages)
+	page := NewSlottedPage(uint64(n))
+	t.setModified(n, page)
+	t.numPages++
+	return page, n
+}
+
+// scan calls fn for every live tuple, reading the table a page at a time.
+// Moved tuples are reported under their home TID. Out-of-line values are
+// left as pointers for the caller to detoast. The caller holds t.mu.
+func (t *Table) scan(fn func(Tuple) error) error {
+	if t.virtual {
+		for i, row := range t.rows {
+			if err := fn(Tuple{TID: TID{Slot: uint16(i)}, Row: row}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for p := 0; p < t.numPages; p++ {
+		page, err := t.page(uint32(p))
+		if err != nil {
+			return err
+		}
+		for s := uint16(0); s < page.NumSlots; s++ {
+			data, flags, ok := page.tuple(s)
+			if !ok || flags&(slotRedirect|slotToast) != 0 {
+				continue
+			}
+			tid := TID{Page: uint32(p), Slot: s}
+			if flags&slotMoved != 0 {
+				tid = decodeTID(data)
+				data = data[tidSize:]
+			}
+			row, err := DecodeRow(t.Columns, data)
+			if err != nil {
+				return fmt.Errorf("failed to decode tuple %s: %w", tid, err)
+			}
+			if err := fn(Tuple{TID: tid, Row: row}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tuples decodes every live tuple. The caller holds t.mu.
+func (t *Table) tuples() ([]Tuple, error) {
+	tuples := make([]Tuple, 0)
+	err := t.scan(func(tuple Tuple) error {
+		tuples = append(tuples, tuple)
+		return t.detoast(tuple.Row, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tuples, nil
+}
+
+// Tuples returns the table's rows with their TIDs
+func (t *Table) Tuples() ([]Tuple, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tuples()
+}
+
+// Scan calls fn for every live row, reading the out-of-line values of the
+// given columns only. Rows are not kept, so a large table is read a page at
+// a time.
+func (t *Table) Scan(columnNames []string, fn func(Row) error) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.scan(func(tuple Tuple) error {
+		if err := t.detoast(tuple.Row, columnNames); err != nil {
+			return err
+		}
+		return fn(tuple.Row)
+	})
+}
+
+// TupleCount returns the number of live tuples
+func (t *Table) TupleCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.virtual {
+		return len(t.rows)
+	}
+	live, _, _ := t.countTuples()
+	return live
+}
+
+// homeSlot returns the page and slot a TID points to, and the slot's
+// data and flags. With write set, the page is returned for changing.
+func (t *Table) homeSlot(tid TID, write bool) (*SlottedPage, []byte, uint16, error) {
+	if t.virtual {
+		return nil, nil, 0, fmt.Errorf("cannot modify %s", t.Name)
+	}
+	if int(tid.Page) < t.numPages {
+		var page *SlottedPage
+		var err error
+		if write {
+			page, err = t.pageForWrite(tid.Page)
+		} else {
+			page, err = t.page(tid.Page)
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if data, flags, ok := page.tuple(tid.Slot); ok && homeTuple(flags) {
+			return page, data, flags, nil
+		}
+	}
+	return nil, nil, 0, fmt.Errorf("tuple %s not found in %s", tid, t.Name)
+}
+
+// Fetch returns the row with the given TID
+func (t *Table) Fetch(tid TID) (Row, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	_, data, flags, err := t.homeSlot(tid, false)
+	if err != nil {
+		return nil, err
+	}
+	row, err := t.storedRow(data, flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.detoast(row, nil); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// storedRow decodes the row in a home slot as it is stored, with pointers
+// for out-of-line values. A redirect is followed to the moved tuple.
+func (t *Table) storedRow(data []byte, flags uint16) (Row, error) {
+	if flags&slotRedirect != 0 {
+		target := decodeTID(data)
+		page, err := t.page(target.Page)
+		if err != nil {
+			return nil, err
+		}
+		data, _, _ = page.tuple(target.Slot)
+		data = data[tidSize:]
+	}
+	return DecodeRow(t.Columns, data)
+}
+
+// checkRequired validates that a row has all required columns
+func (t *Table) checkRequired(row Row) error {
+	for _, col := range t.Columns {
+		if _, exists := row[col.Name]; !exists && !col.Nullable {
+			return util.NewSQLError(util.SQLStateNotNullViolation, "missing required column: %s", col.Name).WithColumn(t.Name, col.Name)
+		}
+	}
+	return nil
+}
+
+// encodeTuple validates and encodes a row for storage. For an update, old
+// is the stored version of the row, whose out-of-line values are reused
+// when unchanged. It also returns the row as stored.
+func (t *Table) encodeTuple(row Row, old Row) ([]byte, Row, error) {
+	if err := t.checkRequired(row); err != nil {
+		return nil, nil, err
+	}
+	return t.encodeRow(row, old)
+}
+
+// pageFor returns a page with room for n bytes of tuple data: the first
+// one the free space map lists with enough room, or else the last page or
+// a new one. The caller holds t.mu for writing.
+func (t *Table) pageFor(n int) (*SlottedPage, uint32, error) {
+	need := n
+	if need < minTupleSize {
+		need = minTupleSize
+	}
+	need += SlotSize
+	for i, free := range t.freeSpace {
+		if int(free) < need {
+			continue
+		}
+		pageNo := uint32(i)
+		page, err := t.page(pageNo)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !page.IsFull(uint16(n)) {
+			t.setModified(pageNo, page)
+			return page, pageNo, nil
+		}
+		// The map was out of date
+		t.freeSpace[i] = uint16(page.FreeSpace())
+	}
+	return t.lastPageFor(n)
+}
+
+// setFreeSpace records the free space of page n in the free space map
+func (t *Table) setFreeSpace(n uint32, page *SlottedPage) {
+	for len(t.freeSpace) <= int(n) {
+		t.freeSpace = append(t.freeSpace, 0)
+	}
+	t.freeSpace[n] = uint16(page.FreeSpace())
+}
+
+// lastPageFor returns the last page if it has room for n bytes, or a new
+// page. The caller holds t.mu for writing.
+func (t *Table) lastPageFor(n int) (*SlottedPage, uint32, error) {
+	if t.numPages > 0 {
+		pageNo := uint32(t.numPages - 1)
+		page, err := t.page(pageNo)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !page.IsFull(uint16(n)) {
+			t.setModified(pageNo, page)
+			return page, pageNo, nil
+		}
+	}
+	page, pageNo := t.newPage()
+	return page, pageNo, nil
+}
+
+// placeTuple stores tuple data in a page with room for it
+func (t *Table) placeTuple(data []byte, flags uint16) (TID, error) {
+	page, pageNo, err := t.pageFor(len(data))
+	if err != nil {
+		return TID{}, err
+	}
+	slot, err := page.insertTuple(data, flags)
+	if err != nil {
+		return TID{}, fmt.Errorf("failed to insert into page: %w", err)
+	}
+	t.setFreeSpace(pageNo, page)
+	return TID{Page: pageNo, Slot: slot}, nil
+}
+
+// InsertTuple adds a new row to the table and returns its TID
+func (t *Table) InsertTuple(row Row) (TID, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.virtual {
+		return TID{}, fmt.Errorf("cannot modify %s", t.Name)
+	}
+	data, stored, err := t.encodeTuple(row, nil)
+	if err != nil {
+		return TID{}, err
+	}
+	tid, err := t.placeTuple(data, 0)
+	if err != nil {
+		t.freeToast(stored, nil)
+		return TID{}, err
+	}
+	t.stats.inserted.Add(1)
+	return tid, nil
+}
+
+// UpdateTuple replaces the row with the given TID. The new version stays
+// in the tuple's home slot when its page has room; otherwise it moves to
+// another page and the home slot is left redirecting to it.
+func (t *Table) UpdateTuple(tid TID, row Row) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.updateTuple(tid, row)
+}
+
+func (t *Table) updateTuple(tid TID, row Row) error {
+	page, homeData, flags, err := t.homeSlot(tid, true)
+	if err != nil {
+		return err
+	}
+	old, err := t.storedRow(homeData, flags)
+	if err != nil {
+		return err
+	}
+	data, stored, err := t.encodeTuple(row, old)
+	if err != nil {
+		return err
+	}
+	t.stats.updated.Add(1)
+
+	if err := t.storeUpdate(tid, page, homeData, flags, data); err != nil {
+		t.freeToast(stored, old)
+		return err
+	}
+	t.freeToast(old, stored)
+	return nil
+}
+
+// storeUpdate puts the new version of a tuple in its home slot, or moves
+// it to another page
+func (t *Table) storeUpdate(tid TID, page *SlottedPage, homeData []byte, flags uint16, data []byte) error {
+	var err error
+	var moved *SlottedPage
+	var movedSlot uint16
+	if flags&slotRedirect != 0 {
+		target := decodeTID(homeData)
+		if moved, err = t.pageForWrite(target.Page); err != nil {
+			return err
+		}
+		movedSlot = target.Slot
+	}
+
+	// Back in the home slot, dropping any moved version
+	if page.UpdateRow(tid.Slot, data, 0) {
+		if moved != nil {
+			moved.DeleteRow(movedSlot)
+		}
+		return nil
+	}
+
+	movedData := append(encodeTID(tid), data...)
+	if moved != nil && moved.UpdateRow(movedSlot, movedData, slotMoved) {
+		return nil
+	}
+	target, err := t.placeTuple(movedData, slotMoved)
+	if err != nil {
+		return err
+	}
+	if moved != nil {
+		moved.DeleteRow(movedSlot)
+	}
+	// A redirect always fits in the space of the tuple it replaces
+	page.UpdateRow(tid.Slot, encodeTID(target), slotRedirect)
+	return nil
+}
+
+// DeleteTuple removes the row with the given TID, leaving a tombstone
+func (t *Table) DeleteTuple(tid TID) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleteTuple(tid)
+}
+
+func (t *Table) deleteTuple(tid TID) error {
+	page, data, flags, err := t.homeSlot(tid, true)
+	if err != nil {
+		return err
+	}
+	old, err := t.storedRow(data, flags)
+	if err != nil {
+		return err
+	}
+	t.stats.deleted.Add(1)
+	t.freeToast(old, nil)
+	if flags&slotRedirect != 0 {
+		target := decodeTID(data)
+		moved, err := t.pageForWrite(target.Page)
+		if err != nil {
+			return err
+		}
+		moved.DeleteRow(target.Slot)
+	}
+	return page.DeleteRow(tid.Slot)
+}
+
+// rewrite replaces the table's pages with freshly packed ones holding rows,
+// which are encoded with the current columns. TIDs are reassigned.
+// Out-of-line values are written again. On error the old pages are kept.
+func (t *Table) rewrite(rows []Row) error {
+	modified, numPages, freeSpace := t.modified, t.numPages, t.freeSpace
+	t.modified, t.numPages, t.freeSpace = make(map[uint32]*SlottedPage), 0, nil
+	if err := t.pack(rows); err != nil {
+		t.modified, t.numPages, t.freeSpace = modified, numPages, freeSpace
+		return err
+	}
+	return nil
+}
+
+// pack stores rows one after another in new pages
+func (t *Table) pack(rows []Row) error {
+	for _, row := range rows {
+		data, _, err := t.encodeRow(row, nil)
+		if err != nil {
+			return err
+		}
+		page, n, err := t.lastPageFor(len(data))
+		if err != nil {
+			return err
+		}
+		if _, err := page.InsertRow(data); err != nil {
+			return fmt.Errorf("failed to insert into page: %w", err)
+		}
+		t.setFreeSpace(n, page)
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 // internal/storage/types.go << 'EOF'
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Vector represents a vector embedding
 type Vector struct {
@@ -89,6 +92,17 @@ func (dt DataType) FixedSize() int {
 	}
 }
 
+// ParseBool parses the PostgreSQL spellings of a boolean value
+func ParseBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "t", "yes", "y", "on", "1":
+		return true, true
+	case "false", "f", "no", "n", "off", "0":
+		return false, true
+	}
+	return false, false
+}
+
 // PageType represents different page types
 type PageType uint8
 
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// tableStats counts the activity on a table since the server started, as
+// shown in pg_stat_user_tables. Clones of a table share it, so changes that
+// are rolled back still count, as in PostgreSQL.
+type tableStats struct {
+	inserted    atomic.Int64
+	updated     atomic.Int64
+	deleted     atomic.Int64
+	vacuumCount atomic.Int64
+	lastVacuum  atomic.Int64 // Unix nanoseconds, 0 if never vacuumed
+}
+
+// vacuumed records a completed VACUUM
+func (s *tableStats) vacuumed() {
+	s.vacuumCount.Add(1)
+	s.lastVacuum.Store(time.Now().UnixNano())
+}
+
+// countTuples returns the numbers of live and dead tuples. The caller holds
+// t.mu.
+func (t *Table) countTuples() (live, dead int, err error) {
+	for p := 0; p < t.numPages; p++ {
+		page, err := t.page(uint32(p))
+		if err != nil {
+			return live, dead, err
+		}
+		for s := uint16(0); s < page.NumSlots; s++ {
+			// Rows are counted at their home slot
+			offset, length, flags := page.slot(s)
+			switch {
+			case !homeTuple(flags) || (offset == 0 && length == 0):
+			case flags&slotDead != 0:
+				dead++
+			default:
+				live++
+			}
+		}
+	}
+	return live, dead, nil
+}
+
+// Vacuum removes the dead tuples of the table. Pages are compacted, so
+// that the space of dead tuples and of tuples that shrank can be reused,
+// and the free space map is rebuilt for inserts to find it. Empty pages at
+// the end of the table are truncated away. TIDs of live tuples are kept.
+// It returns the number of dead tuples removed.
+func (t *Table) Vacuum() (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.virtual {
+		return 0, fmt.Errorf("cannot vacuum %s", t.Name)
+	}
+	removed := 0
+	freeSpace := make([]uint16, t.numPages)
+	numPages := 0
+	for p := 0; p < t.numPages; p++ {
+		n := uint32(p)
+		page, err := t.page(n)
+		if err != nil {
+			return removed, err
+		}
+		free, slots := page.FreeSpace(), page.NumSlots
+		removed += page.compact()
+		if page.FreeSpace() != free || page.NumSlots != slots {
+			t.setModified(n, page)
+		}
+		freeSpace[p] = uint16(page.FreeSpace())
+		if page.NumSlots > 0 {
+			numPages = p + 1
+		}
+	}
+
+	for n := range t.modified {
+		if int(n) >= numPages {
+			delete(t.modified, n)
+		}
+	}
+	t.numPages = numPages
+	t.freeSpace = freeSpace[:numPages]
+	t.stats.vacuumed()
+	return removed, nil
+}
+
+// VacuumFull rewrites the table into as few pages as it needs, without the
+// dead tuples and with no free space left in between. TIDs are reassigned.
+// It returns the number of dead tuples removed.
+func (t *Table) VacuumFull() (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.virtual {
+		return 0, fmt.Errorf("cannot vacuum %s", t.Name)
+	}
+	_, dead, err := t.countTuples()
+	if err != nil {
+		return 0, err
+	}
+	tuples, err := t.tuples()
+	if err != nil {
+		return 0, err
+	}
+	rows := make([]Row, len(tuples))
+	for i, tuple := range tuples {
+		rows[i] = tuple.Row
+	}
+	if err := t.rewrite(rows); err != nil {
+		return 0, err
+	}
+	t.stats.vacuumed()
+	return dead, nil
+}
+
+// tableActivity is a table's row of pg_stat_user_tables
+type tableActivity struct {
+	Inserted, Updated, Deleted int64
+	LiveTuples, DeadTuples     int
+	LastVacuum                 time.Time // Zero if never vacuumed
+	VacuumCount                int64
+}
+
+// activity returns the statistics of the table
+func (t *Table) activity() (tableActivity, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	live, dead, err := t.countTuples()
+	if err != nil {
+		return tableActivity{}, err
+	}
+	activity := tableActivity{
+		Inserted:    t.stats.inserted.Load(),
+		Updated:     t.stats.updated.Load(),
+		Deleted:     t.stats.deleted.Load(),
+		LiveTuples:  live,
+		DeadTuples:  dead,
+		VacuumCount: t.stats.vacuumCount.Load(),
+	}
+	if ns := t.stats.lastVacuum.Load(); ns != 0 {
+		activity.LastVacuum = time.Unix(0, ns)
+	}
+	return activity, nil
+}
@@ -0,0 +1,695 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// WALFileName is the write-ahead log in the WAL directory
+const WALFileName = "ghostsql.wal"
+
+const (
+	walMagic   = "GWAL" // GhostSQL WAL
+	walVersion = 1
+
+	walHeaderSize       = 16 // Magic(4) + Version(4) + start LSN(8)
+	walRecordHeaderSize = 17 // Length(4) + CRC(4) + XID(8) + Type(1)
+	walMaxRecordSize    = PageSize + 1<<16
+)
+
+// WAL record types. A transaction logs the schema of each table it changed
+// followed by images of the changed pages, and ends with a commit record.
+const (
+	walRecordSchema    uint8 = iota + 1 // Database, table, page count, columns
+	walRecordPage                       // Database, table, page number, page image
+	walRecordDropTable                  // Database, table
+	walRecordCommit
+)
+
+// LSN is a position in the write-ahead log. It keeps growing across
+// checkpoints.
+type LSN uint64
+
+// String formats the LSN as PostgreSQL does
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// walTable identifies a table in the WAL
+type walTable struct {
+	db    string
+	table string
+}
+
+// walImage describes a table as it was last logged, to tell whether a
+// transaction changed its schema or size
+type walImage struct {
+	schema   uint32 // Checksum of the columns
+	numPages uint32
+}
+
+// WAL is the write-ahead log. Commits append the changed pages and sync the
+// log, and then store the pages in the buffer pool; the table files are
+// only written by evictions, and brought up to date by checkpoints, which
+// replay the log into them and then truncate it.
+type WAL struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	start   LSN   // LSN of the first record in the file
+	size    int64 // Bytes of records after the header
+	nextXID uint64
+	images  map[walTable]*walImage
+	heaps   map[walTable]*PageManager // Table files by current table name
+}
+
+// openWAL opens the log in dir, creating an empty one if there is none
+func openWAL(dir string) (*WAL, error) {
+	w := &WAL{
+		path:    filepath.Join(dir, WALFileName),
+		nextXID: 1,
+		images:  make(map[walTable]*walImage),
+		heaps:   make(map[walTable]*PageManager),
+	}
+	file, err := os.OpenFile(w.path, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return w, w.reset(0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[0:4]) != walMagic {
+		file.Close()
+		return nil, fmt.Errorf("invalid WAL file %s", w.path)
+	}
+	if version := binary.LittleEndian.Uint32(header[4:8]); version != walVersion {
+		file.Close()
+		return nil, fmt.Errorf("unsupported WAL version: %d", version)
+	}
+	w.file = file
+	w.start = LSN(binary.LittleEndian.Uint64(header[8:16]))
+	return w, nil
+}
+
+// reset replaces the log with an empty one whose records start at start
+func (w *WAL) reset(start LSN) error {
+	header := make([]byte, walHeaderSize)
+	copy(header[0:4], walMagic)
+	binary.LittleEndian.PutUint32(header[4:8], walVersion)
+	binary.LittleEndian.PutUint64(header[8:16], uint64(start))
+
+	tmpPath := w.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL: %w", err)
+	}
+	if _, err = file.Write(header); err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, w.path)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(w.path))
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to reset WAL: %w", err)
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = file
+	w.start = start
+	w.size = 0
+	return nil
+}
+
+// write appends records to the log and syncs it
+func (w *WAL) write(records []byte) error {
+	if w.file == nil {
+		return fmt.Errorf("WAL is closed")
+	}
+	// A failed write is overwritten by the next one
+	if _, err := w.file.WriteAt(records, walHeaderSize+w.size); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.size += int64(len(records))
+	return nil
+}
+
+// close closes the log file and the table files
+func (w *WAL) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	for _, pm := range w.heaps {
+		pm.close()
+	}
+}
+
+// track records the image and the file of a table loaded from disk
+func (w *WAL) track(dbName string, table *Table) {
+	table.mu.RLock()
+	image := &walImage{
+		schema:   crc32.ChecksumIEEE(encodeColumns(table.Columns)),
+		numPages: uint32(table.numPages),
+	}
+	pm := table.PageMgr
+	table.mu.RUnlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := walTable{dbName, table.Name}
+	w.images[key] = image
+	w.heaps[key] = pm
+}
+
+// CommitTables makes a transaction's changes to tables and its dropped
+// tables durable. The changed pages are appended to the WAL with a commit
+// record and the WAL is synced. The pages then go to the buffer pool, from
+// which the next checkpoint or an eviction writes them to the table files.
+func (db *Database) CommitTables(dbInstance *DatabaseInstance, tables []*Table, dropped []string) error {
+	w := db.wal
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var buf bytes.Buffer
+	xid := w.nextXID
+	droppedSet := make(map[string]bool)
+	for _, name := range dropped {
+		appendWALRecord(&buf, xid, walRecordDropTable, walPayload(dbInstance.Name, name).Bytes())
+		droppedSet[name] = true
+	}
+	images := make(map[walTable]*walImage)
+	logged := make(map[*Table]map[uint32]uint32)
+	for _, table := range tables {
+		key := walTable{dbInstance.Name, table.Name}
+		prev := w.images[key]
+		if droppedSet[table.Name] {
+			prev = nil
+		}
+		// A renamed or recreated table moves to the file of its name
+		if table.PageMgr != w.heaps[key] {
+			if err := table.detach(); err != nil {
+				return err
+			}
+			prev = nil
+		}
+		if image, pages := logTableChanges(&buf, xid, key, table, prev); image != nil {
+			images[key] = image
+			logged[table] = pages
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	appendWALRecord(&buf, xid, walRecordCommit, nil)
+
+	if err := w.write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write WAL: %w", err)
+	}
+	w.nextXID++
+	for name := range droppedSet {
+		key := walTable{dbInstance.Name, name}
+		delete(w.images, key)
+		if pm := w.heaps[key]; pm != nil {
+			pm.discard()
+			delete(w.heaps, key)
+		}
+	}
+	for key, image := range images {
+		w.images[key] = image
+	}
+	for _, table := range tables {
+		key := walTable{dbInstance.Name, table.Name}
+		pm := w.heaps[key]
+		if pm == nil {
+			pm = NewPageManager(filepath.Join(dbInstance.BasePath, "tables", table.Name+".tbl"), db.Buffers)
+			w.heaps[key] = pm
+		}
+		if image := images[key]; image != nil {
+			table.publish(pm, logged[table], image.numPages)
+		}
+	}
+
+	if w.size >= db.Config.MaxWALSize {
+		// The transaction is already durable
+		if err := db.checkpoint(); err != nil {
+			db.Logger.Error("Checkpoint failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// logTableChanges appends the schema of table and the pages changed since
+// its last commit. It returns the table's new image and the checksums of
+// the logged pages, or nil if nothing changed.
+func logTableChanges(buf *bytes.Buffer, xid uint64, key walTable, table *Table, prev *walImage) (*walImage, map[uint32]uint32) {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	columns := encodeColumns(table.Columns)
+	image := &walImage{
+		schema:   crc32.ChecksumIEEE(columns),
+		numPages: uint32(table.numPages),
+	}
+	if prev != nil && *prev == *image && len(table.modified) == 0 {
+		return nil, nil
+	}
+
+	payload := walPayload(key.db, key.table)
+	binary.Write(payload, binary.LittleEndian, image.numPages)
+	binary.Write(payload, binary.LittleEndian, uint16(len(table.Columns)))
+	payload.Write(columns)
+	appendWALRecord(buf, xid, walRecordSchema, payload.Bytes())
+
+	changed := make([]uint32, 0, len(table.modified))
+	for n := range table.modified {
+		changed = append(changed, n)
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+
+	logged := make(map[uint32]uint32, len(changed))
+	for _, n := range changed {
+		page := table.modified[n]
+		payload = walPayload(key.db, key.table)
+		binary.Write(payload, binary.LittleEndian, n)
+		payload.Write(page.Data[:])
+		appendWALRecord(buf, xid, walRecordPage, payload.Bytes())
+		logged[n] = crc32.ChecksumIEEE(page.Data[:])
+	}
+	return image, logged
+}
+
+// detach reads every page of the table into its changed pages and lets go
+// of its file, so that the next commit logs the whole table for a new file
+func (t *Table) detach() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for n := 0; n < t.numPages; n++ {
+		if _, err := t.pageForWrite(uint32(n)); err != nil {
+			return err
+		}
+	}
+	t.PageMgr = nil
+	return nil
+}
+
+// publish stores the committed pages of the table in the buffer pool as
+// the table file's pages. A page changed again since it was logged stays
+// with the table until it is committed too, as does one the pool has no
+// room for; logging it again is harmless. Pages past the committed end of
+// the table are dropped from the pool.
+func (t *Table) publish(pm *PageManager, logged map[uint32]uint32, numPages uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.PageMgr = pm
+	for n, crc := range logged {
+		page, ok := t.modified[n]
+		if !ok || crc32.ChecksumIEEE(page.Data[:]) != crc {
+			continue
+		}
+		if err := pm.pool.store(pm, uint64(n), &page.Data); err != nil {
+			continue
+		}
+		delete(t.modified, n)
+	}
+	pm.pool.drop(pm, uint64(numPages))
+}
+
+// walPayload starts a record payload naming a table
+func walPayload(dbName, table string) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, s := range []string{dbName, table} {
+		binary.Write(&buf, binary.LittleEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	return &buf
+}
+
+// appendWALRecord adds a record to buf. The CRC covers the XID, the type
+// and the payload.
+func appendWALRecord(buf *bytes.Buffer, xid uint64, recType uint8, payload []byte) {
+	var header [walRecordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint64(header[8:16], xid)
+	header[16] = recType
+	crc := crc32.NewIEEE()
+	crc.Write(header[8:])
+	crc.Write(payload)
+	binary.LittleEndian.PutUint32(header[4:8], crc.Sum32())
+	buf.Write(header[:])
+	buf.Write(payload)
+}
+
+// walRecord is a decoded WAL record
+type walRecord struct {
+	xid      uint64
+	recType  uint8
+	key      walTable
+	numPages uint32
+	columns  []Column
+	pageNo   uint32
+	page     []byte
+}
+
+// readWALRecord reads the next record. It reports false at the end of the
+// log and at a torn or corrupt record, after which nothing can be trusted.
+func readWALRecord(r io.Reader) (walRecord, int64, bool) {
+	var rec walRecord
+	header := make([]byte, walRecordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return rec, 0, false
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if length > walMaxRecordSize {
+		return rec, 0, false
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, 0, false
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header[8:])
+	crc.Write(payload)
+	if crc.Sum32() != binary.LittleEndian.Uint32(header[4:8]) {
+		return rec, 0, false
+	}
+
+	rec.xid = binary.LittleEndian.Uint64(header[8:16])
+	rec.recType = header[16]
+	d := walDecoder{data: payload}
+	switch rec.recType {
+	case walRecordSchema:
+		rec.key = walTable{d.string(), d.string()}
+		rec.numPages = d.uint32()
+		rec.columns = make([]Column, d.uint16())
+		for i := range rec.columns {
+			rec.columns[i].Name = d.string()
+			rec.columns[i].Type = DataType(d.bytes(1)[0])
+			rec.columns[i].Nullable = d.bytes(1)[0] == 1
+		}
+	case walRecordPage:
+		rec.key = walTable{d.string(), d.string()}
+		rec.pageNo = d.uint32()
+		rec.page = d.bytes(PageSize)
+	case walRecordDropTable:
+		rec.key = walTable{d.string(), d.string()}
+	case walRecordCommit:
+	default:
+		return rec, 0, false
+	}
+	if d.err != nil || len(d.data) != 0 {
+		return rec, 0, false
+	}
+	return rec, walRecordHeaderSize + int64(length), true
+}
+
+// walDecoder reads the fields of a record payload
+type walDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *walDecoder) bytes(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.err = errors.New("truncated WAL record")
+		return make([]byte, n)
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *walDecoder) uint16() uint16 {
+	return binary.LittleEndian.Uint16(d.bytes(2))
+}
+
+func (d *walDecoder) uint32() uint32 {
+	return binary.LittleEndian.Uint32(d.bytes(4))
+}
+
+func (d *walDecoder) string() string {
+	return string(d.bytes(int(d.uint16())))
+}
+
+// tableRedo is the state of a table after the logged transactions
+type tableRedo struct {
+	dropped  bool
+	fresh    bool // Recreated after a drop, so nothing in the file applies
+	columns  []Column
+	numPages uint32
+	pages    map[uint32][]byte // Pages not logged are kept from the file
+}
+
+func (t *tableRedo) apply(rec walRecord) {
+	switch rec.recType {
+	case walRecordSchema:
+		t.dropped = false
+		t.columns = rec.columns
+		t.numPages = rec.numPages
+		for n := range t.pages {
+			if n >= t.numPages {
+				delete(t.pages, n)
+			}
+		}
+	case walRecordPage:
+		if rec.pageNo < t.numPages {
+			if t.pages == nil {
+				t.pages = make(map[uint32][]byte)
+			}
+			t.pages[rec.pageNo] = rec.page
+		}
+	}
+}
+
+// write applies the redo to the table file in place. A file of version 1
+// is upgraded first, since the pages move. The file may hold pages written
+// back by the buffer pool before the crash, even without a header; every
+// such page was logged since the last checkpoint and is overwritten.
+func (t *tableRedo) write(tablePath string) error {
+	flags := os.O_RDWR | os.O_CREATE
+	if t.fresh {
+		flags |= os.O_TRUNC
+	} else if err := upgradeTableFile(tablePath); err != nil {
+		return err
+	}
+	header, err := encodeTableHeader(t.columns, t.numPages)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(tablePath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	for n, page := range t.pages {
+		if _, err := file.WriteAt(page, int64(n+1)*PageSize); err != nil {
+			return err
+		}
+	}
+	if err := file.Truncate(int64(t.numPages+1) * PageSize); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// replay applies the committed transactions in the log to the table files
+// under root. It returns the LSN after the last complete transaction and
+// how many transactions were applied. A transaction without its commit
+// record is ignored, as is everything after a torn or corrupt record.
+func (w *WAL) replay(root string) (LSN, int, error) {
+	if w.file == nil {
+		return 0, 0, fmt.Errorf("WAL is closed")
+	}
+	if _, err := w.file.Seek(walHeaderSize, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	r := bufio.NewReader(w.file)
+
+	tables := make(map[walTable]*tableRedo)
+	var pending []walRecord
+	var offset, committed int64
+	txns := 0
+	for {
+		rec, n, ok := readWALRecord(r)
+		if !ok {
+			break
+		}
+		offset += n
+		if len(pending) > 0 && pending[0].xid != rec.xid {
+			// The previous transaction never committed
+			pending = nil
+		}
+		if rec.recType != walRecordCommit {
+			pending = append(pending, rec)
+			continue
+		}
+
+		for _, p := range pending {
+			if p.recType == walRecordDropTable {
+				tables[p.key] = &tableRedo{dropped: true, fresh: true}
+				continue
+			}
+			redo, ok := tables[p.key]
+			if !ok {
+				redo = &tableRedo{}
+				tables[p.key] = redo
+			}
+			redo.apply(p)
+		}
+		pending = nil
+		committed = offset
+		txns++
+		if rec.xid >= w.nextXID {
+			w.nextXID = rec.xid + 1
+		}
+	}
+
+	keys := make([]walTable, 0, len(tables))
+	for key := range tables {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].db != keys[j].db {
+			return keys[i].db < keys[j].db
+		}
+		return keys[i].table < keys[j].table
+	})
+
+	dirs := make(map[string]bool)
+	for _, key := range keys {
+		redo := tables[key]
+		tablePath := filepath.Join(root, key.db, "tables", key.table+".tbl")
+		dirs[filepath.Dir(tablePath)] = true
+		if redo.dropped {
+			if err := os.Remove(tablePath); err != nil && !os.IsNotExist(err) {
+				return 0, 0, fmt.Errorf("failed to remove table file: %w", err)
+			}
+			continue
+		}
+
+		if err := redo.write(tablePath); err != nil {
+			return 0, 0, fmt.Errorf("failed to redo table %s: %w", key.table, err)
+		}
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+	}
+
+	return w.start + LSN(committed), txns, nil
+}
+
+// recoverWAL opens the WAL and replays the transactions committed since the
+// last checkpoint into the table files, which after a crash may be missing
+// them
+func (db *Database) recoverWAL() error {
+	w, err := openWAL(db.DataDir.WALPath)
+	if err != nil {
+		return err
+	}
+	db.wal = w
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return db.checkpoint()
+}
+
+// Checkpoint writes the changes logged since the last checkpoint to the
+// table files and truncates the WAL
+func (db *Database) Checkpoint() error {
+	db.wal.mu.Lock()
+	defer db.wal.mu.Unlock()
+	return db.checkpoint()
+}
+
+// checkpoint is Checkpoint with the WAL lock held
+func (db *Database) checkpoint() error {
+	end, txns, err := db.wal.replay(db.DataDir.DatabasesPath)
+	if err != nil {
+		return err
+	}
+	if err := db.wal.reset(end); err != nil {
+		return err
+	}
+	// The table files now hold every page in the pool
+	db.Buffers.markClean()
+	if txns > 0 {
+		db.Logger.Info("Checkpoint at %s applied %d transaction(s)", end, txns)
+	}
+	return nil
+}
+
+// CurrentWALLSN returns the LSN the next WAL record will be written at
+func (db *Database) CurrentWALLSN() LSN {
+	db.wal.mu.Lock()
+	defer db.wal.mu.Unlock()
+	return db.wal.start + LSN(db.wal.size)
+}
+
+// removeDatabaseFiles removes the directory of a dropped database. The WAL
+// is checkpointed first, with its lock held throughout, so that no record
+// refers to the removed files.
+func (db *Database) removeDatabaseFiles(dbInstance *DatabaseInstance) error {
+	w := db.wal
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := db.checkpoint(); err != nil {
+		return err
+	}
+	for key, pm := range w.heaps {
+		if key.db == dbInstance.Name {
+			pm.discard()
+			delete(w.heaps, key)
+		}
+	}
+	if err := os.RemoveAll(dbInstance.BasePath); err != nil {
+		return err
+	}
+	for key := range w.images {
+		if key.db == dbInstance.Name {
+			delete(w.images, key)
+		}
+	}
+	return nil
+}
+
+// syncDir makes renames and removals in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
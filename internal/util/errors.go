@@ -1,6 +1,9 @@
 package util
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type ErrorCode int
 
@@ -34,3 +37,181 @@ func NewError(code ErrorCode, message string, cause error) *GhostError {
 		Cause:   cause,
 	}
 }
+
+// SQLSTATE codes reported to clients
+const (
+	SQLStateSuccessfulCompletion       = "00000"
+	SQLStateWarning                    = "01000"
+	SQLStateProtocolViolation          = "08P01"
+	SQLStateFeatureNotSupported        = "0A000"
+	SQLStateStringDataRightTruncation  = "22001"
+	SQLStateInvalidDatetimeFormat      = "22007"
+	SQLStateNumericValueOutOfRange     = "22003"
+	SQLStateDivisionByZero             = "22012"
+	SQLStateInvalidParameterValue      = "22023"
+	SQLStateInvalidTextRepresentation  = "22P02"
+	SQLStateBadCopyFileFormat          = "22P04"
+	SQLStateNotNullViolation           = "23502"
+	SQLStateForeignKeyViolation        = "23503"
+	SQLStateUniqueViolation            = "23505"
+	SQLStateCheckViolation             = "23514"
+	SQLStateInvalidTransactionState    = "25000"
+	SQLStateActiveTransaction          = "25001"
+	SQLStateNoActiveTransaction        = "25P01"
+	SQLStateInFailedTransaction        = "25P02"
+	SQLStateIdleInTransactionTimeout   = "25P03"
+	SQLStateInvalidStatementName       = "26000"
+	SQLStateInvalidAuthorization       = "28000"
+	SQLStateInvalidPassword            = "28P01"
+	SQLStateInvalidCursorName          = "34000"
+	SQLStateInvalidSavepoint           = "3B001"
+	SQLStateDeadlockDetected           = "40P01"
+	SQLStateInvalidCatalogName         = "3D000"
+	SQLStateSyntaxError                = "42601"
+	SQLStateInsufficientPrivilege      = "42501"
+	SQLStateUndefinedColumn            = "42703"
+	SQLStateDatatypeMismatch           = "42804"
+	SQLStateUndefinedObject            = "42704"
+	SQLStateDuplicateColumn            = "42701"
+	SQLStateDuplicateObject            = "42710"
+	SQLStateDuplicateCursor            = "42P03"
+	SQLStateDuplicatePreparedStatement = "42P05"
+	SQLStateDuplicateDatabase          = "42P04"
+	SQLStateDuplicateSchema            = "42P06"
+	SQLStateDuplicateTable             = "42P07"
+	SQLStateUndefinedTable             = "42P01"
+	SQLStateTooManyConnections         = "53300"
+	SQLStateProgramLimitExceeded       = "54000"
+	SQLStateLockNotAvailable           = "55P03"
+	SQLStateQueryCanceled              = "57014"
+	SQLStateAdminShutdown              = "57P01"
+	SQLStateCannotConnectNow           = "57P03"
+	SQLStateIOError                    = "58030"
+	SQLStateInternalError              = "XX000"
+	SQLStateDataCorrupted              = "XX001"
+)
+
+// SQLSTATE returns the code reported to clients for a GhostError
+func (e *GhostError) SQLSTATE() string {
+	switch e.Code {
+	case ErrNotFound:
+		return SQLStateUndefinedObject
+	case ErrAlreadyExists:
+		return SQLStateDuplicateObject
+	case ErrInvalidArgument:
+		return SQLStateInvalidParameterValue
+	case ErrIO:
+		return SQLStateIOError
+	case ErrCorrupted:
+		return SQLStateDataCorrupted
+	default:
+		return SQLStateInternalError
+	}
+}
+
+// SQLError is an error reported to clients with a PostgreSQL SQLSTATE code
+// and the optional fields of an ErrorResponse
+type SQLError struct {
+	Code       string // Five-character SQLSTATE
+	Message    string
+	Detail     string
+	Hint       string
+	Position   int    // 1-based character position in the query, 0 if unknown
+	Where      string // Context in which the error occurred
+	Schema     string
+	Table      string
+	Column     string
+	Constraint string
+}
+
+func (e *SQLError) Error() string {
+	return e.Message
+}
+
+// NewSQLError creates an error with the given SQLSTATE
+func NewSQLError(code string, format string, args ...interface{}) *SQLError {
+	return &SQLError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// WithDetail sets the secondary message of the error
+func (e *SQLError) WithDetail(format string, args ...interface{}) *SQLError {
+	e.Detail = fmt.Sprintf(format, args...)
+	return e
+}
+
+// WithHint sets the suggestion on how to fix the problem
+func (e *SQLError) WithHint(format string, args ...interface{}) *SQLError {
+	e.Hint = fmt.Sprintf(format, args...)
+	return e
+}
+
+// WithPosition sets the 1-based character position of the error in the query
+func (e *SQLError) WithPosition(pos int) *SQLError {
+	e.Position = pos
+	return e
+}
+
+// WithWhere sets the context in which the error occurred
+func (e *SQLError) WithWhere(format string, args ...interface{}) *SQLError {
+	e.Where = fmt.Sprintf(format, args...)
+	return e
+}
+
+// WithTable names the table the error is about. GhostSQL tables live in
+// the public schema.
+func (e *SQLError) WithTable(table string) *SQLError {
+	e.Schema = "public"
+	e.Table = table
+	return e
+}
+
+// WithColumn names the table column the error is about
+func (e *SQLError) WithColumn(table, column string) *SQLError {
+	e.WithTable(table)
+	e.Column = column
+	return e
+}
+
+// WithConstraint names the table constraint the error is about
+func (e *SQLError) WithConstraint(table, constraint string) *SQLError {
+	e.WithTable(table)
+	e.Constraint = constraint
+	return e
+}
+
+// AsSQLError returns the SQLError carried by err. Other errors are reported
+// as internal errors, GhostErrors with the SQLSTATE of their code.
+func AsSQLError(err error) *SQLError {
+	var sqlErr *SQLError
+	if errors.As(err, &sqlErr) {
+		if msg := err.Error(); msg != sqlErr.Message {
+			// Keep the context added by wrapping errors
+			wrapped := *sqlErr
+			wrapped.Message = msg
+			return &wrapped
+		}
+		return sqlErr
+	}
+	code := SQLStateInternalError
+	var ghostErr *GhostError
+	if errors.As(err, &ghostErr) {
+		code = ghostErr.SQLSTATE()
+	}
+	return &SQLError{Code: code, Message: err.Error()}
+}
+
+// SQLState returns the SQLSTATE carried by err, or "" if it has none
+func SQLState(err error) string {
+	var sqlErr *SQLError
+	if errors.As(err, &sqlErr) {
+		return sqlErr.Code
+	}
+	var ghostErr *GhostError
+	if errors.As(err, &ghostErr) {
+		return ghostErr.SQLSTATE()
+	}
+	return ""
+}
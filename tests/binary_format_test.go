@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// bindBinaryMessage binds parameters that are already encoded in binary format
+func bindBinaryMessage(portal, stmt string, params [][]byte, resultFormats ...int16) []byte {
+	body := cstring(portal)
+	body = append(body, cstring(stmt)...)
+	body = binary.BigEndian.AppendUint16(body, 1) // One format code for all parameters
+	body = binary.BigEndian.AppendUint16(body, 1) // Binary
+	body = binary.BigEndian.AppendUint16(body, uint16(len(params)))
+	for _, p := range params {
+		body = binary.BigEndian.AppendUint32(body, uint32(len(p)))
+		body = append(body, p...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(resultFormats)))
+	for _, f := range resultFormats {
+		body = binary.BigEndian.AppendUint16(body, uint16(f))
+	}
+	return body
+}
+
+// dataRowRaw splits a DataRow into its raw column values (nil for NULL)
+func dataRowRaw(body []byte) [][]byte {
+	n := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	values := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		length := int32(binary.BigEndian.Uint32(body))
+		body = body[4:]
+		if length < 0 {
+			continue
+		}
+		values[i] = body[:length]
+		body = body[length:]
+	}
+	return values
+}
+
+func TestBinaryFormatCodes(t *testing.T) {
+	tmpDir := "./test_binary_format_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	c.simpleQuery("CREATE TABLE embeddings (id INT PRIMARY KEY, total BIGINT, score FLOAT, active BOOLEAN, attrs JSONB, embedding VECTOR(3))")
+
+	t.Run("Binary Parameters", func(t *testing.T) {
+		id := binary.BigEndian.AppendUint32(nil, 7)
+		total := binary.BigEndian.AppendUint64(nil, 1<<40)
+		score := binary.BigEndian.AppendUint64(nil, math.Float64bits(0.1))
+		active := []byte{1}
+		attrs := append([]byte{1}, `{"k": "v"}`...)
+		vec := binary.BigEndian.AppendUint16(nil, 3)
+		vec = binary.BigEndian.AppendUint16(vec, 0)
+		for _, f := range []float32{0.5, -1.25, 3} {
+			vec = binary.BigEndian.AppendUint32(vec, math.Float32bits(f))
+		}
+
+		c.send('P', parseMessage("", "INSERT INTO embeddings (id, total, score, active, attrs, embedding) VALUES ($1, $2, $3, $4, $5, $6)"))
+		c.send('B', bindBinaryMessage("", "", [][]byte{id, total, score, active, attrs, vec}))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+		c.expect('1')
+		c.expect('2')
+		c.expect('C')
+		c.expect('Z')
+
+		rows := c.simpleQuery("SELECT id, total, active, embedding FROM embeddings")
+		if len(rows) != 1 || rows[0][0] != "7" || rows[0][1] != "1099511627776" || rows[0][2] != "t" || rows[0][3] != "[0.5,-1.25,3]" {
+			t.Errorf("Unexpected row: %v", rows)
+		}
+	})
+
+	t.Run("Binary Results", func(t *testing.T) {
+		c.send('P', parseMessage("", "SELECT id, total, score, active, attrs, embedding FROM embeddings WHERE id = $1"))
+		c.send('B', bindMessage("", "", textParams("7"), 1))
+		c.send('D', append([]byte{'P'}, cstring("")...))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+		c.expect('1')
+		c.expect('2')
+		for _, f := range parseRowDescription(c.expect('T')) {
+			if f.format != 1 {
+				t.Errorf("Column %s: expected binary format code, got %d", f.name, f.format)
+			}
+		}
+		values := dataRowRaw(c.expect('D'))
+		c.expect('C')
+		c.expect('Z')
+
+		if got := int32(binary.BigEndian.Uint32(values[0])); len(values[0]) != 4 || got != 7 {
+			t.Errorf("Expected int4 7, got %v", values[0])
+		}
+		if got := int64(binary.BigEndian.Uint64(values[1])); len(values[1]) != 8 || got != 1<<40 {
+			t.Errorf("Expected int8 2^40, got %v", values[1])
+		}
+		if got := math.Float64frombits(binary.BigEndian.Uint64(values[2])); got != 0.1 {
+			t.Errorf("Expected float8 0.1 without precision loss, got %v", got)
+		}
+		if len(values[3]) != 1 || values[3][0] != 1 {
+			t.Errorf("Expected bool true, got %v", values[3])
+		}
+		if len(values[4]) == 0 || values[4][0] != 1 || string(values[4][1:]) != `{"k": "v"}` {
+			t.Errorf("Expected jsonb version 1, got %q", values[4])
+		}
+		vec := values[5]
+		if len(vec) != 16 || binary.BigEndian.Uint16(vec) != 3 {
+			t.Fatalf("Expected 3-dimensional vector, got %v", vec)
+		}
+		if got := math.Float32frombits(binary.BigEndian.Uint32(vec[8:])); got != -1.25 {
+			t.Errorf("Expected second dimension -1.25, got %v", got)
+		}
+	})
+
+	t.Run("Mixed Result Formats", func(t *testing.T) {
+		c.send('P', parseMessage("", "SELECT id, score FROM embeddings"))
+		c.send('B', bindMessage("", "", nil, 0, 1))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+		c.expect('1')
+		c.expect('2')
+		values := dataRowRaw(c.expect('D'))
+		c.expect('C')
+		c.expect('Z')
+		if string(values[0]) != "7" || len(values[1]) != 8 {
+			t.Errorf("Expected text id and binary score, got %q and %v", values[0], values[1])
+		}
+	})
+}
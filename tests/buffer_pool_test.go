@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+func TestBufferPool(t *testing.T) {
+	executor.ResetRegistries()
+	tmpDir := "./test_buffer_pool_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	os.MkdirAll(tmpDir, 0755)
+	os.WriteFile(filepath.Join(tmpDir, storage.ConfigFileName), []byte("shared_buffers = 256kB\n"), 0644)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	exec := newWALTestExecutor(db)
+
+	// About 2MB of rows, eight times the pool
+	const numRows = 2000
+	filler := strings.Repeat("x", 1000)
+	runQuery(t, exec, "CREATE TABLE big (id INT, body TEXT)")
+	for i := 0; i < numRows; i += 100 {
+		values := make([]string, 0, 100)
+		for id := i; id < i+100; id++ {
+			values = append(values, fmt.Sprintf("(%d, '%s')", id, filler))
+		}
+		runQuery(t, exec, "INSERT INTO big (id, body) VALUES "+strings.Join(values, ", "))
+	}
+
+	count := func(t *testing.T, where string) int {
+		t.Helper()
+		res, err := exec.Execute(parseQuery("SELECT COUNT(*) AS n FROM big" + where))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("COUNT failed: %v", err)
+		}
+		n, _ := res.Rows[0]["n"].(int)
+		return n
+	}
+
+	t.Run("Eviction", func(t *testing.T) {
+		stats := db.Buffers.Stats()
+		if stats.Buffers != 256*1024/storage.PageSize {
+			t.Errorf("Expected %d buffers, got %d", 256*1024/storage.PageSize, stats.Buffers)
+		}
+		if stats.Used > stats.Buffers || stats.Evictions == 0 || stats.Writes == 0 {
+			t.Errorf("Expected dirty pages to be evicted from a full pool, got %+v", stats)
+		}
+		if n := count(t, ""); n != numRows {
+			t.Errorf("Expected %d rows, got %d", numRows, n)
+		}
+		res, err := exec.Execute(parseQuery("SELECT body FROM big WHERE id = 1234"))
+		if err != nil || len(res.Rows) != 1 || res.Rows[0]["body"] != filler {
+			t.Errorf("Expected row 1234 to be read back, got %v, %v", res, err)
+		}
+		if reads := db.Buffers.Stats().Reads; reads == stats.Reads {
+			t.Error("Expected scans to read evicted pages from disk")
+		}
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		runQuery(t, exec, "UPDATE big SET body = 'short' WHERE id < 500")
+		runQuery(t, exec, "DELETE FROM big WHERE id >= 1500")
+		if n := count(t, " WHERE body = 'short'"); n != 500 {
+			t.Errorf("Expected 500 updated rows, got %d", n)
+		}
+		if n := count(t, ""); n != 1500 {
+			t.Errorf("Expected 1500 rows after delete, got %d", n)
+		}
+		runQuery(t, exec, "CHECKPOINT")
+		if stats := db.Buffers.Stats(); stats.Dirty != 0 {
+			t.Errorf("Expected no dirty pages after a checkpoint, got %d", stats.Dirty)
+		}
+		runQuery(t, exec, "UPDATE big SET body = 'after' WHERE id >= 1000")
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		db = crash(t, db, tmpDir)
+		exec = newWALTestExecutor(db)
+		if n := count(t, ""); n != 1500 {
+			t.Errorf("Expected 1500 rows after recovery, got %d", n)
+		}
+		if n := count(t, " WHERE body = 'short'"); n != 500 {
+			t.Errorf("Expected 500 short rows after recovery, got %d", n)
+		}
+		if n := count(t, " WHERE body = 'after'"); n != 500 {
+			t.Errorf("Expected 500 rows updated after the checkpoint, got %d", n)
+		}
+		res, err := exec.Execute(parseQuery("SHOW shared_buffers"))
+		if err != nil || len(res.Rows) != 1 || res.Rows[0]["shared_buffers"] != "256kB" {
+			t.Errorf("Expected shared_buffers 256kB, got %v, %v", res, err)
+		}
+	})
+
+	if err := db.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
+
+func TestConcurrentTableWrites(t *testing.T) {
+	executor.ResetRegistries()
+	tmpDir := "./test_concurrent_writes_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	os.MkdirAll(tmpDir, 0755)
+	os.WriteFile(filepath.Join(tmpDir, storage.ConfigFileName), []byte("shared_buffers = 128kB\n"), 0644)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	newExecutor := func(id string) *executor.Executor {
+		session := db.SessionMgr.CreateSession(id)
+		session.SetUser("ghost")
+		session.SetDatabase("ghostsql")
+		return executor.NewExecutor(db, session)
+	}
+	exec1, exec2 := newExecutor("writer_1"), newExecutor("writer_2")
+
+	filler := strings.Repeat("x", 1000)
+	insertRows := func(from, to int) string {
+		values := make([]string, 0, to-from)
+		for id := from; id < to; id++ {
+			values = append(values, fmt.Sprintf("(%d, '%s')", id, filler))
+		}
+		return "INSERT INTO items (id, body) VALUES " + strings.Join(values, ", ")
+	}
+	count := func(t *testing.T, exec *executor.Executor, table string) int {
+		t.Helper()
+		res, err := exec.Execute(parseQuery("SELECT COUNT(*) AS n FROM " + table))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("COUNT failed: %v", err)
+		}
+		n, _ := res.Rows[0]["n"].(int)
+		return n
+	}
+	runQuery(t, exec1, "CREATE TABLE items (id INT, body TEXT)")
+	runQuery(t, exec1, "CREATE TABLE other (id INT)")
+	runQuery(t, exec1, insertRows(0, 50))
+
+	t.Run("Writer Waits For Open Transaction", func(t *testing.T) {
+		runQuery(t, exec1, "BEGIN")
+		runQuery(t, exec1, insertRows(1000, 1001))
+
+		// Enough rows for new pages past the ones the transaction saw
+		done := make(chan error, 1)
+		go func() {
+			_, err := exec2.Execute(parseQuery(insertRows(2000, 2100)))
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			t.Fatalf("Expected INSERT to wait for the open transaction, it returned %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+		if n := count(t, exec1, "items"); n != 51 {
+			t.Errorf("Expected the transaction to see 51 rows, got %d", n)
+		}
+
+		runQuery(t, exec1, "COMMIT")
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("INSERT failed after COMMIT: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("INSERT still waiting after COMMIT")
+		}
+		if n := count(t, exec2, "items"); n != 151 {
+			t.Errorf("Expected 151 rows from both sessions, got %d", n)
+		}
+	})
+
+	t.Run("Transaction Sees Rows Committed Before Its First Change", func(t *testing.T) {
+		runQuery(t, exec1, "BEGIN")
+		if n := count(t, exec1, "items"); n != 151 {
+			t.Errorf("Expected 151 rows, got %d", n)
+		}
+		runQuery(t, exec2, insertRows(3000, 3100))
+		runQuery(t, exec1, insertRows(4000, 4001))
+		runQuery(t, exec1, "COMMIT")
+		if n := count(t, exec2, "items"); n != 252 {
+			t.Errorf("Expected 252 rows, got %d", n)
+		}
+	})
+
+	t.Run("Deadlock", func(t *testing.T) {
+		runQuery(t, exec1, "BEGIN")
+		runQuery(t, exec2, "BEGIN")
+		runQuery(t, exec1, "INSERT INTO other (id) VALUES (1)")
+		runQuery(t, exec2, insertRows(5000, 5001))
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := exec2.Execute(parseQuery("INSERT INTO other (id) VALUES (2)"))
+			done <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		_, err := exec1.Execute(parseQuery(insertRows(6000, 6001)))
+		if err == nil || !strings.Contains(err.Error(), "deadlock detected") {
+			t.Fatalf("Expected a deadlock error, got %v", err)
+		}
+		runQuery(t, exec1, "ROLLBACK")
+		if err := <-done; err != nil {
+			t.Fatalf("Expected the other transaction to go on, got %v", err)
+		}
+		runQuery(t, exec2, "COMMIT")
+		if n := count(t, exec1, "other"); n != 1 {
+			t.Errorf("Expected 1 row in other, got %d", n)
+		}
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		db = crash(t, db, tmpDir)
+		exec := newWALTestExecutor(db)
+		if n := count(t, exec, "items"); n != 253 {
+			t.Errorf("Expected 253 rows after recovery, got %d", n)
+		}
+	})
+
+	if err := db.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
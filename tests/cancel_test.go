@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// sendCancelRequest sends a CancelRequest on a new connection and waits for
+// the server to close it
+func sendCancelRequest(t *testing.T, addr string, processID, secretKey uint32) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	msg := binary.BigEndian.AppendUint32(nil, 16)
+	msg = binary.BigEndian.AppendUint32(msg, 80877102)
+	msg = binary.BigEndian.AppendUint32(msg, processID)
+	msg = binary.BigEndian.AppendUint32(msg, secretKey)
+	conn.Write(msg)
+
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Expected the server to close the cancel connection silently, got %d bytes, %v", n, err)
+	}
+}
+
+func TestQueryCancellation(t *testing.T) {
+	tmpDir := "./test_cancel_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	if c.processID == 0 {
+		t.Fatalf("Expected BackendKeyData after authentication")
+	}
+
+	c.simpleQuery("CREATE TABLE nums (n INT)")
+	c.simpleQuery("CREATE TABLE others (m INT)")
+	var nums, others []string
+	for i := 0; i < 300; i++ {
+		nums = append(nums, fmt.Sprintf("(%d)", i))
+		others = append(others, fmt.Sprintf("(%d)", i+1000))
+	}
+	c.simpleQuery("INSERT INTO nums (n) VALUES " + strings.Join(nums, ", "))
+	c.simpleQuery("INSERT INTO others (m) VALUES " + strings.Join(others, ", "))
+
+	// 90,000 cross joined rows probed against 300 rows takes several seconds
+	runaway := "SELECT COUNT(*) FROM nums a CROSS JOIN nums b JOIN others c ON a.n = c.m"
+
+	t.Run("Cancel Runaway Join", func(t *testing.T) {
+		start := time.Now()
+		c.send('Q', cstring(runaway))
+		time.Sleep(200 * time.Millisecond)
+		sendCancelRequest(t, addr, c.processID, c.secretKey)
+
+		var fields map[byte]string
+		for {
+			msgType, body := c.receive()
+			if msgType == 'E' {
+				fields = errorFields(body)
+			}
+			if msgType == 'Z' {
+				break
+			}
+		}
+		if fields == nil || fields['C'] != "57014" {
+			t.Fatalf("Expected SQLSTATE 57014, got %v", fields)
+		}
+		if fields['M'] != "canceling statement due to user request" {
+			t.Errorf("Unexpected message %q", fields['M'])
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Cancellation took %v", elapsed)
+		}
+
+		// The session remains usable
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM nums"); len(rows) != 1 || rows[0][0] != "300" {
+			t.Errorf("Unexpected result after cancel: %v", rows)
+		}
+	})
+
+	t.Run("Wrong Secret Key", func(t *testing.T) {
+		sendCancelRequest(t, addr, c.processID, c.secretKey+1)
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM nums"); len(rows) != 1 {
+			t.Errorf("Unexpected result: %v", rows)
+		}
+	})
+
+	t.Run("Idle Session", func(t *testing.T) {
+		// A cancel that arrives between statements must not affect the next one
+		sendCancelRequest(t, addr, c.processID, c.secretKey)
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM nums a CROSS JOIN others b"); len(rows) != 1 || rows[0][0] != "90000" {
+			t.Errorf("Unexpected result: %v", rows)
+		}
+	})
+}
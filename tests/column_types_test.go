@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/protocol/pg"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// fieldDescription is a single column of a RowDescription message
+type fieldDescription struct {
+	name     string
+	tableOID uint32
+	attNum   uint16
+	typeOID  uint32
+	typeSize int16
+	typmod   int32
+	format   uint16
+}
+
+func parseRowDescription(body []byte) []fieldDescription {
+	n := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	fields := make([]fieldDescription, n)
+	for i := range fields {
+		end := 0
+		for body[end] != 0 {
+			end++
+		}
+		fields[i].name = string(body[:end])
+		body = body[end+1:]
+		fields[i].tableOID = binary.BigEndian.Uint32(body[0:])
+		fields[i].attNum = binary.BigEndian.Uint16(body[4:])
+		fields[i].typeOID = binary.BigEndian.Uint32(body[6:])
+		fields[i].typeSize = int16(binary.BigEndian.Uint16(body[10:]))
+		fields[i].typmod = int32(binary.BigEndian.Uint32(body[12:]))
+		fields[i].format = binary.BigEndian.Uint16(body[16:])
+		body = body[18:]
+	}
+	return fields
+}
+
+// describeQuery runs a simple query and returns its RowDescription and rows
+func (c *pgTestClient) describeQuery(sql string) ([]fieldDescription, [][]string) {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	var fields []fieldDescription
+	var rows [][]string
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'T':
+			fields = parseRowDescription(body)
+		case 'D':
+			rows = append(rows, dataRowValues(body))
+		case 'E':
+			c.t.Fatalf("Query %q failed: %s", sql, errorMessage(body))
+		case 'Z':
+			return fields, rows
+		}
+	}
+}
+
+func TestRowDescriptionColumnTypes(t *testing.T) {
+	tmpDir := "./test_column_types_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	c.simpleQuery("CREATE TABLE docs (id INT PRIMARY KEY, views BIGINT, title VARCHAR(40), body TEXT, score FLOAT, published BOOLEAN, attrs JSONB, embedding VECTOR(3))")
+	c.simpleQuery("INSERT INTO docs (id, views, title, body, score, published, attrs, embedding) VALUES (1, 10, 'first', 'hello', 0.25, 'true', '{\"a\": 1}', '[1, 2.5, 3]')")
+
+	t.Run("Table Columns", func(t *testing.T) {
+		fields, rows := c.describeQuery("SELECT id, views, title, body, score, published, attrs, embedding FROM docs")
+		want := []struct {
+			oid    uint32
+			size   int16
+			typmod int32
+		}{
+			{pg.OIDInt4, 4, -1},
+			{pg.OIDInt8, 8, -1},
+			{pg.OIDVarchar, -1, 44},
+			{pg.OIDText, -1, -1},
+			{pg.OIDFloat8, 8, -1},
+			{pg.OIDBool, 1, -1},
+			{pg.OIDJSONB, -1, -1},
+			{pg.OIDVector, -1, 3},
+		}
+		if len(fields) != len(want) {
+			t.Fatalf("Expected %d fields, got %d", len(want), len(fields))
+		}
+		tableOID := uint32(db.Catalog.GenerateOID("docs"))
+		for i, w := range want {
+			f := fields[i]
+			if f.typeOID != w.oid || f.typeSize != w.size || f.typmod != w.typmod {
+				t.Errorf("Column %s: expected (oid %d, size %d, typmod %d), got (%d, %d, %d)",
+					f.name, w.oid, w.size, w.typmod, f.typeOID, f.typeSize, f.typmod)
+			}
+			if f.tableOID != tableOID || int(f.attNum) != i+1 {
+				t.Errorf("Column %s: expected table %d attnum %d, got %d/%d", f.name, tableOID, i+1, f.tableOID, f.attNum)
+			}
+		}
+
+		if len(rows) != 1 {
+			t.Fatalf("Expected 1 row, got %d", len(rows))
+		}
+		if rows[0][5] != "t" {
+			t.Errorf("Expected boolean text 't', got %q", rows[0][5])
+		}
+		if rows[0][7] != "[1,2.5,3]" {
+			t.Errorf("Expected vector text [1,2.5,3], got %q", rows[0][7])
+		}
+	})
+
+	t.Run("Computed Columns", func(t *testing.T) {
+		fields, _ := c.describeQuery("SELECT COUNT(*) AS n FROM docs")
+		if len(fields) != 1 || fields[0].typeOID != pg.OIDInt8 || fields[0].tableOID != 0 {
+			t.Errorf("Expected COUNT to be an untabled int8, got %+v", fields)
+		}
+
+		fields, rows := c.describeQuery("SELECT score * 2 AS doubled FROM docs")
+		if len(fields) != 1 || fields[0].typeOID != pg.OIDFloat8 || fields[0].attNum != 0 {
+			t.Errorf("Expected computed float8, got %+v", fields)
+		}
+		if len(rows) != 1 || rows[0][0] != "0.5" {
+			t.Errorf("Expected 0.5, got %v", rows)
+		}
+	})
+
+	t.Run("Qualified Join Columns", func(t *testing.T) {
+		c.simpleQuery("CREATE TABLE tags (doc_id INT, tag TEXT)")
+		c.simpleQuery("INSERT INTO tags (doc_id, tag) VALUES (1, 'go')")
+		fields, _ := c.describeQuery("SELECT d.score, t.tag FROM docs d JOIN tags t ON d.id = t.doc_id")
+		if len(fields) != 2 {
+			t.Fatalf("Expected 2 fields, got %d", len(fields))
+		}
+		if fields[0].typeOID != pg.OIDFloat8 || fields[1].typeOID != pg.OIDText {
+			t.Errorf("Expected float8/text, got %d/%d", fields[0].typeOID, fields[1].typeOID)
+		}
+		if fields[1].tableOID != uint32(db.Catalog.GenerateOID("tags")) || fields[1].attNum != 2 {
+			t.Errorf("Expected tags.tag attnum 2, got table %d attnum %d", fields[1].tableOID, fields[1].attNum)
+		}
+	})
+}
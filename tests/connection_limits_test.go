@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// loginError attempts a SCRAM login and returns the fields of the
+// ErrorResponse that refused it, or nil once the server is ready for queries
+func loginError(t *testing.T, addr, user, password string) (*pgTestClient, map[byte]string) {
+	t.Helper()
+	c := newPGTestClient(t, addr, user)
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'R':
+			if binary.BigEndian.Uint32(body) == 10 {
+				if err := c.scramAuth(user, password); err != nil {
+					t.Fatalf("SCRAM authentication failed: %v", err)
+				}
+			}
+		case 'E':
+			return c, errorFields(body)
+		case 'Z':
+			return c, nil
+		}
+	}
+}
+
+// closeAndWait terminates the connection and waits until a new login of
+// user gets past the connection limits
+func closeAndWait(t *testing.T, c *pgTestClient, addr, user, password string) *pgTestClient {
+	t.Helper()
+	c.send('X', nil)
+	c.conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		next, fields := loginError(t, addr, user, password)
+		if fields == nil {
+			return next
+		}
+		if fields['C'] != "53300" || time.Now().After(deadline) {
+			t.Fatalf("Expected login after closing a connection, got %v", fields)
+		}
+		next.conn.Close()
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	tmpDir := "./test_connection_limits_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	os.MkdirAll(tmpDir, 0755)
+	os.WriteFile(filepath.Join(tmpDir, storage.ConfigFileName), []byte("max_connections = 4\nsuperuser_reserved_connections = 1\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, storage.HBAFileName), []byte("host all all all scram-sha-256\n"), 0644)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	admin := connectPG(t, addr, "ghost", "ghost")
+	admin.simpleQuery("CREATE ROLE limited WITH LOGIN PASSWORD 'pw' CONNECTION LIMIT 1")
+	admin.simpleQuery("CREATE ROLE other WITH LOGIN PASSWORD 'pw'")
+	admin.simpleQuery("CREATE ROLE expired WITH LOGIN PASSWORD 'pw' VALID UNTIL '2000-01-01 00:00:00+00'")
+
+	t.Run("Catalog", func(t *testing.T) {
+		rows := admin.simpleQuery("SELECT rolname, rolconnlimit, rolvaliduntil FROM pg_roles WHERE rolname = 'limited' OR rolname = 'expired'")
+		got := make(map[string][]string)
+		for _, row := range rows {
+			got[row[0]] = row[1:]
+		}
+		if v := got["limited"]; len(v) != 2 || v[0] != "1" || v[1] != "NULL" {
+			t.Errorf("Unexpected limits for limited: %v", v)
+		}
+		if v := got["expired"]; len(v) != 2 || v[0] != "-1" || v[1] != "2000-01-01 00:00:00+00" {
+			t.Errorf("Unexpected limits for expired: %v", v)
+		}
+	})
+
+	// The connections below stay open across checks, so they are made
+	// outside subtests
+	limited, fields := loginError(t, addr, "limited", "pw")
+	if fields != nil {
+		t.Fatalf("First connection refused: %v", fields)
+	}
+	if _, fields = loginError(t, addr, "limited", "pw"); fields['C'] != "53300" || fields['M'] != `too many connections for role "limited"` {
+		t.Errorf("Expected role connection limit error, got %v", fields)
+	}
+
+	other, fields := loginError(t, addr, "other", "pw")
+	if fields != nil {
+		t.Fatalf("Third connection refused: %v", fields)
+	}
+	// The last slot is reserved for superusers
+	if _, fields = loginError(t, addr, "other", "pw"); fields['C'] != "53300" || fields['M'] != "remaining connection slots are reserved for roles with the SUPERUSER attribute" {
+		t.Errorf("Expected reserved slot error, got %v", fields)
+	}
+	super, fields := loginError(t, addr, "ghost", "ghost")
+	if fields != nil {
+		t.Fatalf("Superuser refused the reserved slot: %v", fields)
+	}
+	if _, fields = loginError(t, addr, "ghost", "ghost"); fields['C'] != "53300" || fields['M'] != "sorry, too many clients already" {
+		t.Errorf("Expected max_connections error, got %v", fields)
+	}
+
+	// Closed connections no longer count
+	super.conn.Close()
+	other.conn.Close()
+	closeAndWait(t, limited, addr, "limited", "pw")
+
+	t.Run("Valid Until", func(t *testing.T) {
+		_, fields := loginError(t, addr, "expired", "pw")
+		if fields['C'] != "28000" {
+			t.Errorf("Expected expired password to be refused, got %v", fields)
+		}
+
+		admin.simpleQuery("ALTER ROLE expired VALID UNTIL 'infinity'")
+		c, fields := loginError(t, addr, "expired", "pw")
+		if fields != nil {
+			t.Fatalf("Expected login after VALID UNTIL 'infinity', got %v", fields)
+		}
+
+		// A role may change its password but not its own limits
+		res := c.queryBatch("ALTER ROLE expired CONNECTION LIMIT 5")
+		if len(res.errors) != 1 || res.errors[0]['C'] != "42501" {
+			t.Errorf("Expected permission error, got %v", res.errors)
+		}
+		c.simpleQuery("ALTER ROLE expired PASSWORD 'pw'")
+	})
+
+	t.Run("Invalid Values", func(t *testing.T) {
+		if fields := admin.queryError("ALTER ROLE limited CONNECTION LIMIT -2"); fields['C'] != "22023" {
+			t.Errorf("Expected invalid connection limit error, got %v", fields)
+		}
+		if fields := admin.queryError("ALTER ROLE limited VALID UNTIL 'someday'"); fields['C'] != "22007" {
+			t.Errorf("Expected invalid timestamp error, got %v", fields)
+		}
+	})
+
+	t.Run("Persisted", func(t *testing.T) {
+		admin.simpleQuery("ALTER ROLE limited CONNECTION LIMIT 0 VALID UNTIL '2099-12-31'")
+		roles := storage.NewRoleStore(tmpDir)
+		if err := roles.Load(); err != nil {
+			t.Fatalf("Failed to load roles: %v", err)
+		}
+		role, ok := roles.GetRole("limited")
+		if !ok || role.ConnLimit != 0 || role.ValidUntil.Year() != 2099 {
+			t.Errorf("Expected limits to be persisted, got %+v", role)
+		}
+		if role, _ := roles.GetRole("other"); role.ConnLimit != -1 {
+			t.Errorf("Expected no connection limit, got %d", role.ConnLimit)
+		}
+	})
+}
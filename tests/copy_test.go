@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// copyIn runs COPY FROM STDIN, sending each chunk as a CopyData message, and
+// returns the CommandComplete tag and the ErrorResponse fields if any
+func (c *pgTestClient) copyIn(sql string, chunks ...string) (string, map[byte]string) {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+
+	msgType, body := c.receive()
+	if msgType == 'G' {
+		for _, chunk := range chunks {
+			c.send('d', []byte(chunk))
+		}
+		c.send('c', nil)
+	} else if msgType == 'E' {
+		fields := errorFields(body)
+		c.expect('Z')
+		return "", fields
+	} else {
+		c.t.Fatalf("Expected CopyInResponse, got %c", msgType)
+	}
+
+	var tag string
+	var fields map[byte]string
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'C':
+			tag = string(body[:len(body)-1])
+		case 'E':
+			fields = errorFields(body)
+		case 'Z':
+			return tag, fields
+		}
+	}
+}
+
+// copyOut runs COPY TO STDOUT and returns the CopyOutResponse format, the
+// CopyData payloads and the CommandComplete tag
+func (c *pgTestClient) copyOut(sql string) (byte, [][]byte, string) {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	body := c.expect('H')
+	format := body[0]
+
+	var data [][]byte
+	var tag string
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'd':
+			data = append(data, body)
+		case 'C':
+			tag = string(body[:len(body)-1])
+		case 'E':
+			c.t.Fatalf("COPY failed: %s", errorMessage(body))
+		case 'Z':
+			return format, data, tag
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	tmpDir := "./test_copy_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	c.simpleQuery("CREATE TABLE items (id INT PRIMARY KEY, name TEXT, score FLOAT, active BOOLEAN)")
+	c.simpleQuery("CREATE TABLE embeddings (id INT, v VECTOR(3))")
+	c.simpleQuery("CREATE TABLE embeddings_copy (id INT, v VECTOR(3))")
+
+	t.Run("Text From Stdin", func(t *testing.T) {
+		// Rows are split across CopyData messages at arbitrary points
+		tag, fields := c.copyIn("COPY items FROM STDIN",
+			"1\talpha\t1.5\tt\n2\tbe",
+			"ta\\twith tab\t\\N\tf\n",
+			"3\tback\\\\slash\t2\tt")
+		if fields != nil {
+			t.Fatalf("COPY failed: %v", fields)
+		}
+		if tag != "COPY 3" {
+			t.Errorf("Expected COPY 3, got %q", tag)
+		}
+
+		rows := c.simpleQuery("SELECT id, name, score, active FROM items ORDER BY id")
+		want := [][]string{
+			{"1", "alpha", "1.5", "t"},
+			{"2", "beta\twith tab", "NULL", "f"},
+			{"3", "back\\slash", "2", "t"},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("Expected %v, got %v", want, rows)
+		}
+	})
+
+	t.Run("CSV From Stdin", func(t *testing.T) {
+		tag, fields := c.copyIn("COPY items (id, name) FROM STDIN WITH (FORMAT csv, HEADER true, NULL 'NA')",
+			"id,name\n4,\"comma, \"\"quoted\"\"\"\n5,NA\n6,\"NA\"\n7,\"multi\nline\"\n")
+		if fields != nil {
+			t.Fatalf("COPY failed: %v", fields)
+		}
+		if tag != "COPY 4" {
+			t.Errorf("Expected COPY 4, got %q", tag)
+		}
+
+		rows := c.simpleQuery("SELECT id, name FROM items WHERE id > 3 ORDER BY id")
+		want := [][]string{{"4", "comma, \"quoted\""}, {"5", "NULL"}, {"6", "NA"}, {"7", "multi\nline"}}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("Expected %v, got %v", want, rows)
+		}
+		if rows := c.simpleQuery("SELECT id FROM items WHERE name IS NULL"); len(rows) != 1 || rows[0][0] != "5" {
+			t.Errorf("Expected only id 5 to be NULL, got %v", rows)
+		}
+	})
+
+	t.Run("Text To Stdout", func(t *testing.T) {
+		format, data, tag := c.copyOut("COPY items (id, name, score) TO STDOUT")
+		if format != 0 || tag != "COPY 7" || len(data) != 7 {
+			t.Fatalf("Unexpected COPY output: format %d, tag %q, %d rows", format, tag, len(data))
+		}
+		if got := string(data[1]); got != "2\tbeta\\twith tab\t\\N\n" {
+			t.Errorf("Unexpected text row %q", got)
+		}
+		if got := string(data[6]); got != "7\tmulti\\nline\t\\N\n" {
+			t.Errorf("Unexpected text row %q", got)
+		}
+	})
+
+	t.Run("Query To Stdout As CSV", func(t *testing.T) {
+		_, data, tag := c.copyOut("COPY (SELECT id, name FROM items WHERE id >= 4 ORDER BY id) TO STDOUT WITH (FORMAT csv, HEADER)")
+		if tag != "COPY 4" {
+			t.Errorf("Expected COPY 4, got %q", tag)
+		}
+		got := string(bytes.Join(data, nil))
+		want := "id,name\n4,\"comma, \"\"quoted\"\"\"\n5,\n6,NA\n7,\"multi\nline\"\n"
+		if got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("Legacy Options", func(t *testing.T) {
+		_, data, _ := c.copyOut("COPY (SELECT id, active FROM items WHERE id < 3 ORDER BY id) TO STDOUT DELIMITER '|' NULL 'none'")
+		if got := string(bytes.Join(data, nil)); got != "1|t\n2|f\n" {
+			t.Errorf("Unexpected output %q", got)
+		}
+	})
+
+	t.Run("Binary Round Trip", func(t *testing.T) {
+		tag, fields := c.copyIn("COPY embeddings FROM STDIN", "1\t[1,2,3]\n2\t[0.5,-1,4]\n3\t\\N\n")
+		if fields != nil || tag != "COPY 3" {
+			t.Fatalf("COPY failed: %q %v", tag, fields)
+		}
+
+		format, data, _ := c.copyOut("COPY embeddings TO STDOUT (FORMAT binary)")
+		if format != 1 {
+			t.Fatalf("Expected binary CopyOutResponse, got format %d", format)
+		}
+		stream := bytes.Join(data, nil)
+		if !bytes.HasPrefix(stream, []byte("PGCOPY\n\377\r\n\000")) {
+			t.Fatalf("Missing binary COPY signature: %q", stream[:11])
+		}
+
+		// Feed the stream back in small chunks that split tuples
+		var chunks []string
+		for i := 0; i < len(stream); i += 7 {
+			end := min(i+7, len(stream))
+			chunks = append(chunks, string(stream[i:end]))
+		}
+		tag, fields = c.copyIn("COPY embeddings_copy FROM STDIN WITH (FORMAT binary)", chunks...)
+		if fields != nil || tag != "COPY 3" {
+			t.Fatalf("Binary COPY failed: %q %v", tag, fields)
+		}
+
+		src := c.simpleQuery("SELECT id, v FROM embeddings ORDER BY id")
+		dst := c.simpleQuery("SELECT id, v FROM embeddings_copy ORDER BY id")
+		if !reflect.DeepEqual(src, dst) {
+			t.Errorf("Binary round trip changed data: %v vs %v", src, dst)
+		}
+		if dst[1][1] != "[0.5,-1,4]" {
+			t.Errorf("Unexpected vector %q", dst[1][1])
+		}
+
+		// Negative lengths other than a NULL field are malformed
+		signature := "PGCOPY\n\377\r\n\000\000\000\000\000"
+		for message, stream := range map[string]string{
+			"invalid COPY file header (negative length)": signature + "\377\377\377\377",
+			"invalid field size -2":                      signature + "\000\000\000\000\000\002\377\377\377\376",
+		} {
+			_, fields = c.copyIn("COPY embeddings_copy FROM STDIN WITH (FORMAT binary)", stream)
+			if fields == nil || fields['C'] != "22P04" || fields['M'] != message {
+				t.Errorf("Expected SQLSTATE 22P04 %q, got %v", message, fields)
+			}
+		}
+	})
+
+	t.Run("Bad Row Rejects Whole Copy", func(t *testing.T) {
+		_, fields := c.copyIn("COPY items (id, name) FROM STDIN", "100\tok\n101\tok\nnot_a_number\tbad\n102\tok\n")
+		if fields == nil || fields['C'] != "22P02" {
+			t.Fatalf("Expected SQLSTATE 22P02, got %v", fields)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); rows[0][0] != "7" {
+			t.Errorf("Expected no rows from the failed COPY, got %v", rows)
+		}
+
+		_, fields = c.copyIn("COPY items (id, name) FROM STDIN", "100\tok\textra\n")
+		if fields == nil || fields['C'] != "22P04" {
+			t.Errorf("Expected SQLSTATE 22P04 for extra data, got %v", fields)
+		}
+
+		_, fields = c.copyIn("COPY items (id, name) FROM STDIN", "1\tduplicate\n")
+		if fields == nil || !strings.Contains(fields['M'], "duplicate value") {
+			t.Errorf("Expected primary key violation, got %v", fields)
+		}
+	})
+
+	t.Run("Copy Fail", func(t *testing.T) {
+		c.send('Q', cstring("COPY items FROM STDIN"))
+		c.expect('G')
+		c.send('d', []byte("200\tx\t1\tt\n"))
+		c.send('f', cstring("client gave up"))
+
+		var fields map[byte]string
+		for {
+			msgType, body := c.receive()
+			if msgType == 'E' {
+				fields = errorFields(body)
+			}
+			if msgType == 'Z' {
+				break
+			}
+		}
+		if fields['C'] != "57014" || fields['M'] != "COPY from stdin failed: client gave up" {
+			t.Errorf("Unexpected CopyFail error: %v", fields)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); rows[0][0] != "7" {
+			t.Errorf("Expected no rows from the failed COPY, got %v", rows)
+		}
+	})
+
+	t.Run("Unknown Column", func(t *testing.T) {
+		_, fields := c.copyIn("COPY items (id, missing) FROM STDIN")
+		if fields == nil || !strings.Contains(fields['M'], "column \"missing\"") {
+			t.Errorf("Expected unknown column error, got %v", fields)
+		}
+	})
+
+	t.Run("Bulk Load", func(t *testing.T) {
+		c.simpleQuery("CREATE TABLE bulk (id INT, label TEXT)")
+		var sb strings.Builder
+		for i := 0; i < 20000; i++ {
+			fmt.Fprintf(&sb, "%d\tlabel %d\n", i, i)
+		}
+		tag, fields := c.copyIn("COPY bulk FROM STDIN", sb.String())
+		if fields != nil || tag != "COPY 20000" {
+			t.Fatalf("Bulk COPY failed: %q %v", tag, fields)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM bulk"); rows[0][0] != "20000" {
+			t.Errorf("Expected 20000 rows, got %v", rows)
+		}
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		c.simpleQuery("CREATE TABLE parents (id INT PRIMARY KEY)")
+		c.simpleQuery("CREATE TABLE children (id INT PRIMARY KEY, parent_id INT REFERENCES parents(id))")
+		if tag, fields := c.copyIn("COPY parents FROM STDIN", "1\n2\n3\n"); fields != nil || tag != "COPY 3" {
+			t.Fatalf("COPY failed: %q %v", tag, fields)
+		}
+		rowsFrom := func(from, to int, parent int) string {
+			var sb strings.Builder
+			for i := from; i < to; i++ {
+				fmt.Fprintf(&sb, "%d\t%d\n", i, parent)
+			}
+			return sb.String()
+		}
+		count := func() string {
+			return c.simpleQuery("SELECT COUNT(*) FROM children")[0][0]
+		}
+
+		// A key repeated several batches later, with more data after it
+		_, fields := c.copyIn("COPY children FROM STDIN", rowsFrom(0, 2500, 1), "5\t2\n", rowsFrom(2500, 3000, 1))
+		if fields == nil || fields['C'] != "23505" {
+			t.Fatalf("Expected a unique violation, got %v", fields)
+		}
+		if n := count(); n != "0" {
+			t.Errorf("Expected no rows from the failed COPY, got %s", n)
+		}
+
+		_, fields = c.copyIn("COPY children FROM STDIN", rowsFrom(0, 1500, 1), rowsFrom(1500, 1501, 9))
+		if fields == nil || fields['C'] != "23503" {
+			t.Fatalf("Expected a foreign key violation, got %v", fields)
+		}
+
+		tag, fields := c.copyIn("COPY children FROM STDIN", rowsFrom(0, 1500, 1), rowsFrom(1500, 2500, 3))
+		if fields != nil || tag != "COPY 2500" {
+			t.Fatalf("COPY failed: %q %v", tag, fields)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM children WHERE parent_id = 3"); rows[0][0] != "1000" {
+			t.Errorf("Expected 1000 rows with parent 3, got %v", rows)
+		}
+
+		// Inside a transaction block the rows are only kept on COMMIT
+		c.simpleQuery("BEGIN")
+		if tag, fields := c.copyIn("COPY children FROM STDIN", rowsFrom(2500, 4000, 2)); fields != nil || tag != "COPY 1500" {
+			t.Fatalf("COPY failed: %q %v", tag, fields)
+		}
+		c.simpleQuery("ROLLBACK")
+		if n := count(); n != "2500" {
+			t.Errorf("Expected 2500 rows after ROLLBACK, got %s", n)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// queryError runs a simple query that is expected to fail and returns the
+// fields of its ErrorResponse
+func (c *pgTestClient) queryError(sql string) map[byte]string {
+	c.t.Helper()
+	res := c.queryBatch(sql)
+	if len(res.errors) != 1 {
+		c.t.Fatalf("%s: expected one error, got %v", sql, res.errors)
+	}
+	return res.errors[0]
+}
+
+func TestErrorResponseFields(t *testing.T) {
+	tmpDir := "./test_error_fields_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	c.simpleQuery("CREATE TABLE authors (id INT PRIMARY KEY, name VARCHAR(5))")
+	c.simpleQuery("CREATE TABLE books (id INT PRIMARY KEY, author_id INT REFERENCES authors(id))")
+	c.simpleQuery("INSERT INTO authors (id, name) VALUES (1, 'ann')")
+
+	check := func(t *testing.T, fields map[byte]string, want map[byte]string) {
+		t.Helper()
+		if fields['S'] != "ERROR" || fields['V'] != "ERROR" {
+			t.Errorf("Expected ERROR severity, got S=%q V=%q", fields['S'], fields['V'])
+		}
+		for code, value := range want {
+			if fields[code] != value {
+				t.Errorf("Field %c: expected %q, got %q (all fields %v)", code, value, fields[code], fields)
+			}
+		}
+	}
+
+	t.Run("Unique Violation", func(t *testing.T) {
+		fields := c.queryError("INSERT INTO authors (id, name) VALUES (1, 'bob')")
+		check(t, fields, map[byte]string{
+			'C': "23505",
+			'D': "Key (id)=(1) already exists.",
+			's': "public",
+			't': "authors",
+			'n': "authors_pkey",
+		})
+	})
+
+	t.Run("Foreign Key Violation", func(t *testing.T) {
+		fields := c.queryError("INSERT INTO books (id, author_id) VALUES (1, 42)")
+		check(t, fields, map[byte]string{
+			'C': "23503",
+			'D': "Key (author_id)=(42) is not present in table \"authors\".",
+			't': "books",
+			'n': "books_author_id_fkey",
+		})
+	})
+
+	t.Run("Not Null Violation", func(t *testing.T) {
+		fields := c.queryError("INSERT INTO authors (id, name) VALUES (NULL, 'cat')")
+		check(t, fields, map[byte]string{'C': "23502", 't': "authors", 'c': "id"})
+	})
+
+	t.Run("Value Too Long", func(t *testing.T) {
+		fields := c.queryError("INSERT INTO authors (id, name) VALUES (3, 'too long')")
+		check(t, fields, map[byte]string{'C': "22001", 'c': "name"})
+	})
+
+	t.Run("Undefined Table", func(t *testing.T) {
+		fields := c.queryError("SELECT * FROM missing")
+		check(t, fields, map[byte]string{'C': "42P01", 'M': "table missing does not exist", 't': "missing"})
+	})
+
+	t.Run("Syntax Error Position", func(t *testing.T) {
+		fields := c.queryError("CREATE TABLE (id INT)")
+		check(t, fields, map[byte]string{'C': "42601", 'P': "14"})
+
+		// Positions count characters, not bytes
+		fields = c.queryError("SELECT 'é' FROM authors WHERE")
+		check(t, fields, map[byte]string{'C': "42601", 'P': "30"})
+	})
+
+	t.Run("Insufficient Privilege", func(t *testing.T) {
+		c.simpleQuery("CREATE ROLE reader WITH LOGIN PASSWORD 'secret'")
+		rc := connectPG(t, addr, "reader", "secret")
+		fields := rc.queryError("SELECT * FROM authors")
+		check(t, fields, map[byte]string{'C': "42501"})
+	})
+
+	t.Run("Copy Context", func(t *testing.T) {
+		_, fields := c.copyIn("COPY books FROM STDIN", "2\t1\nthree\t1\n")
+		check(t, fields, map[byte]string{'C': "22P02", 'W': "COPY books, line 2"})
+	})
+}
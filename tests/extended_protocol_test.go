@@ -0,0 +1,456 @@
+package tests
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/protocol/pg"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// pgTestClient is a minimal wire protocol client used to drive pg.Handler
+type pgTestClient struct {
+	t         *testing.T
+	conn      net.Conn
+	processID uint32 // From BackendKeyData
+	secretKey uint32
+}
+
+// startPGTestServer serves pg.Handler connections on a loopback TCP port
+func startPGTestServer(t *testing.T, db *storage.Database) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	servePGTestConnections(t, db, listener)
+	return listener.Addr().String()
+}
+
+// servePGTestConnections serves pg.Handler connections accepted on listener
+// until the test ends
+func servePGTestConnections(t *testing.T, db *storage.Database, listener net.Listener) {
+	t.Cleanup(func() { listener.Close() })
+
+	tlsConfig, err := pg.LoadTLSConfig(db)
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				id := conn.RemoteAddr().String()
+				if _, ok := conn.(*net.UnixConn); ok {
+					id = fmt.Sprintf("[local]:%p", conn) // Unix-domain peers have no address
+				}
+				session := db.SessionMgr.CreateSession(id)
+				defer db.SessionMgr.CloseSession(session.ID)
+				session.SetClientAddr(conn.RemoteAddr())
+				session.SetDatabase("ghostsql")
+				handler := pg.NewHandler(conn, db, session)
+				handler.SetTLSConfig(tlsConfig)
+				handler.Handle()
+			}()
+		}
+	}()
+}
+
+// connectPG opens a connection and authenticates as the given user
+func connectPG(t *testing.T, addr, user, password string) *pgTestClient {
+	c := newPGTestClient(t, addr, user)
+	c.login(user, password)
+	return c
+}
+
+// login answers authentication requests until the server is ready for queries
+func (c *pgTestClient) login(user, password string) {
+	t := c.t
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'R':
+			switch binary.BigEndian.Uint32(body) {
+			case 3:
+				c.send('p', cstring(password))
+			case 10:
+				if err := c.scramAuth(user, password); err != nil {
+					t.Fatalf("Login failed: %v", err)
+				}
+			}
+		case 'K':
+			c.processID = binary.BigEndian.Uint32(body)
+			c.secretKey = binary.BigEndian.Uint32(body[4:])
+		case 'E':
+			t.Fatalf("Login failed: %s", errorMessage(body))
+		case 'Z':
+			return
+		}
+	}
+}
+
+// newPGTestClient connects and sends the StartupMessage, leaving
+// authentication to the caller
+func newPGTestClient(t *testing.T, addr, user string) *pgTestClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	sendStartupMessage(conn, map[string]string{"user": user, "database": "ghostsql"})
+	return &pgTestClient{t: t, conn: conn}
+}
+
+func (c *pgTestClient) send(msgType byte, body []byte) {
+	buf := []byte{msgType}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(body)+4))
+	buf = append(buf, body...)
+	if _, err := c.conn.Write(buf); err != nil {
+		c.t.Fatalf("Failed to send %c: %v", msgType, err)
+	}
+}
+
+func (c *pgTestClient) receive() (byte, []byte) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		c.t.Fatalf("Failed to read message header: %v", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		c.t.Fatalf("Failed to read message body: %v", err)
+	}
+	return header[0], body
+}
+
+// expect reads the next message and fails unless it has the given type
+func (c *pgTestClient) expect(msgType byte) []byte {
+	c.t.Helper()
+	got, body := c.receive()
+	if got != msgType {
+		if got == 'E' {
+			c.t.Fatalf("Expected %c, got ErrorResponse: %s", msgType, errorMessage(body))
+		}
+		c.t.Fatalf("Expected %c, got %c", msgType, got)
+	}
+	return body
+}
+
+// simpleQuery runs a simple Query and returns the DataRows as text values
+func (c *pgTestClient) simpleQuery(sql string) [][]string {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	var rows [][]string
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'D':
+			rows = append(rows, dataRowValues(body))
+		case 'E':
+			c.t.Fatalf("Query %q failed: %s", sql, errorMessage(body))
+		case 'Z':
+			return rows
+		}
+	}
+}
+
+func cstring(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+func parseMessage(name, query string, oids ...uint32) []byte {
+	body := cstring(name)
+	body = append(body, cstring(query)...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(oids)))
+	for _, oid := range oids {
+		body = binary.BigEndian.AppendUint32(body, oid)
+	}
+	return body
+}
+
+// bindMessage binds text parameters; a nil entry is sent as NULL
+func bindMessage(portal, stmt string, params []*string, resultFormats ...int16) []byte {
+	body := cstring(portal)
+	body = append(body, cstring(stmt)...)
+	body = binary.BigEndian.AppendUint16(body, 0) // All parameters in text format
+	body = binary.BigEndian.AppendUint16(body, uint16(len(params)))
+	for _, p := range params {
+		if p == nil {
+			body = binary.BigEndian.AppendUint32(body, 0xFFFFFFFF)
+			continue
+		}
+		body = binary.BigEndian.AppendUint32(body, uint32(len(*p)))
+		body = append(body, *p...)
+	}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(resultFormats)))
+	for _, f := range resultFormats {
+		body = binary.BigEndian.AppendUint16(body, uint16(f))
+	}
+	return body
+}
+
+func executeMessage(portal string, maxRows uint32) []byte {
+	return binary.BigEndian.AppendUint32(cstring(portal), maxRows)
+}
+
+func textParams(values ...string) []*string {
+	params := make([]*string, len(values))
+	for i := range values {
+		params[i] = &values[i]
+	}
+	return params
+}
+
+func dataRowValues(body []byte) []string {
+	n := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	values := make([]string, n)
+	for i := 0; i < n; i++ {
+		length := int32(binary.BigEndian.Uint32(body))
+		body = body[4:]
+		if length < 0 {
+			values[i] = "NULL"
+			continue
+		}
+		values[i] = string(body[:length])
+		body = body[length:]
+	}
+	return values
+}
+
+// errorFields parses the fields of an ErrorResponse or NoticeResponse
+func errorFields(body []byte) map[byte]string {
+	fields := make(map[byte]string)
+	for len(body) > 1 {
+		code := body[0]
+		end := 1
+		for end < len(body) && body[end] != 0 {
+			end++
+		}
+		fields[code] = string(body[1:end])
+		body = body[end+1:]
+	}
+	return fields
+}
+
+func errorMessage(body []byte) string {
+	return errorFields(body)['M']
+}
+
+func TestExtendedQueryProtocol(t *testing.T) {
+	tmpDir := "./test_extended_protocol_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	c.simpleQuery("CREATE TABLE items (id INT PRIMARY KEY, name TEXT, price FLOAT)")
+
+	t.Run("Named Statement With Inferred Parameter Types", func(t *testing.T) {
+		c.send('P', parseMessage("ins", "INSERT INTO items (id, name, price) VALUES ($1, $2, $3)"))
+		c.send('D', append([]byte{'S'}, cstring("ins")...))
+		c.send('S', nil)
+
+		c.expect('1')
+		desc := c.expect('t')
+		if n := binary.BigEndian.Uint16(desc); n != 3 {
+			t.Fatalf("Expected 3 parameters, got %d", n)
+		}
+		want := []uint32{pg.OIDInt4, pg.OIDText, pg.OIDFloat8}
+		for i, oid := range want {
+			if got := binary.BigEndian.Uint32(desc[2+4*i:]); got != oid {
+				t.Errorf("Parameter $%d: expected OID %d, got %d", i+1, oid, got)
+			}
+		}
+		c.expect('n')
+		c.expect('Z')
+
+		for _, p := range [][]string{{"1", "apple", "2.5"}, {"2", "banana", "0.5"}, {"3", "cherry", "4.75"}} {
+			c.send('B', bindMessage("", "ins", textParams(p...)))
+			c.send('E', executeMessage("", 0))
+		}
+		c.send('S', nil)
+		for i := 0; i < 3; i++ {
+			c.expect('2')
+			if tag := string(c.expect('C')); !strings.HasPrefix(tag, "INSERT 0 1") {
+				t.Errorf("Expected INSERT 0 1, got %q", tag)
+			}
+		}
+		c.expect('Z')
+
+		rows := c.simpleQuery("SELECT name FROM items WHERE id = 2")
+		if len(rows) != 1 || rows[0][0] != "banana" {
+			t.Errorf("Expected banana, got %v", rows)
+		}
+	})
+
+	t.Run("Portal Row Limit And Suspension", func(t *testing.T) {
+		c.send('P', parseMessage("", "SELECT id, name FROM items WHERE price > $1 ORDER BY id"))
+		c.send('B', bindMessage("", "", textParams("1")))
+		c.send('D', append([]byte{'P'}, cstring("")...))
+		c.send('E', executeMessage("", 1))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+
+		c.expect('1')
+		c.expect('2')
+		c.expect('T')
+		first := dataRowValues(c.expect('D'))
+		if first[0] != "1" || first[1] != "apple" {
+			t.Errorf("Expected first row (1, apple), got %v", first)
+		}
+		c.expect('s')
+		second := dataRowValues(c.expect('D'))
+		if second[0] != "3" || second[1] != "cherry" {
+			t.Errorf("Expected second row (3, cherry), got %v", second)
+		}
+		// Only the rows of the last Execute are counted, as in PostgreSQL
+		if tag := string(c.expect('C')); tag != "SELECT 1\x00" {
+			t.Errorf("Expected SELECT 1 for the last Execute, got %q", tag)
+		}
+		c.expect('Z')
+	})
+
+	t.Run("Portal Describe Does Not Execute", func(t *testing.T) {
+		c.send('P', parseMessage("", "INSERT INTO items (id, name, price) VALUES ($1, $2, $3) RETURNING id, name"))
+		c.send('B', bindMessage("", "", textParams("9", "fig", "1.5")))
+		c.send('D', append([]byte{'P'}, cstring("")...))
+		c.send('S', nil)
+
+		c.expect('1')
+		c.expect('2')
+		desc := c.expect('T')
+		if n := binary.BigEndian.Uint16(desc); n != 2 {
+			t.Errorf("Expected 2 RETURNING columns, got %d", n)
+		}
+		c.expect('Z')
+
+		if rows := c.simpleQuery("SELECT id FROM items WHERE id = 9"); len(rows) != 0 {
+			t.Errorf("Describe must not run the INSERT, found %v", rows)
+		}
+	})
+
+	t.Run("NULL Parameter And Statement Describe", func(t *testing.T) {
+		c.send('P', parseMessage("sel", "SELECT id, name FROM items WHERE name = $1"))
+		c.send('D', append([]byte{'S'}, cstring("sel")...))
+		c.send('B', bindMessage("", "sel", []*string{nil}))
+		c.send('E', executeMessage("", 0))
+		c.send('C', append([]byte{'S'}, cstring("sel")...))
+		c.send('S', nil)
+
+		c.expect('1')
+		c.expect('t')
+		desc := c.expect('T')
+		if n := binary.BigEndian.Uint16(desc); n != 2 {
+			t.Errorf("Expected 2 result columns, got %d", n)
+		}
+		c.expect('2')
+		if tag := string(c.expect('C')); !strings.HasPrefix(tag, "SELECT 0") {
+			t.Errorf("Expected SELECT 0, got %q", tag)
+		}
+		c.expect('3')
+		c.expect('Z')
+	})
+
+	t.Run("Rows Follow The Statement Description", func(t *testing.T) {
+		// Describe of the statement only, then binary results, as pgx does
+		c.send('P', parseMessage("typed", "SELECT id, price FROM items WHERE id = $1"))
+		c.send('D', append([]byte{'S'}, cstring("typed")...))
+		c.send('S', nil)
+		c.expect('1')
+		c.expect('t')
+		c.expect('T')
+		c.expect('Z')
+
+		c.send('B', bindMessage("", "typed", textParams("1"), 1))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+		c.expect('2')
+		row := dataRowValues(c.expect('D'))
+		if len(row[0]) != 4 || len(row[1]) != 8 {
+			t.Errorf("Expected an int4 and a float8, got %d and %d bytes", len(row[0]), len(row[1]))
+		}
+		c.expect('C')
+		c.expect('Z')
+
+		// A value that does not fit the described type fails the Execute
+		c.send('P', parseMessage("", "SELECT 3000000000::int AS big"))
+		c.send('D', append([]byte{'S'}, cstring("")...))
+		c.send('B', bindMessage("", "", nil, 1))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+		c.expect('1')
+		c.expect('t')
+		if oid := binary.BigEndian.Uint32(c.expect('T')[2+len("big")+1+6:]); oid != 23 {
+			t.Errorf("Expected big to be described as int4, got OID %d", oid)
+		}
+		c.expect('2')
+		if fields := errorFields(c.expect('E')); fields['C'] != "22003" {
+			t.Errorf("Expected SQLSTATE 22003, got %v", fields)
+		}
+		c.expect('Z')
+	})
+
+	t.Run("Negative List Lengths", func(t *testing.T) {
+		parse := append(cstring(""), cstring("SELECT 1")...)
+		c.send('P', append(parse, 0xFF, 0xFF))
+		c.send('S', nil)
+		if fields := errorFields(c.expect('E')); fields['C'] != "08P01" {
+			t.Errorf("Expected SQLSTATE 08P01 for Parse, got %v", fields)
+		}
+		c.expect('Z')
+
+		c.send('P', parseMessage("", "SELECT 1"))
+		bind := append(cstring(""), cstring("")...)
+		c.send('B', append(bind, 0xFF, 0xFF))
+		c.send('S', nil)
+		c.expect('1')
+		if fields := errorFields(c.expect('E')); fields['C'] != "08P01" {
+			t.Errorf("Expected SQLSTATE 08P01 for Bind, got %v", fields)
+		}
+		c.expect('Z')
+
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); len(rows) != 1 {
+			t.Errorf("Expected the connection to keep working, got %v", rows)
+		}
+	})
+
+	t.Run("Errors Skip Messages Until Sync", func(t *testing.T) {
+		c.send('B', bindMessage("", "missing", nil))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+
+		body := c.expect('E')
+		if !strings.Contains(errorMessage(body), "does not exist") {
+			t.Errorf("Unexpected error: %s", errorMessage(body))
+		}
+		c.expect('Z')
+
+		c.send('P', parseMessage("", "SELECT id FROM items WHERE id = $1"))
+		c.send('B', bindMessage("", "", textParams("1", "2")))
+		c.send('S', nil)
+		c.expect('1')
+		body = c.expect('E')
+		if !strings.Contains(errorMessage(body), "supplies 2 parameters") {
+			t.Errorf("Unexpected error: %s", errorMessage(body))
+		}
+		c.expect('Z')
+	})
+}
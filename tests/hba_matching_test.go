@@ -0,0 +1,273 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// writeClientCA writes a CA certificate to dir/ca.crt and returns a function
+// issuing client certificates signed by it
+func writeClientCA(t *testing.T, dir string) func(commonName string) tls.Certificate {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "GhostSQL Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644)
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	serial := int64(1)
+	return func(commonName string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		serial++
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to create client certificate: %v", err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+}
+
+func TestHBAMatching(t *testing.T) {
+	tmpDir := "./test_hba_matching_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	os.MkdirAll(tmpDir, 0755)
+
+	os.WriteFile(filepath.Join(tmpDir, "users.txt"), []byte("carol # comment\ndave, erin\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, storage.HBAFileName), []byte(strings.Join([]string{
+		"# TYPE    DATABASE        USER           ADDRESS                      METHOD",
+		"local     all             all                                         trust",
+		"hostssl   all             sslonly        127.0.0.1/32                 trust",
+		"hostssl   all             certuser       all                          trust  clientcert=verify-full",
+		"hostnossl all             plainonly      127.0.0.1  255.255.255.255   trust",
+		"host      ghostsql,other  +staff,listed  all                          trust",
+		"host      sameuser        all            all                          trust",
+		"host      all             @users.txt     127.0.0.0/8                  trust",
+		`host      all             "all"          all                          trust`,
+		"host      all             ghost          all                          scram-sha-256",
+		"host      all             all            all                          reject",
+	}, "\n")), 0644)
+
+	cert := writeSelfSignedCert(t, tmpDir)
+	issue := writeClientCA(t, tmpDir)
+	os.WriteFile(filepath.Join(tmpDir, storage.ConfigFileName), []byte("ssl = on\nssl_ca_file = 'ca.crt'\n"), 0644)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	session := db.SessionMgr.CreateSession("hba_admin")
+	session.SetUser("ghost")
+	session.SetDatabase("ghostsql")
+	exec := executor.NewExecutor(db, session)
+	runQuery(t, exec, "CREATE ROLE staff")
+	runQuery(t, exec, "CREATE ROLE team")
+	runQuery(t, exec, "CREATE ROLE alice WITH LOGIN")
+	runQuery(t, exec, "CREATE ROLE bob WITH LOGIN")
+	runQuery(t, exec, "GRANT team TO alice")
+	runQuery(t, exec, "GRANT staff TO team")
+
+	t.Run("Rules", func(t *testing.T) {
+		localhost := net.ParseIP("127.0.0.1")
+		tests := []struct {
+			name string
+			conn storage.HBAConnection
+			line int
+		}{
+			{"Local Socket", storage.HBAConnection{Local: true, Database: "ghostsql", User: "bob"}, 2},
+			{"hostssl With SSL", storage.HBAConnection{SSL: true, RemoteIP: localhost, Database: "ghostsql", User: "sslonly"}, 3},
+			{"hostssl Without SSL", storage.HBAConnection{RemoteIP: localhost, Database: "ghostsql", User: "sslonly"}, 11},
+			{"hostnossl Without SSL", storage.HBAConnection{RemoteIP: localhost, Database: "ghostsql", User: "plainonly"}, 5},
+			{"hostnossl With SSL", storage.HBAConnection{SSL: true, RemoteIP: localhost, Database: "ghostsql", User: "plainonly"}, 11},
+			{"Netmask Column", storage.HBAConnection{RemoteIP: net.ParseIP("127.0.0.2"), Database: "ghostsql", User: "plainonly"}, 11},
+			{"Indirect Group Member", storage.HBAConnection{RemoteIP: localhost, Database: "ghostsql", User: "alice"}, 6},
+			{"Group Member Other Database", storage.HBAConnection{RemoteIP: localhost, Database: "other", User: "alice"}, 6},
+			{"Group Member Unlisted Database", storage.HBAConnection{RemoteIP: localhost, Database: "sales", User: "alice"}, 11},
+			{"Listed User", storage.HBAConnection{RemoteIP: localhost, Database: "ghostsql", User: "listed"}, 6},
+			{"Non Member", storage.HBAConnection{RemoteIP: localhost, Database: "ghostsql", User: "bob"}, 11},
+			{"sameuser", storage.HBAConnection{RemoteIP: localhost, Database: "bob", User: "bob"}, 7},
+			{"Included User", storage.HBAConnection{RemoteIP: localhost, Database: "sales", User: "erin"}, 8},
+			{"Included User Other Network", storage.HBAConnection{RemoteIP: net.ParseIP("10.0.0.1"), Database: "sales", User: "erin"}, 11},
+			{"Quoted Keyword", storage.HBAConnection{RemoteIP: localhost, Database: "sales", User: "all"}, 9},
+			{"IPv6 Client", storage.HBAConnection{SSL: true, RemoteIP: net.ParseIP("::1"), Database: "sales", User: "all"}, 9},
+		}
+		for _, tt := range tests {
+			rule, err := db.HBA().Check(tt.conn, db.RoleStore)
+			line := 0
+			if err == nil {
+				line = rule.LineNumber
+			}
+			if line != tt.line {
+				t.Errorf("%s: expected line %d to match, got %d (%v)", tt.name, tt.line, line, err)
+			}
+		}
+	})
+
+	t.Run("Parse Errors", func(t *testing.T) {
+		config, err := storage.ParseHBAConfig(strings.NewReader(strings.Join([]string{
+			"host all all 127.0.0.1 trust",
+			"host all all 10.0.0.0 255.0.255.0 trust",
+			"host all all ::1 255.255.255.255 trust",
+			"host all all all trust clientcert=verify-full",
+			"hostssl all all all trust clientcert=maybe",
+			"hostssl all all all trust krb_realm=EXAMPLE",
+			`host "all all all trust`,
+			"host all @missing.txt all trust",
+		}, "\n")), tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		var got []string
+		for _, e := range config.Errors {
+			got = append(got, e.Message)
+		}
+		want := []string{
+			`invalid IP mask "trust"`,
+			`invalid IP mask "255.0.255.0"`,
+			"IP address and mask do not match",
+			`clientcert can only be configured for "hostssl" rows`,
+			`invalid value for clientcert: "maybe"`,
+			`unrecognized authentication option name: "krb_realm"`,
+			"unterminated quoted string",
+		}
+		if len(got) != 8 || !reflect.DeepEqual(got[:7], want) || !strings.HasPrefix(got[7], "could not open file") {
+			t.Errorf("Expected errors %q, got %q", want, got)
+		}
+	})
+
+	t.Run("pg_hba_file_rules", func(t *testing.T) {
+		res, err := exec.Execute(parseQuery("SELECT line_number, database, user_name, address, netmask, options FROM pg_hba_file_rules"))
+		if err != nil {
+			t.Fatalf("Failed to query pg_hba_file_rules: %v", err)
+		}
+		if len(res.Rows) != 10 {
+			t.Fatalf("Expected 10 rules, got %d", len(res.Rows))
+		}
+		columns := []string{"database", "user_name", "address", "netmask", "options"}
+		want := map[int32][]interface{}{
+			2: {"all", "all", nil, nil, nil},
+			4: {"all", "certuser", "all", nil, "clientcert=verify-full"},
+			5: {"all", "plainonly", "127.0.0.1", "255.255.255.255", nil},
+			6: {"ghostsql,other", "+staff,listed", "all", nil, nil},
+			8: {"all", "carol,dave,erin", "127.0.0.0", "255.0.0.0", nil},
+			9: {"all", `"all"`, "all", nil, nil},
+		}
+		for _, row := range res.Rows {
+			expected, ok := want[row["line_number"].(int32)]
+			if !ok {
+				continue
+			}
+			got := make([]interface{}, len(columns))
+			for i, col := range columns {
+				got[i] = row[col]
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Line %d: expected %v, got %v", row["line_number"], expected, got)
+			}
+		}
+	})
+
+	addr := startPGTestServer(t, db)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	// connectTLS negotiates SSL, presenting clientCert if it is set, and
+	// sends a startup message for user
+	connectTLS := func(t *testing.T, user string, clientCert *tls.Certificate) *pgTestClient {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if resp := sendSSLRequest(t, conn); resp != 'S' {
+			t.Fatalf("Expected SSLRequest to be accepted with 'S', got %q", resp)
+		}
+		config := &tls.Config{ServerName: "localhost", RootCAs: roots}
+		if clientCert != nil {
+			config.Certificates = []tls.Certificate{*clientCert}
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			t.Fatalf("TLS handshake failed: %v", err)
+		}
+		sendStartupMessage(tlsConn, map[string]string{"user": user, "database": "ghostsql"})
+		return &pgTestClient{t: t, conn: tlsConn}
+	}
+
+	t.Run("hostssl", func(t *testing.T) {
+		connectTLS(t, "sslonly", nil).login("sslonly", "")
+
+		fields := errorFields(newPGTestClient(t, addr, "sslonly").expect('E'))
+		if fields['C'] != "28000" || !strings.Contains(fields['M'], "no encryption") {
+			t.Errorf("Expected unencrypted connection to be rejected, got %v", fields)
+		}
+	})
+
+	t.Run("hostnossl", func(t *testing.T) {
+		connectPG(t, addr, "plainonly", "")
+
+		fields := errorFields(connectTLS(t, "plainonly", nil).expect('E'))
+		if fields['C'] != "28000" || !strings.Contains(fields['M'], "SSL encryption") {
+			t.Errorf("Expected SSL connection to be rejected, got %v", fields)
+		}
+	})
+
+	t.Run("Client Certificate", func(t *testing.T) {
+		valid := issue("certuser")
+		connectTLS(t, "certuser", &valid).login("certuser", "")
+
+		fields := errorFields(connectTLS(t, "certuser", nil).expect('E'))
+		if fields['M'] != "connection requires a valid client certificate" {
+			t.Errorf("Expected missing certificate to be rejected, got %v", fields)
+		}
+
+		other := issue("someone")
+		fields = errorFields(connectTLS(t, "certuser", &other).expect('E'))
+		if fields['M'] != `certificate authentication failed for user "certuser"` {
+			t.Errorf("Expected certificate for another user to be rejected, got %v", fields)
+		}
+	})
+}
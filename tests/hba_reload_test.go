@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+func TestHBAReload(t *testing.T) {
+	tmpDir := "./test_hba_reload_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	hbaPath := filepath.Join(tmpDir, storage.HBAFileName)
+	writeHBA := func(content string) {
+		if err := os.WriteFile(hbaPath, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", hbaPath, err)
+		}
+	}
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		t.Fatalf("Failed to create data directory: %v", err)
+	}
+	writeHBA("# TYPE DATABASE USER ADDRESS METHOD\n" +
+		"host all blocked 127.0.0.1/32 reject\n" +
+		"host all all all scram-sha-256\n")
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	admin := connectPG(t, addr, "ghost", "ghost")
+
+	t.Run("Loaded From Data Directory", func(t *testing.T) {
+		fields := errorFields(newPGTestClient(t, addr, "blocked").expect('E'))
+		if fields['C'] != "28000" {
+			t.Errorf("Expected connection to be rejected with 28000, got %v", fields)
+		}
+
+		rows := admin.simpleQuery("SELECT line_number, type, user_name, address, netmask, auth_method FROM pg_hba_file_rules")
+		want := [][]string{
+			{"2", "host", "blocked", "127.0.0.1", "255.255.255.255", "reject"},
+			{"3", "host", "all", "all", "NULL", "scram-sha-256"},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("Expected rules %v, got %v", want, rows)
+		}
+	})
+
+	t.Run("pg_reload_conf", func(t *testing.T) {
+		writeHBA("host all blocked 127.0.0.1/32 trust\n" +
+			"host all all all scram-sha-256\n")
+		if rows := admin.simpleQuery("SELECT pg_reload_conf()"); len(rows) != 1 || rows[0][0] != "t" {
+			t.Fatalf("Expected pg_reload_conf to return true, got %v", rows)
+		}
+		connectPG(t, addr, "blocked", "")
+	})
+
+	t.Run("Invalid Line Keeps Rules", func(t *testing.T) {
+		writeHBA("host all blocked 127.0.0.1/32 reject\n" +
+			"host all all 127.0.0.1/33 trust\n")
+		admin.simpleQuery("SELECT pg_reload_conf()")
+		connectPG(t, addr, "blocked", "")
+
+		rows := admin.simpleQuery("SELECT line_number, auth_method, error FROM pg_hba_file_rules")
+		want := [][]string{
+			{"1", "reject", "NULL"},
+			{"2", "NULL", `invalid IP address "127.0.0.1/33"`},
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("Expected rules %v, got %v", want, rows)
+		}
+	})
+
+	t.Run("Requires Superuser", func(t *testing.T) {
+		user := connectPG(t, addr, "blocked", "")
+		res := user.queryBatch("SELECT pg_reload_conf()")
+		if len(res.errors) != 1 || res.errors[0]['C'] != "42501" {
+			t.Errorf("Expected insufficient privilege error, got %v", res.errors)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		writeHBA("host all blocked all reject\n")
+		if err := db.Reload(); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		if rules := db.HBA().Rules; len(rules) != 1 || rules[0].Method != storage.MethodReject {
+			t.Errorf("Expected reloaded rules, got %+v", rules)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// batchResult collects the responses to a simple Query
+type batchResult struct {
+	types  []byte
+	tags   []string
+	rows   [][]string
+	errors []map[byte]string
+	status byte
+}
+
+func (c *pgTestClient) queryBatch(sql string) batchResult {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	var res batchResult
+	for {
+		msgType, body := c.receive()
+		res.types = append(res.types, msgType)
+		switch msgType {
+		case 'C':
+			res.tags = append(res.tags, string(body[:len(body)-1]))
+		case 'D':
+			res.rows = append(res.rows, dataRowValues(body))
+		case 'E':
+			res.errors = append(res.errors, errorFields(body))
+		case 'Z':
+			res.status = body[0]
+			return res
+		}
+	}
+}
+
+func TestMultiStatementQuery(t *testing.T) {
+	tmpDir := "./test_multistmt_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+
+	t.Run("Batch Runs In Order", func(t *testing.T) {
+		res := c.queryBatch("CREATE TABLE items (id INT, name TEXT); INSERT INTO items (id, name) VALUES (1, 'a'); INSERT INTO items (id, name) VALUES (2, 'b'); SELECT id FROM items ORDER BY id;")
+		if len(res.errors) != 0 {
+			t.Fatalf("Unexpected errors: %v", res.errors)
+		}
+		wantTags := []string{"CREATE TABLE items", "INSERT 0 1", "INSERT 0 1", "SELECT 2"}
+		if !reflect.DeepEqual(res.tags, wantTags) {
+			t.Errorf("Expected tags %v, got %v", wantTags, res.tags)
+		}
+		wantTypes := []byte{'C', 'C', 'C', 'T', 'D', 'D', 'C', 'Z'}
+		if !reflect.DeepEqual(res.types, wantTypes) {
+			t.Errorf("Expected messages %q, got %q", wantTypes, res.types)
+		}
+		if res.status != 'I' {
+			t.Errorf("Expected idle status after batch, got %c", res.status)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); len(rows) != 1 || rows[0][0] != "2" {
+			t.Errorf("Expected committed rows, got %v", rows)
+		}
+	})
+
+	t.Run("Error Stops And Rolls Back Batch", func(t *testing.T) {
+		res := c.queryBatch("INSERT INTO items (id, name) VALUES (3, 'c'); INSERT INTO missing (id) VALUES (1); INSERT INTO items (id, name) VALUES (4, 'd')")
+		if len(res.tags) != 1 || len(res.errors) != 1 {
+			t.Fatalf("Expected one completed statement and one error, got %v / %v", res.tags, res.errors)
+		}
+		if res.status != 'I' {
+			t.Errorf("Expected idle status, got %c", res.status)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); len(rows) != 1 || rows[0][0] != "2" {
+			t.Errorf("Expected the batch to be rolled back, got %v", rows)
+		}
+	})
+
+	t.Run("Parse Error Runs Nothing", func(t *testing.T) {
+		res := c.queryBatch("INSERT INTO items (id, name) VALUES (5, 'e'); SELEC oops")
+		if len(res.tags) != 0 || len(res.errors) != 1 {
+			t.Fatalf("Expected only a parse error, got %v / %v", res.tags, res.errors)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); rows[0][0] != "2" {
+			t.Errorf("Expected no insert, got %v", rows)
+		}
+	})
+
+	t.Run("Explicit Block Survives Batch", func(t *testing.T) {
+		res := c.queryBatch("BEGIN; INSERT INTO items (id, name) VALUES (6, 'f')")
+		if res.status != 'T' {
+			t.Fatalf("Expected open transaction block, got %c", res.status)
+		}
+		res = c.queryBatch("INSERT INTO items (id, name) VALUES (7, 'g'); SELECT * FROM missing")
+		if res.status != 'E' {
+			t.Fatalf("Expected failed transaction block, got %c", res.status)
+		}
+		c.queryBatch("ROLLBACK")
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); rows[0][0] != "2" {
+			t.Errorf("Expected rolled back block, got %v", rows)
+		}
+	})
+
+	t.Run("Commit Inside Batch", func(t *testing.T) {
+		res := c.queryBatch("INSERT INTO items (id, name) VALUES (8, 'h'); COMMIT; INSERT INTO missing (id) VALUES (1)")
+		if len(res.errors) != 1 || res.status != 'I' {
+			t.Fatalf("Expected an error after COMMIT, got %v (status %c)", res.errors, res.status)
+		}
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM items"); rows[0][0] != "3" {
+			t.Errorf("Expected the statement before COMMIT to persist, got %v", rows)
+		}
+	})
+
+	t.Run("Empty Query", func(t *testing.T) {
+		for _, sql := range []string{"", " ;; "} {
+			res := c.queryBatch(sql)
+			if !reflect.DeepEqual(res.types, []byte{'I', 'Z'}) {
+				t.Errorf("%q: expected EmptyQueryResponse, got %q", sql, res.types)
+			}
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// queryNotices runs a simple query and returns its CommandComplete tag and
+// the fields of the NoticeResponses sent for it
+func (c *pgTestClient) queryNotices(sql string) (string, []map[byte]string) {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	var tag string
+	var notices []map[byte]string
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'N':
+			if tag != "" {
+				c.t.Errorf("%s: NoticeResponse sent after CommandComplete", sql)
+			}
+			notices = append(notices, errorFields(body))
+		case 'C':
+			tag = string(body[:len(body)-1])
+		case 'E':
+			c.t.Fatalf("%s: %s", sql, errorMessage(body))
+		case 'Z':
+			return tag, notices
+		}
+	}
+}
+
+func TestNoticeResponse(t *testing.T) {
+	tmpDir := "./test_notice_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+
+	t.Run("Drop If Exists", func(t *testing.T) {
+		tag, notices := c.queryNotices("DROP TABLE IF EXISTS missing")
+		if tag != "DROP TABLE" {
+			t.Errorf("Expected DROP TABLE tag, got %q", tag)
+		}
+		if len(notices) != 1 {
+			t.Fatalf("Expected one notice, got %v", notices)
+		}
+		n := notices[0]
+		if n['S'] != "NOTICE" || n['V'] != "NOTICE" || n['C'] != "00000" || n['M'] != "table missing does not exist, skipping" {
+			t.Errorf("Unexpected notice %v", n)
+		}
+	})
+
+	t.Run("Unknown Variable", func(t *testing.T) {
+		tag, notices := c.queryNotices("SET no_such_setting = 'x'")
+		if tag != "SET" || len(notices) != 1 || notices[0]['S'] != "WARNING" || notices[0]['C'] != "42704" {
+			t.Fatalf("Expected an unrecognized parameter warning, got %q %v", tag, notices)
+		}
+
+		// Known and custom options are set silently
+		for _, sql := range []string{"SET work_mem = '8MB'", "SET application_name = 'test'", "SET myapp.flag = 'on'"} {
+			if _, notices := c.queryNotices(sql); len(notices) != 0 {
+				t.Errorf("%s: unexpected notices %v", sql, notices)
+			}
+		}
+	})
+
+	t.Run("Transaction Warnings", func(t *testing.T) {
+		_, notices := c.queryNotices("COMMIT")
+		if len(notices) != 1 || notices[0]['C'] != "25P01" {
+			t.Errorf("Expected no transaction in progress warning, got %v", notices)
+		}
+		c.queryNotices("BEGIN")
+		_, notices = c.queryNotices("BEGIN")
+		if len(notices) != 1 || notices[0]['C'] != "25001" {
+			t.Errorf("Expected transaction in progress warning, got %v", notices)
+		}
+		c.queryNotices("ROLLBACK")
+	})
+
+	t.Run("Client Min Messages", func(t *testing.T) {
+		c.queryNotices("SET client_min_messages = warning")
+		if _, notices := c.queryNotices("DROP TABLE IF EXISTS missing"); len(notices) != 0 {
+			t.Errorf("Expected NOTICE to be filtered, got %v", notices)
+		}
+		if _, notices := c.queryNotices("COMMIT"); len(notices) != 1 {
+			t.Errorf("Expected WARNING to pass the filter, got %v", notices)
+		}
+
+		c.queryNotices("SET client_min_messages = error")
+		if _, notices := c.queryNotices("COMMIT"); len(notices) != 0 {
+			t.Errorf("Expected WARNING to be filtered, got %v", notices)
+		}
+
+		c.queryNotices("RESET client_min_messages")
+		if _, notices := c.queryNotices("DROP TABLE IF EXISTS missing"); len(notices) != 1 {
+			t.Errorf("Expected NOTICE after RESET, got %v", notices)
+		}
+
+		res := c.queryBatch("SET client_min_messages = loud")
+		if len(res.errors) != 1 || res.errors[0]['C'] != "22023" {
+			t.Errorf("Expected invalid value error, got %v", res.errors)
+		}
+	})
+
+	t.Run("Extended Protocol", func(t *testing.T) {
+		c.send('P', parseMessage("", "DROP TABLE IF EXISTS missing"))
+		c.send('B', bindMessage("", "", nil))
+		c.send('E', executeMessage("", 0))
+		c.send('S', nil)
+		c.expect('1')
+		c.expect('2')
+		n := errorFields(c.expect('N'))
+		if n['S'] != "NOTICE" {
+			t.Errorf("Unexpected notice %v", n)
+		}
+		c.expect('C')
+		c.expect('Z')
+	})
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+type notification struct {
+	pid     uint32
+	channel string
+	payload string
+}
+
+func parseNotification(body []byte) notification {
+	fields := bytes.Split(body[4:], []byte{0})
+	return notification{
+		pid:     binary.BigEndian.Uint32(body),
+		channel: string(fields[0]),
+		payload: string(fields[1]),
+	}
+}
+
+// queryNotifications runs a simple query and returns the notifications
+// received before its ReadyForQuery
+func (c *pgTestClient) queryNotifications(sql string) []notification {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	var notes []notification
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'A':
+			notes = append(notes, parseNotification(body))
+		case 'E':
+			c.t.Fatalf("%s: %s", sql, errorMessage(body))
+		case 'Z':
+			return notes
+		}
+	}
+}
+
+// expectNotification waits for a notification sent while the client is idle
+func (c *pgTestClient) expectNotification() notification {
+	c.t.Helper()
+	return parseNotification(c.expect('A'))
+}
+
+func TestListenNotify(t *testing.T) {
+	tmpDir := "./test_notify_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	listener := connectPG(t, addr, "ghost", "ghost")
+	sender := connectPG(t, addr, "ghost", "ghost")
+	listener.simpleQuery("LISTEN Events")
+
+	t.Run("Delivered While Idle", func(t *testing.T) {
+		sender.simpleQuery("NOTIFY events, 'hello'")
+		n := listener.expectNotification()
+		want := notification{pid: sender.processID, channel: "events", payload: "hello"}
+		if n != want {
+			t.Errorf("Expected %+v, got %+v", want, n)
+		}
+	})
+
+	t.Run("pg_notify", func(t *testing.T) {
+		sender.simpleQuery("SELECT pg_notify('events', '{\"id\": 1, \"op\": \"insert\"}')")
+		if n := listener.expectNotification(); n.payload != `{"id": 1, "op": "insert"}` {
+			t.Errorf("Unexpected payload %q", n.payload)
+		}
+	})
+
+	t.Run("Held Until Commit", func(t *testing.T) {
+		sender.simpleQuery("BEGIN")
+		sender.simpleQuery("NOTIFY events, 'in tx'")
+		sender.simpleQuery("NOTIFY events, 'in tx'")
+		sender.simpleQuery("NOTIFY events, 'second'")
+		if notes := listener.queryNotifications("SELECT 1"); len(notes) != 0 {
+			t.Fatalf("Notification delivered before COMMIT: %v", notes)
+		}
+		sender.simpleQuery("COMMIT")
+
+		// Duplicates within a transaction are folded into one
+		if n := listener.expectNotification(); n.payload != "in tx" {
+			t.Errorf("Expected first payload, got %q", n.payload)
+		}
+		if n := listener.expectNotification(); n.payload != "second" {
+			t.Errorf("Expected second payload, got %q", n.payload)
+		}
+	})
+
+	t.Run("Dropped On Rollback", func(t *testing.T) {
+		sender.simpleQuery("BEGIN")
+		sender.simpleQuery("NOTIFY events, 'discarded'")
+		sender.simpleQuery("ROLLBACK")
+		if notes := listener.queryNotifications("SELECT 1"); len(notes) != 0 {
+			t.Errorf("Rolled back notification delivered: %v", notes)
+		}
+	})
+
+	t.Run("Own Notifications", func(t *testing.T) {
+		notes := listener.queryNotifications("NOTIFY events, 'self'")
+		if len(notes) != 1 || notes[0].payload != "self" {
+			t.Errorf("Expected own notification before ReadyForQuery, got %v", notes)
+		}
+	})
+
+	t.Run("Listener In Transaction", func(t *testing.T) {
+		listener.simpleQuery("BEGIN")
+		sender.simpleQuery("NOTIFY events, 'later'")
+		if notes := listener.queryNotifications("SELECT 1"); len(notes) != 0 {
+			t.Fatalf("Notification delivered inside a transaction block: %v", notes)
+		}
+		notes := listener.queryNotifications("COMMIT")
+		if len(notes) != 1 || notes[0].payload != "later" {
+			t.Errorf("Expected notification after COMMIT, got %v", notes)
+		}
+	})
+
+	t.Run("Unlisten", func(t *testing.T) {
+		listener.simpleQuery("UNLISTEN *")
+		sender.simpleQuery("NOTIFY events, 'ignored'")
+		if notes := listener.queryNotifications("SELECT 1"); len(notes) != 0 {
+			t.Errorf("Notification delivered after UNLISTEN: %v", notes)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		res := sender.queryBatch("SELECT pg_notify('', 'x')")
+		if len(res.errors) != 1 || res.errors[0]['C'] != "22023" {
+			t.Errorf("Expected empty channel error, got %v", res.errors)
+		}
+	})
+}
@@ -63,26 +63,18 @@ func TestPostgreSQLAuthentication(t *testing.T) {
 		// Simulate StartupMessage with user='ghost'
 		sendStartupMessage(client, map[string]string{"user": "ghost", "database": "ghostsql"})
 
-		// Expect AuthenticationCleartextPassword (R, 3)
-		resp := make([]byte, 9)
-		io.ReadFull(client, resp)
-		if resp[0] != 'R' || binary.BigEndian.Uint32(resp[5:9]) != 3 {
-			t.Fatalf("Expected AuthenticationCleartextPassword (R, 3), got %c, %d", resp[0], binary.BigEndian.Uint32(resp[5:9]))
+		// Expect AuthenticationSASL (R, 10) offering SCRAM-SHA-256
+		c := &pgTestClient{t: t, conn: client}
+		if code := c.authRequest(); code != 10 {
+			t.Fatalf("Expected AuthenticationSASL (R, 10), got %d", code)
+		}
+		if err := c.scramAuth("ghost", "ghost"); err != nil {
+			t.Fatalf("SCRAM authentication failed: %v", err)
 		}
-
-		// Send PasswordMessage ('p')
-		password := "ghost"
-		payload := append([]byte(password), 0)
-		header := make([]byte, 5)
-		header[0] = 'p'
-		binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
-		client.Write(header)
-		client.Write(payload)
 
 		// Expect AuthenticationOK ('R', 0)
-		io.ReadFull(client, resp)
-		if resp[0] != 'R' || binary.BigEndian.Uint32(resp[5:9]) != 0 {
-			t.Errorf("Expected AuthenticationOK after correct password, got %c, %d", resp[0], binary.BigEndian.Uint32(resp[5:9]))
+		if code := c.authRequest(); code != 0 {
+			t.Errorf("Expected AuthenticationOK after correct password, got %d", code)
 		}
 	})
 
@@ -101,24 +93,13 @@ func TestPostgreSQLAuthentication(t *testing.T) {
 
 		sendStartupMessage(client, map[string]string{"user": "ghost"})
 
-		// Expect AuthenticationCleartextPassword
-		resp := make([]byte, 9)
-		io.ReadFull(client, resp)
+		// Expect AuthenticationSASL
+		c := &pgTestClient{t: t, conn: client}
+		c.authRequest()
 
-		// Send Wrong Password
-		password := "wrong_pass"
-		payload := append([]byte(password), 0)
-		header := make([]byte, 5)
-		header[0] = 'p'
-		binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
-		client.Write(header)
-		client.Write(payload)
-
-		// Expect ErrorResponse ('E')
-		errResp := make([]byte, 1)
-		io.ReadFull(client, errResp)
-		if errResp[0] != 'E' {
-			t.Errorf("Expected ErrorResponse (E), got %c", errResp[0])
+		// Complete the exchange with a wrong password, expect ErrorResponse ('E')
+		if err := c.scramAuth("ghost", "wrong_pass"); err == nil {
+			t.Errorf("Expected ErrorResponse for wrong password")
 		}
 	})
 }
@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// scramAuth answers an AuthenticationSASL request with a SCRAM-SHA-256
+// exchange and checks the server signature. It returns the server's error
+// message if authentication is rejected.
+func (c *pgTestClient) scramAuth(user, password string) error {
+	c.t.Helper()
+	nonceBytes := make([]byte, 18)
+	rand.Read(nonceBytes)
+	clientNonce := base64.StdEncoding.EncodeToString(nonceBytes)
+	clientFirstBare := "n=" + user + ",r=" + clientNonce
+
+	initial := cstring("SCRAM-SHA-256")
+	initial = binary.BigEndian.AppendUint32(initial, uint32(len(clientFirstBare)+3))
+	initial = append(initial, "n,,"+clientFirstBare...)
+	c.send('p', initial)
+
+	serverFirst, err := c.saslResponse(11)
+	if err != nil {
+		return err
+	}
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(serverFirst, ",") {
+		attrs[part[:1]] = part[2:]
+	}
+	if !strings.HasPrefix(attrs["r"], clientNonce) {
+		c.t.Fatalf("Server nonce %q does not extend client nonce %q", attrs["r"], clientNonce)
+	}
+	salt, _ := base64.StdEncoding.DecodeString(attrs["s"])
+	iterations, _ := strconv.Atoi(attrs["i"])
+
+	salted := storage.SCRAMSaltedPassword(password, salt, iterations)
+	clientKey := storage.SCRAMHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + attrs["r"]
+	authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+	clientSignature := storage.SCRAMHMAC(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	c.send('p', []byte(withoutProof+",p="+base64.StdEncoding.EncodeToString(proof)))
+
+	serverFinal, err := c.saslResponse(12)
+	if err != nil {
+		return err
+	}
+	serverKey := storage.SCRAMHMAC(salted, "Server Key")
+	want := "v=" + base64.StdEncoding.EncodeToString(storage.SCRAMHMAC(serverKey, authMessage))
+	if !hmac.Equal([]byte(serverFinal), []byte(want)) {
+		c.t.Fatalf("Invalid server signature %q", serverFinal)
+	}
+	return nil
+}
+
+// saslResponse reads an Authentication message with the given code and
+// returns its data, or the error sent by the server instead
+func (c *pgTestClient) saslResponse(code uint32) (string, error) {
+	c.t.Helper()
+	msgType, body := c.receive()
+	if msgType == 'E' {
+		return "", fmt.Errorf("%s", errorMessage(body))
+	}
+	if msgType != 'R' || binary.BigEndian.Uint32(body) != code {
+		c.t.Fatalf("Expected authentication message %d, got %c %v", code, msgType, body)
+	}
+	return string(body[4:]), nil
+}
+
+// authRequest reads the first authentication request of a login
+func (c *pgTestClient) authRequest() uint32 {
+	c.t.Helper()
+	return binary.BigEndian.Uint32(c.expect('R'))
+}
+
+func TestSCRAMAuthentication(t *testing.T) {
+	tmpDir := "./test_scram_auth_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	writeHBA := func(content string) {
+		if err := os.WriteFile(filepath.Join(tmpDir, storage.HBAFileName), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", storage.HBAFileName, err)
+		}
+		if err := db.Reload(); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+	}
+
+	t.Run("Salted Verifiers", func(t *testing.T) {
+		c := connectPG(t, addr, "ghost", "ghost")
+		c.simpleQuery("CREATE ROLE alice WITH LOGIN PASSWORD 'secret'")
+		c.simpleQuery("CREATE ROLE bob WITH LOGIN PASSWORD 'secret'")
+
+		alice, _ := db.RoleStore.GetRole("alice")
+		bob, _ := db.RoleStore.GetRole("bob")
+		if !strings.HasPrefix(alice.PasswordHash, "SCRAM-SHA-256$4096:") {
+			t.Fatalf("Expected a SCRAM-SHA-256 verifier, got %q", alice.PasswordHash)
+		}
+		if alice.PasswordHash == bob.PasswordHash {
+			t.Errorf("Expected different salts for identical passwords")
+		}
+		if !alice.VerifyPassword("secret") || alice.VerifyPassword("wrong") {
+			t.Errorf("Verifier does not check passwords correctly")
+		}
+
+		// Verifiers are what gets persisted in global/pg_authid
+		reloaded := storage.NewRoleStore(tmpDir)
+		if err := reloaded.Load(); err != nil {
+			t.Fatalf("Failed to reload roles: %v", err)
+		}
+		if r, _ := reloaded.GetRole("alice"); r == nil || r.PasswordHash != alice.PasswordHash {
+			t.Errorf("Expected persisted verifier %q, got %+v", alice.PasswordHash, r)
+		}
+	})
+
+	t.Run("SASL Exchange", func(t *testing.T) {
+		c := newPGTestClient(t, addr, "ghost")
+		if code := c.authRequest(); code != 10 {
+			t.Fatalf("Expected AuthenticationSASL (10), got %d", code)
+		}
+		if err := c.scramAuth("ghost", "ghost"); err != nil {
+			t.Fatalf("SCRAM authentication failed: %v", err)
+		}
+		if code := c.authRequest(); code != 0 {
+			t.Errorf("Expected AuthenticationOk, got %d", code)
+		}
+	})
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		c := newPGTestClient(t, addr, "ghost")
+		c.authRequest()
+		err := c.scramAuth("ghost", "not-ghost")
+		if err == nil || !strings.Contains(err.Error(), "invalid password") {
+			t.Errorf("Expected invalid password error, got %v", err)
+		}
+	})
+
+	t.Run("Legacy Hash Migration", func(t *testing.T) {
+		ghost, _ := db.RoleStore.GetRole("ghost")
+		legacy := sha256.Sum256([]byte("ghost"))
+		ghost.PasswordHash = fmt.Sprintf("%x", legacy)
+		if !ghost.NeedsPasswordUpgrade() || !ghost.VerifyPassword("ghost") {
+			t.Fatalf("Expected legacy hash to verify and need an upgrade")
+		}
+
+		// Without a verifier SCRAM logins are refused rather than falling
+		// back to a cleartext password
+		fields := errorFields(newPGTestClient(t, addr, "ghost").expect('E'))
+		if fields['C'] != "28P01" {
+			t.Fatalf("Expected login to be refused with 28P01, got %v", fields)
+		}
+
+		// Only the password method accepts the cleartext password and
+		// upgrades the hash
+		writeHBA("host all all all password\n")
+		c := newPGTestClient(t, addr, "ghost")
+		if code := c.authRequest(); code != 3 {
+			t.Fatalf("Expected cleartext fallback (3) for a legacy hash, got %d", code)
+		}
+		c.send('p', cstring("ghost"))
+		if code := c.authRequest(); code != 0 {
+			t.Fatalf("Expected AuthenticationOk, got %d", code)
+		}
+
+		if !strings.HasPrefix(ghost.PasswordHash, "SCRAM-SHA-256$") {
+			t.Fatalf("Expected hash to be migrated, got %q", ghost.PasswordHash)
+		}
+		reloaded := storage.NewRoleStore(tmpDir)
+		reloaded.Load()
+		if r, _ := reloaded.GetRole("ghost"); r == nil || r.PasswordHash != ghost.PasswordHash {
+			t.Errorf("Expected migrated verifier to be persisted")
+		}
+
+		// The next login uses SCRAM
+		writeHBA("host all all all scram-sha-256\n")
+		admin := connectPG(t, addr, "ghost", "ghost")
+
+		// Under SCRAM rules an admin migrates a legacy role by setting a
+		// new password
+		alice, _ := db.RoleStore.GetRole("alice")
+		legacy = sha256.Sum256([]byte("secret"))
+		alice.PasswordHash = fmt.Sprintf("%x", legacy)
+		fields = errorFields(newPGTestClient(t, addr, "alice").expect('E'))
+		if fields['C'] != "28P01" {
+			t.Fatalf("Expected login to be refused with 28P01, got %v", fields)
+		}
+		admin.simpleQuery("ALTER ROLE alice PASSWORD 'secret'")
+		if alice.NeedsPasswordUpgrade() {
+			t.Fatalf("Expected ALTER ROLE to store a SCRAM verifier, got %q", alice.PasswordHash)
+		}
+		connectPG(t, addr, "alice", "secret")
+	})
+}
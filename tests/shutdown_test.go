@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// expectShutdownRefusal checks that a new connection is refused because the
+// server is shutting down
+func expectShutdownRefusal(t *testing.T, addr string) {
+	t.Helper()
+	fields := errorFields(newPGTestClient(t, addr, "ghost").expect('E'))
+	if fields['S'] != "FATAL" || fields['C'] != "57P03" || fields['M'] != "the database system is shutting down" {
+		t.Errorf("Expected 57P03, got %v", fields)
+	}
+}
+
+// expectClosed reads until the server ends the connection with a FATAL
+// error and returns its fields
+func expectClosed(t *testing.T, c *pgTestClient) map[byte]string {
+	t.Helper()
+	fields := errorFields(c.expect('E'))
+	if _, err := c.conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the server to close the connection, got %v", err)
+	}
+	return fields
+}
+
+// drain runs DrainSessions in the background; the returned channel is
+// closed once it returns
+func drain(db *storage.Database) <-chan struct{} {
+	drained := make(chan struct{})
+	go func() {
+		db.DrainSessions()
+		close(drained)
+	}()
+	return drained
+}
+
+func TestFastShutdown(t *testing.T) {
+	tmpDir := "./test_fast_shutdown_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	if err := db.Config.Set("shutdown_timeout", "300ms"); err != nil {
+		t.Fatalf("Failed to set shutdown_timeout: %v", err)
+	}
+
+	addr := startPGTestServer(t, db)
+	idle := connectPG(t, addr, "ghost", "ghost")
+	idle.simpleQuery("CREATE TABLE items (id INT)")
+	idle.simpleQuery("INSERT INTO items (id) VALUES (1)")
+	inTx := connectPG(t, addr, "ghost", "ghost")
+	inTx.simpleQuery("BEGIN")
+	inTx.simpleQuery("INSERT INTO items (id) VALUES (2)")
+
+	start := time.Now()
+	if !db.RequestShutdown(storage.ShutdownFast) {
+		t.Fatalf("Expected the shutdown to start")
+	}
+	if db.RequestShutdown(storage.ShutdownSmart) {
+		t.Errorf("A smart shutdown must not replace a fast one")
+	}
+	drained := drain(db)
+	expectShutdownRefusal(t, addr)
+
+	// Sessions between transactions are ended at once
+	if fields := expectClosed(t, idle); fields['C'] != "57P01" {
+		t.Errorf("Expected 57P01 for the idle session, got %v", fields)
+	}
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Errorf("Idle session was ended after %v", elapsed)
+	}
+
+	// Open transactions get shutdown_timeout to finish
+	if fields := expectClosed(t, inTx); fields['C'] != "57P01" {
+		t.Errorf("Expected 57P01 for the session in a transaction, got %v", fields)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Transaction was ended after %v, before shutdown_timeout", elapsed)
+	}
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Sessions were not drained")
+	}
+	if err := db.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// The uncommitted insert was rolled back
+	db, err = storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	defer db.Shutdown()
+	c := connectPG(t, startPGTestServer(t, db), "ghost", "ghost")
+	if rows := c.simpleQuery("SELECT id FROM items"); len(rows) != 1 || rows[0][0] != "1" {
+		t.Errorf("Expected only the committed row, got %v", rows)
+	}
+}
+
+func TestSmartShutdown(t *testing.T) {
+	tmpDir := "./test_smart_shutdown_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+	db.Config.ShutdownTimeout = time.Minute
+
+	addr := startPGTestServer(t, db)
+	leaving := connectPG(t, addr, "ghost", "ghost")
+	staying := connectPG(t, addr, "ghost", "ghost")
+	staying.simpleQuery("BEGIN")
+
+	db.RequestShutdown(storage.ShutdownSmart)
+	drained := drain(db)
+	expectShutdownRefusal(t, addr)
+
+	// Existing sessions keep working until their clients disconnect
+	leaving.simpleQuery("SELECT 1")
+	leaving.send('X', nil)
+	staying.simpleQuery("SELECT 1")
+
+	select {
+	case <-drained:
+		t.Fatalf("Smart shutdown finished while a session was open")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Escalating to immediate ends the remaining session at once
+	if !db.RequestShutdown(storage.ShutdownImmediate) {
+		t.Fatalf("Expected the shutdown to be escalated")
+	}
+	if fields := expectClosed(t, staying); fields['C'] != "57P01" {
+		t.Errorf("Expected 57P01, got %v", fields)
+	}
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Sessions were not drained")
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// activityRows returns the pg_stat_activity rows seen by c, keyed by pid
+func activityRows(c *pgTestClient) map[uint32][]string {
+	rows := c.simpleQuery("SELECT pid, datname, usename, application_name, client_addr, state, query, backend_start, state_change FROM pg_stat_activity")
+	byPID := make(map[uint32][]string)
+	for _, row := range rows {
+		pid, err := strconv.ParseUint(row[0], 10, 32)
+		if err != nil {
+			c.t.Fatalf("Invalid pid %q", row[0])
+		}
+		byPID[uint32(pid)] = row[1:]
+	}
+	return byPID
+}
+
+func TestStatActivity(t *testing.T) {
+	tmpDir := "./test_stat_activity_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	monitor := connectPG(t, addr, "ghost", "ghost")
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	sendStartupMessage(conn, map[string]string{"user": "ghost", "database": "ghostsql", "application_name": "reporting"})
+	app := &pgTestClient{t: t, conn: conn}
+	app.login("ghost", "ghost")
+
+	t.Run("Own Session", func(t *testing.T) {
+		row, ok := activityRows(monitor)[monitor.processID]
+		if !ok {
+			t.Fatalf("Session %d missing from pg_stat_activity", monitor.processID)
+		}
+		if row[0] != "ghostsql" || row[1] != "ghost" || row[3] != "127.0.0.1" {
+			t.Errorf("Unexpected session row %v", row)
+		}
+		if row[4] != "active" || row[5] != "SELECT pid, datname, usename, application_name, client_addr, state, query, backend_start, state_change FROM pg_stat_activity" {
+			t.Errorf("Expected running query, got state %q query %q", row[4], row[5])
+		}
+		if row[6] == "NULL" || row[7] == "NULL" {
+			t.Errorf("Expected timestamps, got %v", row)
+		}
+	})
+
+	t.Run("Idle", func(t *testing.T) {
+		app.simpleQuery("SELECT 1")
+		row := activityRows(monitor)[app.processID]
+		if row[2] != "reporting" || row[4] != "idle" || row[5] != "SELECT 1" {
+			t.Errorf("Expected idle session with its last query, got %v", row)
+		}
+	})
+
+	t.Run("Idle In Transaction", func(t *testing.T) {
+		app.simpleQuery("BEGIN")
+		if row := activityRows(monitor)[app.processID]; row[4] != "idle in transaction" || row[5] != "BEGIN" {
+			t.Errorf("Expected idle in transaction, got %v", row)
+		}
+		app.queryBatch("SELECT * FROM missing_table")
+		if row := activityRows(monitor)[app.processID]; row[4] != "idle in transaction (aborted)" {
+			t.Errorf("Expected aborted transaction, got %v", row)
+		}
+		app.simpleQuery("ROLLBACK")
+		if row := activityRows(monitor)[app.processID]; row[4] != "idle" {
+			t.Errorf("Expected idle after ROLLBACK, got %v", row)
+		}
+	})
+
+	t.Run("Application Name", func(t *testing.T) {
+		app.simpleQuery("SET application_name = 'batch'")
+		if row := activityRows(monitor)[app.processID]; row[2] != "batch" {
+			t.Errorf("Expected updated application_name, got %v", row)
+		}
+	})
+
+	t.Run("Closed Session", func(t *testing.T) {
+		app.send('X', nil)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, ok := activityRows(monitor)[app.processID]; !ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Closed session still listed")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// expectTerminated reads until the FATAL error sent by pg_terminate_backend
+// and checks that the server then closes the connection
+func expectTerminated(t *testing.T, c *pgTestClient) {
+	t.Helper()
+	for {
+		msgType, body := c.receive()
+		if msgType == 'Z' {
+			t.Fatalf("Expected the connection to be terminated, got ReadyForQuery")
+		}
+		if msgType != 'E' {
+			continue
+		}
+		fields := errorFields(body)
+		if fields['S'] != "FATAL" || fields['C'] != "57P01" || fields['M'] != "terminating connection due to administrator command" {
+			t.Fatalf("Expected FATAL 57P01, got %v", fields)
+		}
+		break
+	}
+	if _, err := c.conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the server to close the connection, got %v", err)
+	}
+}
+
+func TestTerminateBackend(t *testing.T) {
+	tmpDir := "./test_terminate_backend_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	admin := connectPG(t, addr, "ghost", "ghost")
+	admin.simpleQuery("CREATE TABLE nums (n INT)")
+	admin.simpleQuery("CREATE TABLE others (m INT)")
+	var nums, others []string
+	for i := 0; i < 300; i++ {
+		nums = append(nums, fmt.Sprintf("(%d)", i))
+		others = append(others, fmt.Sprintf("(%d)", i+1000))
+	}
+	admin.simpleQuery("INSERT INTO nums (n) VALUES " + strings.Join(nums, ", "))
+	admin.simpleQuery("INSERT INTO others (m) VALUES " + strings.Join(others, ", "))
+	admin.simpleQuery("CREATE ROLE plain WITH LOGIN PASSWORD 'pw'")
+
+	runaway := "SELECT COUNT(*) FROM nums a CROSS JOIN nums b JOIN others c ON a.n = c.m"
+
+	t.Run("Cancel Backend", func(t *testing.T) {
+		victim := connectPG(t, addr, "ghost", "ghost")
+		victim.send('Q', cstring(runaway))
+		time.Sleep(200 * time.Millisecond)
+		if rows := admin.simpleQuery(fmt.Sprintf("SELECT pg_cancel_backend(%d)", victim.processID)); rows[0][0] != "t" {
+			t.Fatalf("Expected pg_cancel_backend to return true, got %v", rows)
+		}
+
+		var fields map[byte]string
+		for {
+			msgType, body := victim.receive()
+			if msgType == 'E' {
+				fields = errorFields(body)
+			}
+			if msgType == 'Z' {
+				break
+			}
+		}
+		if fields['C'] != "57014" {
+			t.Fatalf("Expected SQLSTATE 57014, got %v", fields)
+		}
+		victim.simpleQuery("SELECT 1")
+	})
+
+	t.Run("Terminate Idle Backend", func(t *testing.T) {
+		victim := connectPG(t, addr, "ghost", "ghost")
+		writer := connectPG(t, addr, "ghost", "ghost")
+		victim.simpleQuery("DECLARE c CURSOR FOR SELECT n FROM nums")
+		victim.simpleQuery("BEGIN")
+		victim.simpleQuery("INSERT INTO nums (n) VALUES (-1)")
+		victim.simpleQuery("LOCK TABLE nums")
+		if fields := writer.queryError("INSERT INTO nums (n) VALUES (1000)"); fields['C'] != "55P03" {
+			t.Fatalf("Expected the table to be locked, got %v", fields)
+		}
+
+		if rows := admin.simpleQuery(fmt.Sprintf("SELECT pg_terminate_backend(%d)", victim.processID)); rows[0][0] != "t" {
+			t.Fatalf("Expected pg_terminate_backend to return true, got %v", rows)
+		}
+		expectTerminated(t, victim)
+
+		// The lock is released and the uncommitted insert rolled back once
+		// the session has closed
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			res := writer.queryBatch("INSERT INTO nums (n) VALUES (1000)")
+			if len(res.errors) == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Lock not released: %v", res.errors)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if rows := writer.simpleQuery("SELECT COUNT(*) FROM nums WHERE n = -1"); rows[0][0] != "0" {
+			t.Errorf("Expected the transaction to be rolled back, got %v", rows)
+		}
+		if len(activityRows(admin)) != 2 {
+			t.Errorf("Expected only the admin and writer sessions to remain")
+		}
+	})
+
+	t.Run("Terminate Running Statement", func(t *testing.T) {
+		victim := connectPG(t, addr, "ghost", "ghost")
+		start := time.Now()
+		victim.send('Q', cstring(runaway))
+		time.Sleep(200 * time.Millisecond)
+		admin.simpleQuery(fmt.Sprintf("SELECT pg_terminate_backend(%d)", victim.processID))
+		expectTerminated(t, victim)
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Termination took %v", elapsed)
+		}
+	})
+
+	t.Run("Unknown PID", func(t *testing.T) {
+		if rows := admin.simpleQuery("SELECT pg_terminate_backend(999999)"); rows[0][0] != "f" {
+			t.Errorf("Expected false for an unknown PID, got %v", rows)
+		}
+	})
+
+	t.Run("Requires Superuser", func(t *testing.T) {
+		user := connectPG(t, addr, "plain", "pw")
+		for _, fn := range []string{"pg_cancel_backend", "pg_terminate_backend"} {
+			res := user.queryBatch(fmt.Sprintf("SELECT %s(%d)", fn, admin.processID))
+			if len(res.errors) != 1 || res.errors[0]['C'] != "42501" {
+				t.Errorf("%s: expected insufficient privilege error, got %v", fn, res.errors)
+			}
+		}
+	})
+}
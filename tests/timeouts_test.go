@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+func TestTimeouts(t *testing.T) {
+	tmpDir := "./test_timeouts_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	admin := connectPG(t, addr, "ghost", "ghost")
+	admin.simpleQuery("CREATE TABLE nums (n INT)")
+	admin.simpleQuery("CREATE TABLE others (m INT)")
+	var nums, others []string
+	for i := 0; i < 300; i++ {
+		nums = append(nums, fmt.Sprintf("(%d)", i))
+		others = append(others, fmt.Sprintf("(%d)", i+1000))
+	}
+	admin.simpleQuery("INSERT INTO nums (n) VALUES " + strings.Join(nums, ", "))
+	admin.simpleQuery("INSERT INTO others (m) VALUES " + strings.Join(others, ", "))
+
+	t.Run("Statement Timeout", func(t *testing.T) {
+		c := connectPG(t, addr, "ghost", "ghost")
+		c.simpleQuery("SET statement_timeout = '200ms'")
+		start := time.Now()
+		fields := c.queryError("SELECT COUNT(*) FROM nums a CROSS JOIN nums b JOIN others c ON a.n = c.m")
+		if fields['C'] != "57014" || fields['M'] != "canceling statement due to statement timeout" {
+			t.Fatalf("Expected statement timeout, got %v", fields)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Statement ran for %v", elapsed)
+		}
+
+		// Short statements are not affected
+		if rows := c.simpleQuery("SELECT COUNT(*) FROM nums"); len(rows) != 1 || rows[0][0] != "300" {
+			t.Errorf("Unexpected result after timeout: %v", rows)
+		}
+		if rows := c.simpleQuery("SHOW statement_timeout"); rows[0][0] != "200ms" {
+			t.Errorf("Expected SHOW to return the setting, got %v", rows)
+		}
+	})
+
+	t.Run("Invalid Values", func(t *testing.T) {
+		for _, sql := range []string{"SET lock_timeout = 'soon'", "SET statement_timeout = '-5'", "SET idle_in_transaction_session_timeout = '5 weeks'"} {
+			if fields := admin.queryError(sql); fields['C'] != "22023" {
+				t.Errorf("%s: expected invalid value error, got %v", sql, fields)
+			}
+		}
+	})
+
+	t.Run("Lock Timeout", func(t *testing.T) {
+		holder := connectPG(t, addr, "ghost", "ghost")
+		waiter := connectPG(t, addr, "ghost", "ghost")
+		holder.simpleQuery("BEGIN")
+		holder.simpleQuery("LOCK TABLE nums")
+
+		// Without lock_timeout a held lock fails at once
+		if fields := waiter.queryError("INSERT INTO nums (n) VALUES (1)"); fields['C'] != "55P03" {
+			t.Fatalf("Expected lock not available, got %v", fields)
+		}
+
+		waiter.simpleQuery("SET lock_timeout = 100")
+		start := time.Now()
+		fields := waiter.queryError("INSERT INTO nums (n) VALUES (1)")
+		if fields['C'] != "55P03" || fields['M'] != "canceling statement due to lock timeout" {
+			t.Fatalf("Expected lock timeout, got %v", fields)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("Expected to wait for lock_timeout, waited %v", elapsed)
+		}
+
+		// A lock released within lock_timeout is acquired
+		waiter.simpleQuery("SET lock_timeout = '5s'")
+		waiter.send('Q', cstring("LOCK TABLE nums"))
+		time.Sleep(100 * time.Millisecond)
+		holder.simpleQuery("COMMIT")
+		if msgType, body := waiter.receive(); msgType != 'C' {
+			t.Fatalf("Expected LOCK TABLE to complete, got %c %v", msgType, errorFields(body))
+		}
+		waiter.expect('Z')
+		waiter.simpleQuery("COMMIT")
+	})
+
+	t.Run("Idle In Transaction Timeout", func(t *testing.T) {
+		victim := connectPG(t, addr, "ghost", "ghost")
+		victim.simpleQuery("SET idle_in_transaction_session_timeout = '100ms'")
+
+		// Sessions idle outside a transaction block are left alone
+		time.Sleep(200 * time.Millisecond)
+		victim.simpleQuery("BEGIN")
+		victim.simpleQuery("LOCK TABLE nums")
+
+		fields := errorFields(victim.expect('E'))
+		if fields['S'] != "FATAL" || fields['C'] != "25P03" || fields['M'] != "terminating connection due to idle-in-transaction timeout" {
+			t.Fatalf("Expected idle-in-transaction timeout, got %v", fields)
+		}
+		if _, err := victim.conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Expected the server to close the connection, got %v", err)
+		}
+
+		admin.simpleQuery("SET lock_timeout = '5s'")
+		admin.simpleQuery("INSERT INTO nums (n) VALUES (1)")
+	})
+}
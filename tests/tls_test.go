@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for localhost and its
+// key to dir, returning the certificate for clients to trust
+func writeSelfSignedCert(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	os.WriteFile(filepath.Join(dir, "server.crt"), certPEM, 0644)
+	os.WriteFile(filepath.Join(dir, "server.key"), keyPEM, 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// sendSSLRequest sends an SSLRequest and returns the server's one-byte answer
+func sendSSLRequest(t *testing.T, conn net.Conn) byte {
+	msg := binary.BigEndian.AppendUint32(nil, 8)
+	msg = binary.BigEndian.AppendUint32(msg, 80877103)
+	conn.Write(msg)
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatalf("Failed to read SSLRequest response: %v", err)
+	}
+	return resp[0]
+}
+
+// dialTLS opens a connection, negotiates SSL and verifies the server
+// certificate against roots for serverName, as sslmode=verify-full does
+func dialTLS(t *testing.T, addr, serverName string, roots *x509.CertPool) (*tls.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if resp := sendSSLRequest(t, conn); resp != 'S' {
+		t.Fatalf("Expected SSLRequest to be accepted with 'S', got %q", resp)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, RootCAs: roots})
+	return tlsConn, tlsConn.Handshake()
+}
+
+func TestTLSConnections(t *testing.T) {
+	tmpDir := "./test_tls_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	os.MkdirAll(tmpDir, 0755)
+
+	cert := writeSelfSignedCert(t, tmpDir)
+	os.WriteFile(filepath.Join(tmpDir, storage.ConfigFileName), []byte("ssl = on  # certificate files default to server.crt/server.key\n"), 0644)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+	if !db.Config.SSL {
+		t.Fatalf("Expected ssl to be enabled by %s", storage.ConfigFileName)
+	}
+
+	addr := startPGTestServer(t, db)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	t.Run("Verify Full", func(t *testing.T) {
+		tlsConn, err := dialTLS(t, addr, "localhost", roots)
+		if err != nil {
+			t.Fatalf("TLS handshake failed: %v", err)
+		}
+
+		c := &pgTestClient{t: t, conn: tlsConn}
+		sendStartupMessage(tlsConn, map[string]string{"user": "ghost", "database": "ghostsql"})
+		c.login("ghost", "ghost")
+
+		rows := c.simpleQuery("SHOW ssl")
+		if len(rows) != 1 || rows[0][0] != "on" {
+			t.Errorf("Expected SHOW ssl to be on, got %v", rows)
+		}
+	})
+
+	t.Run("Hostname Mismatch", func(t *testing.T) {
+		if _, err := dialTLS(t, addr, "db.example.com", roots); err == nil {
+			t.Errorf("Expected certificate verification to fail for the wrong host name")
+		}
+	})
+
+	t.Run("Unencrypted Connections", func(t *testing.T) {
+		// Clients with sslmode=disable skip the SSLRequest entirely
+		c := connectPG(t, addr, "ghost", "ghost")
+		c.simpleQuery("SELECT 1")
+	})
+}
+
+func TestTLSDisabled(t *testing.T) {
+	tmpDir := "./test_tls_disabled_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if resp := sendSSLRequest(t, conn); resp != 'N' {
+		t.Fatalf("Expected SSLRequest to be declined with 'N', got %q", resp)
+	}
+
+	// The client continues unencrypted on the same connection
+	c := &pgTestClient{t: t, conn: conn}
+	sendStartupMessage(conn, map[string]string{"user": "ghost", "database": "ghostsql"})
+	c.login("ghost", "ghost")
+}
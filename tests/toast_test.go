@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+func TestToast(t *testing.T) {
+	executor.ResetRegistries()
+	tmpDir := "./test_toast_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	exec := newWALTestExecutor(db)
+
+	// Random characters barely compress; repeated words compress well
+	rng := rand.New(rand.NewSource(1))
+	chars := make([]byte, 200*1024)
+	for i := range chars {
+		chars[i] = byte('0' + rng.Intn(75))
+		if chars[i] == '\\' {
+			chars[i] = '/'
+		}
+	}
+	random := string(chars)
+	repeated := strings.Repeat("ghost ", 100000)
+	values := make([]string, 4096)
+	for i := range values {
+		values[i] = fmt.Sprint(float32(i) / 4)
+	}
+	vector := "[" + strings.Join(values, ",") + "]"
+
+	runQuery(t, exec, "CREATE TABLE docs (id INT, title TEXT, body TEXT, attrs JSONB, embedding VECTOR(4096))")
+	attrs := fmt.Sprintf(`{"tags": ["%s"]}`, strings.Repeat("x", 20000))
+	runQuery(t, exec, fmt.Sprintf("INSERT INTO docs (id, title, body, attrs, embedding) VALUES (1, 'random', '%s', '%s', '%s')", random, attrs, vector))
+	runQuery(t, exec, fmt.Sprintf("INSERT INTO docs (id, title, body) VALUES (2, 'repeated', '%s')", repeated))
+
+	table := func(t *testing.T) *storage.Table {
+		t.Helper()
+		dbInstance, err := db.GetDatabaseInstance("ghostsql")
+		if err != nil {
+			t.Fatalf("GetDatabaseInstance failed: %v", err)
+		}
+		table, ok := dbInstance.GetTable("docs")
+		if !ok {
+			t.Fatal("Table docs not found")
+		}
+		return table
+	}
+	check := func(t *testing.T, id int, column string, want string) {
+		t.Helper()
+		res, err := exec.Execute(parseQuery(fmt.Sprintf("SELECT %s FROM docs WHERE id = %d", column, id)))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("Expected row %d, got %v, %v", id, res, err)
+		}
+		if got := fmt.Sprint(res.Rows[0][column]); got != want {
+			t.Errorf("Expected %s of row %d to be %d bytes, got %d bytes", column, id, len(want), len(got))
+		}
+	}
+	checkVector := func(t *testing.T) {
+		t.Helper()
+		res, err := exec.Execute(parseQuery("SELECT embedding FROM docs WHERE id = 1"))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("Expected row 1, got %v, %v", res, err)
+		}
+		vec, ok := res.Rows[0]["embedding"].(*storage.Vector)
+		if !ok || vec.Dimensions != 4096 || vec.Values[4095] != 4095.0/4 {
+			t.Errorf("Expected the 4096-dimension vector back, got %T", res.Rows[0]["embedding"])
+		}
+	}
+
+	t.Run("Values", func(t *testing.T) {
+		check(t, 1, "body", random)
+		check(t, 2, "body", repeated)
+		check(t, 2, "title", "repeated")
+		checkVector(t)
+		res, err := exec.Execute(parseQuery("SELECT id FROM docs WHERE body = 'nothing'"))
+		if err != nil || len(res.Rows) != 0 {
+			t.Errorf("Expected no rows, got %v, %v", res, err)
+		}
+		res, err = exec.Execute(parseQuery("SELECT * FROM docs ORDER BY id"))
+		if err != nil || len(res.Rows) != 2 || res.Rows[1]["body"] != repeated {
+			t.Errorf("Expected both rows in full, got %v", err)
+		}
+
+		// 600kB of repeated words are compressed to a few chunks, while the
+		// random characters take about one page per 16kB
+		if n := table(t).NumPages(); n < 200*1024/storage.PageSize || n > 20 {
+			t.Errorf("Expected out-of-line values to take about 15 pages, got %d", n)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		numPages := table(t).NumPages()
+		runQuery(t, exec, "UPDATE docs SET title = 'renamed' WHERE id = 1")
+		if n := table(t).NumPages(); n != numPages {
+			t.Errorf("Expected unchanged values to stay where they are in %d pages, got %d", numPages, n)
+		}
+		check(t, 1, "body", random)
+		check(t, 1, "title", "renamed")
+
+		runQuery(t, exec, "BEGIN")
+		runQuery(t, exec, "UPDATE docs SET body = 'short' WHERE id = 1")
+		check(t, 1, "body", "short")
+		runQuery(t, exec, "ROLLBACK")
+		check(t, 1, "body", random)
+
+		runQuery(t, exec, "UPDATE docs SET body = 'short' WHERE id = 1")
+		runQuery(t, exec, "DELETE FROM docs WHERE id = 2")
+		tupleCounts := func(t *testing.T) string {
+			t.Helper()
+			res, err := exec.Execute(parseQuery("SELECT n_live_tup, n_dead_tup FROM pg_stat_user_tables WHERE relname = 'docs'"))
+			if err != nil || len(res.Rows) != 1 {
+				t.Fatalf("Expected one row in pg_stat_user_tables, got %v, %v", res, err)
+			}
+			return fmt.Sprint(res.Rows[0]["n_live_tup"], " ", res.Rows[0]["n_dead_tup"])
+		}
+		// The chunks of the freed values are not tuples
+		if counts := tupleCounts(t); counts != "1 1" {
+			t.Errorf("Expected one live and one dead tuple, got %s", counts)
+		}
+		runQuery(t, exec, "VACUUM docs")
+		if counts := tupleCounts(t); counts != "1 0" {
+			t.Errorf("Expected one live tuple, got %s", counts)
+		}
+		check(t, 1, "body", "short")
+		checkVector(t)
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		// The old values were reclaimed by VACUUM
+		numPages := table(t).NumPages()
+		runQuery(t, exec, fmt.Sprintf("INSERT INTO docs (id, title, body) VALUES (3, 'again', '%s')", random))
+		if n := table(t).NumPages(); n > numPages {
+			t.Errorf("Expected the new value to reuse reclaimed space in %d pages, got %d", numPages, n)
+		}
+		runQuery(t, exec, "ALTER TABLE docs ADD COLUMN views INT")
+		runQuery(t, exec, "VACUUM FULL docs")
+		check(t, 3, "body", random)
+		checkVector(t)
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		runQuery(t, exec, fmt.Sprintf("INSERT INTO docs (id, title, body) VALUES (4, 'late', '%s')", repeated))
+		db = crash(t, db, tmpDir)
+		exec = newWALTestExecutor(db)
+		check(t, 3, "body", random)
+		check(t, 4, "body", repeated)
+		check(t, 1, "attrs", attrs)
+		checkVector(t)
+	})
+
+	if err := db.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// queryStatus runs a simple Query and returns the CommandComplete tag, the
+// ErrorResponse fields if any and the ReadyForQuery transaction status
+func (c *pgTestClient) queryStatus(sql string) (string, map[byte]string, byte) {
+	c.t.Helper()
+	c.send('Q', cstring(sql))
+	var tag string
+	var fields map[byte]string
+	for {
+		msgType, body := c.receive()
+		switch msgType {
+		case 'C':
+			tag = string(body[:len(body)-1])
+		case 'E':
+			fields = errorFields(body)
+		case 'Z':
+			return tag, fields, body[0]
+		}
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	tmpDir := "./test_txstatus_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	addr := startPGTestServer(t, db)
+	c := connectPG(t, addr, "ghost", "ghost")
+	c.simpleQuery("CREATE TABLE accounts (id INT, balance INT)")
+
+	expectStatus := func(t *testing.T, sql string, want byte) (string, map[byte]string) {
+		t.Helper()
+		tag, fields, status := c.queryStatus(sql)
+		if status != want {
+			t.Fatalf("%s: expected status %c, got %c", sql, want, status)
+		}
+		return tag, fields
+	}
+
+	t.Run("Idle And In Block", func(t *testing.T) {
+		expectStatus(t, "SELECT * FROM accounts", 'I')
+		expectStatus(t, "BEGIN", 'T')
+		expectStatus(t, "INSERT INTO accounts (id, balance) VALUES (1, 100)", 'T')
+		expectStatus(t, "COMMIT", 'I')
+		if rows := c.simpleQuery("SELECT * FROM accounts"); len(rows) != 1 {
+			t.Errorf("Expected committed row, got %v", rows)
+		}
+	})
+
+	t.Run("Failed Block Until Rollback", func(t *testing.T) {
+		expectStatus(t, "BEGIN", 'T')
+		expectStatus(t, "INSERT INTO accounts (id, balance) VALUES (2, 200)", 'T')
+		if _, fields := expectStatus(t, "SELECT * FROM missing_table", 'E'); fields == nil {
+			t.Fatalf("Expected an error")
+		}
+
+		_, fields := expectStatus(t, "SELECT * FROM accounts", 'E')
+		if fields['C'] != "25P02" {
+			t.Errorf("Expected SQLSTATE 25P02, got %v", fields)
+		}
+		if fields['M'] != "current transaction is aborted, commands ignored until end of transaction block" {
+			t.Errorf("Unexpected message %q", fields['M'])
+		}
+
+		if tag, _ := expectStatus(t, "ROLLBACK", 'I'); tag != "ROLLBACK" {
+			t.Errorf("Expected ROLLBACK, got %q", tag)
+		}
+		if rows := c.simpleQuery("SELECT * FROM accounts"); len(rows) != 1 {
+			t.Errorf("Expected rolled back insert, got %v", rows)
+		}
+	})
+
+	t.Run("Parse Error Aborts Block", func(t *testing.T) {
+		expectStatus(t, "BEGIN", 'T')
+		expectStatus(t, "SELEC oops", 'E')
+		expectStatus(t, "ROLLBACK", 'I')
+	})
+
+	t.Run("Commit Of Failed Block Rolls Back", func(t *testing.T) {
+		expectStatus(t, "BEGIN", 'T')
+		expectStatus(t, "INSERT INTO accounts (id, balance) VALUES (3, 300)", 'T')
+		expectStatus(t, "SELECT * FROM missing_table", 'E')
+		if tag, _ := expectStatus(t, "COMMIT", 'I'); tag != "ROLLBACK" {
+			t.Errorf("Expected COMMIT of a failed block to report ROLLBACK, got %q", tag)
+		}
+		if rows := c.simpleQuery("SELECT * FROM accounts"); len(rows) != 1 {
+			t.Errorf("Expected no committed changes, got %v", rows)
+		}
+	})
+
+	t.Run("Rollback To Savepoint Recovers", func(t *testing.T) {
+		expectStatus(t, "BEGIN", 'T')
+		expectStatus(t, "INSERT INTO accounts (id, balance) VALUES (4, 400)", 'T')
+		expectStatus(t, "SAVEPOINT sp1", 'T')
+		expectStatus(t, "SELECT * FROM missing_table", 'E')
+		expectStatus(t, "ROLLBACK TO SAVEPOINT sp1", 'T')
+		expectStatus(t, "INSERT INTO accounts (id, balance) VALUES (5, 500)", 'T')
+		expectStatus(t, "COMMIT", 'I')
+		if rows := c.simpleQuery("SELECT * FROM accounts"); len(rows) != 3 {
+			t.Errorf("Expected 3 rows after savepoint recovery, got %v", rows)
+		}
+	})
+
+	t.Run("Error Outside Block", func(t *testing.T) {
+		expectStatus(t, "SELECT * FROM missing_table", 'I')
+		expectStatus(t, "SELECT * FROM accounts", 'I')
+	})
+}
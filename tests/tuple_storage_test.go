@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+func TestTupleStorage(t *testing.T) {
+	t.Run("Stable TIDs", func(t *testing.T) {
+		table := storage.NewTable("docs", "ghost", []storage.Column{
+			{Name: "id", Type: storage.TypeInt, Nullable: false},
+			{Name: "body", Type: storage.TypeText, Nullable: true},
+		}, nil)
+
+		// Fill the first page so that a grown row has to move
+		var tids []storage.TID
+		for i := 0; table.NumPages() < 2; i++ {
+			tid, err := table.InsertTuple(storage.Row{"id": i, "body": strings.Repeat("x", 100)})
+			if err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+			tids = append(tids, tid)
+		}
+		count := table.TupleCount()
+		first := tids[0]
+
+		big := strings.Repeat("y", 4000)
+		if err := table.UpdateTuple(first, storage.Row{"id": 0, "body": big}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		row, err := table.Fetch(first)
+		if err != nil || row["body"] != big {
+			t.Fatalf("Expected the moved row under its TID, got %v, %v", row, err)
+		}
+		tuples, _ := table.Tuples()
+		if len(tuples) != count || table.TupleCount() != count {
+			t.Errorf("Expected %d tuples after a forwarded update, got %d", count, len(tuples))
+		}
+		found := false
+		for _, tuple := range tuples {
+			if tuple.TID == first {
+				found = tuple.Row["body"] == big
+			}
+		}
+		if !found {
+			t.Errorf("Expected scans to report the moved row under %s", first)
+		}
+
+		// Shrinking it again still keeps the TID
+		if err := table.UpdateTuple(first, storage.Row{"id": 0, "body": "small"}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if row, _ := table.Fetch(first); row["body"] != "small" {
+			t.Errorf("Expected updated row, got %v", row)
+		}
+		if table.TupleCount() != count {
+			t.Errorf("Expected %d tuples, got %d", count, table.TupleCount())
+		}
+
+		// A delete leaves a tombstone; the other TIDs are unaffected
+		if err := table.DeleteTuple(tids[1]); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, err := table.Fetch(tids[1]); err == nil {
+			t.Error("Expected deleted tuple not to be found")
+		}
+		if err := table.DeleteTuple(tids[1]); err == nil {
+			t.Error("Expected deleting a deleted tuple to fail")
+		}
+		if row, _ := table.Fetch(tids[2]); row["id"] != 2 {
+			t.Errorf("Expected row 2 at %s, got %v", tids[2], row)
+		}
+		if table.TupleCount() != count-1 {
+			t.Errorf("Expected %d tuples after delete, got %d", count-1, table.TupleCount())
+		}
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		executor.ResetRegistries()
+		tmpDir := "./test_tuple_storage_dir"
+		os.RemoveAll(tmpDir)
+		defer os.RemoveAll(tmpDir)
+
+		db, err := storage.Initialize(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		exec := newWALTestExecutor(db)
+		runQuery(t, exec, "CREATE TABLE items (id INT, name TEXT, attrs JSONB)")
+		runQuery(t, exec, `INSERT INTO items (id, name, attrs) VALUES (1, 'a', '{"k": 1}'), (2, 'b', NULL), (3, 'c', NULL), (4, 'd', NULL)`)
+		runQuery(t, exec, "UPDATE items SET name = '"+strings.Repeat("z", 2000)+"' WHERE id = 2")
+		runQuery(t, exec, "DELETE FROM items WHERE id = 3")
+		runQuery(t, exec, "CREATE TABLE gone (id INT)")
+		runQuery(t, exec, "INSERT INTO gone (id) VALUES (4)")
+		runQuery(t, exec, "DELETE FROM items USING gone WHERE items.id = gone.id")
+		runQuery(t, exec, "ALTER TABLE items RENAME COLUMN name TO label")
+		runQuery(t, exec, "ALTER TABLE items ADD COLUMN extra INT")
+		if err := db.Shutdown(); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+
+		db, err = storage.Initialize(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to restart database: %v", err)
+		}
+		defer db.Shutdown()
+		exec = newWALTestExecutor(db)
+		if ids := selectIDs(exec, "items"); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+			t.Fatalf("Expected rows 1 and 2 after restart, got %v", ids)
+		}
+		res, err := exec.Execute(parseQuery("SELECT label, attrs, extra FROM items WHERE id = 2"))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("Select failed: %v", err)
+		}
+		if res.Rows[0]["label"] != strings.Repeat("z", 2000) || res.Rows[0]["extra"] != nil {
+			t.Errorf("Unexpected row after restart: %v", res.Rows[0])
+		}
+		res, _ = exec.Execute(parseQuery("SELECT attrs->>'k' AS k FROM items WHERE id = 1"))
+		if len(res.Rows) != 1 || res.Rows[0]["k"] != "1" {
+			t.Errorf("Expected JSONB to survive a restart, got %v", res.Rows)
+		}
+
+		// Pages with tombstones still take new rows after loading
+		runQuery(t, exec, "INSERT INTO items (id, label) VALUES (5, 'e')")
+		if ids := selectIDs(exec, "items"); !reflect.DeepEqual(ids, []string{"1", "2", "5"}) {
+			t.Errorf("Expected rows 1, 2 and 5, got %v", ids)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/protocol/pg"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// connectUnix opens a Unix-domain socket connection and sends the
+// StartupMessage, leaving authentication to the caller
+func connectUnix(t *testing.T, path, user string) *pgTestClient {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	sendStartupMessage(conn, map[string]string{"user": user, "database": "ghostsql"})
+	return &pgTestClient{t: t, conn: conn}
+}
+
+func TestUnixSocket(t *testing.T) {
+	tmpDir := "./test_unix_socket_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	os.MkdirAll(tmpDir, 0755)
+
+	osUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("Failed to look up the current user: %v", err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, storage.HBAFileName), []byte(strings.Join([]string{
+		"local all " + osUser.Username + " peer",
+		"local all peeronly peer",
+		"local all ghost   scram-sha-256",
+		"host  all ghost   all scram-sha-256",
+		"host  all all     all reject",
+	}, "\n")), 0644)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Shutdown()
+
+	session := db.SessionMgr.CreateSession("unix_admin")
+	session.SetUser("ghost")
+	session.SetDatabase("ghostsql")
+	exec := executor.NewExecutor(db, session)
+	runQuery(t, exec, "CREATE ROLE "+osUser.Username+" WITH LOGIN")
+	runQuery(t, exec, "CREATE ROLE peeronly WITH LOGIN")
+
+	socketDir := t.TempDir()
+	listener, err := pg.ListenUnix(socketDir, 5433)
+	if err != nil {
+		t.Fatalf("Failed to listen on Unix socket: %v", err)
+	}
+	servePGTestConnections(t, db, listener)
+	path := pg.UnixSocketPath(socketDir, 5433)
+	if filepath.Base(path) != ".s.PGSQL.5433" {
+		t.Errorf("Unexpected socket name %s", path)
+	}
+	addr := startPGTestServer(t, db)
+
+	t.Run("Password Over Socket", func(t *testing.T) {
+		c := connectUnix(t, path, "ghost")
+		c.login("ghost", "ghost")
+		c.simpleQuery("SELECT 1")
+	})
+
+	t.Run("Peer", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("peer authentication needs SO_PEERCRED")
+		}
+		c := connectUnix(t, path, osUser.Username)
+		c.login(osUser.Username, "")
+		c.simpleQuery("SELECT 1")
+	})
+
+	t.Run("Peer Mismatch", func(t *testing.T) {
+		if osUser.Username == "peeronly" {
+			t.Skip("running as the peeronly OS user")
+		}
+		fields := errorFields(connectUnix(t, path, "peeronly").expect('E'))
+		if fields['C'] != "28000" || fields['M'] != `Peer authentication failed for user "peeronly"` {
+			t.Errorf("Expected peer authentication failure, got %v", fields)
+		}
+	})
+
+	t.Run("Local Rules Skip TCP", func(t *testing.T) {
+		fields := errorFields(newPGTestClient(t, addr, osUser.Username).expect('E'))
+		if fields['C'] != "28000" || !strings.Contains(fields['M'], "rejects connection") {
+			t.Errorf("Expected TCP connection to be rejected, got %v", fields)
+		}
+	})
+
+	t.Run("SSL Declined", func(t *testing.T) {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if resp := sendSSLRequest(t, conn); resp != 'N' {
+			t.Errorf("Expected SSLRequest over a Unix socket to be declined, got %q", resp)
+		}
+	})
+
+	t.Run("Socket In Use", func(t *testing.T) {
+		if _, err := pg.ListenUnix(socketDir, 5433); err == nil {
+			t.Errorf("Expected a second listener on the same socket to fail")
+		}
+	})
+
+	t.Run("Stale Socket", func(t *testing.T) {
+		dir := t.TempDir()
+		stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: pg.UnixSocketPath(dir, 5433), Net: "unix"})
+		if err != nil {
+			t.Fatalf("Failed to create socket: %v", err)
+		}
+		stale.SetUnlinkOnClose(false)
+		stale.Close()
+
+		listener, err := pg.ListenUnix(dir, 5433)
+		if err != nil {
+			t.Fatalf("Expected stale socket to be replaced, got %v", err)
+		}
+		listener.Close()
+	})
+
+	t.Run("Setting", func(t *testing.T) {
+		if dirs := db.Config.SocketDirectories(); len(dirs) != 1 || dirs[0] != "/tmp" {
+			t.Errorf("Expected unix_socket_directories to default to /tmp, got %v", dirs)
+		}
+		db.Config.Set("unix_socket_directories", "/var/run/ghostsql, /tmp,")
+		if dirs := db.Config.SocketDirectories(); len(dirs) != 2 || dirs[0] != "/var/run/ghostsql" {
+			t.Errorf("Unexpected socket directories %v", dirs)
+		}
+	})
+}
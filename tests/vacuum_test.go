@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+func TestVacuum(t *testing.T) {
+	executor.ResetRegistries()
+	tmpDir := "./test_vacuum_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	exec := newWALTestExecutor(db)
+
+	const numRows = 400
+	filler := strings.Repeat("x", 200)
+	runQuery(t, exec, "CREATE TABLE items (id INT, body TEXT)")
+	insert := func(t *testing.T, from, to int) {
+		t.Helper()
+		values := make([]string, 0, to-from)
+		for id := from; id < to; id++ {
+			values = append(values, fmt.Sprintf("(%d, '%s')", id, filler))
+		}
+		runQuery(t, exec, "INSERT INTO items (id, body) VALUES "+strings.Join(values, ", "))
+	}
+	insert(t, 0, numRows)
+
+	dbInstance := func(t *testing.T) *storage.DatabaseInstance {
+		t.Helper()
+		dbInstance, err := db.GetDatabaseInstance("ghostsql")
+		if err != nil {
+			t.Fatalf("GetDatabaseInstance failed: %v", err)
+		}
+		return dbInstance
+	}
+	table := func(t *testing.T) *storage.Table {
+		t.Helper()
+		table, ok := dbInstance(t).GetTable("items")
+		if !ok {
+			t.Fatal("Table items not found")
+		}
+		return table
+	}
+	stats := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		res, err := exec.Execute(parseQuery("SELECT * FROM pg_stat_user_tables WHERE relname = 'items'"))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("Expected one row in pg_stat_user_tables, got %v, %v", res, err)
+		}
+		return res.Rows[0]
+	}
+	tableFileSize := func(t *testing.T) int64 {
+		t.Helper()
+		info, err := os.Stat(filepath.Join(dbInstance(t).BasePath, "tables", "items.tbl"))
+		if err != nil {
+			t.Fatalf("Failed to stat table file: %v", err)
+		}
+		return info.Size()
+	}
+
+	t.Run("DeadTuples", func(t *testing.T) {
+		runQuery(t, exec, "DELETE FROM items WHERE id < 200")
+		runQuery(t, exec, "UPDATE items SET body = 'short' WHERE id = 201")
+		row := stats(t)
+		if fmt.Sprint(row["n_tup_ins"]) != "400" || fmt.Sprint(row["n_tup_del"]) != "200" || fmt.Sprint(row["n_tup_upd"]) != "1" {
+			t.Errorf("Unexpected counters: %v", row)
+		}
+		if fmt.Sprint(row["n_live_tup"]) != "200" || fmt.Sprint(row["n_dead_tup"]) != "200" {
+			t.Errorf("Expected 200 live and 200 dead tuples, got %v", row)
+		}
+		if row["last_vacuum"] != nil || fmt.Sprint(row["vacuum_count"]) != "0" {
+			t.Errorf("Expected a table never vacuumed, got %v", row)
+		}
+	})
+
+	t.Run("Vacuum", func(t *testing.T) {
+		before := table(t)
+		tids := map[int]storage.TID{}
+		tuples, err := before.Tuples()
+		if err != nil {
+			t.Fatalf("Tuples failed: %v", err)
+		}
+		for _, tuple := range tuples {
+			tids[tuple.Row["id"].(int)] = tuple.TID
+		}
+		numPages := before.NumPages()
+
+		runQuery(t, exec, "VACUUM items")
+		row := stats(t)
+		if fmt.Sprint(row["n_dead_tup"]) != "0" || fmt.Sprint(row["n_live_tup"]) != "200" {
+			t.Errorf("Expected no dead tuples after VACUUM, got %v", row)
+		}
+		if row["last_vacuum"] == nil || fmt.Sprint(row["vacuum_count"]) != "1" {
+			t.Errorf("Expected the vacuum to be recorded, got %v", row)
+		}
+
+		tuples, err = table(t).Tuples()
+		if err != nil {
+			t.Fatalf("Tuples failed: %v", err)
+		}
+		for _, tuple := range tuples {
+			if tids[tuple.Row["id"].(int)] != tuple.TID {
+				t.Errorf("Expected row %v to keep TID %v, got %v", tuple.Row["id"], tids[tuple.Row["id"].(int)], tuple.TID)
+			}
+		}
+
+		// The freed space is found through the free space map
+		insert(t, numRows, numRows+150)
+		if n := table(t).NumPages(); n > numPages {
+			t.Errorf("Expected inserts to reuse freed space in %d pages, got %d", numPages, n)
+		}
+		if ids := selectIDs(exec, "items"); len(ids) != 350 {
+			t.Errorf("Expected 350 rows, got %d", len(ids))
+		}
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		runQuery(t, exec, "DELETE FROM items WHERE id >= 210")
+		runQuery(t, exec, "CHECKPOINT")
+		numPages, size := table(t).NumPages(), tableFileSize(t)
+
+		runQuery(t, exec, "VACUUM FULL items")
+		if n := table(t).NumPages(); n != 1 {
+			t.Errorf("Expected VACUUM FULL to shrink %d pages to 1, got %d", numPages, n)
+		}
+		if after := tableFileSize(t); after >= size {
+			t.Errorf("Expected the table file to shrink from %d bytes, got %d", size, after)
+		}
+		row := stats(t)
+		if fmt.Sprint(row["n_live_tup"]) != "10" || fmt.Sprint(row["n_dead_tup"]) != "0" || fmt.Sprint(row["vacuum_count"]) != "2" {
+			t.Errorf("Unexpected statistics after VACUUM FULL: %v", row)
+		}
+		runQuery(t, exec, "VACUUM")
+	})
+
+	t.Run("TransactionBlock", func(t *testing.T) {
+		runQuery(t, exec, "BEGIN")
+		if _, err := exec.Execute(parseQuery("VACUUM items")); err == nil || !strings.Contains(err.Error(), "transaction block") {
+			t.Errorf("Expected VACUUM to fail in a transaction block, got %v", err)
+		}
+		runQuery(t, exec, "ROLLBACK")
+	})
+
+	t.Run("Permission", func(t *testing.T) {
+		runQuery(t, exec, "CREATE ROLE vacuum_user")
+		session := db.SessionMgr.CreateSession("vacuum_user_session")
+		session.SetUser("vacuum_user")
+		session.SetDatabase("ghostsql")
+		userExec := executor.NewExecutor(db, session)
+
+		res, err := userExec.Execute(parseQuery("VACUUM items"))
+		if err != nil {
+			t.Fatalf("VACUUM failed: %v", err)
+		}
+		if len(res.Notices) != 1 || !strings.Contains(res.Notices[0].Message, "permission denied") {
+			t.Errorf("Expected a permission warning, got %v", res.Notices)
+		}
+		res, err = userExec.Execute(parseQuery("VACUUM"))
+		if err != nil || len(res.Notices) != 0 {
+			t.Errorf("Expected a database-wide VACUUM to skip other tables silently, got %v, %v", res, err)
+		}
+		if _, err := exec.Execute(parseQuery("VACUUM missing")); err == nil {
+			t.Error("Expected VACUUM of a missing table to fail")
+		}
+	})
+
+	t.Run("OpenTransaction", func(t *testing.T) {
+		session := db.SessionMgr.CreateSession("vacuum_tx_session")
+		session.SetUser("ghost")
+		session.SetDatabase("ghostsql")
+		txExec := executor.NewExecutor(db, session)
+		runQuery(t, txExec, "BEGIN")
+		runQuery(t, txExec, "UPDATE items SET body = 'changed' WHERE id = 200")
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := exec.Execute(parseQuery("VACUUM FULL items"))
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			t.Fatalf("Expected VACUUM FULL to wait for the open transaction, it returned %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+		runQuery(t, txExec, "COMMIT")
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("VACUUM FULL failed after COMMIT: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("VACUUM FULL still waiting after COMMIT")
+		}
+
+		res, err := exec.Execute(parseQuery("SELECT body FROM items WHERE id = 200"))
+		if err != nil || len(res.Rows) != 1 || res.Rows[0]["body"] != "changed" {
+			t.Errorf("Expected the committed update to survive VACUUM FULL, got %v, %v", res, err)
+		}
+		if row := stats(t); fmt.Sprint(row["n_live_tup"]) != "10" || fmt.Sprint(row["n_dead_tup"]) != "0" {
+			t.Errorf("Unexpected statistics after VACUUM FULL: %v", row)
+		}
+	})
+
+	t.Run("MovedTuple", func(t *testing.T) {
+		runQuery(t, exec, "CREATE TABLE moves (id INT, body TEXT)")
+		// Fill the first page, so that a row growing in it has to move
+		numRows := 0
+		for numPages := 0; numPages < 2; numRows++ {
+			runQuery(t, exec, fmt.Sprintf("INSERT INTO moves (id, body) VALUES (%d, '%s')", numRows, filler))
+			moves, _ := dbInstance(t).GetTable("moves")
+			numPages = moves.NumPages()
+		}
+		runQuery(t, exec, fmt.Sprintf("UPDATE moves SET body = '%s' WHERE id = 0", strings.Repeat("y", 2000)))
+		runQuery(t, exec, "DELETE FROM moves WHERE id = 0")
+
+		res, err := exec.Execute(parseQuery("SELECT n_live_tup, n_dead_tup FROM pg_stat_user_tables WHERE relname = 'moves'"))
+		if err != nil || len(res.Rows) != 1 {
+			t.Fatalf("Expected one row in pg_stat_user_tables, got %v, %v", res, err)
+		}
+		if row := res.Rows[0]; fmt.Sprint(row["n_live_tup"]) != fmt.Sprint(numRows-1) || fmt.Sprint(row["n_dead_tup"]) != "1" {
+			t.Errorf("Expected the moved row to count as one dead tuple, got %v", row)
+		}
+		runQuery(t, exec, "DROP TABLE moves")
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		insert(t, 1000, 1005)
+		runQuery(t, exec, "DELETE FROM items WHERE id = 201")
+		runQuery(t, exec, "VACUUM items")
+		db = crash(t, db, tmpDir)
+		exec = newWALTestExecutor(db)
+		ids := selectIDs(exec, "items")
+		if len(ids) != 14 || ids[0] != "200" || ids[len(ids)-1] != "1004" {
+			t.Errorf("Expected 14 rows after recovery, got %v", ids)
+		}
+		insert(t, 2000, 2010)
+		if ids := selectIDs(exec, "items"); len(ids) != 24 {
+			t.Errorf("Expected 24 rows after inserting into a recovered table, got %d", len(ids))
+		}
+	})
+
+	if err := db.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
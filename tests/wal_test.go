@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghosecorp/ghostsql/internal/executor"
+	"github.com/ghosecorp/ghostsql/internal/storage"
+)
+
+// crash abandons db without shutting it down, leaving the table files and
+// the WAL as they were, and starts the database again
+func crash(t *testing.T, db *storage.Database, dir string) *storage.Database {
+	t.Helper()
+	os.Remove(db.LockFile)
+	restarted, err := storage.Initialize(dir)
+	if err != nil {
+		t.Fatalf("Failed to restart database: %v", err)
+	}
+	return restarted
+}
+
+func newWALTestExecutor(db *storage.Database) *executor.Executor {
+	session := db.SessionMgr.CreateSession("wal_session")
+	session.SetUser("ghost")
+	session.SetDatabase("ghostsql")
+	return executor.NewExecutor(db, session)
+}
+
+// selectIDs returns the ids of a table in order, or nil if the query fails
+func selectIDs(exec *executor.Executor, table string) []string {
+	res, err := exec.Execute(parseQuery("SELECT id FROM " + table + " ORDER BY id"))
+	if err != nil {
+		return nil
+	}
+	ids := []string{}
+	for _, row := range res.Rows {
+		ids = append(ids, fmt.Sprint(row["id"]))
+	}
+	return ids
+}
+
+func walSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, "wal", storage.WALFileName))
+	if err != nil {
+		t.Fatalf("Failed to stat WAL: %v", err)
+	}
+	return info.Size()
+}
+
+func TestWALRecovery(t *testing.T) {
+	executor.ResetRegistries()
+	tmpDir := "./test_wal_dir"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	db, err := storage.Initialize(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	exec := newWALTestExecutor(db)
+	runQuery(t, exec, "CREATE TABLE items (id INT, name TEXT)")
+	runQuery(t, exec, "INSERT INTO items (id, name) VALUES (1, 'a'), (2, 'b')")
+	runQuery(t, exec, "BEGIN")
+	runQuery(t, exec, "INSERT INTO items (id, name) VALUES (3, 'c')")
+	runQuery(t, exec, "COMMIT")
+	runQuery(t, exec, "CREATE TABLE gone (id INT)")
+	runQuery(t, exec, "DROP TABLE gone")
+	runQuery(t, exec, "CREATE TABLE old_name (id INT)")
+	runQuery(t, exec, "INSERT INTO old_name (id) VALUES (7)")
+	runQuery(t, exec, "ALTER TABLE old_name RENAME TO new_name")
+	runQuery(t, exec, "BEGIN")
+	runQuery(t, exec, "INSERT INTO items (id, name) VALUES (99, 'uncommitted')")
+
+	// Committed changes are only in the WAL until a checkpoint
+	itemsPath := filepath.Join(tmpDir, "databases", "ghostsql", "tables", "items.tbl")
+	if _, err := os.Stat(itemsPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected no table file before a checkpoint, got %v", err)
+	}
+
+	db = crash(t, db, tmpDir)
+	exec = newWALTestExecutor(db)
+
+	t.Run("Replay", func(t *testing.T) {
+		if ids := selectIDs(exec, "items"); !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+			t.Errorf("Expected committed rows 1, 2, 3, got %v", ids)
+		}
+		if ids := selectIDs(exec, "new_name"); !reflect.DeepEqual(ids, []string{"7"}) {
+			t.Errorf("Expected renamed table, got %v", ids)
+		}
+		for _, table := range []string{"old_name", "gone"} {
+			if ids := selectIDs(exec, table); ids != nil {
+				t.Errorf("Expected %s not to exist, got %v", table, ids)
+			}
+		}
+		if _, err := os.Stat(itemsPath); err != nil {
+			t.Errorf("Expected recovery to write the table file: %v", err)
+		}
+	})
+
+	t.Run("Torn Transaction", func(t *testing.T) {
+		runQuery(t, exec, "INSERT INTO items (id, name) VALUES (4, 'd')")
+		runQuery(t, exec, "INSERT INTO items (id, name) VALUES (5, 'e')")
+
+		// Lose the end of the last transaction's commit record
+		walPath := filepath.Join(tmpDir, "wal", storage.WALFileName)
+		if err := os.Truncate(walPath, walSize(t, tmpDir)-1); err != nil {
+			t.Fatalf("Failed to truncate WAL: %v", err)
+		}
+		db = crash(t, db, tmpDir)
+		exec = newWALTestExecutor(db)
+		if ids := selectIDs(exec, "items"); !reflect.DeepEqual(ids, []string{"1", "2", "3", "4"}) {
+			t.Errorf("Expected rows up to the torn transaction, got %v", ids)
+		}
+
+		// Garbage after the last record is ignored as well
+		runQuery(t, exec, "INSERT INTO items (id, name) VALUES (5, 'e')")
+		f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatalf("Failed to open WAL: %v", err)
+		}
+		f.Write([]byte(strings.Repeat("\xff", 100)))
+		f.Close()
+		db = crash(t, db, tmpDir)
+		exec = newWALTestExecutor(db)
+		if ids := selectIDs(exec, "items"); !reflect.DeepEqual(ids, []string{"1", "2", "3", "4", "5"}) {
+			t.Errorf("Expected rows 1 to 5, got %v", ids)
+		}
+	})
+
+	t.Run("Checkpoint", func(t *testing.T) {
+		empty := walSize(t, tmpDir)
+		lsn := func() string {
+			res, err := exec.Execute(parseQuery("SELECT pg_current_wal_lsn()"))
+			if err != nil || len(res.Rows) != 1 {
+				t.Fatalf("pg_current_wal_lsn failed: %v", err)
+			}
+			for _, v := range res.Rows[0] {
+				return fmt.Sprint(v)
+			}
+			return ""
+		}
+		before := lsn()
+
+		runQuery(t, exec, "INSERT INTO items (id, name) VALUES (6, 'f')")
+		if size := walSize(t, tmpDir); size <= empty {
+			t.Errorf("Expected the WAL to grow, got %d bytes", size)
+		}
+		after := lsn()
+		if after == before {
+			t.Errorf("Expected the LSN to advance from %s", before)
+		}
+
+		runQuery(t, exec, "CHECKPOINT")
+		if size := walSize(t, tmpDir); size != empty {
+			t.Errorf("Expected CHECKPOINT to truncate the WAL to %d bytes, got %d", empty, size)
+		}
+		if got := lsn(); got != after {
+			t.Errorf("Expected the LSN to stay at %s after a checkpoint, got %s", after, got)
+		}
+
+		// max_wal_size triggers checkpoints
+		if err := db.Config.Set("max_wal_size", "1MB"); err != nil {
+			t.Fatalf("Failed to set max_wal_size: %v", err)
+		}
+		runQuery(t, exec, "CREATE TABLE filler (id INT)")
+		for i := 0; i < 100; i++ {
+			runQuery(t, exec, fmt.Sprintf("INSERT INTO filler (id) VALUES (%d)", i))
+		}
+		if size := walSize(t, tmpDir); size >= 1<<20 {
+			t.Errorf("Expected a checkpoint once the WAL reached max_wal_size, got %d bytes", size)
+		}
+		db = crash(t, db, tmpDir)
+		exec = newWALTestExecutor(db)
+		if ids := selectIDs(exec, "filler"); len(ids) != 100 {
+			t.Errorf("Expected 100 rows after recovery, got %d", len(ids))
+		}
+	})
+
+	t.Run("Requires Superuser", func(t *testing.T) {
+		runQuery(t, exec, "CREATE ROLE plain WITH LOGIN")
+		session := db.SessionMgr.CreateSession("plain_session")
+		session.SetUser("plain")
+		session.SetDatabase("ghostsql")
+		_, err := executor.NewExecutor(db, session).Execute(parseQuery("CHECKPOINT"))
+		if err == nil || !strings.Contains(err.Error(), "must be superuser") {
+			t.Errorf("Expected permission error, got %v", err)
+		}
+	})
+
+	if err := db.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if size := walSize(t, tmpDir); size != 16 {
+		t.Errorf("Expected an empty WAL after shutdown, got %d bytes", size)
+	}
+}